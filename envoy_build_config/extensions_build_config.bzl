@@ -12,13 +12,16 @@ EXTENSIONS = {
     # All extensions explicitly referenced by config generator and our tests.
     "envoy.access_loggers.file": "//source/extensions/access_loggers/file:config",
     "envoy.filters.http.cors": "//source/extensions/filters/http/cors:config",
+    "envoy.filters.http.ext_authz": "//source/extensions/filters/http/ext_authz:config",
     "envoy.filters.http.grpc_json_transcoder": "//source/extensions/filters/http/grpc_json_transcoder:config",
     "envoy.filters.http.grpc_web": "//source/extensions/filters/http/grpc_web:config",
     "envoy.filters.http.health_check": "//source/extensions/filters/http/health_check:config",
     "envoy.filters.http.jwt_authn": "//source/extensions/filters/http/jwt_authn:config",
+    "envoy.filters.http.rbac": "//source/extensions/filters/http/rbac:config",
     "envoy.filters.http.router": "//source/extensions/filters/http/router:config",
     "envoy.filters.network.http_connection_manager": "//source/extensions/filters/network/http_connection_manager:config",
     "envoy.tracers.opencensus": "//source/extensions/tracers/opencensus:config",
+    "envoy.tracers.zipkin": "//source/extensions/tracers/zipkin:config",
 
     # Implicitly needed for TLS config.
     "envoy.transport_sockets.raw_buffer": "//source/extensions/transport_sockets/raw_buffer:config",
@@ -26,6 +29,7 @@ EXTENSIONS = {
     # Remaining items are for API Gateway and not covered by our tests. Do not remove.
     "envoy.access_loggers.http_grpc": "//source/extensions/access_loggers/grpc:http_config",
     "envoy.filters.http.header_to_metadata": "//source/extensions/filters/http/header_to_metadata:config",
+    "envoy.stat_sinks.dog_statsd": "//source/extensions/stat_sinks/dog_statsd:config",
     "envoy.stat_sinks.metrics_service": "//source/extensions/stat_sinks/metrics_service:config",
     "envoy.stat_sinks.statsd": "//source/extensions/stat_sinks/statsd:config",
 }
@@ -0,0 +1,244 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package apikeyserver checks API keys against a local file for the ext_authz
+// filter, replacing the API key check of Service Control on non-GCP deployments.
+package apikeyserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/glog"
+	"google.golang.org/grpc/codes"
+
+	corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	authpb "github.com/envoyproxy/go-control-plane/envoy/service/auth/v2"
+	typepb "github.com/envoyproxy/go-control-plane/envoy/type"
+	wrapperspb "github.com/golang/protobuf/ptypes/wrappers"
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
+)
+
+// ApiKeyServer implements the ext_authz gRPC service, the routes of the
+// operations requiring an API key send the operation and the API key locations
+// as context extensions.
+type ApiKeyServer struct {
+	path              string
+	consumerHeader    string
+	xffNumTrustedHops int
+
+	mu      sync.RWMutex
+	store   apiKeyStore
+	modTime time.Time
+}
+
+// NewApiKeyServer loads the API keys file and checks it for changes at the
+// interval. The consumer of the API key is forwarded to the backend in the
+// consumer header. The IP restrictions apply to the client address found with
+// the xff_num_trusted_hops of Envoy.
+func NewApiKeyServer(path, consumerHeader string, xffNumTrustedHops int, checkInterval time.Duration) (*ApiKeyServer, error) {
+	s := &ApiKeyServer{
+		path:              path,
+		consumerHeader:    consumerHeader,
+		xffNumTrustedHops: xffNumTrustedHops,
+	}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	s.startApiKeysCheck(checkInterval)
+	return s, nil
+}
+
+func (s *ApiKeyServer) startApiKeysCheck(interval time.Duration) {
+	go func() {
+		glog.Infof("start checking API keys file every %v", interval)
+		ticker := time.NewTicker(interval)
+		for range ticker.C {
+			if err := s.reload(); err != nil {
+				glog.Warningf("keeping the current API keys: %v", err)
+			}
+		}
+	}()
+}
+
+// reload reads the API keys file if it changed since it was last read.
+func (s *ApiKeyServer) reload() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return fmt.Errorf("fail to read API keys: %v", err)
+	}
+
+	s.mu.RLock()
+	changed := s.store == nil || !info.ModTime().Equal(s.modTime)
+	s.mu.RUnlock()
+	if !changed {
+		return nil
+	}
+
+	store, err := loadApiKeyStore(s.path)
+	if err != nil {
+		return err
+	}
+	glog.Infof("loaded %d API keys from %s", len(store), s.path)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store = store
+	s.modTime = info.ModTime()
+	return nil
+}
+
+// Check allows the requests with a valid API key, in the same way as the
+// Service Control filter with the check response of Service Control.
+func (s *ApiKeyServer) Check(ctx context.Context, req *authpb.CheckRequest) (*authpb.CheckResponse, error) {
+	attributes := req.GetAttributes()
+	operation, ok := attributes.GetContextExtensions()[util.ApiKeyOperationContextKey]
+	if !ok {
+		// Routes without the API key check of an operation, e.g. unknown paths.
+		return okResponse(nil), nil
+	}
+
+	httpReq := attributes.GetRequest().GetHttp()
+	apiKeyStr := extractApiKey(httpReq, attributes.GetContextExtensions()[util.ApiKeyLocationsContextKey])
+	if apiKeyStr == "" {
+		return deniedResponse(codes.Unauthenticated, "UNAUTHENTICATED:Method doesn't allow unregistered callers (callers without established identity). Please use API Key or other form of API consumer identity to call this API."), nil
+	}
+
+	s.mu.RLock()
+	key, ok := s.store[apiKeyStr]
+	s.mu.RUnlock()
+	if !ok {
+		return deniedResponse(codes.InvalidArgument, "INVALID_ARGUMENT:API key not valid. Please pass a valid API key."), nil
+	}
+	if !key.allowOperation(operation) {
+		return deniedResponse(codes.PermissionDenied, "PERMISSION_DENIED:The API targeted by this request is invalid for the given API key."), nil
+	}
+	if !key.allowReferer(httpReq.GetHeaders()["referer"]) {
+		return deniedResponse(codes.PermissionDenied, "PERMISSION_DENIED:Referer blocked."), nil
+	}
+	if !key.allowIp(s.clientIp(attributes)) {
+		return deniedResponse(codes.PermissionDenied, "PERMISSION_DENIED:IP address blocked."), nil
+	}
+
+	return okResponse([]*corepb.HeaderValueOption{
+		{
+			Header: &corepb.HeaderValue{
+				Key:   s.consumerHeader,
+				Value: key.consumer,
+			},
+			Append: &wrapperspb.BoolValue{Value: false},
+		},
+	}), nil
+}
+
+// clientIp returns the client address as Envoy finds it with
+// xff_num_trusted_hops: the address that many hops before the last one of the
+// x-forwarded-for header, which Envoy ends with the downstream address when it
+// uses the remote address. The downstream address is used if the header does
+// not have enough addresses.
+func (s *ApiKeyServer) clientIp(attributes *authpb.AttributeContext) net.IP {
+	var xff []string
+	if header := attributes.GetRequest().GetHttp().GetHeaders()["x-forwarded-for"]; header != "" {
+		xff = strings.Split(header, ",")
+	}
+	if s.xffNumTrustedHops < len(xff) {
+		return net.ParseIP(strings.TrimSpace(xff[len(xff)-1-s.xffNumTrustedHops]))
+	}
+	return net.ParseIP(attributes.GetSource().GetAddress().GetSocketAddress().GetAddress())
+}
+
+// extractApiKey returns the API key in the first of the locations that has
+// one. The locations are in format of "query:key,header:x-api-key,cookie:key".
+func extractApiKey(httpReq *authpb.AttributeContext_HttpRequest, locations string) string {
+	var query url.Values
+	if i := strings.Index(httpReq.GetPath(), "?"); i >= 0 {
+		query, _ = url.ParseQuery(httpReq.GetPath()[i+1:])
+	}
+	cookieReq := &http.Request{
+		Header: http.Header{
+			"Cookie": {httpReq.GetHeaders()["cookie"]},
+		},
+	}
+
+	for _, location := range strings.Split(locations, ",") {
+		parts := strings.SplitN(location, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		var apiKey string
+		switch parts[0] {
+		case "query":
+			apiKey = query.Get(parts[1])
+		case "header":
+			// Envoy sends the headers in lower case.
+			apiKey = httpReq.GetHeaders()[strings.ToLower(parts[1])]
+		case "cookie":
+			if cookie, err := cookieReq.Cookie(parts[1]); err == nil {
+				apiKey = cookie.Value
+			}
+		}
+		if apiKey != "" {
+			return apiKey
+		}
+	}
+	return ""
+}
+
+func okResponse(headers []*corepb.HeaderValueOption) *authpb.CheckResponse {
+	return &authpb.CheckResponse{
+		Status: &statuspb.Status{
+			Code: int32(codes.OK),
+		},
+		HttpResponse: &authpb.CheckResponse_OkResponse{
+			OkResponse: &authpb.OkHttpResponse{
+				Headers: headers,
+			},
+		},
+	}
+}
+
+// deniedResponse is sent to the client as a local reply, converted to the
+// same JSON error as the other requests rejected by Envoy.
+func deniedResponse(code codes.Code, message string) *authpb.CheckResponse {
+	httpCode := typepb.StatusCode_Forbidden
+	switch code {
+	case codes.Unauthenticated:
+		httpCode = typepb.StatusCode_Unauthorized
+	case codes.InvalidArgument:
+		httpCode = typepb.StatusCode_BadRequest
+	}
+
+	return &authpb.CheckResponse{
+		Status: &statuspb.Status{
+			Code:    int32(code),
+			Message: message,
+		},
+		HttpResponse: &authpb.CheckResponse_DeniedResponse{
+			DeniedResponse: &authpb.DeniedHttpResponse{
+				Status: &typepb.HttpStatus{
+					Code: httpCode,
+				},
+				Body: message,
+			},
+		},
+	}
+}
@@ -0,0 +1,315 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apikeyserver
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/testutil"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/codes"
+
+	corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	authpb "github.com/envoyproxy/go-control-plane/envoy/service/auth/v2"
+	typepb "github.com/envoyproxy/go-control-plane/envoy/type"
+	wrapperspb "github.com/golang/protobuf/ptypes/wrappers"
+)
+
+const (
+	testOperation      = "endpoints.examples.bookstore.Bookstore.GetBook"
+	testLocations      = "query:key,header:x-api-key,cookie:api-key"
+	testConsumerHeader = "X-Endpoint-API-Consumer"
+)
+
+func makeCheckRequest(path string, headers map[string]string, sourceIp string, contextExtensions map[string]string) *authpb.CheckRequest {
+	return &authpb.CheckRequest{
+		Attributes: &authpb.AttributeContext{
+			Source: &authpb.AttributeContext_Peer{
+				Address: &corepb.Address{
+					Address: &corepb.Address_SocketAddress{
+						SocketAddress: &corepb.SocketAddress{
+							Address: sourceIp,
+						},
+					},
+				},
+			},
+			Request: &authpb.AttributeContext_Request{
+				Http: &authpb.AttributeContext_HttpRequest{
+					Path:    path,
+					Headers: headers,
+				},
+			},
+			ContextExtensions: contextExtensions,
+		},
+	}
+}
+
+func TestCheck(t *testing.T) {
+	path, removeFile := testutil.WriteTempFile(t, "api_keys", `{"keys": [
+  {"key": "key-0", "consumer": "consumer-0"},
+  {"key": "key-1", "consumer": "consumer-1", "operations": ["endpoints.examples.bookstore.Bookstore.ListBooks"]},
+  {"key": "key-2", "consumer": "consumer-2", "allowedReferers": ["*.example.com/*"], "allowedIps": ["10.0.0.0/8", "192.168.0.1"]}
+]}`)
+	defer removeFile()
+
+	s, err := NewApiKeyServer(path, testConsumerHeader, 2, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	operationContext := map[string]string{
+		util.ApiKeyOperationContextKey: testOperation,
+		util.ApiKeyLocationsContextKey: testLocations,
+	}
+
+	testData := []struct {
+		desc         string
+		req          *authpb.CheckRequest
+		wantConsumer string
+		wantCode     codes.Code
+		wantHttpCode typepb.StatusCode
+		wantMessage  string
+	}{
+		{
+			desc:         "API key in query",
+			req:          makeCheckRequest("/v1/books/1?key=key-0", nil, "127.0.0.1", operationContext),
+			wantConsumer: "consumer-0",
+		},
+		{
+			desc:         "API key in header",
+			req:          makeCheckRequest("/v1/books/1", map[string]string{"x-api-key": "key-0"}, "127.0.0.1", operationContext),
+			wantConsumer: "consumer-0",
+		},
+		{
+			desc:         "API key in cookie",
+			req:          makeCheckRequest("/v1/books/1", map[string]string{"cookie": "session=abc; api-key=key-0"}, "127.0.0.1", operationContext),
+			wantConsumer: "consumer-0",
+		},
+		{
+			desc: "Route without the API key check",
+			req:  makeCheckRequest("/unknown", nil, "127.0.0.1", nil),
+		},
+		{
+			desc:         "Missing API key",
+			req:          makeCheckRequest("/v1/books/1?api_key=key-0", nil, "127.0.0.1", operationContext),
+			wantCode:     codes.Unauthenticated,
+			wantHttpCode: typepb.StatusCode_Unauthorized,
+			wantMessage:  "UNAUTHENTICATED:Method doesn't allow unregistered callers",
+		},
+		{
+			desc:         "Invalid API key",
+			req:          makeCheckRequest("/v1/books/1?key=key-9", nil, "127.0.0.1", operationContext),
+			wantCode:     codes.InvalidArgument,
+			wantHttpCode: typepb.StatusCode_BadRequest,
+			wantMessage:  "INVALID_ARGUMENT:API key not valid. Please pass a valid API key.",
+		},
+		{
+			desc:         "API key not allowed for the operation",
+			req:          makeCheckRequest("/v1/books/1?key=key-1", nil, "127.0.0.1", operationContext),
+			wantCode:     codes.PermissionDenied,
+			wantHttpCode: typepb.StatusCode_Forbidden,
+			wantMessage:  "PERMISSION_DENIED:The API targeted by this request is invalid for the given API key.",
+		},
+		{
+			desc:         "API key with allowed referer and IP",
+			req:          makeCheckRequest("/v1/books/1?key=key-2", map[string]string{"referer": "https://www.example.com/books"}, "10.1.2.3", operationContext),
+			wantConsumer: "consumer-2",
+		},
+		{
+			desc:         "API key with allowed single IP",
+			req:          makeCheckRequest("/v1/books/1?key=key-2", map[string]string{"referer": "http://books.example.com/"}, "192.168.0.1", operationContext),
+			wantConsumer: "consumer-2",
+		},
+		{
+			desc:         "API key with blocked referer",
+			req:          makeCheckRequest("/v1/books/1?key=key-2", map[string]string{"referer": "https://www.example.org/books"}, "10.1.2.3", operationContext),
+			wantCode:     codes.PermissionDenied,
+			wantHttpCode: typepb.StatusCode_Forbidden,
+			wantMessage:  "PERMISSION_DENIED:Referer blocked.",
+		},
+		{
+			desc:         "API key with blocked IP",
+			req:          makeCheckRequest("/v1/books/1?key=key-2", map[string]string{"referer": "https://www.example.com/books"}, "192.168.0.2", operationContext),
+			wantCode:     codes.PermissionDenied,
+			wantHttpCode: typepb.StatusCode_Forbidden,
+			wantMessage:  "PERMISSION_DENIED:IP address blocked.",
+		},
+		{
+			desc: "API key with allowed IP behind trusted hops",
+			req: makeCheckRequest("/v1/books/1?key=key-2", map[string]string{
+				"referer":         "https://www.example.com/books",
+				"x-forwarded-for": "10.1.2.3, 130.211.0.1, 169.254.1.1",
+			}, "169.254.1.1", operationContext),
+			wantConsumer: "consumer-2",
+		},
+		{
+			desc: "API key with blocked IP behind trusted hops",
+			req: makeCheckRequest("/v1/books/1?key=key-2", map[string]string{
+				"referer":         "https://www.example.com/books",
+				"x-forwarded-for": "10.1.2.3,192.168.0.2,130.211.0.1,169.254.1.1",
+			}, "169.254.1.1", operationContext),
+			wantCode:     codes.PermissionDenied,
+			wantHttpCode: typepb.StatusCode_Forbidden,
+			wantMessage:  "PERMISSION_DENIED:IP address blocked.",
+		},
+		{
+			desc: "API key with fewer x-forwarded-for addresses than trusted hops",
+			req: makeCheckRequest("/v1/books/1?key=key-2", map[string]string{
+				"referer":         "https://www.example.com/books",
+				"x-forwarded-for": "10.1.2.3, 169.254.1.1",
+			}, "192.168.0.1", operationContext),
+			wantConsumer: "consumer-2",
+		},
+	}
+
+	for _, tc := range testData {
+		resp, err := s.Check(context.Background(), tc.req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if codes.Code(resp.GetStatus().GetCode()) != tc.wantCode {
+			t.Errorf("Test Desc(%s): got code %v, want %v", tc.desc, codes.Code(resp.GetStatus().GetCode()), tc.wantCode)
+			continue
+		}
+		if tc.wantCode != codes.OK {
+			denied := resp.GetDeniedResponse()
+			if denied.GetStatus().GetCode() != tc.wantHttpCode {
+				t.Errorf("Test Desc(%s): got HTTP code %v, want %v", tc.desc, denied.GetStatus().GetCode(), tc.wantHttpCode)
+			}
+			if !strings.HasPrefix(denied.GetBody(), tc.wantMessage) {
+				t.Errorf("Test Desc(%s): got message %q, want %q", tc.desc, denied.GetBody(), tc.wantMessage)
+			}
+			continue
+		}
+
+		var wantHeaders []*corepb.HeaderValueOption
+		if tc.wantConsumer != "" {
+			wantHeaders = []*corepb.HeaderValueOption{
+				{
+					Header: &corepb.HeaderValue{
+						Key:   testConsumerHeader,
+						Value: tc.wantConsumer,
+					},
+					Append: &wrapperspb.BoolValue{Value: false},
+				},
+			}
+		}
+		if !proto.Equal(resp.GetOkResponse(), &authpb.OkHttpResponse{Headers: wantHeaders}) {
+			t.Errorf("Test Desc(%s): got OK response %v, want headers %v", tc.desc, resp.GetOkResponse(), wantHeaders)
+		}
+	}
+}
+
+func TestLoadApiKeyStore(t *testing.T) {
+	testData := []struct {
+		desc      string
+		keysFile  string
+		wantKeys  int
+		wantError string
+	}{
+		{
+			desc:     "Valid keys",
+			keysFile: `{"keys": [{"key": "key-0", "consumer": "consumer-0"}, {"key": "key-1", "consumer": "consumer-0", "allowedIps": ["::1"]}]}`,
+			wantKeys: 2,
+		},
+		{
+			desc:      "Key without consumer",
+			keysFile:  `{"keys": [{"key": "key-0"}]}`,
+			wantError: "API key 0 has no consumer",
+		},
+		{
+			desc:      "Duplicate keys",
+			keysFile:  `{"keys": [{"key": "key-0", "consumer": "consumer-0"}, {"key": "key-0", "consumer": "consumer-1"}]}`,
+			wantError: `API key 1 of consumer "consumer-1" is a duplicate`,
+		},
+		{
+			desc:      "Invalid IP",
+			keysFile:  `{"keys": [{"key": "key-0", "consumer": "consumer-0", "allowedIps": ["10.0.0.0/33"]}]}`,
+			wantError: `API key 0 of consumer "consumer-0" has invalid IP "10.0.0.0/33"`,
+		},
+		{
+			desc:      "Unknown field",
+			keysFile:  `{"keys": [{"key": "key-0", "consumer": "consumer-0", "referers": ["*"]}]}`,
+			wantError: "fail to read API keys",
+		},
+	}
+
+	for _, tc := range testData {
+		path, removeFile := testutil.WriteTempFile(t, "api_keys", tc.keysFile)
+		defer removeFile()
+
+		store, err := loadApiKeyStore(path)
+		if err != nil {
+			if tc.wantError == "" || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test Desc(%s): want error: %s, get error: %v", tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if tc.wantError != "" {
+			t.Errorf("Test Desc(%s): want error: %s, get no error", tc.desc, tc.wantError)
+			continue
+		}
+		if len(store) != tc.wantKeys {
+			t.Errorf("Test Desc(%s): got %d keys, want %d", tc.desc, len(store), tc.wantKeys)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	path, removeFile := testutil.WriteTempFile(t, "api_keys", `{"keys": [{"key": "key-0", "consumer": "consumer-0"}]}`)
+	defer removeFile()
+
+	s, err := NewApiKeyServer(path, testConsumerHeader, 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Invalid files are ignored.
+	if err := ioutil.WriteFile(path, []byte(`{"keys": [{"key": "key-1"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.reload(); err == nil {
+		t.Errorf("reload invalid API keys got no error")
+	}
+	if _, ok := s.store["key-0"]; !ok {
+		t.Errorf("API keys are not kept after reloading an invalid file")
+	}
+
+	if err := ioutil.WriteFile(path, []byte(`{"keys": [{"key": "key-1", "consumer": "consumer-1"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, time.Now(), time.Now().Add(2*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.store["key-1"]; !ok {
+		t.Errorf("API keys are not reloaded after the file changed")
+	}
+	if _, ok := s.store["key-0"]; ok {
+		t.Errorf("removed API key is kept after the file changed")
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apikeyserver
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+)
+
+// apiKeysFile is the format of the file at --api_keys_path.
+type apiKeysFile struct {
+	Keys []*apiKeyEntry `json:"keys"`
+}
+
+type apiKeyEntry struct {
+	Key      string `json:"key"`
+	Consumer string `json:"consumer"`
+	// Operations the key can call, all of them if empty.
+	Operations []string `json:"operations,omitempty"`
+	// Referer patterns with "*" wildcards, the scheme is optional.
+	AllowedReferers []string `json:"allowedReferers,omitempty"`
+	// Client IP addresses or CIDR ranges.
+	AllowedIps []string `json:"allowedIps,omitempty"`
+}
+
+// apiKey is a validated API key with its restrictions.
+type apiKey struct {
+	consumer        string
+	operations      map[string]bool
+	allowedReferers []*regexp.Regexp
+	allowedIps      []*net.IPNet
+}
+
+// apiKeyStore is the API keys loaded from the file, by key.
+type apiKeyStore map[string]*apiKey
+
+// loadApiKeyStore reads and validates the API keys file at the path.
+func loadApiKeyStore(path string) (apiKeyStore, error) {
+	var keysFile apiKeysFile
+	if err := util.UnmarshalJsonFile(path, &keysFile); err != nil {
+		return nil, fmt.Errorf("fail to read API keys: %v", err)
+	}
+
+	store := make(apiKeyStore)
+	for i, entry := range keysFile.Keys {
+		if entry.Key == "" {
+			return nil, fmt.Errorf("API key %d has no key", i)
+		}
+		if entry.Consumer == "" {
+			return nil, fmt.Errorf("API key %d has no consumer", i)
+		}
+		if _, ok := store[entry.Key]; ok {
+			return nil, fmt.Errorf("API key %d of consumer %q is a duplicate", i, entry.Consumer)
+		}
+
+		key := &apiKey{
+			consumer: entry.Consumer,
+		}
+		if len(entry.Operations) > 0 {
+			key.operations = make(map[string]bool)
+			for _, operation := range entry.Operations {
+				key.operations[operation] = true
+			}
+		}
+		for _, referer := range entry.AllowedReferers {
+			re, err := makeRefererRegexp(referer)
+			if err != nil {
+				return nil, fmt.Errorf("API key %d of consumer %q has invalid referer %q: %v", i, entry.Consumer, referer, err)
+			}
+			key.allowedReferers = append(key.allowedReferers, re)
+		}
+		for _, ip := range entry.AllowedIps {
+			ipNet, err := parseIpNet(ip)
+			if err != nil {
+				return nil, fmt.Errorf("API key %d of consumer %q has invalid IP %q: %v", i, entry.Consumer, ip, err)
+			}
+			key.allowedIps = append(key.allowedIps, ipNet)
+		}
+		store[entry.Key] = key
+	}
+	return store, nil
+}
+
+// makeRefererRegexp matches the referers with "*" matching any characters.
+// Patterns without scheme match any scheme.
+func makeRefererRegexp(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("referer must not be empty")
+	}
+	var parts []string
+	for _, part := range strings.Split(pattern, "*") {
+		parts = append(parts, regexp.QuoteMeta(part))
+	}
+	expr := strings.Join(parts, ".*")
+	if !strings.Contains(pattern, "://") {
+		expr = `([a-z]+://)?` + expr
+	}
+	return regexp.Compile("^" + expr + "$")
+}
+
+func parseIpNet(ip string) (*net.IPNet, error) {
+	if strings.Contains(ip, "/") {
+		_, ipNet, err := net.ParseCIDR(ip)
+		return ipNet, err
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return nil, fmt.Errorf("not an IP address or CIDR range")
+	}
+	bits := 8 * net.IPv6len
+	if parsed.To4() != nil {
+		parsed = parsed.To4()
+		bits = 8 * net.IPv4len
+	}
+	return &net.IPNet{
+		IP:   parsed,
+		Mask: net.CIDRMask(bits, bits),
+	}, nil
+}
+
+func (k *apiKey) allowOperation(operation string) bool {
+	return k.operations == nil || k.operations[operation]
+}
+
+func (k *apiKey) allowReferer(referer string) bool {
+	if len(k.allowedReferers) == 0 {
+		return true
+	}
+	for _, re := range k.allowedReferers {
+		if re.MatchString(referer) {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *apiKey) allowIp(ip net.IP) bool {
+	if len(k.allowedIps) == 0 {
+		return true
+	}
+	for _, ipNet := range k.allowedIps {
+		if ip != nil && ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -40,6 +40,20 @@ func CreateBootstrapConfig(opts options.AdsBootstrapperOptions) (string, error)
 	// Parse ADS connect timeout
 	connectTimeoutProto := ptypes.DurationProto(opts.AdsConnectTimeout)
 
+	// Stats sinks and the metrics listener
+	statsConfig, err := bt.CreateStatsConfig(opts.CommonOptions)
+	if err != nil {
+		return "", err
+	}
+	statsSinks, err := bt.CreateStatsSinks(opts.CommonOptions)
+	if err != nil {
+		return "", err
+	}
+	metricsListener, adminCluster, err := bt.CreateMetricsListener(opts.CommonOptions)
+	if err != nil {
+		return "", err
+	}
+
 	bt := &bootstrappb.Bootstrap{
 		// Node info
 		Node: bt.CreateNode(opts.CommonOptions),
@@ -50,6 +64,10 @@ func CreateBootstrapConfig(opts options.AdsBootstrapperOptions) (string, error)
 		// layer runtime
 		LayeredRuntime: bt.CreateLayeredRuntime(),
 
+		// stats
+		StatsConfig: statsConfig,
+		StatsSinks:  statsSinks,
+
 		// Dynamic resource
 		DynamicResources: &bootstrappb.Bootstrap_DynamicResources{
 			LdsConfig: &corepb.ConfigSource{
@@ -94,6 +112,11 @@ func CreateBootstrapConfig(opts options.AdsBootstrapperOptions) (string, error)
 		},
 	}
 
+	if metricsListener != nil {
+		bt.StaticResources.Listeners = append(bt.StaticResources.Listeners, metricsListener)
+		bt.StaticResources.Clusters = append(bt.StaticResources.Clusters, adminCluster)
+	}
+
 	jsonStr, err := util.ProtoToJson(bt)
 	if err != nil {
 		return "", fmt.Errorf("failed to MarshalToString, error: %v", err)
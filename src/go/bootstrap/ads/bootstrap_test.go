@@ -72,6 +72,10 @@ func TestCreateBootstrapConfig(t *testing.T) {
             "staticLayer":{
                "re2.max_program_size.error_level":1000
             }
+         },
+         {
+            "name":"admin",
+            "adminLayer":{}
          }
       ]
    },
@@ -163,6 +167,108 @@ func TestCreateBootstrapConfig(t *testing.T) {
             "staticLayer":{
                "re2.max_program_size.error_level":1000
             }
+         },
+         {
+            "name":"admin",
+            "adminLayer":{}
+         }
+      ]
+   },
+   "node":{
+      "cluster":"test-node_cluster",
+      "id":"test-node"
+   },
+   "staticResources":{
+      "clusters":[
+         {
+            "connectTimeout":"10s",
+            "http2ProtocolOptions":{
+               
+            },
+            "loadAssignment":{
+               "clusterName":"127.0.0.1",
+               "endpoints":[
+                  {
+                     "lbEndpoints":[
+                        {
+                           "endpoint":{
+                              "address":{
+                                 "socketAddress":{
+                                    "address":"127.0.0.1",
+                                    "portValue":8790
+                                 }
+                              }
+                           }
+                        }
+                     ]
+                  }
+               ]
+            },
+            "name":"ads_cluster",
+            "type":"STRICT_DNS"
+         }
+      ]
+   }
+}
+`,
+		},
+		{
+			desc: "bootstrap with stats sink and metrics listener",
+			args: map[string]string{
+				"admin_address":      "127.0.0.1",
+				"admin_port":         "8001",
+				"stats_sink":         "dogstatsd",
+				"stats_sink_address": "127.0.0.1:8125",
+				"stats_tags":         `{"route":"^http\\.ingress_http\\.(route=([^.]+)\\.)"}`,
+				"metrics_port":       "9090",
+			},
+			wantConfig: `
+{
+   "admin":{
+      "accessLogPath":"/dev/null",
+      "address":{
+         "socketAddress":{
+            "address":"127.0.0.1",
+            "portValue":8001
+         }
+      }
+   },
+   "dynamicResources":{
+      "adsConfig":{
+         "apiType":"GRPC",
+         "grpcServices":[
+            {
+               "envoyGrpc":{
+                  "clusterName":"ads_cluster"
+               }
+            }
+         ],
+         "transportApiVersion":"V3"
+      },
+      "cdsConfig":{
+         "ads":{
+            
+         },
+         "resourceApiVersion":"V3"
+      },
+      "ldsConfig":{
+         "ads":{
+            
+         },
+         "resourceApiVersion":"V3"
+      }
+   },
+   "layeredRuntime":{
+      "layers":[
+         {
+            "name":"deprecation",
+            "staticLayer":{
+               "re2.max_program_size.error_level":1000
+            }
+         },
+         {
+            "name":"admin",
+            "adminLayer":{}
          }
       ]
    },
@@ -170,6 +276,30 @@ func TestCreateBootstrapConfig(t *testing.T) {
       "cluster":"test-node_cluster",
       "id":"test-node"
    },
+   "statsConfig":{
+      "statsTags":[
+         {
+            "regex":"^http\\.ingress_http\\.(route=([^.]+)\\.)",
+            "tagName":"route"
+         }
+      ],
+      "useAllDefaultTags":true
+   },
+   "statsSinks":[
+      {
+         "name":"envoy.stat_sinks.dog_statsd",
+         "typedConfig":{
+            "@type":"type.googleapis.com/envoy.config.metrics.v3.DogStatsdSink",
+            "address":{
+               "socketAddress":{
+                  "address":"127.0.0.1",
+                  "portValue":8125,
+                  "protocol":"UDP"
+               }
+            }
+         }
+      }
+   ],
    "staticResources":{
       "clusters":[
          {
@@ -198,6 +328,83 @@ func TestCreateBootstrapConfig(t *testing.T) {
             },
             "name":"ads_cluster",
             "type":"STRICT_DNS"
+         },
+         {
+            "connectTimeout":"5s",
+            "loadAssignment":{
+               "clusterName":"127.0.0.1",
+               "endpoints":[
+                  {
+                     "lbEndpoints":[
+                        {
+                           "endpoint":{
+                              "address":{
+                                 "socketAddress":{
+                                    "address":"127.0.0.1",
+                                    "portValue":8001
+                                 }
+                              }
+                           }
+                        }
+                     ]
+                  }
+               ]
+            },
+            "name":"admin-cluster",
+            "type":"STATIC"
+         }
+      ],
+      "listeners":[
+         {
+            "address":{
+               "socketAddress":{
+                  "address":"0.0.0.0",
+                  "portValue":9090
+               }
+            },
+            "filterChains":[
+               {
+                  "filters":[
+                     {
+                        "name":"envoy.filters.network.http_connection_manager",
+                        "typedConfig":{
+                           "@type":"type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager",
+                           "httpFilters":[
+                              {
+                                 "name":"envoy.filters.http.router",
+                                 "typedConfig":{
+                                    "@type":"type.googleapis.com/envoy.extensions.filters.http.router.v3.Router"
+                                 }
+                              }
+                           ],
+                           "routeConfig":{
+                              "name":"metrics_route",
+                              "virtualHosts":[
+                                 {
+                                    "domains":[
+                                       "*"
+                                    ],
+                                    "name":"metrics",
+                                    "routes":[
+                                       {
+                                          "match":{
+                                             "path":"/stats/prometheus"
+                                          },
+                                          "route":{
+                                             "cluster":"admin-cluster"
+                                          }
+                                       }
+                                    ]
+                                 }
+                              ]
+                           },
+                           "statPrefix":"metrics"
+                        }
+                     }
+                  ]
+               }
+            ],
+            "name":"metrics_listener"
          }
       ]
    }
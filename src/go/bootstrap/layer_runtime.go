@@ -39,6 +39,14 @@ func CreateLayeredRuntime() *bootstrappb.LayeredRuntime {
 					},
 				},
 			},
+			// Allows overriding runtime values with the admin endpoint "/runtime_modify",
+			// e.g. the backend shadow percentage.
+			{
+				Name: "admin",
+				LayerSpecifier: &bootstrappb.RuntimeLayer_AdminLayer_{
+					AdminLayer: &bootstrappb.RuntimeLayer_AdminLayer{},
+				},
+			},
 		},
 	}
 }
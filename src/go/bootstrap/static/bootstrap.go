@@ -30,12 +30,31 @@ import (
 // id is the service configuration ID. It is generated when deploying
 // service config to ServiceManagement Server, example: 2017-02-13r0.
 func ServiceToBootstrapConfig(serviceConfig *confpb.Service, id string, opts options.ConfigGeneratorOptions) (*bootstrappb.Bootstrap, error) {
+	if opts.ApiKeysPath != "" {
+		// The API keys are checked by the config manager.
+		return nil, fmt.Errorf("api_keys_path is not supported with static bootstrap")
+	}
+	if opts.LocalServiceControl {
+		// The local Service Control server is hosted by the config manager.
+		return nil, fmt.Errorf("local_service_control is not supported with static bootstrap")
+	}
+
 	bt := &bootstrappb.Bootstrap{
 		Node:           bootstrap.CreateNode(opts.CommonOptions),
 		Admin:          bootstrap.CreateAdmin(opts.CommonOptions),
 		LayeredRuntime: bootstrap.CreateLayeredRuntime(),
 	}
 
+	statsConfig, err := bootstrap.CreateStatsConfig(opts.CommonOptions)
+	if err != nil {
+		return nil, err
+	}
+	bt.StatsConfig = statsConfig
+	bt.StatsSinks, err = bootstrap.CreateStatsSinks(opts.CommonOptions)
+	if err != nil {
+		return nil, err
+	}
+
 	serviceInfo, err := sc.NewServiceInfoFromServiceConfig(serviceConfig, id, opts)
 	if err != nil {
 		return nil, fmt.Errorf("fail to initialize ServiceInfo, %s", err)
@@ -50,6 +69,15 @@ func ServiceToBootstrapConfig(serviceConfig *confpb.Service, id string, opts opt
 		return nil, err
 	}
 
+	metricsListener, adminCluster, err := bootstrap.CreateMetricsListener(opts.CommonOptions)
+	if err != nil {
+		return nil, err
+	}
+	if metricsListener != nil {
+		listeners = append(listeners, metricsListener)
+		clusters = append(clusters, adminCluster)
+	}
+
 	bt.StaticResources = &bootstrappb.Bootstrap_StaticResources{
 		Listeners: listeners,
 		Clusters:  clusters,
@@ -0,0 +1,254 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+
+	clusterpb "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	corepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	listenerpb "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	statspb "github.com/envoyproxy/go-control-plane/envoy/config/metrics/v3"
+	routepb "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	routerpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/router/v3"
+	hcmpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	wrapperspb "github.com/golang/protobuf/ptypes/wrappers"
+)
+
+const (
+	// The admin endpoint serving the stats in the Prometheus text format.
+	prometheusStatsPath = "/stats/prometheus"
+
+	metricsRouteName = "metrics_route"
+)
+
+// CreateStatsConfig outputs StatsConfig struct for bootstrap config, it is nil
+// if no tags are extracted.
+func CreateStatsConfig(opts options.CommonOptions) (*statspb.StatsConfig, error) {
+	if opts.StatsTags == "" {
+		return nil, nil
+	}
+
+	var tags map[string]string
+	if err := json.Unmarshal([]byte(opts.StatsTags), &tags); err != nil {
+		return nil, fmt.Errorf("stats_tags must be a JSON object of tag names to regexes: %v", err)
+	}
+
+	// Sort the tags so the output is stable.
+	var tagNames []string
+	for tagName := range tags {
+		tagNames = append(tagNames, tagName)
+	}
+	sort.Strings(tagNames)
+
+	statsConfig := &statspb.StatsConfig{
+		UseAllDefaultTags: &wrapperspb.BoolValue{Value: true},
+	}
+	for _, tagName := range tagNames {
+		if err := util.ValidateRegexProgramSize(tags[tagName], util.GoogleRE2MaxProgramSize); err != nil {
+			return nil, fmt.Errorf("invalid regex for stats tag %s: %v", tagName, err)
+		}
+		statsConfig.StatsTags = append(statsConfig.StatsTags, &statspb.TagSpecifier{
+			TagName: tagName,
+			TagValue: &statspb.TagSpecifier_Regex{
+				Regex: tags[tagName],
+			},
+		})
+	}
+	return statsConfig, nil
+}
+
+// CreateStatsSinks outputs the statsd or dogstatsd StatsSink for bootstrap config.
+func CreateStatsSinks(opts options.CommonOptions) ([]*statspb.StatsSink, error) {
+	if opts.StatsSink == "" {
+		return nil, nil
+	}
+
+	address, err := createUdpAddress(opts.StatsSinkAddress)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stats_sink_address: %v", err)
+	}
+
+	var name string
+	var sink proto.Message
+	switch opts.StatsSink {
+	case "statsd":
+		name = util.StatsdSink
+		sink = &statspb.StatsdSink{
+			StatsdSpecifier: &statspb.StatsdSink_Address{
+				Address: address,
+			},
+			Prefix: opts.StatsPrefix,
+		}
+	case "dogstatsd":
+		name = util.DogStatsdSink
+		sink = &statspb.DogStatsdSink{
+			DogStatsdSpecifier: &statspb.DogStatsdSink_Address{
+				Address: address,
+			},
+			Prefix: opts.StatsPrefix,
+		}
+	default:
+		return nil, fmt.Errorf("invalid stats_sink: %v. It must be one of (statsd|dogstatsd)", opts.StatsSink)
+	}
+
+	typedConfig, err := ptypes.MarshalAny(sink)
+	if err != nil {
+		return nil, err
+	}
+	return []*statspb.StatsSink{
+		{
+			Name: name,
+			ConfigType: &statspb.StatsSink_TypedConfig{
+				TypedConfig: typedConfig,
+			},
+		},
+	}, nil
+}
+
+// statsd sinks only accept an IP address, they do not resolve host names.
+func createUdpAddress(address string) (*corepb.Address, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) == nil {
+		return nil, fmt.Errorf("%s is not an IP address", host)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %s: %v", portStr, err)
+	}
+
+	return &corepb.Address{
+		Address: &corepb.Address_SocketAddress{
+			SocketAddress: &corepb.SocketAddress{
+				Protocol: corepb.SocketAddress_UDP,
+				Address:  host,
+				PortSpecifier: &corepb.SocketAddress_PortValue{
+					PortValue: uint32(port),
+				},
+			},
+		},
+	}, nil
+}
+
+// CreateMetricsListener outputs the listener serving the Prometheus metrics and
+// the cluster of the admin interface it routes to. Only the Prometheus stats
+// endpoint is routed, so the admin interface can stay on a loopback address.
+func CreateMetricsListener(opts options.CommonOptions) (*listenerpb.Listener, *clusterpb.Cluster, error) {
+	if opts.MetricsPort == 0 {
+		return nil, nil, nil
+	}
+	if opts.AdminPort == 0 {
+		return nil, nil, fmt.Errorf("metrics_port requires the admin interface, admin_port must not be 0")
+	}
+
+	adminCluster := &clusterpb.Cluster{
+		Name:                 util.AdminClusterName,
+		LbPolicy:             clusterpb.Cluster_ROUND_ROBIN,
+		ConnectTimeout:       ptypes.DurationProto(5 * time.Second),
+		ClusterDiscoveryType: &clusterpb.Cluster_Type{Type: clusterpb.Cluster_STATIC},
+		LoadAssignment:       util.CreateLoadAssignment(adminConnectAddress(opts.AdminAddress), uint32(opts.AdminPort)),
+	}
+
+	router, _ := ptypes.MarshalAny(&routerpb.Router{})
+	httpConMgr := &hcmpb.HttpConnectionManager{
+		StatPrefix: "metrics",
+		RouteSpecifier: &hcmpb.HttpConnectionManager_RouteConfig{
+			RouteConfig: &routepb.RouteConfiguration{
+				Name: metricsRouteName,
+				VirtualHosts: []*routepb.VirtualHost{
+					{
+						Name:    "metrics",
+						Domains: []string{"*"},
+						Routes: []*routepb.Route{
+							{
+								Match: &routepb.RouteMatch{
+									PathSpecifier: &routepb.RouteMatch_Path{
+										Path: prometheusStatsPath,
+									},
+								},
+								Action: &routepb.Route_Route{
+									Route: &routepb.RouteAction{
+										ClusterSpecifier: &routepb.RouteAction_Cluster{
+											Cluster: util.AdminClusterName,
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		HttpFilters: []*hcmpb.HttpFilter{
+			{
+				Name:       util.Router,
+				ConfigType: &hcmpb.HttpFilter_TypedConfig{TypedConfig: router},
+			},
+		},
+	}
+	hcm, err := ptypes.MarshalAny(httpConMgr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	listener := &listenerpb.Listener{
+		Name: util.MetricsListenerName,
+		Address: &corepb.Address{
+			Address: &corepb.Address_SocketAddress{
+				SocketAddress: &corepb.SocketAddress{
+					Address: opts.MetricsAddress,
+					PortSpecifier: &corepb.SocketAddress_PortValue{
+						PortValue: uint32(opts.MetricsPort),
+					},
+				},
+			},
+		},
+		FilterChains: []*listenerpb.FilterChain{
+			{
+				Filters: []*listenerpb.Filter{
+					{
+						Name:       util.HTTPConnectionManager,
+						ConfigType: &listenerpb.Filter_TypedConfig{TypedConfig: hcm},
+					},
+				},
+			},
+		},
+	}
+	return listener, adminCluster, nil
+}
+
+// The admin interface is reached on the loopback address if it listens on all addresses.
+func adminConnectAddress(adminAddress string) string {
+	switch adminAddress {
+	case "0.0.0.0":
+		return util.LoopbackIPv4Addr
+	case "::":
+		return "::1"
+	}
+	return adminAddress
+}
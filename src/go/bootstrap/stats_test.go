@@ -0,0 +1,338 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/protobuf/proto"
+
+	statspb "github.com/envoyproxy/go-control-plane/envoy/config/metrics/v3"
+	wrapperspb "github.com/golang/protobuf/ptypes/wrappers"
+)
+
+func TestCreateStatsConfig(t *testing.T) {
+	testData := []struct {
+		desc      string
+		statsTags string
+		want      *statspb.StatsConfig
+		wantError string
+	}{
+		{
+			desc: "No stats tags",
+		},
+		{
+			desc:      "Stats tags are sorted by name",
+			statsTags: `{"route":"^http\\.ingress_http\\.(route=([^.]+)\\.)", "backend":"^cluster\\.(backend-cluster-([^.]+)\\.)"}`,
+			want: &statspb.StatsConfig{
+				UseAllDefaultTags: &wrapperspb.BoolValue{Value: true},
+				StatsTags: []*statspb.TagSpecifier{
+					{
+						TagName: "backend",
+						TagValue: &statspb.TagSpecifier_Regex{
+							Regex: `^cluster\.(backend-cluster-([^.]+)\.)`,
+						},
+					},
+					{
+						TagName: "route",
+						TagValue: &statspb.TagSpecifier_Regex{
+							Regex: `^http\.ingress_http\.(route=([^.]+)\.)`,
+						},
+					},
+				},
+			},
+		},
+		{
+			desc:      "Stats tags are not a JSON object",
+			statsTags: `["route"]`,
+			wantError: "stats_tags must be a JSON object of tag names to regexes",
+		},
+		{
+			desc:      "Stats tag with invalid regex",
+			statsTags: `{"route":"^(route"}`,
+			wantError: "invalid regex for stats tag route",
+		},
+	}
+
+	for _, tc := range testData {
+		opts := options.DefaultCommonOptions()
+		opts.StatsTags = tc.statsTags
+
+		got, err := CreateStatsConfig(opts)
+		if err != nil {
+			if tc.wantError == "" || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test (%s): failed, expected err: %v, got: %v", tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if tc.wantError != "" {
+			t.Errorf("Test (%s): failed, expected err: %v, got no err", tc.desc, tc.wantError)
+			continue
+		}
+
+		if !proto.Equal(got, tc.want) {
+			t.Errorf("Test (%s): failed, got: %v, want: %v", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestCreateStatsSinks(t *testing.T) {
+	testData := []struct {
+		desc             string
+		statsSink        string
+		statsSinkAddress string
+		statsPrefix      string
+		wantSinks        string
+		wantError        string
+	}{
+		{
+			desc:      "No stats sink",
+			wantSinks: `{"sinks": []}`,
+		},
+		{
+			desc:             "Statsd sink",
+			statsSink:        "statsd",
+			statsSinkAddress: "127.0.0.1:8125",
+			wantSinks: `{"sinks": [
+				{
+					"name": "envoy.stat_sinks.statsd",
+					"typedConfig": {
+						"@type": "type.googleapis.com/envoy.config.metrics.v3.StatsdSink",
+						"address": {
+							"socketAddress": {
+								"protocol": "UDP",
+								"address": "127.0.0.1",
+								"portValue": 8125
+							}
+						}
+					}
+				}
+			]}`,
+		},
+		{
+			desc:             "DogStatsD sink with prefix on IPv6",
+			statsSink:        "dogstatsd",
+			statsSinkAddress: "[::1]:9125",
+			statsPrefix:      "espv2",
+			wantSinks: `{"sinks": [
+				{
+					"name": "envoy.stat_sinks.dog_statsd",
+					"typedConfig": {
+						"@type": "type.googleapis.com/envoy.config.metrics.v3.DogStatsdSink",
+						"address": {
+							"socketAddress": {
+								"protocol": "UDP",
+								"address": "::1",
+								"portValue": 9125
+							}
+						},
+						"prefix": "espv2"
+					}
+				}
+			]}`,
+		},
+		{
+			desc:             "Statsd sink with host name",
+			statsSink:        "statsd",
+			statsSinkAddress: "statsd:8125",
+			wantError:        "statsd is not an IP address",
+		},
+		{
+			desc:             "Unknown stats sink",
+			statsSink:        "graphite",
+			statsSinkAddress: "127.0.0.1:8125",
+			wantError:        "invalid stats_sink: graphite",
+		},
+	}
+
+	for _, tc := range testData {
+		opts := options.DefaultCommonOptions()
+		opts.StatsSink = tc.statsSink
+		opts.StatsSinkAddress = tc.statsSinkAddress
+		opts.StatsPrefix = tc.statsPrefix
+
+		sinks, err := CreateStatsSinks(opts)
+		if err != nil {
+			if tc.wantError == "" || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test (%s): failed, expected err: %v, got: %v", tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if tc.wantError != "" {
+			t.Errorf("Test (%s): failed, expected err: %v, got no err", tc.desc, tc.wantError)
+			continue
+		}
+
+		var gotSinks []string
+		for _, sink := range sinks {
+			jsonStr, err := util.ProtoToJson(sink)
+			if err != nil {
+				t.Fatalf("Test (%s): failed, got err: %v", tc.desc, err)
+			}
+			gotSinks = append(gotSinks, jsonStr)
+		}
+		if err := util.JsonEqual(tc.wantSinks, `{"sinks": [`+strings.Join(gotSinks, ",")+"]}"); err != nil {
+			t.Errorf("Test (%s): failed, \n %v ", tc.desc, err)
+		}
+	}
+}
+
+func TestCreateMetricsListener(t *testing.T) {
+	testData := []struct {
+		desc         string
+		adminAddress string
+		adminPort    int
+		metricsPort  int
+		wantListener string
+		wantCluster  string
+		wantError    string
+	}{
+		{
+			desc:         "Metrics listener is disabled",
+			adminAddress: "0.0.0.0",
+			adminPort:    8001,
+		},
+		{
+			desc:         "Metrics listener routes to the admin interface on loopback",
+			adminAddress: "0.0.0.0",
+			adminPort:    8001,
+			metricsPort:  9090,
+			wantListener: `{
+				"name": "metrics_listener",
+				"address": {
+					"socketAddress": {
+						"address": "0.0.0.0",
+						"portValue": 9090
+					}
+				},
+				"filterChains": [
+					{
+						"filters": [
+							{
+								"name": "envoy.filters.network.http_connection_manager",
+								"typedConfig": {
+									"@type": "type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager",
+									"statPrefix": "metrics",
+									"routeConfig": {
+										"name": "metrics_route",
+										"virtualHosts": [
+											{
+												"name": "metrics",
+												"domains": ["*"],
+												"routes": [
+													{
+														"match": {
+															"path": "/stats/prometheus"
+														},
+														"route": {
+															"cluster": "admin-cluster"
+														}
+													}
+												]
+											}
+										]
+									},
+									"httpFilters": [
+										{
+											"name": "envoy.filters.http.router",
+											"typedConfig": {
+												"@type": "type.googleapis.com/envoy.extensions.filters.http.router.v3.Router"
+											}
+										}
+									]
+								}
+							}
+						]
+					}
+				]
+			}`,
+			wantCluster: `{
+				"name": "admin-cluster",
+				"type": "STATIC",
+				"connectTimeout": "5s",
+				"loadAssignment": {
+					"clusterName": "127.0.0.1",
+					"endpoints": [
+						{
+							"lbEndpoints": [
+								{
+									"endpoint": {
+										"address": {
+											"socketAddress": {
+												"address": "127.0.0.1",
+												"portValue": 8001
+											}
+										}
+									}
+								}
+							]
+						}
+					]
+				}
+			}`,
+		},
+		{
+			desc:         "Metrics listener without admin interface",
+			adminAddress: "0.0.0.0",
+			metricsPort:  9090,
+			wantError:    "metrics_port requires the admin interface",
+		},
+	}
+
+	for _, tc := range testData {
+		opts := options.DefaultCommonOptions()
+		opts.AdminAddress = tc.adminAddress
+		opts.AdminPort = tc.adminPort
+		opts.MetricsPort = tc.metricsPort
+
+		listener, cluster, err := CreateMetricsListener(opts)
+		if err != nil {
+			if tc.wantError == "" || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test (%s): failed, expected err: %v, got: %v", tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if tc.wantError != "" {
+			t.Errorf("Test (%s): failed, expected err: %v, got no err", tc.desc, tc.wantError)
+			continue
+		}
+
+		if tc.wantListener == "" {
+			if listener != nil || cluster != nil {
+				t.Errorf("Test (%s): failed, got listener: %v, cluster: %v, want none", tc.desc, listener, cluster)
+			}
+			continue
+		}
+
+		gotListener, err := util.ProtoToJson(listener)
+		if err != nil {
+			t.Fatalf("Test (%s): failed, got err: %v", tc.desc, err)
+		}
+		if err := util.JsonEqual(tc.wantListener, gotListener); err != nil {
+			t.Errorf("Test (%s): failed listener, \n %v ", tc.desc, err)
+		}
+
+		gotCluster, err := util.ProtoToJson(cluster)
+		if err != nil {
+			t.Fatalf("Test (%s): failed, got err: %v", tc.desc, err)
+		}
+		if err := util.JsonEqual(tc.wantCluster, gotCluster); err != nil {
+			t.Errorf("Test (%s): failed cluster, \n %v ", tc.desc, err)
+		}
+	}
+}
@@ -45,6 +45,22 @@ var (
 	TracingMaxNumMessageEvents = flag.Int64("tracing_max_num_message_events", 128, "Sets the maximum number of message events that each span can contain. Defaults to the maximum allowed by Stackdriver. In practice, the number of message events published will be much less.")
 	TracingMaxNumLinks         = flag.Int64("tracing_max_num_links", 128, "Sets the maximum number of links that each span can contain. Defaults to the maximum allowed by Stackdriver. In practice, the number of links published will be much less.")
 
+	TracingProvider = flag.String("tracing_provider", "stackdriver", `The tracing provider, one of (stackdriver|opencensus_agent|zipkin).
+	opencensus_agent sends spans to --tracing_collector_address with the OpenCensus agent protocol, an OpenTelemetry collector must enable the opencensus receiver.`)
+	TracingCollectorAddress = flag.String("tracing_collector_address", "", `Address of the tracing collector, required by the opencensus_agent and zipkin providers.
+	In format of grpc://HOST:PORT or grpcs://HOST:PORT for opencensus_agent, and http://HOST:PORT[/PATH] or https://HOST:PORT[/PATH] for zipkin.
+	The zipkin path defaults to /api/v2/spans.`)
+
+	StatsSink        = flag.String("stats_sink", "", "Sends Envoy stats to a statsd server, one of (statsd|dogstatsd). Disabled if empty.")
+	StatsSinkAddress = flag.String("stats_sink_address", "127.0.0.1:8125", "The UDP address of the statsd server, in format of IP:PORT.")
+	StatsPrefix      = flag.String("stats_prefix", "", `The prefix of the stats sent to the statsd server. Defaults to "envoy" if empty.`)
+	StatsTags        = flag.String("stats_tags", "", `Extracts tags from the stat names, specified as a JSON object of tag names to regexes, e.g. '{"route":"^http\\.ingress_http\\.(route=([^.]+)\\.)"}'.
+	The first capture group of the regex is removed from the stat name, the second one, if present, is the tag value.
+	The tags are used by the dogstatsd sink and the Prometheus metrics.`)
+	MetricsPort = flag.Int("metrics_port", 0, `Serves the Prometheus metrics at /stats/prometheus on this port if it is not 0, so the admin interface can stay on a loopback address.
+	Requires --admin_port.`)
+	MetricsAddress = flag.String("metrics_address", "0.0.0.0", "Address that envoy should serve the Prometheus metrics on. Supports both ipv4 and ipv6 addresses.")
+
 	//Suspected Envoy has listener initialization bug: if a http filter needs to use
 	//a cluster with DSN lookup for initialization, e.g. fetching a remote access
 	//token, the cluster is not ready so the whole listener is destroyed. ADS will
@@ -72,6 +88,8 @@ func DefaultCommonOptionsFromFlags() options.CommonOptions {
 		Node:                       *Node,
 		NonGCP:                     *NonGCP,
 		GeneratedHeaderPrefix:      *GeneratedHeaderPrefix,
+		TracingProvider:            *TracingProvider,
+		TracingCollectorAddress:    *TracingCollectorAddress,
 		TracingProjectId:           *TracingProjectId,
 		TracingStackdriverAddress:  *TracingStackdriverAddress,
 		TracingSamplingRate:        *TracingSamplingRate,
@@ -81,6 +99,12 @@ func DefaultCommonOptionsFromFlags() options.CommonOptions {
 		TracingMaxNumAnnotations:   *TracingMaxNumAnnotations,
 		TracingMaxNumMessageEvents: *TracingMaxNumMessageEvents,
 		TracingMaxNumLinks:         *TracingMaxNumLinks,
+		StatsSink:                  *StatsSink,
+		StatsSinkAddress:           *StatsSinkAddress,
+		StatsPrefix:                *StatsPrefix,
+		StatsTags:                  *StatsTags,
+		MetricsAddress:             *MetricsAddress,
+		MetricsPort:                *MetricsPort,
 		MetadataURL:                *MetadataURL,
 		IamURL:                     *IamURL,
 	}
@@ -19,6 +19,7 @@ import (
 	"time"
 
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/tracing"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
 	"github.com/golang/glog"
 	"github.com/golang/protobuf/ptypes"
@@ -26,6 +27,8 @@ import (
 	sc "github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
 	clusterpb "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
 	corepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	typepb "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	wrapperspb "github.com/golang/protobuf/ptypes/wrappers"
 )
 
 // MakeClusters provides dynamic cluster settings for Envoy
@@ -79,6 +82,26 @@ func MakeClusters(serviceInfo *sc.ServiceInfo) ([]*clusterpb.Cluster, error) {
 		clusters = append(clusters, scCluster)
 	}
 
+	tracingCluster, err := makeTracingCollectorCluster(serviceInfo)
+	if err != nil {
+		return nil, err
+	}
+	if tracingCluster != nil {
+		clusters = append(clusters, tracingCluster)
+	}
+
+	alsCluster, err := makeAccessLogServiceCluster(serviceInfo)
+	if err != nil {
+		return nil, err
+	}
+	if alsCluster != nil {
+		clusters = append(clusters, alsCluster)
+	}
+
+	if serviceInfo.Options.ApiKeysPath != "" {
+		clusters = append(clusters, makeApiKeyServerCluster(serviceInfo))
+	}
+
 	brClusters, err := makeRemoteBackendClusters(serviceInfo)
 	if err != nil {
 		return nil, err
@@ -87,6 +110,14 @@ func MakeClusters(serviceInfo *sc.ServiceInfo) ([]*clusterpb.Cluster, error) {
 		clusters = append(clusters, brClusters...)
 	}
 
+	if serviceInfo.ShadowBackendCluster != nil {
+		shadowCluster, err := makeBackendCluster(&serviceInfo.Options, serviceInfo.ShadowBackendCluster)
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, shadowCluster)
+	}
+
 	providerClusters, err := makeJwtProviderClusters(serviceInfo)
 	if err != nil {
 		return nil, err
@@ -160,6 +191,21 @@ func makeTokenAgentCluster(serviceInfo *sc.ServiceInfo) *clusterpb.Cluster {
 	}
 }
 
+// makeApiKeyServerCluster is the ext_authz gRPC server of the config manager,
+// served with the discovery services.
+func makeApiKeyServerCluster(serviceInfo *sc.ServiceInfo) *clusterpb.Cluster {
+	return &clusterpb.Cluster{
+		Name:           util.ApiKeyServerClusterName,
+		LbPolicy:       clusterpb.Cluster_ROUND_ROBIN,
+		ConnectTimeout: ptypes.DurationProto(serviceInfo.Options.ClusterConnectTimeout),
+		ClusterDiscoveryType: &clusterpb.Cluster_Type{
+			Type: clusterpb.Cluster_STATIC,
+		},
+		LoadAssignment:       util.CreateLoadAssignment(util.LoopbackIPv4Addr, uint32(serviceInfo.Options.DiscoveryPort)),
+		Http2ProtocolOptions: &corepb.Http2ProtocolOptions{},
+	}
+}
+
 func makeIamCluster(serviceInfo *sc.ServiceInfo) (*clusterpb.Cluster, error) {
 	if serviceInfo.Options.ServiceControlCredentials == nil && serviceInfo.Options.BackendAuthCredentials == nil {
 		return nil, nil
@@ -199,7 +245,11 @@ func makeJwtProviderClusters(serviceInfo *sc.ServiceInfo) ([]*clusterpb.Cluster,
 	generatedClusters := map[string]bool{}
 
 	for _, provider := range authn.GetProviders() {
-		jwksUri := provider.GetJwksUri()
+		if _, ok := serviceInfo.LocalJwks[provider.GetId()]; ok {
+			continue
+		}
+
+		jwksUri := serviceInfo.JwksUris[provider.GetId()]
 		addr, err := util.ExtraAddressFromURI(jwksUri)
 		if err != nil {
 			return nil, err
@@ -251,6 +301,12 @@ func makeBackendCluster(opt *options.ConfigGeneratorOptions, brc *sc.BackendRout
 		LoadAssignment:       util.CreateLoadAssignment(brc.Hostname, brc.Port),
 	}
 
+	if brc.Endpoints != nil {
+		// LOGICAL_DNS only supports a single endpoint.
+		c.ClusterDiscoveryType = &clusterpb.Cluster_Type{Type: clusterpb.Cluster_STRICT_DNS}
+		c.LoadAssignment = util.CreateWeightedLoadAssignment(brc.ClusterName, brc.Endpoints)
+	}
+
 	isHttp2 := brc.Protocol == util.GRPC || brc.Protocol == util.HTTP2
 
 	if brc.UseTLS {
@@ -270,6 +326,12 @@ func makeBackendCluster(opt *options.ConfigGeneratorOptions, brc *sc.BackendRout
 		c.Http2ProtocolOptions = &corepb.Http2ProtocolOptions{}
 	}
 
+	c.CircuitBreakers = makeCircuitBreakers(brc.CircuitBreakers)
+	c.OutlierDetection = makeOutlierDetection(brc.OutlierDetection)
+	if hc := makeHealthCheck(brc, isHttp2); hc != nil {
+		c.HealthChecks = []*corepb.HealthCheck{hc}
+	}
+
 	switch opt.BackendDnsLookupFamily {
 	case "auto":
 		c.DnsLookupFamily = clusterpb.Cluster_AUTO
@@ -283,16 +345,106 @@ func makeBackendCluster(opt *options.ConfigGeneratorOptions, brc *sc.BackendRout
 	return c, nil
 }
 
+// makeCircuitBreakers creates the default priority thresholds of a backend cluster.
+// The remaining capacity is tracked so that it is exposed in the
+// "cluster.<cluster_name>.circuit_breakers.default.remaining_*" stats.
+func makeCircuitBreakers(cb *sc.CircuitBreakers) *clusterpb.CircuitBreakers {
+	if cb == nil {
+		return nil
+	}
+
+	threshold := func(v *uint32) *wrapperspb.UInt32Value {
+		if v == nil {
+			return nil
+		}
+		return &wrapperspb.UInt32Value{Value: *v}
+	}
+	return &clusterpb.CircuitBreakers{
+		Thresholds: []*clusterpb.CircuitBreakers_Thresholds{
+			{
+				Priority:           corepb.RoutingPriority_DEFAULT,
+				MaxConnections:     threshold(cb.MaxConnections),
+				MaxPendingRequests: threshold(cb.MaxPendingRequests),
+				MaxRequests:        threshold(cb.MaxRequests),
+				MaxRetries:         threshold(cb.MaxRetries),
+				TrackRemaining:     true,
+			},
+		},
+	}
+}
+
+func makeOutlierDetection(od *sc.OutlierDetection) *clusterpb.OutlierDetection {
+	if od == nil {
+		return nil
+	}
+	return &clusterpb.OutlierDetection{
+		Consecutive_5Xx:    &wrapperspb.UInt32Value{Value: od.Consecutive5xx},
+		Interval:           ptypes.DurationProto(od.Interval),
+		BaseEjectionTime:   ptypes.DurationProto(od.BaseEjectionTime),
+		MaxEjectionPercent: &wrapperspb.UInt32Value{Value: od.MaxEjectionPercent},
+	}
+}
+
+// makeHealthCheck creates the active health check of a backend cluster.
+// Health check requests are sent with the backend hostname as host header,
+// using the same protocol as the routed requests.
+func makeHealthCheck(brc *sc.BackendRoutingCluster, isHttp2 bool) *corepb.HealthCheck {
+	hc := brc.HealthCheck
+	if hc == nil {
+		return nil
+	}
+
+	healthCheck := &corepb.HealthCheck{
+		Interval:           ptypes.DurationProto(hc.Interval),
+		Timeout:            ptypes.DurationProto(hc.Timeout),
+		HealthyThreshold:   &wrapperspb.UInt32Value{Value: hc.HealthyThreshold},
+		UnhealthyThreshold: &wrapperspb.UInt32Value{Value: hc.UnhealthyThreshold},
+	}
+
+	switch hc.Type {
+	case "grpc":
+		healthCheck.HealthChecker = &corepb.HealthCheck_GrpcHealthCheck_{
+			GrpcHealthCheck: &corepb.HealthCheck_GrpcHealthCheck{
+				ServiceName: hc.GrpcServiceName,
+				Authority:   brc.Hostname,
+			},
+		}
+	default:
+		httpHealthCheck := &corepb.HealthCheck_HttpHealthCheck{
+			Host: brc.Hostname,
+			Path: hc.Path,
+		}
+		if isHttp2 {
+			httpHealthCheck.CodecClientType = typepb.CodecClientType_HTTP2
+		}
+		healthCheck.HealthChecker = &corepb.HealthCheck_HttpHealthCheck_{
+			HttpHealthCheck: httpHealthCheck,
+		}
+	}
+	return healthCheck
+}
+
 func makeLocalBackendCluster(serviceInfo *sc.ServiceInfo) (*clusterpb.Cluster, error) {
 	c, err := makeBackendCluster(&serviceInfo.Options, serviceInfo.LocalBackendCluster)
 	if err != nil {
 		return nil, err
 	}
 
+	switch serviceInfo.Options.BackendLbPolicy {
+	case "least_request":
+		c.LbPolicy = clusterpb.Cluster_LEAST_REQUEST
+	case "ring_hash":
+		c.LbPolicy = clusterpb.Cluster_RING_HASH
+	}
+
 	return c, nil
 }
 
 func makeServiceControlCluster(serviceInfo *sc.ServiceInfo) (*clusterpb.Cluster, error) {
+	if serviceInfo.Options.LocalServiceControl {
+		return makeLocalServiceControlCluster(serviceInfo), nil
+	}
+
 	uri := serviceInfo.ServiceConfig().GetControl().GetEnvironment()
 	if uri == "" {
 		return nil, nil
@@ -334,6 +486,104 @@ func makeServiceControlCluster(serviceInfo *sc.ServiceInfo) (*clusterpb.Cluster,
 	return c, nil
 }
 
+// makeLocalServiceControlCluster points the Service Control filter to the
+// local Service Control server of the config manager.
+func makeLocalServiceControlCluster(serviceInfo *sc.ServiceInfo) *clusterpb.Cluster {
+	port := uint32(serviceInfo.Options.LocalServiceControlPort)
+	serviceInfo.ServiceControlURI = fmt.Sprintf("http://%s:%d/v1/services", util.LoopbackIPv4Addr, port)
+	return &clusterpb.Cluster{
+		Name:           util.ServiceControlClusterName,
+		LbPolicy:       clusterpb.Cluster_ROUND_ROBIN,
+		ConnectTimeout: ptypes.DurationProto(serviceInfo.Options.ClusterConnectTimeout),
+		ClusterDiscoveryType: &clusterpb.Cluster_Type{
+			Type: clusterpb.Cluster_STATIC,
+		},
+		LoadAssignment: util.CreateLoadAssignment(util.LoopbackIPv4Addr, port),
+	}
+}
+
+// makeTracingCollectorCluster creates the cluster for the zipkin tracer. The
+// OpenCensus tracer connects to its exporters by itself with Google gRPC.
+func makeTracingCollectorCluster(serviceInfo *sc.ServiceInfo) (*clusterpb.Cluster, error) {
+	opts := serviceInfo.Options
+	if opts.DisableTracing || opts.TracingProvider != tracing.ZipkinProvider {
+		return nil, nil
+	}
+
+	scheme, hostname, port, _, err := util.ParseURI(opts.TracingCollectorAddress)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing tracing collector address: %v", err)
+	}
+	protocol, tls, err := util.ParseBackendProtocol(scheme, "")
+	if err != nil {
+		return nil, err
+	}
+	if protocol != util.HTTP1 {
+		return nil, fmt.Errorf("tracing collector address for provider %s must use http or https scheme: %s", tracing.ZipkinProvider, opts.TracingCollectorAddress)
+	}
+
+	c := &clusterpb.Cluster{
+		Name:                 util.TracingCollectorClusterName,
+		LbPolicy:             clusterpb.Cluster_ROUND_ROBIN,
+		ConnectTimeout:       ptypes.DurationProto(opts.ClusterConnectTimeout),
+		ClusterDiscoveryType: &clusterpb.Cluster_Type{clusterpb.Cluster_LOGICAL_DNS},
+		LoadAssignment:       util.CreateLoadAssignment(hostname, port),
+	}
+
+	if tls {
+		transportSocket, err := util.CreateUpstreamTransportSocket(hostname, opts.SslSidestreamClientRootCertsPath, "", nil)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling tls context to transport_socket config for cluster %s, err=%v",
+				c.Name, err)
+		}
+		c.TransportSocket = transportSocket
+	}
+
+	return c, nil
+}
+
+func makeAccessLogServiceCluster(serviceInfo *sc.ServiceInfo) (*clusterpb.Cluster, error) {
+	uri := serviceInfo.Options.AccessLogGrpcServiceAddress
+	if uri == "" {
+		return nil, nil
+	}
+
+	scheme, hostname, port, path, err := util.ParseURI(uri)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing access log service uri: %v", err)
+	}
+	if path != "" {
+		return nil, fmt.Errorf("Invalid uri: access log service should not have path part: %s, %s", uri, path)
+	}
+	protocol, tls, err := util.ParseBackendProtocol(scheme, "")
+	if err != nil {
+		return nil, err
+	}
+	if protocol != util.GRPC {
+		return nil, fmt.Errorf("Invalid uri: access log service scheme must be grpc or grpcs: %s", uri)
+	}
+
+	c := &clusterpb.Cluster{
+		Name:                 util.AccessLogServiceClusterName,
+		LbPolicy:             clusterpb.Cluster_ROUND_ROBIN,
+		ConnectTimeout:       ptypes.DurationProto(serviceInfo.Options.ClusterConnectTimeout),
+		ClusterDiscoveryType: &clusterpb.Cluster_Type{clusterpb.Cluster_LOGICAL_DNS},
+		LoadAssignment:       util.CreateLoadAssignment(hostname, port),
+		Http2ProtocolOptions: &corepb.Http2ProtocolOptions{},
+	}
+
+	if tls {
+		transportSocket, err := util.CreateUpstreamTransportSocket(hostname, serviceInfo.Options.SslSidestreamClientRootCertsPath, "", []string{"h2"})
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling tls context to transport_socket config for cluster %s, err=%v",
+				c.Name, err)
+		}
+		c.TransportSocket = transportSocket
+	}
+
+	return c, nil
+}
+
 func makeRemoteBackendClusters(serviceInfo *sc.ServiceInfo) ([]*clusterpb.Cluster, error) {
 	var brClusters []*clusterpb.Cluster
 
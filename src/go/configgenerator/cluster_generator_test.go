@@ -28,6 +28,8 @@ import (
 
 	clusterpb "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
 	corepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	typepb "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	wrapperspb "github.com/golang/protobuf/ptypes/wrappers"
 	annotationspb "google.golang.org/genproto/googleapis/api/annotations"
 	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
 	apipb "google.golang.org/genproto/protobuf/api"
@@ -52,10 +54,12 @@ func createH2TransportSocket(hostname string) *corepb.TransportSocket {
 
 func TestMakeServiceControlCluster(t *testing.T) {
 	testData := []struct {
-		desc              string
-		fakeServiceConfig *confpb.Service
-		wantedCluster     clusterpb.Cluster
-		BackendAddress    string
+		desc                  string
+		fakeServiceConfig     *confpb.Service
+		localServiceControl   bool
+		wantedCluster         clusterpb.Cluster
+		wantServiceControlURI string
+		BackendAddress        string
 	}{
 		{
 			desc: "Success for gRPC backend",
@@ -112,11 +116,35 @@ func TestMakeServiceControlCluster(t *testing.T) {
 				LoadAssignment:       util.CreateLoadAssignment("127.0.0.1", 8000),
 			},
 		},
+		{
+			desc: "Success for local service control",
+			fakeServiceConfig: &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+					},
+				},
+				Control: &confpb.Control{
+					Environment: testServiceControlEnv,
+				},
+			},
+			localServiceControl: true,
+			BackendAddress:      "http://127.0.0.1:80",
+			wantedCluster: clusterpb.Cluster{
+				Name:                 "service-control-cluster",
+				ConnectTimeout:       ptypes.DurationProto(20 * time.Second),
+				ClusterDiscoveryType: &clusterpb.Cluster_Type{Type: clusterpb.Cluster_STATIC},
+				LoadAssignment:       util.CreateLoadAssignment("127.0.0.1", 8792),
+			},
+			wantServiceControlURI: "http://127.0.0.1:8792/v1/services",
+		},
 	}
 
 	for i, tc := range testData {
 		opts := options.DefaultConfigGeneratorOptions()
 		opts.BackendAddress = tc.BackendAddress
+		opts.LocalServiceControl = tc.localServiceControl
 		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(tc.fakeServiceConfig, testConfigID, opts)
 		if err != nil {
 			t.Fatal(err)
@@ -130,6 +158,165 @@ func TestMakeServiceControlCluster(t *testing.T) {
 		if !proto.Equal(cluster, &tc.wantedCluster) {
 			t.Errorf("Test Desc(%d): %s, makeServiceControlCluster\ngot Clusters: %v,\nwant: %v", i, tc.desc, cluster, tc.wantedCluster)
 		}
+		if tc.wantServiceControlURI != "" && fakeServiceInfo.ServiceControlURI != tc.wantServiceControlURI {
+			t.Errorf("Test Desc(%d): %s, got service control uri: %s, want: %s", i, tc.desc, fakeServiceInfo.ServiceControlURI, tc.wantServiceControlURI)
+		}
+	}
+}
+
+func TestMakeTracingCollectorCluster(t *testing.T) {
+	testData := []struct {
+		desc             string
+		disableTracing   bool
+		provider         string
+		collectorAddress string
+		wantedCluster    *clusterpb.Cluster
+		wantError        string
+	}{
+		{
+			desc:     "No cluster for stackdriver",
+			provider: "stackdriver",
+		},
+		{
+			desc:             "No cluster for opencensus_agent",
+			provider:         "opencensus_agent",
+			collectorAddress: "grpc://otel-collector:55678",
+		},
+		{
+			desc:             "No cluster when tracing is disabled",
+			disableTracing:   true,
+			provider:         "zipkin",
+			collectorAddress: "http://zipkin:9411",
+		},
+		{
+			desc:             "Success for zipkin",
+			provider:         "zipkin",
+			collectorAddress: "http://zipkin:9411",
+			wantedCluster: &clusterpb.Cluster{
+				Name:                 "tracing-collector-cluster",
+				LbPolicy:             clusterpb.Cluster_ROUND_ROBIN,
+				ConnectTimeout:       ptypes.DurationProto(20 * time.Second),
+				ClusterDiscoveryType: &clusterpb.Cluster_Type{Type: clusterpb.Cluster_LOGICAL_DNS},
+				LoadAssignment:       util.CreateLoadAssignment("zipkin", 9411),
+			},
+		},
+		{
+			desc:             "Success for zipkin with TLS",
+			provider:         "zipkin",
+			collectorAddress: "https://zipkin.example.com/api/v2/spans",
+			wantedCluster: &clusterpb.Cluster{
+				Name:                 "tracing-collector-cluster",
+				LbPolicy:             clusterpb.Cluster_ROUND_ROBIN,
+				ConnectTimeout:       ptypes.DurationProto(20 * time.Second),
+				ClusterDiscoveryType: &clusterpb.Cluster_Type{Type: clusterpb.Cluster_LOGICAL_DNS},
+				LoadAssignment:       util.CreateLoadAssignment("zipkin.example.com", 443),
+				TransportSocket:      createTransportSocket("zipkin.example.com"),
+			},
+		},
+		{
+			desc:             "Zipkin with grpc scheme",
+			provider:         "zipkin",
+			collectorAddress: "grpc://zipkin:9411",
+			wantError:        "tracing collector address for provider zipkin must use http or https scheme",
+		},
+	}
+
+	for _, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.DisableTracing = tc.disableTracing
+		opts.TracingProvider = tc.provider
+		opts.TracingCollectorAddress = tc.collectorAddress
+		fakeServiceInfo := &configinfo.ServiceInfo{
+			Options: opts,
+		}
+
+		cluster, err := makeTracingCollectorCluster(fakeServiceInfo)
+		if err != nil {
+			if tc.wantError == "" || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test Desc(%s): want error: %s, get error: %v", tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if tc.wantError != "" {
+			t.Errorf("Test Desc(%s): want error: %s, get no error", tc.desc, tc.wantError)
+			continue
+		}
+
+		if !proto.Equal(cluster, tc.wantedCluster) {
+			t.Errorf("Test Desc(%s): makeTracingCollectorCluster\ngot: %v,\nwant: %v", tc.desc, cluster, tc.wantedCluster)
+		}
+	}
+}
+
+func TestMakeAccessLogServiceCluster(t *testing.T) {
+	testData := []struct {
+		desc          string
+		address       string
+		wantedCluster *clusterpb.Cluster
+		wantError     string
+	}{
+		{
+			desc: "No access log service",
+		},
+		{
+			desc:    "Success for grpcs collector",
+			address: "grpcs://als.example.com",
+			wantedCluster: &clusterpb.Cluster{
+				Name:                 "access-log-service-cluster",
+				LbPolicy:             clusterpb.Cluster_ROUND_ROBIN,
+				ConnectTimeout:       ptypes.DurationProto(20 * time.Second),
+				ClusterDiscoveryType: &clusterpb.Cluster_Type{Type: clusterpb.Cluster_LOGICAL_DNS},
+				LoadAssignment:       util.CreateLoadAssignment("als.example.com", 443),
+				Http2ProtocolOptions: &corepb.Http2ProtocolOptions{},
+				TransportSocket:      createH2TransportSocket("als.example.com"),
+			},
+		},
+		{
+			desc:    "Success for grpc collector",
+			address: "grpc://127.0.0.1:9001",
+			wantedCluster: &clusterpb.Cluster{
+				Name:                 "access-log-service-cluster",
+				LbPolicy:             clusterpb.Cluster_ROUND_ROBIN,
+				ConnectTimeout:       ptypes.DurationProto(20 * time.Second),
+				ClusterDiscoveryType: &clusterpb.Cluster_Type{Type: clusterpb.Cluster_LOGICAL_DNS},
+				LoadAssignment:       util.CreateLoadAssignment("127.0.0.1", 9001),
+				Http2ProtocolOptions: &corepb.Http2ProtocolOptions{},
+			},
+		},
+		{
+			desc:      "Collector with path",
+			address:   "grpc://127.0.0.1:9001/logs",
+			wantError: "access log service should not have path part",
+		},
+		{
+			desc:      "Collector with http scheme",
+			address:   "http://127.0.0.1:9001",
+			wantError: "access log service scheme must be grpc or grpcs",
+		},
+	}
+
+	for _, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.AccessLogGrpcServiceAddress = tc.address
+		fakeServiceInfo := &configinfo.ServiceInfo{
+			Options: opts,
+		}
+
+		cluster, err := makeAccessLogServiceCluster(fakeServiceInfo)
+		if err != nil {
+			if tc.wantError == "" || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test Desc(%s): want error: %s, get error: %v", tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if tc.wantError != "" {
+			t.Errorf("Test Desc(%s): want error: %s, get no error", tc.desc, tc.wantError)
+			continue
+		}
+
+		if !proto.Equal(cluster, tc.wantedCluster) {
+			t.Errorf("Test Desc(%s): makeAccessLogServiceCluster\ngot: %v,\nwant: %v", tc.desc, cluster, tc.wantedCluster)
+		}
 	}
 }
 
@@ -579,10 +766,306 @@ func TestMakeBackendRoutingCluster(t *testing.T) {
 	}
 }
 
+func TestMakeLocalBackendCluster(t *testing.T) {
+	testData := []struct {
+		desc          string
+		optsMergeFunc func(opts *options.ConfigGeneratorOptions)
+		wantCluster   *clusterpb.Cluster
+	}{
+		{
+			desc: "Single local backend",
+			wantCluster: &clusterpb.Cluster{
+				Name:                 "backend-cluster-bookstore.endpoints.project123.cloud.goog_local",
+				LbPolicy:             clusterpb.Cluster_ROUND_ROBIN,
+				ConnectTimeout:       ptypes.DurationProto(20 * time.Second),
+				ClusterDiscoveryType: &clusterpb.Cluster_Type{Type: clusterpb.Cluster_LOGICAL_DNS},
+				LoadAssignment:       util.CreateLoadAssignment("127.0.0.1", 8082),
+			},
+		},
+		{
+			desc: "Multiple weighted local backends with least request",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.BackendAddress = "grpc://127.0.0.1:8081, grpc://localhost:8082"
+				opts.BackendWeights = "3,1"
+				opts.BackendLbPolicy = "least_request"
+			},
+			wantCluster: &clusterpb.Cluster{
+				Name:                 "backend-cluster-bookstore.endpoints.project123.cloud.goog_local",
+				LbPolicy:             clusterpb.Cluster_LEAST_REQUEST,
+				ConnectTimeout:       ptypes.DurationProto(20 * time.Second),
+				ClusterDiscoveryType: &clusterpb.Cluster_Type{Type: clusterpb.Cluster_STRICT_DNS},
+				LoadAssignment: util.CreateWeightedLoadAssignment("backend-cluster-bookstore.endpoints.project123.cloud.goog_local",
+					[]*util.WeightedEndpoint{
+						{
+							Hostname: "127.0.0.1",
+							Port:     8081,
+							Weight:   3,
+						},
+						{
+							Hostname: "localhost",
+							Port:     8082,
+							Weight:   1,
+						},
+					}),
+				Http2ProtocolOptions: &corepb.Http2ProtocolOptions{},
+			},
+		},
+		{
+			desc: "Multiple local backends with ring hash",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.BackendAddress = "http://127.0.0.1:8081,http://127.0.0.1:8082"
+				opts.BackendLbPolicy = "ring_hash"
+				opts.BackendLbHashHeader = "x-user-id"
+			},
+			wantCluster: &clusterpb.Cluster{
+				Name:                 "backend-cluster-bookstore.endpoints.project123.cloud.goog_local",
+				LbPolicy:             clusterpb.Cluster_RING_HASH,
+				ConnectTimeout:       ptypes.DurationProto(20 * time.Second),
+				ClusterDiscoveryType: &clusterpb.Cluster_Type{Type: clusterpb.Cluster_STRICT_DNS},
+				LoadAssignment: util.CreateWeightedLoadAssignment("backend-cluster-bookstore.endpoints.project123.cloud.goog_local",
+					[]*util.WeightedEndpoint{
+						{
+							Hostname: "127.0.0.1",
+							Port:     8081,
+						},
+						{
+							Hostname: "127.0.0.1",
+							Port:     8082,
+						},
+					}),
+			},
+		},
+	}
+
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+			},
+		},
+	}
+
+	for _, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		if tc.optsMergeFunc != nil {
+			tc.optsMergeFunc(&opts)
+		}
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatalf("Test Desc(%s): %v", tc.desc, err)
+		}
+
+		cluster, err := makeLocalBackendCluster(fakeServiceInfo)
+		if err != nil {
+			t.Fatalf("Test Desc(%s): %v", tc.desc, err)
+		}
+
+		if !proto.Equal(cluster, tc.wantCluster) {
+			t.Errorf("Test Desc(%s): makeLocalBackendCluster\ngot: %v,\nwant: %v", tc.desc, cluster, tc.wantCluster)
+		}
+	}
+}
+
+func TestMakeBackendClusterTrafficPolicy(t *testing.T) {
+	maxRequests := uint32(100)
+	maxRetries := uint32(0)
+
+	testData := []struct {
+		desc                  string
+		brc                   *configinfo.BackendRoutingCluster
+		wantCircuitBreakers   *clusterpb.CircuitBreakers
+		wantOutlierDetections *clusterpb.OutlierDetection
+	}{
+		{
+			desc: "No traffic policy keeps the Envoy defaults",
+			brc: &configinfo.BackendRoutingCluster{
+				ClusterName: "backend-cluster-mybackend.com:443",
+				Hostname:    "mybackend.com",
+				Port:        443,
+			},
+		},
+		{
+			desc: "Circuit breakers and outlier detection are set",
+			brc: &configinfo.BackendRoutingCluster{
+				ClusterName: "backend-cluster-mybackend.com:443",
+				Hostname:    "mybackend.com",
+				Port:        443,
+				CircuitBreakers: &configinfo.CircuitBreakers{
+					MaxRequests: &maxRequests,
+					MaxRetries:  &maxRetries,
+				},
+				OutlierDetection: &configinfo.OutlierDetection{
+					Consecutive5xx:     5,
+					Interval:           10 * time.Second,
+					BaseEjectionTime:   30 * time.Second,
+					MaxEjectionPercent: 50,
+				},
+			},
+			wantCircuitBreakers: &clusterpb.CircuitBreakers{
+				Thresholds: []*clusterpb.CircuitBreakers_Thresholds{
+					{
+						Priority:       corepb.RoutingPriority_DEFAULT,
+						MaxRequests:    &wrapperspb.UInt32Value{Value: 100},
+						MaxRetries:     &wrapperspb.UInt32Value{Value: 0},
+						TrackRemaining: true,
+					},
+				},
+			},
+			wantOutlierDetections: &clusterpb.OutlierDetection{
+				Consecutive_5Xx:    &wrapperspb.UInt32Value{Value: 5},
+				Interval:           ptypes.DurationProto(10 * time.Second),
+				BaseEjectionTime:   ptypes.DurationProto(30 * time.Second),
+				MaxEjectionPercent: &wrapperspb.UInt32Value{Value: 50},
+			},
+		},
+	}
+
+	for _, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		cluster, err := makeBackendCluster(&opts, tc.brc)
+		if err != nil {
+			t.Fatalf("Test Desc(%s): %v", tc.desc, err)
+		}
+
+		if !proto.Equal(cluster.CircuitBreakers, tc.wantCircuitBreakers) {
+			t.Errorf("Test Desc(%s): makeBackendCluster circuit breakers\ngot: %v,\nwant: %v", tc.desc, cluster.CircuitBreakers, tc.wantCircuitBreakers)
+		}
+		if !proto.Equal(cluster.OutlierDetection, tc.wantOutlierDetections) {
+			t.Errorf("Test Desc(%s): makeBackendCluster outlier detection\ngot: %v,\nwant: %v", tc.desc, cluster.OutlierDetection, tc.wantOutlierDetections)
+		}
+	}
+}
+
+func TestMakeBackendClusterHealthCheck(t *testing.T) {
+	testData := []struct {
+		desc            string
+		brc             *configinfo.BackendRoutingCluster
+		wantHealthCheck []*corepb.HealthCheck
+	}{
+		{
+			desc: "No health check",
+			brc: &configinfo.BackendRoutingCluster{
+				ClusterName: "backend-cluster-mybackend.com:443",
+				Hostname:    "mybackend.com",
+				Port:        443,
+				Protocol:    util.HTTP1,
+			},
+		},
+		{
+			desc: "HTTP health check for HTTP/1 backend",
+			brc: &configinfo.BackendRoutingCluster{
+				ClusterName: "backend-cluster-mybackend.com:443",
+				Hostname:    "mybackend.com",
+				Port:        443,
+				Protocol:    util.HTTP1,
+				HealthCheck: &configinfo.HealthCheck{
+					Type:               "http",
+					Path:               "/ready",
+					Interval:           10 * time.Second,
+					Timeout:            5 * time.Second,
+					HealthyThreshold:   2,
+					UnhealthyThreshold: 3,
+				},
+			},
+			wantHealthCheck: []*corepb.HealthCheck{
+				{
+					Interval:           ptypes.DurationProto(10 * time.Second),
+					Timeout:            ptypes.DurationProto(5 * time.Second),
+					HealthyThreshold:   &wrapperspb.UInt32Value{Value: 2},
+					UnhealthyThreshold: &wrapperspb.UInt32Value{Value: 3},
+					HealthChecker: &corepb.HealthCheck_HttpHealthCheck_{
+						HttpHealthCheck: &corepb.HealthCheck_HttpHealthCheck{
+							Host: "mybackend.com",
+							Path: "/ready",
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "HTTP health check for HTTP/2 backend",
+			brc: &configinfo.BackendRoutingCluster{
+				ClusterName: "backend-cluster-mybackend.com:443",
+				Hostname:    "mybackend.com",
+				Port:        443,
+				Protocol:    util.HTTP2,
+				HealthCheck: &configinfo.HealthCheck{
+					Type:               "http",
+					Path:               "/",
+					Interval:           10 * time.Second,
+					Timeout:            5 * time.Second,
+					HealthyThreshold:   2,
+					UnhealthyThreshold: 3,
+				},
+			},
+			wantHealthCheck: []*corepb.HealthCheck{
+				{
+					Interval:           ptypes.DurationProto(10 * time.Second),
+					Timeout:            ptypes.DurationProto(5 * time.Second),
+					HealthyThreshold:   &wrapperspb.UInt32Value{Value: 2},
+					UnhealthyThreshold: &wrapperspb.UInt32Value{Value: 3},
+					HealthChecker: &corepb.HealthCheck_HttpHealthCheck_{
+						HttpHealthCheck: &corepb.HealthCheck_HttpHealthCheck{
+							Host:            "mybackend.com",
+							Path:            "/",
+							CodecClientType: typepb.CodecClientType_HTTP2,
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "gRPC health check",
+			brc: &configinfo.BackendRoutingCluster{
+				ClusterName: "backend-cluster-mybackend.com:443",
+				Hostname:    "mybackend.com",
+				Port:        443,
+				Protocol:    util.GRPC,
+				HealthCheck: &configinfo.HealthCheck{
+					Type:               "grpc",
+					GrpcServiceName:    "foo.Bar",
+					Interval:           time.Second,
+					Timeout:            time.Second,
+					HealthyThreshold:   1,
+					UnhealthyThreshold: 1,
+				},
+			},
+			wantHealthCheck: []*corepb.HealthCheck{
+				{
+					Interval:           ptypes.DurationProto(time.Second),
+					Timeout:            ptypes.DurationProto(time.Second),
+					HealthyThreshold:   &wrapperspb.UInt32Value{Value: 1},
+					UnhealthyThreshold: &wrapperspb.UInt32Value{Value: 1},
+					HealthChecker: &corepb.HealthCheck_GrpcHealthCheck_{
+						GrpcHealthCheck: &corepb.HealthCheck_GrpcHealthCheck{
+							ServiceName: "foo.Bar",
+							Authority:   "mybackend.com",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		cluster, err := makeBackendCluster(&opts, tc.brc)
+		if err != nil {
+			t.Fatalf("Test Desc(%s): %v", tc.desc, err)
+		}
+
+		if !cmp.Equal(cluster.HealthChecks, tc.wantHealthCheck, cmp.Comparer(proto.Equal)) {
+			t.Errorf("Test Desc(%s): makeBackendCluster health checks\ngot: %v,\nwant: %v", tc.desc, cluster.HealthChecks, tc.wantHealthCheck)
+		}
+	}
+}
+
 func TestMakeJwtProviderClusters(t *testing.T) {
 	testData := []struct {
 		desc            string
 		fakeProviders   []*confpb.AuthProvider
+		jwtLocalJwks    string
 		backendProtocol string
 		wantedClusters  []*clusterpb.Cluster
 		wantedError     string
@@ -591,12 +1074,12 @@ func TestMakeJwtProviderClusters(t *testing.T) {
 			desc: "Use https jwksUri and http jwksUri",
 			fakeProviders: []*confpb.AuthProvider{
 				&confpb.AuthProvider{
-					Id:      "auth_provider",
+					Id:      "auth_provider_0",
 					Issuer:  "issuer_0",
 					JwksUri: "https://metadata.com/pkey",
 				},
 				&confpb.AuthProvider{
-					Id:      "auth_provider",
+					Id:      "auth_provider_1",
 					Issuer:  "issuer_1",
 					JwksUri: "http://metadata.com/pkey",
 				},
@@ -623,7 +1106,7 @@ func TestMakeJwtProviderClusters(t *testing.T) {
 			desc: "Failed with wrong-format jwksUri",
 			fakeProviders: []*confpb.AuthProvider{
 				&confpb.AuthProvider{
-					Id:      "auth_provider",
+					Id:      "auth_provider_2",
 					Issuer:  "issuer_2",
 					JwksUri: "%",
 				}},
@@ -633,12 +1116,12 @@ func TestMakeJwtProviderClusters(t *testing.T) {
 			desc: "Deduplicate Auth Provider With Same Host",
 			fakeProviders: []*confpb.AuthProvider{
 				&confpb.AuthProvider{
-					Id:      "auth_provider",
+					Id:      "auth_provider_0",
 					Issuer:  "issuer_0",
 					JwksUri: "https://metadata.com/pkey",
 				},
 				&confpb.AuthProvider{
-					Id:      "auth_provider",
+					Id:      "auth_provider_1",
 					Issuer:  "issuer_1",
 					JwksUri: "https://metadata.com/pkey",
 				},
@@ -654,6 +1137,31 @@ func TestMakeJwtProviderClusters(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc: "No cluster for provider with local JWKS",
+			fakeProviders: []*confpb.AuthProvider{
+				&confpb.AuthProvider{
+					Id:      "auth_provider_0",
+					Issuer:  "issuer_0",
+					JwksUri: "https://metadata.com/pkey",
+				},
+				&confpb.AuthProvider{
+					Id:     "auth_provider_1",
+					Issuer: "issuer_1",
+				},
+			},
+			jwtLocalJwks: `{"auth_provider_1": {"keys": [{"kty": "RSA"}]}}`,
+			wantedClusters: []*clusterpb.Cluster{
+				{
+					Name:                 "jwt-provider-cluster-metadata.com:443",
+					ConnectTimeout:       ptypes.DurationProto(20 * time.Second),
+					ClusterDiscoveryType: &clusterpb.Cluster_Type{clusterpb.Cluster_LOGICAL_DNS},
+					DnsLookupFamily:      clusterpb.Cluster_V4_ONLY,
+					LoadAssignment:       util.CreateLoadAssignment("metadata.com", 443),
+					TransportSocket:      createTransportSocket("metadata.com"),
+				},
+			},
+		},
 	}
 	for i, tc := range testData {
 		fakeServiceConfig := &confpb.Service{
@@ -669,6 +1177,7 @@ func TestMakeJwtProviderClusters(t *testing.T) {
 
 		opts := options.DefaultConfigGeneratorOptions()
 		opts.BackendAddress = "grpc://127.0.0.1:80"
+		opts.JwtLocalJwks = tc.jwtLocalJwks
 		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
 		if err != nil {
 			t.Fatal(err)
@@ -808,3 +1317,31 @@ func TestMakeTokenAgentCluster(t *testing.T) {
 		t.Errorf("Test makeTokenAgentClusters, \ngot: %v,\nwant: %v", cluster, wantCluster)
 	}
 }
+
+func TestMakeApiKeyServerCluster(t *testing.T) {
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.ApiKeysPath = "/etc/espv2/api_keys.json"
+	fakeServiceInfo, _ := configinfo.NewServiceInfoFromServiceConfig(&confpb.Service{
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+			},
+		},
+	}, testConfigID, opts)
+
+	cluster := makeApiKeyServerCluster(fakeServiceInfo)
+	wantCluster := &clusterpb.Cluster{
+		Name:           util.ApiKeyServerClusterName,
+		LbPolicy:       clusterpb.Cluster_ROUND_ROBIN,
+		ConnectTimeout: ptypes.DurationProto(fakeServiceInfo.Options.ClusterConnectTimeout),
+		ClusterDiscoveryType: &clusterpb.Cluster_Type{
+			Type: clusterpb.Cluster_STATIC,
+		},
+		LoadAssignment:       util.CreateLoadAssignment("127.0.0.1", uint32(fakeServiceInfo.Options.DiscoveryPort)),
+		Http2ProtocolOptions: &corepb.Http2ProtocolOptions{},
+	}
+
+	if !proto.Equal(cluster, wantCluster) {
+		t.Errorf("Test makeApiKeyServerCluster, \ngot: %v,\nwant: %v", cluster, wantCluster)
+	}
+}
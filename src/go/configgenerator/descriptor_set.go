@@ -0,0 +1,127 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configgenerator
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+
+	sc "github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	descpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	smpb "google.golang.org/genproto/googleapis/api/servicemanagement/v1"
+)
+
+// makeProtoDescriptorBin returns the proto descriptor set for the gRPC-JSON
+// transcoder, nil if there is none. The descriptor sets of the service config
+// are merged, a file in several of them must have the same descriptor. The
+// files of the local descriptor set are added, replacing the ones with the
+// same name.
+func makeProtoDescriptorBin(serviceInfo *sc.ServiceInfo) ([]byte, error) {
+	var configFiles []*smpb.ConfigFile
+	for _, sourceFile := range serviceInfo.ServiceConfig().GetSourceInfo().GetSourceFiles() {
+		configFile := &smpb.ConfigFile{}
+		ptypes.UnmarshalAny(sourceFile, configFile)
+
+		if configFile.GetFileType() == smpb.ConfigFile_FILE_DESCRIPTOR_SET_PROTO {
+			configFiles = append(configFiles, configFile)
+		}
+	}
+
+	localPath := serviceInfo.Options.TranscodingProtoDescriptorPath
+	if localPath == "" {
+		// Nothing to merge, the descriptor set is used as it is.
+		switch len(configFiles) {
+		case 0:
+			return nil, nil
+		case 1:
+			return configFiles[0].GetFileContents(), nil
+		}
+	}
+
+	var files []*descpb.FileDescriptorProto
+	fileIndexes := make(map[string]int)
+	for _, configFile := range configFiles {
+		descriptorSet := &descpb.FileDescriptorSet{}
+		if err := proto.Unmarshal(configFile.GetFileContents(), descriptorSet); err != nil {
+			return nil, fmt.Errorf("fail to unmarshal proto descriptor set %q: %v", configFile.GetFilePath(), err)
+		}
+
+		for _, file := range descriptorSet.GetFile() {
+			if i, ok := fileIndexes[file.GetName()]; ok {
+				if !proto.Equal(files[i], file) {
+					return nil, fmt.Errorf("proto descriptor set %q has a conflicting descriptor for file %q", configFile.GetFilePath(), file.GetName())
+				}
+				continue
+			}
+			fileIndexes[file.GetName()] = len(files)
+			files = append(files, file)
+		}
+	}
+
+	if localPath != "" {
+		content, err := ioutil.ReadFile(localPath)
+		if err != nil {
+			return nil, fmt.Errorf("fail to read proto descriptor set: %v", err)
+		}
+		descriptorSet := &descpb.FileDescriptorSet{}
+		if err := proto.Unmarshal(content, descriptorSet); err != nil {
+			return nil, fmt.Errorf("fail to unmarshal proto descriptor set %q: %v", localPath, err)
+		}
+
+		for _, file := range descriptorSet.GetFile() {
+			if i, ok := fileIndexes[file.GetName()]; ok {
+				files[i] = file
+				continue
+			}
+			fileIndexes[file.GetName()] = len(files)
+			files = append(files, file)
+		}
+	}
+
+	return proto.Marshal(&descpb.FileDescriptorSet{
+		File: sortFilesByDependencies(files, fileIndexes),
+	})
+}
+
+// sortFilesByDependencies orders the files so that each one follows its
+// dependencies, as the transcoder builds them in order. The files are
+// otherwise kept in their order.
+func sortFilesByDependencies(files []*descpb.FileDescriptorProto, fileIndexes map[string]int) []*descpb.FileDescriptorProto {
+	sorted := make([]*descpb.FileDescriptorProto, 0, len(files))
+	visited := make([]bool, len(files))
+
+	var visit func(i int)
+	visit = func(i int) {
+		if visited[i] {
+			return
+		}
+		visited[i] = true
+		for _, dependency := range files[i].GetDependency() {
+			// Dependencies missing from the set are left for the transcoder to report.
+			if j, ok := fileIndexes[dependency]; ok {
+				visit(j)
+			}
+		}
+		sorted = append(sorted, files[i])
+	}
+
+	for i := range files {
+		visit(i)
+	}
+	return sorted
+}
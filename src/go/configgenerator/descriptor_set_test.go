@@ -0,0 +1,232 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configgenerator
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/testutil"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+
+	descpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	anypb "github.com/golang/protobuf/ptypes/any"
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	smpb "google.golang.org/genproto/googleapis/api/servicemanagement/v1"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func fakeFileDescriptor(name, message string, dependencies ...string) *descpb.FileDescriptorProto {
+	return &descpb.FileDescriptorProto{
+		Name:       proto.String(name),
+		Package:    proto.String("endpoints.examples.bookstore"),
+		Dependency: dependencies,
+		MessageType: []*descpb.DescriptorProto{
+			{
+				Name: proto.String(message),
+			},
+		},
+	}
+}
+
+func marshalDescriptorSet(t *testing.T, files ...*descpb.FileDescriptorProto) []byte {
+	content, err := proto.Marshal(&descpb.FileDescriptorSet{File: files})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func TestMakeProtoDescriptorBin(t *testing.T) {
+	shelf := fakeFileDescriptor("shelf.proto", "Shelf")
+	book := fakeFileDescriptor("book.proto", "Book", "shelf.proto")
+	bookstore := fakeFileDescriptor("bookstore.proto", "ListShelvesRequest", "shelf.proto", "book.proto")
+	author := fakeFileDescriptor("author.proto", "Author")
+
+	testData := []struct {
+		desc string
+		// Contents of the descriptor set source files of the service config.
+		descriptorSets [][]byte
+		// Content of the local descriptor set, if any.
+		localDescriptorSet []byte
+		localPath          string
+		wantDescriptorBin  []byte
+		wantFiles          []*descpb.FileDescriptorProto
+		wantError          string
+	}{
+		{
+			desc: "No descriptor set",
+		},
+		{
+			desc:              "Single descriptor set is used as it is",
+			descriptorSets:    [][]byte{[]byte("rawDescriptor")},
+			wantDescriptorBin: []byte("rawDescriptor"),
+		},
+		{
+			desc: "Descriptor sets are merged, identical files are de-duplicated",
+			descriptorSets: [][]byte{
+				marshalDescriptorSet(t, shelf, book),
+				marshalDescriptorSet(t, shelf, bookstore),
+			},
+			wantFiles: []*descpb.FileDescriptorProto{shelf, book, bookstore},
+		},
+		{
+			desc: "Conflicting descriptors of the same file",
+			descriptorSets: [][]byte{
+				marshalDescriptorSet(t, shelf, book),
+				marshalDescriptorSet(t, fakeFileDescriptor("book.proto", "Novel")),
+			},
+			wantError: `proto descriptor set "descriptor_1.pb" has a conflicting descriptor for file "book.proto"`,
+		},
+		{
+			desc: "Malformed descriptor set",
+			descriptorSets: [][]byte{
+				marshalDescriptorSet(t, shelf),
+				[]byte("rawDescriptor"),
+			},
+			wantError: `fail to unmarshal proto descriptor set "descriptor_1.pb"`,
+		},
+		{
+			desc:               "Local descriptor set supplements the service config",
+			descriptorSets:     [][]byte{marshalDescriptorSet(t, shelf, book)},
+			localDescriptorSet: marshalDescriptorSet(t, bookstore),
+			wantFiles:          []*descpb.FileDescriptorProto{shelf, book, bookstore},
+		},
+		{
+			desc:               "Local descriptor set without descriptor in the service config",
+			localDescriptorSet: marshalDescriptorSet(t, shelf),
+			wantFiles:          []*descpb.FileDescriptorProto{shelf},
+		},
+		{
+			desc:           "Local descriptor set overrides files, which are ordered after their dependencies",
+			descriptorSets: [][]byte{marshalDescriptorSet(t, shelf, book)},
+			localDescriptorSet: marshalDescriptorSet(t,
+				fakeFileDescriptor("shelf.proto", "Shelf", "author.proto"),
+				author),
+			wantFiles: []*descpb.FileDescriptorProto{
+				author,
+				fakeFileDescriptor("shelf.proto", "Shelf", "author.proto"),
+				book,
+			},
+		},
+		{
+			desc:           "Missing local descriptor set",
+			descriptorSets: [][]byte{marshalDescriptorSet(t, shelf)},
+			localPath:      "/non/existing/descriptor.pb",
+			wantError:      "fail to read proto descriptor set",
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			fakeServiceConfig := &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+					},
+				},
+				SourceInfo: &confpb.SourceInfo{},
+			}
+			for i, content := range tc.descriptorSets {
+				sourceFile, _ := ptypes.MarshalAny(&smpb.ConfigFile{
+					FilePath:     fmt.Sprintf("descriptor_%d.pb", i),
+					FileContents: content,
+					FileType:     smpb.ConfigFile_FILE_DESCRIPTOR_SET_PROTO,
+				})
+				fakeServiceConfig.SourceInfo.SourceFiles = append(fakeServiceConfig.SourceInfo.SourceFiles, sourceFile)
+			}
+			// Source files of other types are ignored.
+			otherFile, _ := ptypes.MarshalAny(&smpb.ConfigFile{
+				FilePath:     "bookstore.yaml",
+				FileContents: []byte("type: google.api.Service"),
+				FileType:     smpb.ConfigFile_SERVICE_CONFIG_YAML,
+			})
+			fakeServiceConfig.SourceInfo.SourceFiles = append([]*anypb.Any{otherFile}, fakeServiceConfig.SourceInfo.SourceFiles...)
+
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.BackendAddress = "grpc://127.0.0.0:80"
+			opts.TranscodingProtoDescriptorPath = tc.localPath
+			if tc.localDescriptorSet != nil {
+				path, removeFile := testutil.WriteTempFile(t, "descriptor_set", string(tc.localDescriptorSet))
+				defer removeFile()
+				opts.TranscodingProtoDescriptorPath = path
+			}
+
+			fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gotDescriptorBin, err := makeProtoDescriptorBin(fakeServiceInfo)
+			if err != nil {
+				if tc.wantError == "" || !strings.Contains(err.Error(), tc.wantError) {
+					t.Fatalf("got error: %v, want error: %v", err, tc.wantError)
+				}
+				return
+			}
+			if tc.wantError != "" {
+				t.Fatalf("got no error, want error: %v", tc.wantError)
+			}
+
+			if tc.wantFiles == nil {
+				if !bytes.Equal(gotDescriptorBin, tc.wantDescriptorBin) {
+					t.Errorf("got descriptor: %q, want descriptor: %q", gotDescriptorBin, tc.wantDescriptorBin)
+				}
+				return
+			}
+
+			gotDescriptorSet := &descpb.FileDescriptorSet{}
+			if err := proto.Unmarshal(gotDescriptorBin, gotDescriptorSet); err != nil {
+				t.Fatal(err)
+			}
+			if !proto.Equal(gotDescriptorSet, &descpb.FileDescriptorSet{File: tc.wantFiles}) {
+				var gotNames []string
+				for _, file := range gotDescriptorSet.GetFile() {
+					gotNames = append(gotNames, file.GetName())
+				}
+				t.Errorf("got descriptor files: %v, want descriptor files: %v", gotNames, tc.wantFiles)
+			}
+		})
+	}
+}
+
+func TestSortFilesByDependencies(t *testing.T) {
+	files := []*descpb.FileDescriptorProto{
+		fakeFileDescriptor("bookstore.proto", "ListShelvesRequest", "book.proto", "google/api/annotations.proto"),
+		fakeFileDescriptor("book.proto", "Book", "shelf.proto"),
+		fakeFileDescriptor("author.proto", "Author"),
+		fakeFileDescriptor("shelf.proto", "Shelf"),
+	}
+	fileIndexes := make(map[string]int)
+	for i, file := range files {
+		fileIndexes[file.GetName()] = i
+	}
+
+	var gotNames []string
+	for _, file := range sortFilesByDependencies(files, fileIndexes) {
+		gotNames = append(gotNames, file.GetName())
+	}
+	wantNames := []string{"shelf.proto", "book.proto", "bookstore.proto", "author.proto"}
+	if !reflect.DeepEqual(gotNames, wantNames) {
+		t.Errorf("got files: %v, want files: %v", gotNames, wantNames)
+	}
+}
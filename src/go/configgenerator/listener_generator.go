@@ -15,6 +15,7 @@
 package configgenerator
 
 import (
+	"encoding/json"
 	"fmt"
 	"sort"
 	"strings"
@@ -37,16 +38,20 @@ import (
 	listenerpb "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
 	routepb "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
 	facpb "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/file/v3"
+	alspb "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/grpc/v3"
+	extauthzpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_authz/v3"
 	transcoderpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/grpc_json_transcoder/v3"
 	hcpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/health_check/v3"
 	jwtpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/jwt_authn/v3"
+	rbacpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/rbac/v3"
 	routerpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/router/v3"
 	hcmpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	typepb "github.com/envoyproxy/go-control-plane/envoy/type/v3"
 	durationpb "github.com/golang/protobuf/ptypes/duration"
+	emptypb "github.com/golang/protobuf/ptypes/empty"
 	structpb "github.com/golang/protobuf/ptypes/struct"
 	wrapperspb "github.com/golang/protobuf/ptypes/wrappers"
 	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
-	smpb "google.golang.org/genproto/googleapis/api/servicemanagement/v1"
 )
 
 const (
@@ -66,7 +71,7 @@ func MakeListeners(serviceInfo *sc.ServiceInfo) ([]*listenerpb.Listener, error)
 func makeListener(serviceInfo *sc.ServiceInfo) (*listenerpb.Listener, error) {
 	httpFilters := []*hcmpb.HttpFilter{}
 
-	if serviceInfo.Options.CorsPreset == "basic" || serviceInfo.Options.CorsPreset == "cors_with_regex" {
+	if serviceInfo.Options.CorsPreset == "basic" || serviceInfo.Options.CorsPreset == "cors_with_regex" || serviceInfo.Options.CorsPolicyPath != "" {
 		corsFilter := &hcmpb.HttpFilter{
 			Name: util.CORS,
 		}
@@ -107,9 +112,24 @@ func makeListener(serviceInfo *sc.ServiceInfo) (*listenerpb.Listener, error) {
 			httpFilters = append(httpFilters, jwtAuthnFilter)
 			jsonStr, _ := util.ProtoToJson(jwtAuthnFilter)
 			glog.Infof("adding JWT Authn Filter config: %v", jsonStr)
+
+			// Add RBAC filter if needed. It must be behind JWT Authn filter, the JWT
+			// claims policies of the routes match on the JWT payload in the metadata.
+			if rbacFilter := makeRbacFilter(serviceInfo); rbacFilter != nil {
+				httpFilters = append(httpFilters, rbacFilter)
+				jsonStr, _ := util.ProtoToJson(rbacFilter)
+				glog.Infof("adding RBAC Filter config: %v", jsonStr)
+			}
 		}
 	}
 
+	// Add the API key filter if needed, checking the API keys locally.
+	if apiKeyFilter := makeApiKeyFilter(serviceInfo); apiKeyFilter != nil {
+		httpFilters = append(httpFilters, apiKeyFilter)
+		jsonStr, _ := util.ProtoToJson(apiKeyFilter)
+		glog.Infof("adding API Key Filter config: %v", jsonStr)
+	}
+
 	// Add Service Control filter if needed.
 	if !serviceInfo.Options.SkipServiceControlFilter {
 		serviceControlFilter := makeServiceControlFilter(serviceInfo)
@@ -132,8 +152,11 @@ func makeListener(serviceInfo *sc.ServiceInfo) (*listenerpb.Listener, error) {
 		}
 		httpFilters = append(httpFilters, grpcWebFilter)
 
-		transcoderFilter := makeTranscoderFilter(serviceInfo)
-		if transcoderFilter != nil {
+		transcoderFilters, err := makeTranscoderFilters(serviceInfo)
+		if err != nil {
+			return nil, err
+		}
+		for _, transcoderFilter := range transcoderFilters {
 			httpFilters = append(httpFilters, transcoderFilter)
 			jsonStr, _ := util.ProtoToJson(transcoderFilter)
 			glog.Infof("adding Transcoder Filter config: %v", jsonStr)
@@ -275,11 +298,59 @@ func makeHttpConMgr(opts *options.ConfigGeneratorOptions, route *routepb.RouteCo
 		},
 	}
 
+	accessLogs, err := makeAccessLogs(opts)
+	if err != nil {
+		return nil, err
+	}
+	httpConMgr.AccessLog = accessLogs
+
+	if !opts.DisableTracing {
+		httpConMgr.Tracing, err = tracing.CreateTracing(opts.CommonOptions, opts.SslSidestreamClientRootCertsPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.UnderscoresInHeaders {
+		httpConMgr.CommonHttpProtocolOptions = &corepb.HttpProtocolOptions{
+			HeadersWithUnderscoresAction: corepb.HttpProtocolOptions_ALLOW,
+		}
+	} else {
+		httpConMgr.CommonHttpProtocolOptions = &corepb.HttpProtocolOptions{
+			HeadersWithUnderscoresAction: corepb.HttpProtocolOptions_REJECT_REQUEST,
+		}
+	}
+
+	if opts.EnableGrpcForHttp1 {
+		// Retain gRPC trailers if downstream is using http1.
+		httpConMgr.HttpProtocolOptions = &corepb.Http1ProtocolOptions{
+			EnableTrailers: true,
+		}
+	}
+
+	return httpConMgr, nil
+}
+
+// makeAccessLogs creates the file and gRPC access log service sinks, sharing the same filter.
+func makeAccessLogs(opts *options.ConfigGeneratorOptions) ([]*acpb.AccessLog, error) {
+	if opts.AccessLog == "" && opts.AccessLogGrpcServiceAddress == "" {
+		return nil, nil
+	}
+
+	filter, err := makeAccessLogFilter(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var accessLogs []*acpb.AccessLog
 	if opts.AccessLog != "" {
 		fileAccessLog := &facpb.FileAccessLog{
-			Path: opts.AccessLog,
+			Path: accessLogPath(opts.AccessLog),
 		}
 
+		if opts.AccessLogFormat != "" && opts.AccessLogJsonFormat != "" {
+			return nil, fmt.Errorf("only one of access_log_format and access_log_json_format can be set")
+		}
 		if opts.AccessLogFormat != "" {
 			fileAccessLog.AccessLogFormat = &facpb.FileAccessLog_LogFormat{
 				LogFormat: &corepb.SubstitutionFormatString{
@@ -289,46 +360,157 @@ func makeHttpConMgr(opts *options.ConfigGeneratorOptions, route *routepb.RouteCo
 				},
 			}
 		}
+		if opts.AccessLogJsonFormat != "" {
+			jsonFormat, err := makeAccessLogJsonFormat(opts.AccessLogJsonFormat)
+			if err != nil {
+				return nil, err
+			}
+			fileAccessLog.AccessLogFormat = &facpb.FileAccessLog_LogFormat{
+				LogFormat: &corepb.SubstitutionFormatString{
+					Format: &corepb.SubstitutionFormatString_JsonFormat{
+						JsonFormat: jsonFormat,
+					},
+				},
+			}
+		}
 
 		serialized, _ := ptypes.MarshalAny(fileAccessLog)
+		accessLogs = append(accessLogs, &acpb.AccessLog{
+			Name:   util.AccessFileLogger,
+			Filter: filter,
+			ConfigType: &acpb.AccessLog_TypedConfig{
+				TypedConfig: serialized,
+			},
+		})
+	}
 
-		httpConMgr.AccessLog = []*acpb.AccessLog{
-			{
-				Name:   util.AccessFileLogger,
-				Filter: nil,
-				ConfigType: &acpb.AccessLog_TypedConfig{
-					TypedConfig: serialized,
+	if opts.AccessLogGrpcServiceAddress != "" {
+		grpcAccessLog := &alspb.HttpGrpcAccessLogConfig{
+			CommonConfig: &alspb.CommonGrpcAccessLogConfig{
+				LogName: util.AccessLogName,
+				GrpcService: &corepb.GrpcService{
+					TargetSpecifier: &corepb.GrpcService_EnvoyGrpc_{
+						EnvoyGrpc: &corepb.GrpcService_EnvoyGrpc{
+							ClusterName: util.AccessLogServiceClusterName,
+						},
+					},
 				},
 			},
 		}
+
+		serialized, _ := ptypes.MarshalAny(grpcAccessLog)
+		accessLogs = append(accessLogs, &acpb.AccessLog{
+			Name:   util.AccessHttpGrpcLogger,
+			Filter: filter,
+			ConfigType: &acpb.AccessLog_TypedConfig{
+				TypedConfig: serialized,
+			},
+		})
 	}
+	return accessLogs, nil
+}
 
-	if !opts.DisableTracing {
-		var err error
-		httpConMgr.Tracing, err = tracing.CreateTracing(opts.CommonOptions)
-		if err != nil {
-			return nil, err
-		}
+func accessLogPath(path string) string {
+	switch path {
+	case "stdout":
+		return "/dev/stdout"
+	case "stderr":
+		return "/dev/stderr"
 	}
+	return path
+}
 
-	if opts.UnderscoresInHeaders {
-		httpConMgr.CommonHttpProtocolOptions = &corepb.HttpProtocolOptions{
-			HeadersWithUnderscoresAction: corepb.HttpProtocolOptions_ALLOW,
-		}
-	} else {
-		httpConMgr.CommonHttpProtocolOptions = &corepb.HttpProtocolOptions{
-			HeadersWithUnderscoresAction: corepb.HttpProtocolOptions_REJECT_REQUEST,
-		}
+// makeAccessLogJsonFormat parses a JSON object of log keys to command operators.
+func makeAccessLogJsonFormat(format string) (*structpb.Struct, error) {
+	var operators map[string]string
+	if err := json.Unmarshal([]byte(format), &operators); err != nil {
+		return nil, fmt.Errorf("access_log_json_format must be a JSON object of strings: %v", err)
+	}
+	if len(operators) == 0 {
+		return nil, fmt.Errorf("access_log_json_format must have at least one key")
 	}
 
-	if opts.EnableGrpcForHttp1 {
-		// Retain gRPC trailers if downstream is using http1.
-		httpConMgr.HttpProtocolOptions = &corepb.Http1ProtocolOptions{
-			EnableTrailers: true,
+	jsonFormat := &structpb.Struct{
+		Fields: make(map[string]*structpb.Value),
+	}
+	for key, operator := range operators {
+		jsonFormat.Fields[key] = &structpb.Value{
+			Kind: &structpb.Value_StringValue{StringValue: operator},
 		}
 	}
+	return jsonFormat, nil
+}
 
-	return httpConMgr, nil
+func makeAccessLogFilter(opts *options.ConfigGeneratorOptions) (*acpb.AccessLogFilter, error) {
+	var filters []*acpb.AccessLogFilter
+
+	if opts.AccessLogMinStatusCode < 0 || opts.AccessLogMaxStatusCode < 0 {
+		return nil, fmt.Errorf("access_log_min_status_code and access_log_max_status_code cannot be negative")
+	}
+	if opts.AccessLogMaxStatusCode != 0 && opts.AccessLogMinStatusCode > opts.AccessLogMaxStatusCode {
+		return nil, fmt.Errorf("access_log_min_status_code %v is greater than access_log_max_status_code %v", opts.AccessLogMinStatusCode, opts.AccessLogMaxStatusCode)
+	}
+	if opts.AccessLogMinStatusCode != 0 {
+		filters = append(filters, makeStatusCodeFilter(acpb.ComparisonFilter_GE, opts.AccessLogMinStatusCode, util.AccessLogMinStatusCodeRuntimeKey))
+	}
+	if opts.AccessLogMaxStatusCode != 0 {
+		filters = append(filters, makeStatusCodeFilter(acpb.ComparisonFilter_LE, opts.AccessLogMaxStatusCode, util.AccessLogMaxStatusCodeRuntimeKey))
+	}
+
+	if opts.AccessLogSamplePercent < 0 || opts.AccessLogSamplePercent > 100 {
+		return nil, fmt.Errorf("access_log_sample_percent must be between 0 and 100, got %v", opts.AccessLogSamplePercent)
+	}
+	if opts.AccessLogSamplePercent < 100 {
+		filters = append(filters, &acpb.AccessLogFilter{
+			FilterSpecifier: &acpb.AccessLogFilter_RuntimeFilter{
+				RuntimeFilter: &acpb.RuntimeFilter{
+					RuntimeKey: util.AccessLogSampleRuntimeKey,
+					PercentSampled: &typepb.FractionalPercent{
+						Numerator:   uint32(opts.AccessLogSamplePercent),
+						Denominator: typepb.FractionalPercent_HUNDRED,
+					},
+				},
+			},
+		})
+	}
+
+	if opts.AccessLogExcludeHealthz {
+		filters = append(filters, &acpb.AccessLogFilter{
+			FilterSpecifier: &acpb.AccessLogFilter_NotHealthCheckFilter{
+				NotHealthCheckFilter: &acpb.NotHealthCheckFilter{},
+			},
+		})
+	}
+
+	switch len(filters) {
+	case 0:
+		return nil, nil
+	case 1:
+		return filters[0], nil
+	}
+	return &acpb.AccessLogFilter{
+		FilterSpecifier: &acpb.AccessLogFilter_AndFilter{
+			AndFilter: &acpb.AndFilter{
+				Filters: filters,
+			},
+		},
+	}, nil
+}
+
+func makeStatusCodeFilter(op acpb.ComparisonFilter_Op, statusCode int, runtimeKey string) *acpb.AccessLogFilter {
+	return &acpb.AccessLogFilter{
+		FilterSpecifier: &acpb.AccessLogFilter_StatusCodeFilter{
+			StatusCodeFilter: &acpb.StatusCodeFilter{
+				Comparison: &acpb.ComparisonFilter{
+					Op: op,
+					Value: &corepb.RuntimeUInt32{
+						DefaultValue: uint32(statusCode),
+						RuntimeKey:   runtimeKey,
+					},
+				},
+			},
+		},
+	}
 }
 
 func makePathMatcherFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
@@ -416,21 +598,37 @@ func makeJwtAuthnFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
 	}
 	providers := make(map[string]*jwtpb.JwtProvider)
 	for _, provider := range auth.GetProviders() {
-		addr, err := util.ExtraAddressFromURI(provider.GetJwksUri())
-		if err != nil {
-			return nil
-		}
-		clusterName := util.JwtProviderClusterName(addr)
 		fromHeaders, fromParams := processJwtLocations(provider)
 
 		jp := &jwtpb.JwtProvider{
-			Issuer: provider.GetIssuer(),
-			JwksSourceSpecifier: &jwtpb.JwtProvider_RemoteJwks{
+			Issuer:               provider.GetIssuer(),
+			FromHeaders:          fromHeaders,
+			FromParams:           fromParams,
+			ForwardPayloadHeader: serviceInfo.Options.GeneratedHeaderPrefix + util.JwtAuthnForwardPayloadHeaderSuffix,
+			Forward:              true,
+		}
+
+		if jwks, ok := serviceInfo.LocalJwks[provider.GetId()]; ok {
+			// The JWKS is inlined so the config manager can push the changes of the file.
+			jp.JwksSourceSpecifier = &jwtpb.JwtProvider_LocalJwks{
+				LocalJwks: &corepb.DataSource{
+					Specifier: &corepb.DataSource_InlineString{
+						InlineString: jwks,
+					},
+				},
+			}
+		} else {
+			jwksUri := serviceInfo.JwksUris[provider.GetId()]
+			addr, err := util.ExtraAddressFromURI(jwksUri)
+			if err != nil {
+				return nil
+			}
+			jp.JwksSourceSpecifier = &jwtpb.JwtProvider_RemoteJwks{
 				RemoteJwks: &jwtpb.RemoteJwks{
 					HttpUri: &corepb.HttpUri{
-						Uri: provider.GetJwksUri(),
+						Uri: jwksUri,
 						HttpUpstreamType: &corepb.HttpUri_Cluster{
-							Cluster: clusterName,
+							Cluster: util.JwtProviderClusterName(addr),
 						},
 						Timeout: ptypes.DurationProto(serviceInfo.Options.HttpRequestTimeout),
 					},
@@ -438,11 +636,7 @@ func makeJwtAuthnFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
 						Seconds: int64(serviceInfo.Options.JwksCacheDurationInS),
 					},
 				},
-			},
-			FromHeaders:          fromHeaders,
-			FromParams:           fromParams,
-			ForwardPayloadHeader: serviceInfo.Options.GeneratedHeaderPrefix + util.JwtAuthnForwardPayloadHeaderSuffix,
-			Forward:              true,
+			}
 		}
 
 		if len(provider.GetAudiences()) != 0 {
@@ -469,9 +663,9 @@ func makeJwtAuthnFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
 	}
 
 	requirements := make(map[string]*jwtpb.JwtRequirement)
-	for _, rule := range auth.GetRules() {
-		if len(rule.GetRequirements()) > 0 {
-			requirements[rule.GetSelector()] = makeJwtRequirement(rule.GetRequirements())
+	for operation, method := range serviceInfo.Methods {
+		if len(method.JwtRequirements) > 0 {
+			requirements[operation] = makeJwtRequirement(method.JwtRequirements, method.JwtRequirementMode)
 		}
 	}
 
@@ -491,22 +685,68 @@ func makeJwtAuthnFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
 	return jwtAuthnFilter
 }
 
-func makeJwtRequirement(requirements []*confpb.AuthRequirement) *jwtpb.JwtRequirement {
-	// By default, if there are multi requirements, treat it as RequireAny.
-	requires := &jwtpb.JwtRequirement{
-		RequiresType: &jwtpb.JwtRequirement_RequiresAny{
-			RequiresAny: &jwtpb.JwtRequirementOrList{},
+// makeRbacFilter allows all requests, the routes with JWT claims policies override it.
+func makeRbacFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
+	hasClaimsPolicy := false
+	for _, method := range serviceInfo.Methods {
+		if len(method.ClaimRequirements) > 0 {
+			hasClaimsPolicy = true
+			break
+		}
+	}
+	if !hasClaimsPolicy {
+		return nil
+	}
+
+	rbac, _ := ptypes.MarshalAny(&rbacpb.RBAC{})
+	return &hcmpb.HttpFilter{
+		Name:       util.RBAC,
+		ConfigType: &hcmpb.HttpFilter_TypedConfig{TypedConfig: rbac},
+	}
+}
+
+// makeApiKeyFilter checks the API keys with the local API key server. The
+// routes of the operations set the API key locations, or disable the check.
+func makeApiKeyFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
+	if serviceInfo.Options.ApiKeysPath == "" {
+		return nil
+	}
+
+	extAuthz := &extauthzpb.ExtAuthz{
+		Services: &extauthzpb.ExtAuthz_GrpcService{
+			GrpcService: &corepb.GrpcService{
+				TargetSpecifier: &corepb.GrpcService_EnvoyGrpc_{
+					EnvoyGrpc: &corepb.GrpcService_EnvoyGrpc{
+						ClusterName: util.ApiKeyServerClusterName,
+					},
+				},
+				Timeout: ptypes.DurationProto(serviceInfo.Options.HttpRequestTimeout),
+			},
+		},
+		StatusOnError: &typepb.HttpStatus{
+			Code: typepb.StatusCode_ServiceUnavailable,
 		},
 	}
 
+	eas, _ := ptypes.MarshalAny(extAuthz)
+	return &hcmpb.HttpFilter{
+		Name:       util.ExtAuthz,
+		ConfigType: &hcmpb.HttpFilter_TypedConfig{TypedConfig: eas},
+	}
+}
+
+// makeJwtRequirement combines the requirements by the mode of the operation.
+// The allow missing modes are requirements on their own, they are combined
+// with the providers in RequiresAny so present JWTs are still verified.
+func makeJwtRequirement(requirements []*confpb.AuthRequirement, mode sc.JwtRequirementMode) *jwtpb.JwtRequirement {
+	var requires []*jwtpb.JwtRequirement
 	for _, r := range requirements {
-		var require *jwtpb.JwtRequirement
 		if r.GetAudiences() == "" {
-			require = &jwtpb.JwtRequirement{
+			requires = append(requires, &jwtpb.JwtRequirement{
 				RequiresType: &jwtpb.JwtRequirement_ProviderName{
 					ProviderName: r.GetProviderId(),
 				},
-			}
+			})
 		} else {
 			// Note: Audiences in requirements is deprecated.
 			// But if it's specified, we should override the audiences for the provider.
@@ -514,23 +754,52 @@ func makeJwtRequirement(requirements []*confpb.AuthRequirement) *jwtpb.JwtRequir
 			for _, a := range strings.Split(r.GetAudiences(), ",") {
 				audiences = append(audiences, strings.TrimSpace(a))
 			}
-			require = &jwtpb.JwtRequirement{
+			requires = append(requires, &jwtpb.JwtRequirement{
 				RequiresType: &jwtpb.JwtRequirement_ProviderAndAudiences{
 					ProviderAndAudiences: &jwtpb.ProviderWithAudiences{
 						ProviderName: r.GetProviderId(),
 						Audiences:    audiences,
 					},
 				},
-			}
-		}
-		if len(requirements) == 1 {
-			requires = require
-		} else {
-			requires.GetRequiresAny().Requirements = append(requires.GetRequiresAny().GetRequirements(), require)
+			})
 		}
 	}
 
-	return requires
+	switch mode {
+	case sc.JwtRequirementAllowMissing:
+		requires = append(requires, &jwtpb.JwtRequirement{
+			RequiresType: &jwtpb.JwtRequirement_AllowMissing{
+				AllowMissing: &emptypb.Empty{},
+			},
+		})
+	case sc.JwtRequirementAllowMissingOrFailed:
+		requires = append(requires, &jwtpb.JwtRequirement{
+			RequiresType: &jwtpb.JwtRequirement_AllowMissingOrFailed{
+				AllowMissingOrFailed: &emptypb.Empty{},
+			},
+		})
+	}
+
+	if len(requires) == 1 {
+		return requires[0]
+	}
+	if mode == sc.JwtRequirementAll {
+		return &jwtpb.JwtRequirement{
+			RequiresType: &jwtpb.JwtRequirement_RequiresAll{
+				RequiresAll: &jwtpb.JwtRequirementAndList{
+					Requirements: requires,
+				},
+			},
+		}
+	}
+	// By default, if there are multi requirements, treat it as RequireAny.
+	return &jwtpb.JwtRequirement{
+		RequiresType: &jwtpb.JwtRequirement_RequiresAny{
+			RequiresAny: &jwtpb.JwtRequirementOrList{
+				Requirements: requires,
+			},
+		},
+	}
 }
 
 func makeServiceControlCallingConfig(opts options.ConfigGeneratorOptions) *scpb.ServiceControlCallingConfig {
@@ -560,7 +829,7 @@ func makeServiceControlCallingConfig(opts options.ConfigGeneratorOptions) *scpb.
 }
 
 func makeServiceControlFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
-	if serviceInfo == nil || serviceInfo.ServiceConfig().GetControl().GetEnvironment() == "" {
+	if serviceInfo == nil || (serviceInfo.ServiceConfig().GetControl().GetEnvironment() == "" && !serviceInfo.Options.LocalServiceControl) {
 		return nil
 	}
 
@@ -616,7 +885,16 @@ func makeServiceControlFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
 		GeneratedHeaderPrefix: serviceInfo.Options.GeneratedHeaderPrefix,
 	}
 
-	if serviceInfo.Options.ServiceControlCredentials != nil {
+	if serviceInfo.Options.LocalServiceControl {
+		// The local Service Control server serves a dummy access token.
+		filterConfig.AccessToken = &scpb.FilterConfig_ImdsToken{
+			ImdsToken: &commonpb.HttpUri{
+				Uri:     fmt.Sprintf("http://%s:%d%s", util.LoopbackIPv4Addr, serviceInfo.Options.LocalServiceControlPort, util.TokenAgentAccessTokenPath),
+				Cluster: util.ServiceControlClusterName,
+				Timeout: ptypes.DurationProto(serviceInfo.Options.HttpRequestTimeout),
+			},
+		}
+	} else if serviceInfo.Options.ServiceControlCredentials != nil {
 		// Use access token fetched from Google Cloud IAM Server to talk to Service Controller
 		filterConfig.AccessToken = &scpb.FilterConfig_IamToken{
 			IamToken: &commonpb.IamTokenInfo{
@@ -659,8 +937,9 @@ func makeServiceControlFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
 		}
 
 		// For these OPTIONS methods, auth should be disabled and AllowWithoutApiKey
-		// should be true for each CORS.
-		if method.IsGenerated || method.AllowUnregisteredCalls {
+		// should be true for each CORS. The API keys checked by the local API key
+		// server are not checked again by Service Control.
+		if method.IsGenerated || method.AllowUnregisteredCalls || serviceInfo.Options.ApiKeysPath != "" {
 			requirement.ApiKey = &scpb.ApiKeyRequirement{
 				AllowWithoutApiKey: true,
 			}
@@ -699,53 +978,78 @@ func copyServiceConfigForReportMetrics(src *confpb.Service) *confpb.Service {
 	}
 }
 
-func makeTranscoderFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
-	for _, sourceFile := range serviceInfo.ServiceConfig().GetSourceInfo().GetSourceFiles() {
-		configFile := &smpb.ConfigFile{}
-		ptypes.UnmarshalAny(sourceFile, configFile)
+// makeTranscoderFilters returns a transcoder filter per set of apis with the
+// same transcoding options. A filter only transcodes the methods of its apis,
+// the requests of the other apis pass through it.
+func makeTranscoderFilters(serviceInfo *sc.ServiceInfo) ([]*hcmpb.HttpFilter, error) {
+	protoDescriptorBin, err := makeProtoDescriptorBin(serviceInfo)
+	if err != nil {
+		return nil, err
+	}
+	if protoDescriptorBin == nil {
+		// b/148605552: Previous versions of the `gcloud_build_image` script did not download the proto descriptor.
+		// We cannot ensure that users have the latest version of the script, so notify them via non-fatal logs.
+		// Log as error instead of warning because error logs will show up even if `--enable_debug` is false.
+		glog.Error("Unable to setup gRPC-JSON transcoding because no proto descriptor was found in the service config. " +
+			"Please use version 2020-01-29 (or later) of the `gcloud_build_image` script, " +
+			"or set the proto descriptor with --transcoding_proto_descriptor_path. " +
+			"https://github.com/GoogleCloudPlatform/esp-v2/blob/master/docker/serverless/gcloud_build_image")
+		return nil, nil
+	}
 
-		if configFile.GetFileType() == smpb.ConfigFile_FILE_DESCRIPTOR_SET_PROTO {
-			ignoredQueryParameterList := []string{}
-			for IgnoredQueryParameter := range serviceInfo.AllTranscodingIgnoredQueryParams {
-				ignoredQueryParameterList = append(ignoredQueryParameterList, IgnoredQueryParameter)
+	ignoredQueryParameterList := []string{}
+	for IgnoredQueryParameter := range serviceInfo.AllTranscodingIgnoredQueryParams {
+		ignoredQueryParameterList = append(ignoredQueryParameterList, IgnoredQueryParameter)
 
-			}
-			sort.Sort(sort.StringSlice(ignoredQueryParameterList))
-
-			configContent := configFile.GetFileContents()
-			transcodeConfig := &transcoderpb.GrpcJsonTranscoder{
-				DescriptorSet: &transcoderpb.GrpcJsonTranscoder_ProtoDescriptorBin{
-					ProtoDescriptorBin: configContent,
-				},
-				AutoMapping:                  true,
-				ConvertGrpcStatus:            true,
-				IgnoredQueryParameters:       ignoredQueryParameterList,
-				IgnoreUnknownQueryParameters: serviceInfo.Options.TranscodingIgnoreUnknownQueryParameters,
-				PrintOptions: &transcoderpb.GrpcJsonTranscoder_PrintOptions{
-					AlwaysPrintPrimitiveFields: serviceInfo.Options.TranscodingAlwaysPrintPrimitiveFields,
-					AlwaysPrintEnumsAsInts:     serviceInfo.Options.TranscodingAlwaysPrintEnumsAsInts,
-					PreserveProtoFieldNames:    serviceInfo.Options.TranscodingPreserveProtoFieldNames,
-				},
-			}
+	}
+	sort.Sort(sort.StringSlice(ignoredQueryParameterList))
 
-			transcodeConfig.Services = append(transcodeConfig.Services, serviceInfo.ApiNames...)
+	// Group the apis by options, in the order of the apis.
+	var transcodeConfigs []*transcoderpb.GrpcJsonTranscoder
+	var transcodeOptions []sc.TranscodingOptions
+	for _, apiName := range serviceInfo.ApiNames {
+		apiOptions := *serviceInfo.ApiTranscodingOptions[apiName]
 
-			transcodeConfigStruct, _ := ptypes.MarshalAny(transcodeConfig)
-			transcodeFilter := &hcmpb.HttpFilter{
-				Name:       util.GRPCJSONTranscoder,
-				ConfigType: &hcmpb.HttpFilter_TypedConfig{transcodeConfigStruct},
+		found := false
+		for i := range transcodeOptions {
+			if transcodeOptions[i] == apiOptions {
+				transcodeConfigs[i].Services = append(transcodeConfigs[i].Services, apiName)
+				found = true
+				break
 			}
-			return transcodeFilter
 		}
+		if found {
+			continue
+		}
+
+		transcodeOptions = append(transcodeOptions, apiOptions)
+		transcodeConfigs = append(transcodeConfigs, &transcoderpb.GrpcJsonTranscoder{
+			DescriptorSet: &transcoderpb.GrpcJsonTranscoder_ProtoDescriptorBin{
+				ProtoDescriptorBin: protoDescriptorBin,
+			},
+			Services:                     []string{apiName},
+			AutoMapping:                  true,
+			ConvertGrpcStatus:            true,
+			IgnoredQueryParameters:       ignoredQueryParameterList,
+			IgnoreUnknownQueryParameters: apiOptions.IgnoreUnknownQueryParameters,
+			MatchIncomingRequestRoute:    apiOptions.MatchIncomingRequestRoute,
+			PrintOptions: &transcoderpb.GrpcJsonTranscoder_PrintOptions{
+				AlwaysPrintPrimitiveFields: apiOptions.AlwaysPrintPrimitiveFields,
+				AlwaysPrintEnumsAsInts:     apiOptions.AlwaysPrintEnumsAsInts,
+				PreserveProtoFieldNames:    apiOptions.PreserveProtoFieldNames,
+			},
+		})
 	}
 
-	// b/148605552: Previous versions of the `gcloud_build_image` script did not download the proto descriptor.
-	// We cannot ensure that users have the latest version of the script, so notify them via non-fatal logs.
-	// Log as error instead of warning because error logs will show up even if `--enable_debug` is false.
-	glog.Error("Unable to setup gRPC-JSON transcoding because no proto descriptor was found in the service config. " +
-		"Please use version 2020-01-29 (or later) of the `gcloud_build_image` script. " +
-		"https://github.com/GoogleCloudPlatform/esp-v2/blob/master/docker/serverless/gcloud_build_image")
-	return nil
+	var transcodeFilters []*hcmpb.HttpFilter
+	for _, transcodeConfig := range transcodeConfigs {
+		transcodeConfigStruct, _ := ptypes.MarshalAny(transcodeConfig)
+		transcodeFilters = append(transcodeFilters, &hcmpb.HttpFilter{
+			Name:       util.GRPCJSONTranscoder,
+			ConfigType: &hcmpb.HttpFilter_TypedConfig{transcodeConfigStruct},
+		})
+	}
+	return transcodeFilters, nil
 }
 
 func makeBackendAuthFilter(serviceInfo *sc.ServiceInfo) *hcmpb.HttpFilter {
@@ -867,6 +1171,15 @@ func makeHealthCheckFilter(serviceInfo *sc.ServiceInfo) (*hcmpb.HttpFilter, erro
 			},
 		},
 	}
+
+	if serviceInfo.Options.HealthzCheckLocalBackend || serviceInfo.Options.HealthzGrpcHealthCheck {
+		hcFilterConfig.ClusterMinHealthyPercentages = map[string]*typepb.Percent{
+			serviceInfo.LocalBackendClusterName(): {
+				Value: util.HealthzMinHealthyPercentage,
+			},
+		}
+	}
+
 	hcFilterConfigStruc, err := ptypes.MarshalAny(hcFilterConfig)
 	if err != nil {
 		return nil, err
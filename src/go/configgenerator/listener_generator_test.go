@@ -17,12 +17,15 @@ package configgenerator
 import (
 	"encoding/base64"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/testutil"
 	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
 
 	routepb "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
@@ -244,8 +247,16 @@ func TestTranscoderFilter(t *testing.T) {
 			t.Fatal(err)
 		}
 
+		transcoderFilters, err := makeTranscoderFilters(fakeServiceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(transcoderFilters) != 1 {
+			t.Fatalf("Test Desc(%d): %s, got %d transcoder filters, want 1", i, tc.desc, len(transcoderFilters))
+		}
+
 		marshaler := &jsonpb.Marshaler{}
-		gotFilter, err := marshaler.MarshalToString(makeTranscoderFilter(fakeServiceInfo))
+		gotFilter, err := marshaler.MarshalToString(transcoderFilters[0])
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -256,10 +267,102 @@ func TestTranscoderFilter(t *testing.T) {
 	}
 }
 
+func TestTranscoderFiltersPerApi(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: "endpoints.examples.bookstore.LegacyBookstore",
+			},
+			{
+				Name: "endpoints.examples.bookstore.Bookstore",
+			},
+			{
+				Name: "endpoints.examples.bookstore.Shelves",
+			},
+		},
+		SourceInfo: &confpb.SourceInfo{
+			SourceFiles: []*anypb.Any{content},
+		},
+	}
+
+	path, removeFile := testutil.WriteTempFile(t, "transcoding_api_options", `{"rules": [
+  {"api": "endpoints.examples.bookstore.LegacyBookstore", "preserveProtoFieldNames": true, "matchIncomingRequestRoute": true}
+]}`)
+	defer removeFile()
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.BackendAddress = "grpc://127.0.0.0:80"
+	opts.TranscodingAlwaysPrintEnumsAsInts = true
+	opts.TranscodingApiOptionsPath = path
+	fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transcoderFilters, err := makeTranscoderFilters(fakeServiceInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantTranscoderFilters := []string{
+		fmt.Sprintf(`
+{
+   "name":"envoy.filters.http.grpc_json_transcoder",
+   "typedConfig":{
+      "@type":"type.googleapis.com/envoy.extensions.filters.http.grpc_json_transcoder.v3.GrpcJsonTranscoder",
+      "autoMapping":true,
+      "convertGrpcStatus":true,
+      "matchIncomingRequestRoute":true,
+      "printOptions":{
+         "alwaysPrintEnumsAsInts":true,
+         "preserveProtoFieldNames":true
+      },
+      "protoDescriptorBin":"%s",
+      "services":[
+         "endpoints.examples.bookstore.LegacyBookstore"
+      ]
+   }
+}`, fakeProtoDescriptor),
+		fmt.Sprintf(`
+{
+   "name":"envoy.filters.http.grpc_json_transcoder",
+   "typedConfig":{
+      "@type":"type.googleapis.com/envoy.extensions.filters.http.grpc_json_transcoder.v3.GrpcJsonTranscoder",
+      "autoMapping":true,
+      "convertGrpcStatus":true,
+      "printOptions":{
+         "alwaysPrintEnumsAsInts":true
+      },
+      "protoDescriptorBin":"%s",
+      "services":[
+         "endpoints.examples.bookstore.Bookstore",
+         "endpoints.examples.bookstore.Shelves"
+      ]
+   }
+}`, fakeProtoDescriptor),
+	}
+	if len(transcoderFilters) != len(wantTranscoderFilters) {
+		t.Fatalf("got %d transcoder filters, want %d", len(transcoderFilters), len(wantTranscoderFilters))
+	}
+
+	marshaler := &jsonpb.Marshaler{}
+	for i, transcoderFilter := range transcoderFilters {
+		gotFilter, err := marshaler.MarshalToString(transcoderFilter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := util.JsonEqual(wantTranscoderFilters[i], gotFilter); err != nil {
+			t.Errorf("transcoder filter %d mismatch, \n %v", i, err)
+		}
+	}
+}
+
 func TestJwtAuthnFilter(t *testing.T) {
 	testData := []struct {
 		desc               string
 		fakeServiceConfig  *confpb.Service
+		jwtLocalJwks       string
 		wantJwtAuthnFilter string
 	}{
 		{
@@ -397,6 +500,148 @@ func TestJwtAuthnFilter(t *testing.T) {
             }
         }
     }
+}`,
+		},
+		{
+			desc: "Success. Generate jwt authn filter with inline local JWKS",
+			fakeServiceConfig: &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+					},
+				},
+				Authentication: &confpb.Authentication{
+					Providers: []*confpb.AuthProvider{
+						{
+							Id:     "auth_provider",
+							Issuer: "issuer-0",
+						},
+					},
+				},
+			},
+			jwtLocalJwks: `{"auth_provider": {"keys": [{"kty": "RSA", "kid": "key-0"}]}}`,
+			wantJwtAuthnFilter: `{
+    "name": "envoy.filters.http.jwt_authn",
+    "typedConfig": {
+        "@type": "type.googleapis.com/envoy.extensions.filters.http.jwt_authn.v3.JwtAuthentication",
+        "filterStateRules": {
+            "name": "com.google.espv2.filters.http.path_matcher.operation"
+        },
+        "providers": {
+            "auth_provider": {
+                "audiences": [
+                    "https://bookstore.endpoints.project123.cloud.goog"
+                ],
+                "forward": true,
+                "forwardPayloadHeader": "X-Endpoint-API-UserInfo",
+                "fromHeaders": [
+                    {
+                        "name": "Authorization",
+                        "valuePrefix": "Bearer "
+                    },
+                    {
+                        "name": "X-Goog-Iap-Jwt-Assertion"
+                    }
+                ],
+                "fromParams": [
+                    "access_token"
+                ],
+                "issuer": "issuer-0",
+                "payloadInMetadata": "jwt_payloads",
+                "localJwks": {
+                    "inlineString": "{\"keys\": [{\"kty\": \"RSA\", \"kid\": \"key-0\"}]}"
+                }
+            }
+        }
+    }
+}`,
+		},
+		{
+			desc: "Success. Generate jwt authn filter requirements from wildcard selectors",
+			fakeServiceConfig: &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+						Methods: []*apipb.Method{
+							{
+								Name: "ListShelves",
+							},
+							{
+								Name: "GetShelf",
+							},
+						},
+					},
+				},
+				Authentication: &confpb.Authentication{
+					Providers: []*confpb.AuthProvider{
+						{
+							Id:     "auth_provider",
+							Issuer: "issuer-0",
+						},
+					},
+					Rules: []*confpb.AuthenticationRule{
+						{
+							Selector: fmt.Sprintf("%s.ListShelves", testApiName),
+						},
+						{
+							Selector: "*",
+							Requirements: []*confpb.AuthRequirement{
+								{
+									ProviderId: "auth_provider",
+									Audiences:  "audience-0",
+								},
+							},
+						},
+					},
+				},
+			},
+			jwtLocalJwks: `{"auth_provider": {"keys": [{"kty": "RSA", "kid": "key-0"}]}}`,
+			wantJwtAuthnFilter: `{
+    "name": "envoy.filters.http.jwt_authn",
+    "typedConfig": {
+        "@type": "type.googleapis.com/envoy.extensions.filters.http.jwt_authn.v3.JwtAuthentication",
+        "filterStateRules": {
+            "name": "com.google.espv2.filters.http.path_matcher.operation",
+            "requires": {
+                "endpoints.examples.bookstore.Bookstore.GetShelf": {
+                    "providerAndAudiences": {
+                        "audiences": [
+                            "audience-0"
+                        ],
+                        "providerName": "auth_provider"
+                    }
+                }
+            }
+        },
+        "providers": {
+            "auth_provider": {
+                "audiences": [
+                    "https://bookstore.endpoints.project123.cloud.goog"
+                ],
+                "forward": true,
+                "forwardPayloadHeader": "X-Endpoint-API-UserInfo",
+                "fromHeaders": [
+                    {
+                        "name": "Authorization",
+                        "valuePrefix": "Bearer "
+                    },
+                    {
+                        "name": "X-Goog-Iap-Jwt-Assertion"
+                    }
+                ],
+                "fromParams": [
+                    "access_token"
+                ],
+                "issuer": "issuer-0",
+                "payloadInMetadata": "jwt_payloads",
+                "localJwks": {
+                    "inlineString": "{\"keys\": [{\"kty\": \"RSA\", \"kid\": \"key-0\"}]}"
+                }
+            }
+        }
+    }
 }`,
 		},
 	}
@@ -404,6 +649,7 @@ func TestJwtAuthnFilter(t *testing.T) {
 	for i, tc := range testData {
 		opts := options.DefaultConfigGeneratorOptions()
 		opts.BackendAddress = "grpc://127.0.0.0:80"
+		opts.JwtLocalJwks = tc.jwtLocalJwks
 		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(tc.fakeServiceConfig, testConfigID, opts)
 		if err != nil {
 			t.Fatal(err)
@@ -421,6 +667,251 @@ func TestJwtAuthnFilter(t *testing.T) {
 	}
 }
 
+func TestMakeJwtRequirement(t *testing.T) {
+	requirements := []*confpb.AuthRequirement{
+		{
+			ProviderId: "auth_provider_0",
+		},
+		{
+			ProviderId: "auth_provider_1",
+			Audiences:  "aud-0, aud-1",
+		},
+	}
+
+	testData := []struct {
+		desc            string
+		requirements    []*confpb.AuthRequirement
+		mode            configinfo.JwtRequirementMode
+		wantRequirement string
+	}{
+		{
+			desc:            "Single requirement by default",
+			requirements:    requirements[:1],
+			wantRequirement: `{"providerName": "auth_provider_0"}`,
+		},
+		{
+			desc:            "Single requirement with mode all",
+			requirements:    requirements[:1],
+			mode:            configinfo.JwtRequirementAll,
+			wantRequirement: `{"providerName": "auth_provider_0"}`,
+		},
+		{
+			desc:         "Multiple requirements by default",
+			requirements: requirements,
+			wantRequirement: `{
+  "requiresAny": {
+    "requirements": [
+      {"providerName": "auth_provider_0"},
+      {"providerAndAudiences": {"providerName": "auth_provider_1", "audiences": ["aud-0", "aud-1"]}}
+    ]
+  }
+}`,
+		},
+		{
+			desc:         "Multiple requirements with mode all",
+			requirements: requirements,
+			mode:         configinfo.JwtRequirementAll,
+			wantRequirement: `{
+  "requiresAll": {
+    "requirements": [
+      {"providerName": "auth_provider_0"},
+      {"providerAndAudiences": {"providerName": "auth_provider_1", "audiences": ["aud-0", "aud-1"]}}
+    ]
+  }
+}`,
+		},
+		{
+			desc:         "Single requirement with mode allow_missing",
+			requirements: requirements[:1],
+			mode:         configinfo.JwtRequirementAllowMissing,
+			wantRequirement: `{
+  "requiresAny": {
+    "requirements": [
+      {"providerName": "auth_provider_0"},
+      {"allowMissing": {}}
+    ]
+  }
+}`,
+		},
+		{
+			desc:         "Multiple requirements with mode allow_missing_or_failed",
+			requirements: requirements,
+			mode:         configinfo.JwtRequirementAllowMissingOrFailed,
+			wantRequirement: `{
+  "requiresAny": {
+    "requirements": [
+      {"providerName": "auth_provider_0"},
+      {"providerAndAudiences": {"providerName": "auth_provider_1", "audiences": ["aud-0", "aud-1"]}},
+      {"allowMissingOrFailed": {}}
+    ]
+  }
+}`,
+		},
+	}
+
+	for _, tc := range testData {
+		marshaler := &jsonpb.Marshaler{}
+		gotRequirement, err := marshaler.MarshalToString(makeJwtRequirement(tc.requirements, tc.mode))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := util.JsonEqual(tc.wantRequirement, gotRequirement); err != nil {
+			t.Errorf("Test Desc(%s): makeJwtRequirement failed, %s", tc.desc, err)
+		}
+	}
+}
+
+func TestRbacFilter(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "CreateBook",
+					},
+				},
+			},
+		},
+		Authentication: &confpb.Authentication{
+			Providers: []*confpb.AuthProvider{
+				{
+					Id:      "auth_provider",
+					Issuer:  "issuer-0",
+					JwksUri: "https://fake-jwks.com",
+				},
+			},
+			Rules: []*confpb.AuthenticationRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.CreateBook",
+					Requirements: []*confpb.AuthRequirement{
+						{
+							ProviderId: "auth_provider",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc           string
+		claimsPolicy   string
+		wantRbacFilter string
+	}{
+		{
+			desc: "No RBAC filter without JWT claims policies",
+		},
+		{
+			desc:         "RBAC filter allows all requests for JWT claims policies",
+			claimsPolicy: `{"rules": [{"selector": "endpoints.examples.bookstore.Bookstore.CreateBook", "claims": [{"claim": "tenant", "equals": "tenant-1"}]}]}`,
+			wantRbacFilter: `{
+				"name": "envoy.filters.http.rbac",
+				"typedConfig": {
+					"@type": "type.googleapis.com/envoy.extensions.filters.http.rbac.v3.RBAC"
+				}
+			}`,
+		},
+	}
+
+	for _, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		if tc.claimsPolicy != "" {
+			path, removeFile := testutil.WriteTempFile(t, "jwt_claims_policy", tc.claimsPolicy)
+			defer removeFile()
+			opts.JwtClaimsPolicyPath = path
+		}
+
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotFilter := makeRbacFilter(fakeServiceInfo)
+		if tc.wantRbacFilter == "" {
+			if gotFilter != nil {
+				t.Errorf("Test Desc(%s): got RBAC filter %v, want none", tc.desc, gotFilter)
+			}
+			continue
+		}
+
+		gotJson, err := util.ProtoToJson(gotFilter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := util.JsonEqual(tc.wantRbacFilter, gotJson); err != nil {
+			t.Errorf("Test Desc(%s): makeRbacFilter failed, %s", tc.desc, err)
+		}
+	}
+}
+
+func TestApiKeyFilter(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+			},
+		},
+	}
+
+	testData := []struct {
+		desc             string
+		apiKeysPath      string
+		wantApiKeyFilter string
+	}{
+		{
+			desc: "No API key filter without API keys file",
+		},
+		{
+			desc:        "API key filter with the API key server",
+			apiKeysPath: "/etc/espv2/api_keys.json",
+			wantApiKeyFilter: `{
+  "name": "envoy.filters.http.ext_authz",
+  "typedConfig": {
+    "@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthz",
+    "grpcService": {
+      "envoyGrpc": {
+        "clusterName": "api-key-server-cluster"
+      },
+      "timeout": "30s"
+    },
+    "statusOnError": {
+      "code": "ServiceUnavailable"
+    }
+  }
+}`,
+		},
+	}
+
+	for _, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.ApiKeysPath = tc.apiKeysPath
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotFilter := makeApiKeyFilter(fakeServiceInfo)
+		if tc.wantApiKeyFilter == "" {
+			if gotFilter != nil {
+				t.Errorf("Test Desc(%s): got API key filter %v, want none", tc.desc, gotFilter)
+			}
+			continue
+		}
+
+		gotJson, err := util.ProtoToJson(gotFilter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := util.JsonEqual(tc.wantApiKeyFilter, gotJson); err != nil {
+			t.Errorf("Test Desc(%s): makeApiKeyFilter failed, %s", tc.desc, err)
+		}
+	}
+}
+
 func TestBackendRoutingFilter(t *testing.T) {
 	testdata := []struct {
 		desc                     string
@@ -523,13 +1014,13 @@ func TestBackendRoutingFilter(t *testing.T) {
 						{
 							Selector: "testapi.foo",
 							Pattern: &annotationspb.HttpRule_Get{
-								Get: "foo",
+								Get: "/foo",
 							},
 						},
 						{
 							Selector: "testapi.bar",
 							Pattern: &annotationspb.HttpRule_Get{
-								Get: "bar",
+								Get: "/bar",
 							},
 						},
 					},
@@ -603,13 +1094,13 @@ func TestBackendRoutingFilter(t *testing.T) {
 						{
 							Selector: "testapi.foo",
 							Pattern: &annotationspb.HttpRule_Get{
-								Get: "foo",
+								Get: "/foo",
 							},
 						},
 						{
 							Selector: "testapi.bar",
 							Pattern: &annotationspb.HttpRule_Get{
-								Get: "bar",
+								Get: "/bar",
 							},
 						},
 					},
@@ -687,13 +1178,13 @@ func TestBackendRoutingFilter(t *testing.T) {
 						{
 							Selector: "testapi.foo",
 							Pattern: &annotationspb.HttpRule_Get{
-								Get: "foo",
+								Get: "/foo",
 							},
 						},
 						{
 							Selector: "testapi.bar",
 							Pattern: &annotationspb.HttpRule_Get{
-								Get: "bar",
+								Get: "/bar",
 							},
 						},
 					},
@@ -738,13 +1229,13 @@ func TestBackendRoutingFilter(t *testing.T) {
 						{
 							Selector: "testapi.foo",
 							Pattern: &annotationspb.HttpRule_Get{
-								Get: "foo",
+								Get: "/foo",
 							},
 						},
 						{
 							Selector: "testapi.bar",
 							Pattern: &annotationspb.HttpRule_Get{
-								Get: "bar",
+								Get: "/bar",
 							},
 						},
 					},
@@ -914,13 +1405,13 @@ func TestBackendAuthFilter(t *testing.T) {
 						{
 							Selector: "get_testapi.foo",
 							Pattern: &annotationspb.HttpRule_Get{
-								Get: "foo",
+								Get: "/foo",
 							},
 						},
 						{
 							Selector: "get_testapi.bar",
 							Pattern: &annotationspb.HttpRule_Get{
-								Get: "bar",
+								Get: "/bar",
 							},
 						},
 					},
@@ -1231,13 +1722,13 @@ func TestPathMatcherFilter(t *testing.T) {
 						{
 							Selector: "1.cloudesf_testing_cloud_goog.Foo",
 							Pattern: &annotationspb.HttpRule_Get{
-								Get: "foo/{id}",
+								Get: "/foo/{id}",
 							},
 						},
 						{
 							Selector: "1.cloudesf_testing_cloud_goog.Bar",
 							Pattern: &annotationspb.HttpRule_Get{
-								Get: "foo",
+								Get: "/foo",
 							},
 						},
 					},
@@ -1254,14 +1745,14 @@ func TestPathMatcherFilter(t *testing.T) {
             "operation":"1.cloudesf_testing_cloud_goog.Bar",
             "pattern":{
                "httpMethod":"GET",
-               "uriTemplate":"foo"
+               "uriTemplate":"/foo"
             }
          },
          {
             "operation":"1.cloudesf_testing_cloud_goog.Foo",
             "pattern":{
                "httpMethod":"GET",
-               "uriTemplate":"foo/{id}"
+               "uriTemplate":"/foo/{id}"
             },
             "pathParameterExtraction":{}
          }
@@ -1295,7 +1786,7 @@ func TestPathMatcherFilter(t *testing.T) {
 						{
 							Selector: "1.cloudesf_testing_cloud_goog.Foo",
 							Pattern: &annotationspb.HttpRule_Get{
-								Get: "foo",
+								Get: "/foo",
 							},
 						},
 					},
@@ -1312,14 +1803,14 @@ func TestPathMatcherFilter(t *testing.T) {
             "operation":"1.cloudesf_testing_cloud_goog.Foo",
             "pattern":{
                "httpMethod":"GET",
-               "uriTemplate":"foo"
+               "uriTemplate":"/foo"
             }
          },
          {
             "operation":"1.cloudesf_testing_cloud_goog.ESPv2_Autogenerated_CORS_foo",
             "pattern":{
                "httpMethod":"OPTIONS",
-               "uriTemplate":"foo"
+               "uriTemplate":"/foo"
             }
          }
       ]
@@ -1389,13 +1880,13 @@ func TestPathMatcherFilter(t *testing.T) {
 						{
 							Selector: "1.cloudesf_testing_cloud_goog.Foo",
 							Pattern: &annotationspb.HttpRule_Get{
-								Get: "foo/{foo_bar}",
+								Get: "/foo/{foo_bar}",
 							},
 						},
 						{
 							Selector: "1.cloudesf_testing_cloud_goog.Baz",
 							Pattern: &annotationspb.HttpRule_Get{
-								Get: "baz/{baz_baz}",
+								Get: "/baz/{baz_baz}",
 							},
 						},
 					},
@@ -1412,7 +1903,7 @@ func TestPathMatcherFilter(t *testing.T) {
             "operation":"1.cloudesf_testing_cloud_goog.Baz",
             "pattern":{
                "httpMethod":"GET",
-               "uriTemplate":"baz/{baz_baz}"
+               "uriTemplate":"/baz/{baz_baz}"
             },
             "pathParameterExtraction":{
               "snakeToJsonSegments":{
@@ -1425,7 +1916,7 @@ func TestPathMatcherFilter(t *testing.T) {
             "operation":"1.cloudesf_testing_cloud_goog.Foo",
             "pattern":{
                "httpMethod":"GET",
-               "uriTemplate":"foo/{foo_bar}"
+               "uriTemplate":"/foo/{foo_bar}"
             },
             "pathParameterExtraction":{
               "snakeToJsonSegments":{
@@ -1478,6 +1969,8 @@ func TestServiceControl(t *testing.T) {
 		desc                            string
 		serviceControlCredentials       *options.IAMCredentialsOptions
 		serviceAccountKey               string
+		localServiceControl             bool
+		apiKeysPath                     string
 		wantPartialServiceControlFilter string
 	}{
 		{
@@ -1526,13 +2019,45 @@ func TestServiceControl(t *testing.T) {
       "uri": "http://127.0.0.1:8791/local/access_token"
     },`,
 		},
+		{
+			desc:                "get access token from the local service control server",
+			serviceAccountKey:   "this-is-sa-cred",
+			localServiceControl: true,
+			wantPartialServiceControlFilter: `
+    "imdsToken": {
+      "cluster": "service-control-cluster",
+      "timeout": "30s",
+      "uri": "http://127.0.0.1:8792/local/access_token"
+    },`,
+		},
+		{
+			desc:                "API keys checked by the local API key server are not required by Service Control",
+			serviceAccountKey:   "this-is-sa-cred",
+			localServiceControl: true,
+			apiKeysPath:         "/etc/espv2/api_keys.json",
+			wantPartialServiceControlFilter: `
+    "requirements": [
+      {
+        "apiKey": {
+          "allowWithoutApiKey": true
+        },
+        "apiName": "endpoints.examples.bookstore.Bookstore",`,
+		},
 	}
 	for i, tc := range testData {
 		opts := options.DefaultConfigGeneratorOptions()
 		opts.ServiceControlCredentials = tc.serviceControlCredentials
 		opts.ServiceAccountKey = tc.serviceAccountKey
+		opts.LocalServiceControl = tc.localServiceControl
+		opts.ApiKeysPath = tc.apiKeysPath
 
-		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		serviceConfig := fakeServiceConfig
+		if tc.localServiceControl {
+			// The local service control server does not need control.environment.
+			serviceConfig = proto.Clone(fakeServiceConfig).(*confpb.Service)
+			serviceConfig.Control = nil
+		}
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(serviceConfig, testConfigID, opts)
 		if err != nil {
 			t.Error(err)
 		}
@@ -1557,6 +2082,9 @@ func TestHealthCheckFilter(t *testing.T) {
 		desc                  string
 		BackendAddress        string
 		healthz               string
+		backendHealthCheck    string
+		checkLocalBackend     bool
+		grpcHealthCheck       bool
 		fakeServiceConfig     *confpb.Service
 		wantHealthCheckFilter string
 	}{
@@ -1612,7 +2140,7 @@ func TestHealthCheckFilter(t *testing.T) {
 						{
 							Selector: "1.cloudesf_testing_cloud_goog.Foo",
 							Pattern: &annotationspb.HttpRule_Get{
-								Get: "foo/{id}",
+								Get: "/foo/{id}",
 							},
 						},
 					},
@@ -1630,6 +2158,81 @@ func TestHealthCheckFilter(t *testing.T) {
             }
           ]
         }
+      }`,
+		},
+		{
+			desc:               "Success, generate health check filter that checks the local backend",
+			BackendAddress:     "grpc://127.0.0.1:80",
+			healthz:            "healthz",
+			backendHealthCheck: "grpc",
+			checkLocalBackend:  true,
+			fakeServiceConfig: &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: "endpoints.examples.bookstore.Bookstore",
+						Methods: []*apipb.Method{
+							{
+								Name: "CreateShelf",
+							},
+						},
+					},
+				},
+			},
+			wantHealthCheckFilter: `{
+        "name": "envoy.filters.http.health_check",
+        "typedConfig": {
+          "@type":"type.googleapis.com/envoy.extensions.filters.http.health_check.v3.HealthCheck",
+          "passThroughMode":false,
+          "headers": [
+            {
+              "exactMatch": "/healthz",
+              "name":":path"
+            }
+          ],
+          "clusterMinHealthyPercentages": {
+            "backend-cluster-bookstore.endpoints.project123.cloud.goog_local": {
+              "value": 0.001
+            }
+          }
+        }
+      }`,
+		},
+		{
+			desc:            "Success, generate health check filter with the gRPC health check of the local backend",
+			BackendAddress:  "grpc://127.0.0.1:80",
+			healthz:         "healthz",
+			grpcHealthCheck: true,
+			fakeServiceConfig: &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: "endpoints.examples.bookstore.Bookstore",
+						Methods: []*apipb.Method{
+							{
+								Name: "CreateShelf",
+							},
+						},
+					},
+				},
+			},
+			wantHealthCheckFilter: `{
+        "name": "envoy.filters.http.health_check",
+        "typedConfig": {
+          "@type":"type.googleapis.com/envoy.extensions.filters.http.health_check.v3.HealthCheck",
+          "passThroughMode":false,
+          "headers": [
+            {
+              "exactMatch": "/healthz",
+              "name":":path"
+            }
+          ],
+          "clusterMinHealthyPercentages": {
+            "backend-cluster-bookstore.endpoints.project123.cloud.goog_local": {
+              "value": 0.001
+            }
+          }
+        }
       }`,
 		},
 	}
@@ -1638,6 +2241,9 @@ func TestHealthCheckFilter(t *testing.T) {
 		opts := options.DefaultConfigGeneratorOptions()
 		opts.BackendAddress = tc.BackendAddress
 		opts.Healthz = tc.healthz
+		opts.BackendHealthCheck = tc.backendHealthCheck
+		opts.HealthzCheckLocalBackend = tc.checkLocalBackend
+		opts.HealthzGrpcHealthCheck = tc.grpcHealthCheck
 		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(tc.fakeServiceConfig, testConfigID, opts)
 		if err != nil {
 			t.Fatal(err)
@@ -1848,8 +2454,9 @@ func TestMakeHttpConMgr(t *testing.T) {
 		{
 			desc: "Generate HttpConMgr when accessLog is defined",
 			opts: options.ConfigGeneratorOptions{
-				AccessLog:       "/foo",
-				AccessLogFormat: "/bar",
+				AccessLog:              "/foo",
+				AccessLogFormat:        "/bar",
+				AccessLogSamplePercent: 100,
 				CommonOptions: options.CommonOptions{
 					DisableTracing: true,
 				},
@@ -2018,3 +2625,183 @@ func TestMakeHttpConMgr(t *testing.T) {
 		}
 	}
 }
+
+func TestMakeAccessLogs(t *testing.T) {
+	testdata := []struct {
+		desc           string
+		opts           options.ConfigGeneratorOptions
+		wantAccessLogs string
+		wantError      string
+	}{
+		{
+			desc: "JSON access log to stdout",
+			opts: options.ConfigGeneratorOptions{
+				AccessLog:              "stdout",
+				AccessLogJsonFormat:    `{"status":"%RESPONSE_CODE%","path":"%REQ(:PATH)%"}`,
+				AccessLogSamplePercent: 100,
+			},
+			wantAccessLogs: `{"accessLog": [
+				{
+					"name": "envoy.access_loggers.file",
+					"typedConfig": {
+						"@type": "type.googleapis.com/envoy.extensions.access_loggers.file.v3.FileAccessLog",
+						"path": "/dev/stdout",
+						"logFormat": {
+							"jsonFormat": {
+								"path": "%REQ(:PATH)%",
+								"status": "%RESPONSE_CODE%"
+							}
+						}
+					}
+				}
+			]}`,
+		},
+		{
+			// The sample percent is over HUNDRED, the default denominator that is
+			// omitted in JSON, so the runtime key is also read as a percent.
+			desc: "File and gRPC access log service sinks share the filters",
+			opts: options.ConfigGeneratorOptions{
+				AccessLog:                   "stderr",
+				AccessLogGrpcServiceAddress: "grpc://127.0.0.1:9001",
+				AccessLogMinStatusCode:      400,
+				AccessLogMaxStatusCode:      599,
+				AccessLogSamplePercent:      12,
+				AccessLogExcludeHealthz:     true,
+			},
+			wantAccessLogs: `{"accessLog": [
+				{
+					"name": "envoy.access_loggers.file",
+					"filter": {
+						"andFilter": {
+							"filters": [
+								{"statusCodeFilter": {"comparison": {"op": "GE", "value": {"defaultValue": 400, "runtimeKey": "access_log.min_status_code"}}}},
+								{"statusCodeFilter": {"comparison": {"op": "LE", "value": {"defaultValue": 599, "runtimeKey": "access_log.max_status_code"}}}},
+								{"runtimeFilter": {"runtimeKey": "access_log.sample_percent", "percentSampled": {"numerator": 12}}},
+								{"notHealthCheckFilter": {}}
+							]
+						}
+					},
+					"typedConfig": {
+						"@type": "type.googleapis.com/envoy.extensions.access_loggers.file.v3.FileAccessLog",
+						"path": "/dev/stderr"
+					}
+				},
+				{
+					"name": "envoy.access_loggers.http_grpc",
+					"filter": {
+						"andFilter": {
+							"filters": [
+								{"statusCodeFilter": {"comparison": {"op": "GE", "value": {"defaultValue": 400, "runtimeKey": "access_log.min_status_code"}}}},
+								{"statusCodeFilter": {"comparison": {"op": "LE", "value": {"defaultValue": 599, "runtimeKey": "access_log.max_status_code"}}}},
+								{"runtimeFilter": {"runtimeKey": "access_log.sample_percent", "percentSampled": {"numerator": 12}}},
+								{"notHealthCheckFilter": {}}
+							]
+						}
+					},
+					"typedConfig": {
+						"@type": "type.googleapis.com/envoy.extensions.access_loggers.grpc.v3.HttpGrpcAccessLogConfig",
+						"commonConfig": {
+							"logName": "espv2",
+							"grpcService": {
+								"envoyGrpc": {
+									"clusterName": "access-log-service-cluster"
+								}
+							}
+						}
+					}
+				}
+			]}`,
+		},
+		{
+			desc: "Single filter is not wrapped",
+			opts: options.ConfigGeneratorOptions{
+				AccessLogGrpcServiceAddress: "grpc://127.0.0.1:9001",
+				AccessLogSamplePercent:      100,
+				AccessLogExcludeHealthz:     true,
+			},
+			wantAccessLogs: `{"accessLog": [
+				{
+					"name": "envoy.access_loggers.http_grpc",
+					"filter": {
+						"notHealthCheckFilter": {}
+					},
+					"typedConfig": {
+						"@type": "type.googleapis.com/envoy.extensions.access_loggers.grpc.v3.HttpGrpcAccessLogConfig",
+						"commonConfig": {
+							"logName": "espv2",
+							"grpcService": {
+								"envoyGrpc": {
+									"clusterName": "access-log-service-cluster"
+								}
+							}
+						}
+					}
+				}
+			]}`,
+		},
+		{
+			desc: "Both text and JSON formats",
+			opts: options.ConfigGeneratorOptions{
+				AccessLog:              "/foo",
+				AccessLogFormat:        "%RESPONSE_CODE%",
+				AccessLogJsonFormat:    `{"status":"%RESPONSE_CODE%"}`,
+				AccessLogSamplePercent: 100,
+			},
+			wantError: "only one of access_log_format and access_log_json_format can be set",
+		},
+		{
+			desc: "JSON format with non string values",
+			opts: options.ConfigGeneratorOptions{
+				AccessLog:              "/foo",
+				AccessLogJsonFormat:    `{"status":200}`,
+				AccessLogSamplePercent: 100,
+			},
+			wantError: "access_log_json_format must be a JSON object of strings",
+		},
+		{
+			desc: "Min status code greater than max status code",
+			opts: options.ConfigGeneratorOptions{
+				AccessLog:              "/foo",
+				AccessLogMinStatusCode: 500,
+				AccessLogMaxStatusCode: 400,
+				AccessLogSamplePercent: 100,
+			},
+			wantError: "access_log_min_status_code 500 is greater than access_log_max_status_code 400",
+		},
+		{
+			desc: "Sample percent out of range",
+			opts: options.ConfigGeneratorOptions{
+				AccessLog:              "/foo",
+				AccessLogSamplePercent: 101,
+			},
+			wantError: "access_log_sample_percent must be between 0 and 100",
+		},
+	}
+
+	for _, tc := range testdata {
+		accessLogs, err := makeAccessLogs(&tc.opts)
+		if err != nil {
+			if tc.wantError == "" || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test Desc(%s): want error: %s, get error: %v", tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if tc.wantError != "" {
+			t.Errorf("Test Desc(%s): want error: %s, get no error", tc.desc, tc.wantError)
+			continue
+		}
+
+		var gotAccessLogs []string
+		for _, accessLog := range accessLogs {
+			jsonStr, err := util.ProtoToJson(accessLog)
+			if err != nil {
+				t.Fatalf("Test Desc(%s): failed with error: %v", tc.desc, err)
+			}
+			gotAccessLogs = append(gotAccessLogs, jsonStr)
+		}
+
+		if err := util.JsonEqual(tc.wantAccessLogs, `{"accessLog": [`+strings.Join(gotAccessLogs, ",")+"]}"); err != nil {
+			t.Errorf("Test Desc(%s): failed, \n %v ", tc.desc, err)
+		}
+	}
+}
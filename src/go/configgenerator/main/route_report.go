@@ -0,0 +1,75 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The route report prints the route analysis of a service config as JSON,
+// with the routes in the order Envoy matches them and their conflicts. It
+// takes the same flags as the config manager, and exits with 1 if there are
+// conflicts with --route_conflicts=fail.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configmanager/flags"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/glog"
+
+	gen "github.com/GoogleCloudPlatform/esp-v2/src/go/configgenerator"
+)
+
+var servicePath = flag.String("service_json_path", "", "file path to the endpoint service config.")
+
+func main() {
+	flag.Parse()
+	if *servicePath == "" {
+		glog.Exitf("Please specify the service config with --service_json_path")
+	}
+
+	f, err := os.Open(*servicePath)
+	if err != nil {
+		glog.Exitf("fail to open service config %v: %v", *servicePath, err)
+	}
+	serviceConfig, err := util.UnmarshalServiceConfig(f)
+	f.Close()
+	if err != nil {
+		glog.Exitf("fail to unmarshal service config %v: %v", *servicePath, err)
+	}
+
+	opts := flags.EnvoyConfigOptionsFromFlags()
+	failOnConflicts := opts.RouteConflicts == gen.RouteConflictsFail
+	// The report is always made, the conflicts are checked below.
+	opts.RouteConflicts = gen.RouteConflictsWarn
+
+	serviceInfo, err := configinfo.NewServiceInfoFromServiceConfig(serviceConfig, serviceConfig.Id, opts)
+	if err != nil {
+		glog.Exitf("fail to initialize ServiceInfo: %v", err)
+	}
+	if _, err := gen.MakeRouteConfig(serviceInfo); err != nil {
+		glog.Exitf("fail to make route config: %v", err)
+	}
+
+	report, err := json.MarshalIndent(serviceInfo.RouteReport, "", "  ")
+	if err != nil {
+		glog.Exitf("fail to marshal route report: %v", err)
+	}
+	fmt.Println(string(report))
+
+	if failOnConflicts && len(serviceInfo.RouteReport.Conflicts) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,480 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configgenerator
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/glog"
+
+	commonpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/v9/http/common"
+	routepb "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+)
+
+const (
+	// Conflicts between the routes are logged as warnings.
+	RouteConflictsWarn = "warn"
+	// Conflicts between the routes fail the config generation.
+	RouteConflictsFail = "fail"
+)
+
+// operationRoute is the route of an http rule of an operation, with its
+// header canary routes which are always matched right before it.
+type operationRoute struct {
+	operation string
+	httpRule  *commonpb.Pattern
+	paths     *pathAutomaton
+	routes    []*routepb.Route
+
+	// The overlapping routes of other operations, set by analyzeRoutes.
+	overlapping []*operationRoute
+}
+
+// routeOverlap is a pair of overlapping routes of different operations.
+type routeOverlap struct {
+	// A path matched by both routes.
+	examplePath string
+	// Whether the first route matches all the requests of the second one, and
+	// the reverse.
+	covers, coveredBy bool
+}
+
+// analyzeRoutes orders the routes of the operations by specificity, and
+// reports the routes shadowed by an earlier route of another operation.
+//
+// Envoy uses the first matching route, so a broad template of an operation
+// hides the more specific templates of the operations after it. When a route
+// matches a subset of the requests of an earlier overlapping route, it is
+// moved before it. The other overlapping routes keep the operation order, and
+// routes that still match the same requests are reported as unreachable or
+// ambiguous. The routes of the same operation are never conflicts, as they
+// all send requests to the same operation.
+func analyzeRoutes(serviceInfo *configinfo.ServiceInfo, opRoutes []*operationRoute) ([]*operationRoute, error) {
+	switch serviceInfo.Options.RouteConflicts {
+	case RouteConflictsWarn, RouteConflictsFail:
+	default:
+		return nil, fmt.Errorf(`route_conflicts must be either "warn" or "fail", got %q`, serviceInfo.Options.RouteConflicts)
+	}
+
+	n := len(opRoutes)
+	// Keyed by the indexes of the routes, the first one is the smallest.
+	overlaps := make(map[[2]int]*routeOverlap)
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			a, b := opRoutes[i], opRoutes[j]
+			if a.operation == b.operation || !methodsOverlap(a.httpRule.HttpMethod, b.httpRule.HttpMethod) {
+				continue
+			}
+			// Cheap check first, the paths have no common prefix.
+			if !strings.HasPrefix(a.paths.prefix, b.paths.prefix) && !strings.HasPrefix(b.paths.prefix, a.paths.prefix) {
+				continue
+			}
+			path, ok := a.paths.intersection(b.paths)
+			if !ok {
+				continue
+			}
+			overlaps[[2]int{i, j}] = &routeOverlap{
+				examplePath: path,
+				covers:      methodCovers(a.httpRule.HttpMethod, b.httpRule.HttpMethod) && a.paths.covers(b.paths),
+				coveredBy:   methodCovers(b.httpRule.HttpMethod, a.httpRule.HttpMethod) && b.paths.covers(a.paths),
+			}
+			a.overlapping = append(a.overlapping, b)
+			b.overlapping = append(b.overlapping, a)
+		}
+	}
+
+	report := &configinfo.RouteReport{}
+	order, reordered := orderRoutes(n, overlaps)
+	if order == nil {
+		glog.Warningf("routes are kept in the operation order, they can not be ordered by specificity")
+		report.ReorderSkipped = true
+		order = make([]int, n)
+		for i := range order {
+			order[i] = i
+		}
+		reordered = make([]bool, n)
+	}
+
+	entries := make([]*configinfo.RouteReportEntry, n)
+	position := make([]int, n)
+	var ordered []*operationRoute
+	for p, i := range order {
+		entries[i] = &configinfo.RouteReportEntry{
+			Operation:   opRoutes[i].operation,
+			HttpMethod:  opRoutes[i].httpRule.HttpMethod,
+			UriTemplate: opRoutes[i].httpRule.UriTemplate,
+			Reordered:   reordered[i],
+		}
+		report.Routes = append(report.Routes, entries[i])
+		position[i] = p
+		ordered = append(ordered, opRoutes[i])
+	}
+
+	var conflicts []*configinfo.RouteConflict
+	var conflictPositions [][2]int
+	for pair, overlap := range overlaps {
+		// i is matched before j.
+		i, j := pair[0], pair[1]
+		covers, coveredBy := overlap.covers, overlap.coveredBy
+		if position[i] > position[j] {
+			i, j = j, i
+			covers, coveredBy = coveredBy, covers
+		}
+		conflict := &configinfo.RouteConflict{
+			Route:       entries[j],
+			ShadowedBy:  entries[i],
+			ExamplePath: overlap.examplePath,
+		}
+		switch {
+		case covers:
+			conflict.Type = configinfo.RouteConflictUnreachable
+		case coveredBy:
+			// The more specific route is matched first.
+			continue
+		default:
+			conflict.Type = configinfo.RouteConflictAmbiguous
+		}
+		conflicts = append(conflicts, conflict)
+		conflictPositions = append(conflictPositions, [2]int{position[i], position[j]})
+	}
+	// Sorted by the order of the routes, the map order is random.
+	sort.Sort(&conflictsByPosition{conflicts: conflicts, positions: conflictPositions})
+	report.Conflicts = conflicts
+	serviceInfo.RouteReport = report
+
+	if len(report.Conflicts) == 0 {
+		return ordered, nil
+	}
+	var msgs []string
+	for _, c := range report.Conflicts {
+		msgs = append(msgs, fmt.Sprintf("%s route %s %s of operation %s is shadowed by route %s %s of operation %s, for example at path %s",
+			c.Type, c.Route.HttpMethod, c.Route.UriTemplate, c.Route.Operation,
+			c.ShadowedBy.HttpMethod, c.ShadowedBy.UriTemplate, c.ShadowedBy.Operation, c.ExamplePath))
+	}
+	if serviceInfo.Options.RouteConflicts == RouteConflictsFail {
+		return nil, fmt.Errorf("found %d route conflicts: %s", len(msgs), strings.Join(msgs, "; "))
+	}
+	for _, msg := range msgs {
+		glog.Warningf("%s", msg)
+	}
+	return ordered, nil
+}
+
+type conflictsByPosition struct {
+	conflicts []*configinfo.RouteConflict
+	// The positions of the shadowing route and the shadowed route.
+	positions [][2]int
+}
+
+func (c *conflictsByPosition) Len() int { return len(c.conflicts) }
+
+func (c *conflictsByPosition) Less(i, j int) bool {
+	if c.positions[i][1] != c.positions[j][1] {
+		return c.positions[i][1] < c.positions[j][1]
+	}
+	return c.positions[i][0] < c.positions[j][0]
+}
+
+func (c *conflictsByPosition) Swap(i, j int) {
+	c.conflicts[i], c.conflicts[j] = c.conflicts[j], c.conflicts[i]
+	c.positions[i], c.positions[j] = c.positions[j], c.positions[i]
+}
+
+// orderRoutes sorts the routes so that a route comes before the overlapping
+// routes it is strictly more specific than, and keeps the original order of
+// the other overlapping routes. It returns nil if these constraints conflict.
+func orderRoutes(n int, overlaps map[[2]int]*routeOverlap) ([]int, []bool) {
+	after := make([][]int, n)
+	inDegree := make([]int, n)
+	reordered := make([]bool, n)
+	for pair, overlap := range overlaps {
+		i, j := pair[0], pair[1]
+		if overlap.covers && !overlap.coveredBy {
+			after[j] = append(after[j], i)
+			inDegree[i]++
+			reordered[j] = true
+		} else {
+			after[i] = append(after[i], j)
+			inDegree[j]++
+		}
+	}
+
+	// Kahn's algorithm, picking the first route in the original order.
+	ready := &intHeap{}
+	for i := 0; i < n; i++ {
+		if inDegree[i] == 0 {
+			heap.Push(ready, i)
+		}
+	}
+	var order []int
+	for ready.Len() > 0 {
+		next := heap.Pop(ready).(int)
+		order = append(order, next)
+		for _, j := range after[next] {
+			inDegree[j]--
+			if inDegree[j] == 0 {
+				heap.Push(ready, j)
+			}
+		}
+	}
+	if len(order) < n {
+		return nil, nil
+	}
+	return order, reordered
+}
+
+type intHeap []int
+
+func (h intHeap) Len() int            { return len(h) }
+func (h intHeap) Less(i, j int) bool  { return h[i] < h[j] }
+func (h intHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *intHeap) Push(x interface{}) { *h = append(*h, x.(int)) }
+func (h *intHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// methodsOverlap returns whether a request can match both methods, "*" is any
+// method.
+func methodsOverlap(a, b string) bool {
+	return a == "*" || b == "*" || a == b
+}
+
+// methodCovers returns whether all the requests of method b match method a.
+func methodCovers(a, b string) bool {
+	return a == "*" || a == b
+}
+
+const (
+	// Matches a character.
+	pathLiteral = iota
+	// Matches any character but "/", for "*".
+	pathSegmentChar
+	// Matches any character, for "**".
+	pathAnyChar
+)
+
+type pathTransition struct {
+	kind int
+	char byte
+	to   int
+}
+
+// pathAutomaton is a nondeterministic finite automaton matching the same
+// paths as the route of an http template, it starts at state 0.
+type pathAutomaton struct {
+	transitions [][]pathTransition
+	final       int
+	// The characters of the literals.
+	chars [256]bool
+	// The literal start of the paths, before the first wildcard.
+	prefix string
+	// The parts of the regex of the route, see util.HttpTemplate.RegexAtoms.
+	regexAtoms []string
+}
+
+func newPathAutomaton(uriTemplate string) (*pathAutomaton, error) {
+	t, err := util.ParseHttpTemplate(uriTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &pathAutomaton{
+		transitions: make([][]pathTransition, 1),
+		regexAtoms:  t.RegexAtoms(),
+	}
+	cur := 0
+	hasWildcard := false
+	addState := func() int {
+		a.transitions = append(a.transitions, nil)
+		return len(a.transitions) - 1
+	}
+	addLiteral := func(s string) {
+		for i := 0; i < len(s); i++ {
+			next := addState()
+			a.transitions[cur] = append(a.transitions[cur], pathTransition{kind: pathLiteral, char: s[i], to: next})
+			cur = next
+			a.chars[s[i]] = true
+		}
+		if !hasWildcard {
+			a.prefix += s
+		}
+	}
+
+	// One or more characters of a segment.
+	addSegmentChars := func() {
+		next := addState()
+		a.transitions[cur] = append(a.transitions[cur], pathTransition{kind: pathSegmentChar, to: next})
+		a.transitions[next] = append(a.transitions[next], pathTransition{kind: pathSegmentChar, to: next})
+		cur = next
+		hasWildcard = true
+	}
+
+	for _, segment := range t.Segments {
+		addLiteral("/")
+		switch {
+		case segment.Literal == "**":
+			a.transitions[cur] = append(a.transitions[cur], pathTransition{kind: pathAnyChar, to: cur})
+			hasWildcard = true
+		case segment.Parts != nil:
+			for _, part := range segment.Parts {
+				if part.IsWildcard {
+					addSegmentChars()
+				} else {
+					addLiteral(part.Literal)
+				}
+			}
+		case segment.IsWildcard:
+			addSegmentChars()
+		default:
+			addLiteral(segment.Literal)
+		}
+	}
+	if t.TrailingSlash || len(t.Segments) == 0 {
+		addLiteral("/")
+	}
+	if t.Verb != "" {
+		addLiteral(":" + t.Verb)
+	}
+	a.final = cur
+	return a, nil
+}
+
+// step returns the states reached from the sorted states with the character.
+func (a *pathAutomaton) step(states []int, c byte) []int {
+	reached := make([]bool, len(a.transitions))
+	for _, s := range states {
+		for _, t := range a.transitions[s] {
+			switch {
+			case t.kind == pathAnyChar,
+				t.kind == pathSegmentChar && c != '/',
+				t.kind == pathLiteral && c == t.char:
+				reached[t.to] = true
+			}
+		}
+	}
+	var next []int
+	for s, ok := range reached {
+		if ok {
+			next = append(next, s)
+		}
+	}
+	return next
+}
+
+func (a *pathAutomaton) accepts(states []int) bool {
+	for _, s := range states {
+		if s == a.final {
+			return true
+		}
+	}
+	return false
+}
+
+// intersection returns the shortest path matched by both automatons.
+func (a *pathAutomaton) intersection(b *pathAutomaton) (string, bool) {
+	return a.search(b, true, func(inA, inB bool) bool { return inA && inB })
+}
+
+// covers returns whether all the paths matched by b are matched by a.
+func (a *pathAutomaton) covers(b *pathAutomaton) bool {
+	_, found := a.search(b, false, func(inA, inB bool) bool { return !inA && inB })
+	return !found
+}
+
+// search runs a breadth first search over the pairs of the states of both
+// automatons, and returns the shortest path reaching states accepted by want.
+// The paths are only made of the characters of the literals, "/", ":" and a
+// character used by none of them, which stands for all the other characters.
+func (a *pathAutomaton) search(b *pathAutomaton, needA bool, want func(inA, inB bool) bool) (string, bool) {
+	var alphabet [256]bool
+	alphabet['/'], alphabet[':'] = true, true
+	for c := range alphabet {
+		alphabet[c] = alphabet[c] || a.chars[c] || b.chars[c]
+	}
+	// The other character is tried first, for readable example paths.
+	var symbols []byte
+	for _, c := range []byte("xyz0123456789abcdefghijklmnopqrstuvw") {
+		if !alphabet[c] {
+			symbols = append(symbols, c)
+			break
+		}
+	}
+	for c := 0; c < 256; c++ {
+		if alphabet[byte(c)] {
+			symbols = append(symbols, byte(c))
+		}
+	}
+
+	type node struct {
+		statesA, statesB []int
+		path             string
+	}
+	key := func(n *node) string {
+		var b strings.Builder
+		for _, s := range n.statesA {
+			b.WriteString(strconv.Itoa(s))
+			b.WriteByte(',')
+		}
+		b.WriteByte('|')
+		for _, s := range n.statesB {
+			b.WriteString(strconv.Itoa(s))
+			b.WriteByte(',')
+		}
+		return b.String()
+	}
+	// All the paths of b start with the common literal prefix.
+	common := 0
+	for common < len(a.prefix) && common < len(b.prefix) && a.prefix[common] == b.prefix[common] {
+		common++
+	}
+	start := &node{statesA: []int{0}, statesB: []int{0}, path: b.prefix[:common]}
+	for i := 0; i < common; i++ {
+		start.statesA = a.step(start.statesA, b.prefix[i])
+		start.statesB = b.step(start.statesB, b.prefix[i])
+	}
+	visited := map[string]bool{key(start): true}
+	queue := []*node{start}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if want(a.accepts(cur.statesA), b.accepts(cur.statesB)) {
+			return cur.path, true
+		}
+		for _, c := range symbols {
+			next := &node{
+				statesA: a.step(cur.statesA, c),
+				statesB: b.step(cur.statesB, c),
+				path:    cur.path + string(c),
+			}
+			if len(next.statesB) == 0 || needA && len(next.statesA) == 0 {
+				continue
+			}
+			if k := key(next); !visited[k] {
+				visited[k] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return "", false
+}
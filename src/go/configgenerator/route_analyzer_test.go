@@ -0,0 +1,339 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configgenerator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/google/go-cmp/cmp"
+
+	commonpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/v9/http/common"
+	routepb "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+)
+
+func TestAnalyzeRoutes(t *testing.T) {
+	type testRoute struct {
+		operation, httpMethod, uriTemplate string
+	}
+	testData := []struct {
+		desc           string
+		routeConflicts string
+		routes         []testRoute
+		wantReport     *configinfo.RouteReport
+		wantError      string
+	}{
+		{
+			desc: "Disjoint routes keep the operation order",
+			routes: []testRoute{
+				{"ListShelves", "GET", "/v1/shelves"},
+				{"GetShelf", "GET", "/v1/shelves/{shelf}"},
+				{"CreateShelf", "POST", "/v1/shelves/{shelf}"},
+			},
+			wantReport: &configinfo.RouteReport{
+				Routes: []*configinfo.RouteReportEntry{
+					{Operation: "ListShelves", HttpMethod: "GET", UriTemplate: "/v1/shelves"},
+					{Operation: "GetShelf", HttpMethod: "GET", UriTemplate: "/v1/shelves/{shelf}"},
+					{Operation: "CreateShelf", HttpMethod: "POST", UriTemplate: "/v1/shelves/{shelf}"},
+				},
+			},
+		},
+		{
+			desc: "Specific routes are moved before a broad wildcard",
+			routes: []testRoute{
+				{"GetResource", "GET", "/v1/{name=**}"},
+				{"GetShelf", "GET", "/v1/shelves/{shelf}"},
+				{"ListShelves", "GET", "/v1/shelves"},
+				{"CreateShelf", "POST", "/v1/shelves"},
+			},
+			wantReport: &configinfo.RouteReport{
+				Routes: []*configinfo.RouteReportEntry{
+					{Operation: "GetShelf", HttpMethod: "GET", UriTemplate: "/v1/shelves/{shelf}", Reordered: true},
+					{Operation: "ListShelves", HttpMethod: "GET", UriTemplate: "/v1/shelves", Reordered: true},
+					{Operation: "GetResource", HttpMethod: "GET", UriTemplate: "/v1/{name=**}"},
+					{Operation: "CreateShelf", HttpMethod: "POST", UriTemplate: "/v1/shelves"},
+				},
+			},
+		},
+		{
+			desc: "Routes of any method are matched after the routes of a method",
+			routes: []testRoute{
+				{"Proxy", "*", "/v1/shelves"},
+				{"ListShelves", "GET", "/v1/shelves"},
+			},
+			wantReport: &configinfo.RouteReport{
+				Routes: []*configinfo.RouteReportEntry{
+					{Operation: "ListShelves", HttpMethod: "GET", UriTemplate: "/v1/shelves", Reordered: true},
+					{Operation: "Proxy", HttpMethod: "*", UriTemplate: "/v1/shelves"},
+				},
+			},
+		},
+		{
+			desc: "Custom verbs are more specific than a variable",
+			routes: []testRoute{
+				{"GetOperation", "POST", "/v1/{name=operations/**}"},
+				{"CancelOperation", "POST", "/v1/{name=operations/*}:cancel"},
+			},
+			wantReport: &configinfo.RouteReport{
+				Routes: []*configinfo.RouteReportEntry{
+					{Operation: "CancelOperation", HttpMethod: "POST", UriTemplate: "/v1/{name=operations/*}:cancel", Reordered: true},
+					{Operation: "GetOperation", HttpMethod: "POST", UriTemplate: "/v1/{name=operations/**}"},
+				},
+			},
+		},
+		{
+			desc: "Routes of the same operation are not conflicts",
+			routes: []testRoute{
+				{"GetShelf", "GET", "/v1/{name=**}"},
+				{"GetShelf", "GET", "/v1/shelves/{shelf}"},
+			},
+			wantReport: &configinfo.RouteReport{
+				Routes: []*configinfo.RouteReportEntry{
+					{Operation: "GetShelf", HttpMethod: "GET", UriTemplate: "/v1/{name=**}"},
+					{Operation: "GetShelf", HttpMethod: "GET", UriTemplate: "/v1/shelves/{shelf}"},
+				},
+			},
+		},
+		{
+			desc: "Duplicate routes are unreachable",
+			routes: []testRoute{
+				{"GetShelf", "GET", "/v1/shelves/{shelf}"},
+				{"GetBook", "GET", "/v1/shelves/{book}"},
+			},
+			wantReport: &configinfo.RouteReport{
+				Routes: []*configinfo.RouteReportEntry{
+					{Operation: "GetShelf", HttpMethod: "GET", UriTemplate: "/v1/shelves/{shelf}"},
+					{Operation: "GetBook", HttpMethod: "GET", UriTemplate: "/v1/shelves/{book}"},
+				},
+				Conflicts: []*configinfo.RouteConflict{
+					{
+						Type:        configinfo.RouteConflictUnreachable,
+						Route:       &configinfo.RouteReportEntry{Operation: "GetBook", HttpMethod: "GET", UriTemplate: "/v1/shelves/{book}"},
+						ShadowedBy:  &configinfo.RouteReportEntry{Operation: "GetShelf", HttpMethod: "GET", UriTemplate: "/v1/shelves/{shelf}"},
+						ExamplePath: "/v1/shelves/x",
+					},
+				},
+			},
+		},
+		{
+			desc: "Partially overlapping routes are ambiguous",
+			routes: []testRoute{
+				{"GetShelf", "GET", "/v1/shelves/{shelf}/*"},
+				{"GetBook", "GET", "/v1/*/books/{book}"},
+			},
+			wantReport: &configinfo.RouteReport{
+				Routes: []*configinfo.RouteReportEntry{
+					{Operation: "GetShelf", HttpMethod: "GET", UriTemplate: "/v1/shelves/{shelf}/*"},
+					{Operation: "GetBook", HttpMethod: "GET", UriTemplate: "/v1/*/books/{book}"},
+				},
+				Conflicts: []*configinfo.RouteConflict{
+					{
+						Type:        configinfo.RouteConflictAmbiguous,
+						Route:       &configinfo.RouteReportEntry{Operation: "GetBook", HttpMethod: "GET", UriTemplate: "/v1/*/books/{book}"},
+						ShadowedBy:  &configinfo.RouteReportEntry{Operation: "GetShelf", HttpMethod: "GET", UriTemplate: "/v1/shelves/{shelf}/*"},
+						ExamplePath: "/v1/shelves/books/x",
+					},
+				},
+			},
+		},
+		{
+			desc: "Routes are kept in order when specificity conflicts with ambiguous routes",
+			routes: []testRoute{
+				{"GetResource", "GET", "/v1/{name=shelves/**}"},
+				{"GetBook", "GET", "/v1/*/books"},
+				{"GetShelf", "GET", "/v1/shelves/*"},
+			},
+			wantReport: &configinfo.RouteReport{
+				Routes: []*configinfo.RouteReportEntry{
+					{Operation: "GetResource", HttpMethod: "GET", UriTemplate: "/v1/{name=shelves/**}"},
+					{Operation: "GetBook", HttpMethod: "GET", UriTemplate: "/v1/*/books"},
+					{Operation: "GetShelf", HttpMethod: "GET", UriTemplate: "/v1/shelves/*"},
+				},
+				Conflicts: []*configinfo.RouteConflict{
+					{
+						Type:        configinfo.RouteConflictAmbiguous,
+						Route:       &configinfo.RouteReportEntry{Operation: "GetBook", HttpMethod: "GET", UriTemplate: "/v1/*/books"},
+						ShadowedBy:  &configinfo.RouteReportEntry{Operation: "GetResource", HttpMethod: "GET", UriTemplate: "/v1/{name=shelves/**}"},
+						ExamplePath: "/v1/shelves/books",
+					},
+					{
+						Type:        configinfo.RouteConflictUnreachable,
+						Route:       &configinfo.RouteReportEntry{Operation: "GetShelf", HttpMethod: "GET", UriTemplate: "/v1/shelves/*"},
+						ShadowedBy:  &configinfo.RouteReportEntry{Operation: "GetResource", HttpMethod: "GET", UriTemplate: "/v1/{name=shelves/**}"},
+						ExamplePath: "/v1/shelves/x",
+					},
+					{
+						Type:        configinfo.RouteConflictAmbiguous,
+						Route:       &configinfo.RouteReportEntry{Operation: "GetShelf", HttpMethod: "GET", UriTemplate: "/v1/shelves/*"},
+						ShadowedBy:  &configinfo.RouteReportEntry{Operation: "GetBook", HttpMethod: "GET", UriTemplate: "/v1/*/books"},
+						ExamplePath: "/v1/shelves/books",
+					},
+				},
+				ReorderSkipped: true,
+			},
+		},
+		{
+			desc:           "Conflicts fail with route_conflicts=fail",
+			routeConflicts: RouteConflictsFail,
+			routes: []testRoute{
+				{"GetShelf", "GET", "/v1/shelves/{shelf}"},
+				{"GetBook", "GET", "/v1/shelves/{book}"},
+			},
+			wantError: "found 1 route conflicts: unreachable route GET /v1/shelves/{book} of operation GetBook is shadowed by route GET /v1/shelves/{shelf} of operation GetShelf, for example at path /v1/shelves/x",
+		},
+		{
+			desc:           "Invalid route_conflicts",
+			routeConflicts: "ignore",
+			wantError:      `route_conflicts must be either "warn" or "fail", got "ignore"`,
+		},
+	}
+
+	for _, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		if tc.routeConflicts != "" {
+			opts.RouteConflicts = tc.routeConflicts
+		}
+		serviceInfo := &configinfo.ServiceInfo{
+			Options: opts,
+		}
+
+		var opRoutes []*operationRoute
+		for _, r := range tc.routes {
+			paths, err := newPathAutomaton(r.uriTemplate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opRoutes = append(opRoutes, &operationRoute{
+				operation: r.operation,
+				httpRule: &commonpb.Pattern{
+					HttpMethod:  r.httpMethod,
+					UriTemplate: r.uriTemplate,
+				},
+				paths: paths,
+				routes: []*routepb.Route{
+					{Name: r.operation},
+				},
+			})
+		}
+
+		got, err := analyzeRoutes(serviceInfo, opRoutes)
+		if err != nil {
+			if tc.wantError == "" || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test Desc(%s): want error: %s, get error: %v", tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if tc.wantError != "" {
+			t.Errorf("Test Desc(%s): want error: %s, get no error", tc.desc, tc.wantError)
+			continue
+		}
+
+		if diff := cmp.Diff(tc.wantReport, serviceInfo.RouteReport); diff != "" {
+			t.Errorf("Test Desc(%s): got route report diff (-want +got):\n%s", tc.desc, diff)
+		}
+		if len(got) != len(tc.wantReport.Routes) {
+			t.Errorf("Test Desc(%s): got %d routes, want %d", tc.desc, len(got), len(tc.wantReport.Routes))
+			continue
+		}
+		for i, r := range got {
+			if r.routes[0].Name != tc.wantReport.Routes[i].Operation {
+				t.Errorf("Test Desc(%s): got route %d of operation %s, want %s", tc.desc, i, r.routes[0].Name, tc.wantReport.Routes[i].Operation)
+			}
+		}
+	}
+}
+
+func TestPathAutomaton(t *testing.T) {
+	testData := []struct {
+		desc             string
+		a, b             string
+		wantIntersection string
+		wantCovers       bool
+	}{
+		{
+			desc:             "Same literal",
+			a:                "/v1/shelves",
+			b:                "/v1/shelves",
+			wantIntersection: "/v1/shelves",
+			wantCovers:       true,
+		},
+		{
+			desc: "Different literals",
+			a:    "/v1/shelves",
+			b:    "/v1/books",
+		},
+		{
+			desc: "Wildcard does not match empty or several segments",
+			a:    "/v1/*",
+			b:    "/v1/",
+		},
+		{
+			desc:             "Double wildcard covers a wildcard",
+			a:                "/v1/**",
+			b:                "/v1/*/books",
+			wantIntersection: "/v1/x/books",
+			wantCovers:       true,
+		},
+		{
+			desc:             "Wildcard does not cover a double wildcard",
+			a:                "/v1/*",
+			b:                "/v1/**",
+			wantIntersection: "/v1/x",
+		},
+		{
+			desc:             "Wildcard matches the custom verb",
+			a:                "/v1/*",
+			b:                "/v1/operations:cancel",
+			wantIntersection: "/v1/operations:cancel",
+			wantCovers:       true,
+		},
+		{
+			desc:             "Wildcard covers a partial segment",
+			a:                "/v1/*",
+			b:                "/v1/{id}.json",
+			wantIntersection: "/v1/x.json",
+			wantCovers:       true,
+		},
+		{
+			desc: "Partial segments with different literals",
+			a:    "/v1/{id}.json",
+			b:    "/v1/{id}.xml",
+		},
+		{
+			desc: "Different custom verbs",
+			a:    "/v1/*:cancel",
+			b:    "/v1/*:delete",
+		},
+	}
+
+	for _, tc := range testData {
+		a, err := newPathAutomaton(tc.a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := newPathAutomaton(tc.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := a.intersection(b); got != tc.wantIntersection {
+			t.Errorf("Test Desc(%s): got intersection %q, want %q", tc.desc, got, tc.wantIntersection)
+		}
+		if got := a.covers(b); got != tc.wantCovers {
+			t.Errorf("Test Desc(%s): got covers %v, want %v", tc.desc, got, tc.wantCovers)
+		}
+	}
+}
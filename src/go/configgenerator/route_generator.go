@@ -16,25 +16,39 @@ package configgenerator
 
 import (
 	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
 	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
 
 	commonpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/v9/http/common"
+	scpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/v9/http/service_control"
 	corepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	rbacconfigpb "github.com/envoyproxy/go-control-plane/envoy/config/rbac/v3"
 	routepb "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	extauthzpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_authz/v3"
+	rbacpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/rbac/v3"
 	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
+	typepb "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	anypb "github.com/golang/protobuf/ptypes/any"
 	wrapperspb "github.com/golang/protobuf/ptypes/wrappers"
 )
 
 const (
 	routeName       = "local_route"
 	virtualHostName = "backend"
+
+	claimsPolicyName = "jwt-claims"
 )
 
+var nonWordCharRegex = regexp.MustCompile(`[^\w-]`)
+
 func MakeRouteConfig(serviceInfo *configinfo.ServiceInfo) (*routepb.RouteConfiguration, error) {
 	var virtualHosts []*routepb.VirtualHost
 	host := routepb.VirtualHost{
@@ -49,6 +63,12 @@ func MakeRouteConfig(serviceInfo *configinfo.ServiceInfo) (*routepb.RouteConfigu
 	}
 	host.Routes = brRoutes
 
+	if serviceInfo.Options.EnableOperationStats {
+		if host.VirtualClusters, err = makeVirtualClusters(serviceInfo); err != nil {
+			return nil, err
+		}
+	}
+
 	switch serviceInfo.Options.CorsPreset {
 	case "basic":
 		org := serviceInfo.Options.CorsAllowOrigin
@@ -127,6 +147,7 @@ func MakeRouteConfig(serviceInfo *configinfo.ServiceInfo) (*routepb.RouteConfigu
 			Decorator: &routepb.Decorator{
 				Operation: util.SpanNamePrefix,
 			},
+			RequestHeadersToRemove: serviceInfo.AllClaimHeaders,
 		}
 		host.Routes = append(host.Routes, corsRoute)
 
@@ -142,7 +163,13 @@ func MakeRouteConfig(serviceInfo *configinfo.ServiceInfo) (*routepb.RouteConfigu
 }
 
 func makeRouteTable(serviceInfo *configinfo.ServiceInfo) ([]*routepb.Route, error) {
-	var backendRoutes []*routepb.Route
+	switch serviceInfo.Options.RouteTableMode {
+	case RouteTableFlat, RouteTableGrouped:
+	default:
+		return nil, fmt.Errorf(`route_table_mode must be either "flat" or "grouped", got %q`, serviceInfo.Options.RouteTableMode)
+	}
+
+	var opRoutes []*operationRoute
 	for _, operation := range serviceInfo.Operations {
 		method := serviceInfo.Methods[operation]
 		var routeMatcher *routepb.RouteMatch
@@ -179,6 +206,76 @@ func makeRouteTable(serviceInfo *configinfo.ServiceInfo) ([]*routepb.Route, erro
 				},
 			}
 
+			if serviceInfo.Options.BackendLbHashHeader != "" && method.BackendInfo.ClusterName == serviceInfo.LocalBackendClusterName() {
+				r.GetRoute().HashPolicy = []*routepb.RouteAction_HashPolicy{
+					{
+						PolicySpecifier: &routepb.RouteAction_HashPolicy_Header_{
+							Header: &routepb.RouteAction_HashPolicy_Header{
+								HeaderName: serviceInfo.Options.BackendLbHashHeader,
+							},
+						},
+					},
+				}
+			}
+
+			if method.MirrorToShadowBackend {
+				// The router mirrors the request after all the other HTTP filters ran,
+				// so mirrored requests are never checked or reported by Service Control.
+				r.GetRoute().RequestMirrorPolicies = []*routepb.RouteAction_RequestMirrorPolicy{
+					makeShadowMirrorPolicy(serviceInfo),
+				}
+			}
+
+			if method.CorsPolicy != nil {
+				r.GetRoute().Cors = makeRouteCorsPolicy(method.CorsPolicy)
+			}
+
+			if len(method.ClaimRequirements) > 0 {
+				rbacPerRoute, err := makeClaimsRbacPerRoute(method.ClaimRequirements)
+				if err != nil {
+					return nil, fmt.Errorf("error making JWT claims policy for selector (%v): %v", operation, err)
+				}
+				r.TypedPerFilterConfig = map[string]*anypb.Any{
+					util.RBAC: rbacPerRoute,
+				}
+			}
+
+			// The claim headers sent by the client never reach the backend, for all
+			// the operations. Envoy removes the headers before adding them, so the
+			// operations with claim headers get them from the JWT. Headers of missing
+			// claims are empty, and Envoy does not add empty headers.
+			r.RequestHeadersToRemove = append(r.RequestHeadersToRemove, serviceInfo.AllClaimHeaders...)
+			if len(method.ClaimHeaders) > 0 {
+				for _, claimHeader := range method.ClaimHeaders {
+					r.RequestHeadersToAdd = append(r.RequestHeadersToAdd, &corepb.HeaderValueOption{
+						Header: &corepb.HeaderValue{
+							Key:   claimHeader.Header,
+							Value: makeClaimHeaderValue(claimHeader.ClaimPath),
+						},
+						Append: &wrapperspb.BoolValue{Value: false},
+					})
+				}
+			}
+
+			if serviceInfo.Options.ApiKeysPath != "" {
+				// Same operations as the API key requirements of the Service Control filter.
+				requireApiKey := !method.IsGenerated && !method.AllowUnregisteredCalls && !method.SkipServiceControl
+				apiKeyPerRoute, err := makeApiKeyPerRoute(operation, requireApiKey, method.ApiKeyLocations)
+				if err != nil {
+					return nil, fmt.Errorf("error making API key check for selector (%v): %v", operation, err)
+				}
+				if r.TypedPerFilterConfig == nil {
+					r.TypedPerFilterConfig = make(map[string]*anypb.Any)
+				}
+				r.TypedPerFilterConfig[util.ExtAuthz] = apiKeyPerRoute
+
+				// The API key server sets the consumer header when it checks the API key,
+				// the header is never sent by the client to the other operations.
+				if !requireApiKey {
+					r.RequestHeadersToRemove = append(r.RequestHeadersToRemove, serviceInfo.Options.GeneratedHeaderPrefix+util.ApiKeyConsumerHeaderSuffix)
+				}
+			}
+
 			if method.BackendInfo.Hostname != "" {
 				// For routing to remote backends.
 				r.GetRoute().HostRewriteSpecifier = &routepb.RouteAction_HostRewriteLiteral{
@@ -196,22 +293,389 @@ func makeRouteTable(serviceInfo *configinfo.ServiceInfo) ([]*routepb.Route, erro
 					},
 				}
 			}
-			backendRoutes = append(backendRoutes, &r)
+
+			// Header canary routes must be matched before the primary route.
+			canaryRoutes := makeCanaryRoutes(&r, method.BackendInfo.ClusterName, method.BackendInfo.Hostname, method.CanaryBackends)
+			for _, cr := range canaryRoutes {
+				jsonStr, _ := util.ProtoToJson(cr)
+				glog.Infof("adding canary route: %v", jsonStr)
+			}
+			paths, err := newPathAutomaton(httpRule.UriTemplate)
+			if err != nil {
+				return nil, fmt.Errorf("error making HTTP route matcher for selector (%v): %v", operation, err)
+			}
+			opRoutes = append(opRoutes, &operationRoute{
+				operation: operation,
+				httpRule:  httpRule,
+				paths:     paths,
+				routes:    append(canaryRoutes, &r),
+			})
 
 			jsonStr, _ := util.ProtoToJson(&r)
 			glog.Infof("adding route: %v", jsonStr)
 		}
 	}
+	ordered, err := analyzeRoutes(serviceInfo, opRoutes)
+	if err != nil {
+		return nil, err
+	}
+	if serviceInfo.Options.RouteTableMode == RouteTableGrouped {
+		return groupRoutes(ordered)
+	}
+
+	var backendRoutes []*routepb.Route
+	for _, r := range ordered {
+		backendRoutes = append(backendRoutes, r.routes...)
+	}
 	return backendRoutes, nil
 }
 
+// makeRouteCorsPolicy overrides the CORS policy of the virtual host for a route.
+func makeRouteCorsPolicy(policy *configinfo.CorsPolicy) *routepb.CorsPolicy {
+	cors := &routepb.CorsPolicy{
+		AllowMethods:     policy.AllowMethods,
+		AllowHeaders:     policy.AllowHeaders,
+		ExposeHeaders:    policy.ExposeHeaders,
+		AllowCredentials: &wrapperspb.BoolValue{Value: policy.AllowCredentials},
+	}
+	for _, origin := range policy.AllowOrigins {
+		cors.AllowOriginStringMatch = append(cors.AllowOriginStringMatch, &matcher.StringMatcher{
+			MatchPattern: &matcher.StringMatcher_Exact{
+				Exact: origin,
+			},
+		})
+	}
+	for _, regex := range policy.AllowOriginRegexes {
+		cors.AllowOriginStringMatch = append(cors.AllowOriginStringMatch, &matcher.StringMatcher{
+			MatchPattern: &matcher.StringMatcher_SafeRegex{
+				SafeRegex: &matcher.RegexMatcher{
+					EngineType: &matcher.RegexMatcher_GoogleRe2{
+						GoogleRe2: &matcher.RegexMatcher_GoogleRE2{},
+					},
+					Regex: regex,
+				},
+			},
+		})
+	}
+	if policy.MaxAge != 0 {
+		cors.MaxAge = strconv.FormatUint(uint64(policy.MaxAge), 10)
+	}
+	return cors
+}
+
+// makeApiKeyPerRoute sends the operation and its API key locations to the API
+// key server, or disables the API key check for the route.
+func makeApiKeyPerRoute(operation string, requireApiKey bool, locations []*scpb.ApiKeyLocation) (*anypb.Any, error) {
+	if !requireApiKey {
+		return ptypes.MarshalAny(&extauthzpb.ExtAuthzPerRoute{
+			Override: &extauthzpb.ExtAuthzPerRoute_Disabled{
+				Disabled: true,
+			},
+		})
+	}
+
+	var locationStrs []string
+	if len(locations) == 0 {
+		locationStrs = []string{
+			"query:" + util.DefaultApiKeyQueryParamKey,
+			"query:" + util.DefaultApiKeyQueryParamApiKey,
+			"header:" + util.DefaultApiKeyHeader,
+		}
+	}
+	for _, location := range locations {
+		switch location.Key.(type) {
+		case *scpb.ApiKeyLocation_Query:
+			locationStrs = append(locationStrs, "query:"+location.GetQuery())
+		case *scpb.ApiKeyLocation_Header:
+			locationStrs = append(locationStrs, "header:"+location.GetHeader())
+		case *scpb.ApiKeyLocation_Cookie:
+			locationStrs = append(locationStrs, "cookie:"+location.GetCookie())
+		}
+	}
+
+	return ptypes.MarshalAny(&extauthzpb.ExtAuthzPerRoute{
+		Override: &extauthzpb.ExtAuthzPerRoute_CheckSettings{
+			CheckSettings: &extauthzpb.CheckSettings{
+				ContextExtensions: map[string]string{
+					util.ApiKeyOperationContextKey: operation,
+					util.ApiKeyLocationsContextKey: strings.Join(locationStrs, ","),
+				},
+			},
+		},
+	})
+}
+
+// makeClaimsRbacPerRoute overrides the RBAC filter for a route, allowing the
+// requests with a JWT payload that has all the claims.
+func makeClaimsRbacPerRoute(requirements []*configinfo.ClaimRequirement) (*anypb.Any, error) {
+	var ids []*rbacconfigpb.Principal
+	for _, requirement := range requirements {
+		ids = append(ids, &rbacconfigpb.Principal{
+			Identifier: &rbacconfigpb.Principal_Metadata{
+				Metadata: &matcher.MetadataMatcher{
+					Filter: util.JwtAuthn,
+					Path: []*matcher.MetadataMatcher_PathSegment{
+						{
+							Segment: &matcher.MetadataMatcher_PathSegment_Key{Key: util.JwtPayloadMetadataName},
+						},
+						{
+							Segment: &matcher.MetadataMatcher_PathSegment_Key{Key: requirement.Claim},
+						},
+					},
+					Value: makeClaimValueMatcher(requirement),
+				},
+			},
+		})
+	}
+
+	return ptypes.MarshalAny(&rbacpb.RBACPerRoute{
+		Rbac: &rbacpb.RBAC{
+			Rules: &rbacconfigpb.RBAC{
+				Action: rbacconfigpb.RBAC_ALLOW,
+				Policies: map[string]*rbacconfigpb.Policy{
+					claimsPolicyName: {
+						Permissions: []*rbacconfigpb.Permission{
+							{
+								Rule: &rbacconfigpb.Permission_Any{Any: true},
+							},
+						},
+						Principals: []*rbacconfigpb.Principal{
+							{
+								Identifier: &rbacconfigpb.Principal_AndIds{
+									AndIds: &rbacconfigpb.Principal_Set{Ids: ids},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+}
+
+func makeClaimValueMatcher(requirement *configinfo.ClaimRequirement) *matcher.ValueMatcher {
+	switch {
+	case requirement.Includes != "":
+		return &matcher.ValueMatcher{
+			MatchPattern: &matcher.ValueMatcher_ListMatch{
+				ListMatch: &matcher.ListMatcher{
+					MatchPattern: &matcher.ListMatcher_OneOf{
+						OneOf: makeStringValueMatcher(&matcher.StringMatcher{
+							MatchPattern: &matcher.StringMatcher_Exact{Exact: requirement.Includes},
+						}),
+					},
+				},
+			},
+		}
+	case requirement.HasScope != "":
+		return makeStringValueMatcher(&matcher.StringMatcher{
+			MatchPattern: &matcher.StringMatcher_SafeRegex{
+				SafeRegex: &matcher.RegexMatcher{
+					EngineType: &matcher.RegexMatcher_GoogleRe2{
+						GoogleRe2: &matcher.RegexMatcher_GoogleRE2{},
+					},
+					Regex: fmt.Sprintf(`(^| )%s( |$)`, regexp.QuoteMeta(requirement.HasScope)),
+				},
+			},
+		})
+	default:
+		return makeStringValueMatcher(&matcher.StringMatcher{
+			MatchPattern: &matcher.StringMatcher_Exact{Exact: requirement.Equals},
+		})
+	}
+}
+
+func makeStringValueMatcher(stringMatcher *matcher.StringMatcher) *matcher.ValueMatcher {
+	return &matcher.ValueMatcher{
+		MatchPattern: &matcher.ValueMatcher_StringMatch{
+			StringMatch: stringMatcher,
+		},
+	}
+}
+
+// makeClaimHeaderValue formats the claim from the JWT payload written to the
+// dynamic metadata by the JWT Authn filter.
+func makeClaimHeaderValue(claimPath []string) string {
+	keys := []string{util.JwtAuthn, util.JwtPayloadMetadataName}
+	keys = append(keys, claimPath...)
+	quotedKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		quotedKeys = append(quotedKeys, strconv.Quote(key))
+	}
+	return fmt.Sprintf("%%DYNAMIC_METADATA([%s])%%", strings.Join(quotedKeys, ", "))
+}
+
+// makeCanaryRoutes returns a copy of the primary route for each header canary
+// backend of the method, and splits the primary route between the primary and
+// the percent canary backend.
+//
+// Host rewrite is consistent with the primary backend: canary requests are
+// sent with the canary hostname only if the primary backend rewrites the host.
+func makeCanaryRoutes(primary *routepb.Route, primaryClusterName, primaryHostname string, canaries []*configinfo.CanaryBackend) []*routepb.Route {
+	var canaryRoutes []*routepb.Route
+	rewriteHost := primaryHostname != ""
+
+	for _, canary := range canaries {
+		if canary.Percent != 0 {
+			primary.GetRoute().ClusterSpecifier = &routepb.RouteAction_WeightedClusters{
+				WeightedClusters: &routepb.WeightedCluster{
+					Clusters: []*routepb.WeightedCluster_ClusterWeight{
+						{
+							Name:   primaryClusterName,
+							Weight: &wrapperspb.UInt32Value{Value: 100 - canary.Percent},
+						},
+						{
+							Name:   canary.ClusterName,
+							Weight: &wrapperspb.UInt32Value{Value: canary.Percent},
+						},
+					},
+					TotalWeight: &wrapperspb.UInt32Value{Value: 100},
+				},
+			}
+			if rewriteHost {
+				// Host rewrite literal applies to all the weighted clusters, so use the
+				// DNS name of the upstream host picked by either cluster.
+				primary.GetRoute().HostRewriteSpecifier = &routepb.RouteAction_AutoHostRewrite{
+					AutoHostRewrite: &wrapperspb.BoolValue{Value: true},
+				}
+			}
+			continue
+		}
+
+		r := proto.Clone(primary).(*routepb.Route)
+		r.Match.Headers = append(r.Match.Headers, makeCanaryHeaderMatcher(canary.HeaderName, canary.HeaderValue))
+		r.GetRoute().ClusterSpecifier = &routepb.RouteAction_Cluster{
+			Cluster: canary.ClusterName,
+		}
+		r.GetRoute().HashPolicy = nil
+		if rewriteHost {
+			r.GetRoute().HostRewriteSpecifier = &routepb.RouteAction_HostRewriteLiteral{
+				HostRewriteLiteral: canary.Hostname,
+			}
+		}
+		canaryRoutes = append(canaryRoutes, r)
+	}
+	return canaryRoutes
+}
+
+func makeCanaryHeaderMatcher(name, value string) *routepb.HeaderMatcher {
+	if value == "" {
+		return &routepb.HeaderMatcher{
+			Name: name,
+			HeaderMatchSpecifier: &routepb.HeaderMatcher_PresentMatch{
+				PresentMatch: true,
+			},
+		}
+	}
+	return &routepb.HeaderMatcher{
+		Name: name,
+		HeaderMatchSpecifier: &routepb.HeaderMatcher_ExactMatch{
+			ExactMatch: value,
+		},
+	}
+}
+
+func makeShadowMirrorPolicy(serviceInfo *configinfo.ServiceInfo) *routepb.RouteAction_RequestMirrorPolicy {
+	return &routepb.RouteAction_RequestMirrorPolicy{
+		Cluster: serviceInfo.ShadowBackendCluster.ClusterName,
+		RuntimeFraction: &corepb.RuntimeFractionalPercent{
+			DefaultValue: &typepb.FractionalPercent{
+				Numerator:   uint32(serviceInfo.Options.BackendShadowPercent),
+				Denominator: typepb.FractionalPercent_HUNDRED,
+			},
+			RuntimeKey: util.BackendShadowRuntimeKey,
+		},
+	}
+}
+
+// makeVirtualClusters creates a virtual cluster for each HTTP rule so Envoy
+// emits per-operation request stats. Virtual clusters are matched on the
+// request headers only, and the :path header includes the query string.
+func makeVirtualClusters(serviceInfo *configinfo.ServiceInfo) ([]*routepb.VirtualCluster, error) {
+	maxOperationStats := serviceInfo.Options.MaxOperationStats
+	if maxOperationStats <= 0 {
+		return nil, fmt.Errorf("max_operation_stats must be > 0, got %v", maxOperationStats)
+	}
+
+	var virtualClusters []*routepb.VirtualCluster
+	for _, operation := range serviceInfo.Operations {
+		method := serviceInfo.Methods[operation]
+		if method.IsGenerated {
+			continue
+		}
+
+		for i, httpRule := range method.HttpRule {
+			if len(virtualClusters) == maxOperationStats {
+				glog.Warningf("only the first %v HTTP rules have operation stats, the others are counted in vcluster.other", maxOperationStats)
+				return virtualClusters, nil
+			}
+
+			pathRegex, err := util.WildcardMatcherForPath(httpRule.UriTemplate)
+			if err != nil {
+				return nil, err
+			}
+			if pathRegex == "" {
+				pathRegex = regexp.QuoteMeta(httpRule.UriTemplate)
+			} else {
+				pathRegex = strings.TrimSuffix(strings.TrimPrefix(pathRegex, "^"), "$")
+			}
+			pathRegex = "^" + pathRegex + `(\?.*)?$`
+			if err := util.ValidateRegexProgramSize(pathRegex, util.GoogleRE2MaxProgramSize); err != nil {
+				return nil, fmt.Errorf("invalid virtual cluster path regex: %v, generated by UriTemplate: %s", err, httpRule.UriTemplate)
+			}
+
+			headers := []*routepb.HeaderMatcher{
+				{
+					Name: ":path",
+					HeaderMatchSpecifier: &routepb.HeaderMatcher_SafeRegexMatch{
+						SafeRegexMatch: &matcher.RegexMatcher{
+							EngineType: &matcher.RegexMatcher_GoogleRe2{
+								GoogleRe2: &matcher.RegexMatcher_GoogleRE2{},
+							},
+							Regex: pathRegex,
+						},
+					},
+				},
+			}
+			if httpRule.HttpMethod != "*" {
+				headers = append(headers, &routepb.HeaderMatcher{
+					Name: ":method",
+					HeaderMatchSpecifier: &routepb.HeaderMatcher_ExactMatch{
+						ExactMatch: httpRule.HttpMethod,
+					},
+				})
+			}
+
+			// The name is a stat name segment, additional bindings get a suffix.
+			name := operationStatName(operation)
+			if i > 0 {
+				name = fmt.Sprintf("%s_%d", name, i)
+			}
+			virtualClusters = append(virtualClusters, &routepb.VirtualCluster{
+				Name:    name,
+				Headers: headers,
+			})
+		}
+	}
+	return virtualClusters, nil
+}
+
+// operationStatName replaces the characters that Envoy's tag extraction does
+// not accept in a virtual cluster name.
+func operationStatName(operation string) string {
+	return nonWordCharRegex.ReplaceAllString(operation, "_")
+}
+
 func makeHttpRouteMatcher(httpRule *commonpb.Pattern) (*routepb.RouteMatch, error) {
 	if httpRule == nil {
 		return nil, fmt.Errorf("httpRule is nil")
 	}
 	var routeMatcher routepb.RouteMatch
 
-	regex := util.WildcardMatcherForPath(httpRule.UriTemplate)
+	regex, err := util.WildcardMatcherForPath(httpRule.UriTemplate)
+	if err != nil {
+		return nil, err
+	}
 	if regex == "" {
 		// Match with HttpHeader method. Some methods may have same path.
 		routeMatcher = routepb.RouteMatch{
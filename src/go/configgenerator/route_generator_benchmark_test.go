@@ -0,0 +1,120 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configgenerator
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/tests/env/testdata"
+	"github.com/golang/protobuf/proto"
+
+	annotationspb "google.golang.org/genproto/googleapis/api/annotations"
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+// makeLargeServiceConfig scales up the fake bookstore service config, with
+// copies of its APIs and http rules under the paths /c{i}, until it has at
+// least the number of methods.
+func makeLargeServiceConfig(numMethods int) *confpb.Service {
+	bookstore := testdata.FakeBookstoreConfig
+	serviceConfig := &confpb.Service{
+		Name: bookstore.Name,
+		Id:   bookstore.Id,
+		Http: &annotationspb.Http{},
+	}
+
+	for i := 0; len(serviceConfig.Apis) == 0 || countMethods(serviceConfig) < numMethods; i++ {
+		for _, api := range bookstore.Apis {
+			api := proto.Clone(api).(*apipb.Api)
+			api.Name = fmt.Sprintf("%s%d", api.Name, i)
+			serviceConfig.Apis = append(serviceConfig.Apis, api)
+		}
+		for _, rule := range bookstore.Http.Rules {
+			rule := proto.Clone(rule).(*annotationspb.HttpRule)
+			sep := strings.LastIndex(rule.Selector, ".")
+			rule.Selector = fmt.Sprintf("%s%d%s", rule.Selector[:sep], i, rule.Selector[sep:])
+			prefixHttpRule(rule, fmt.Sprintf("/c%d", i))
+			serviceConfig.Http.Rules = append(serviceConfig.Http.Rules, rule)
+		}
+	}
+	return serviceConfig
+}
+
+func countMethods(serviceConfig *confpb.Service) int {
+	n := 0
+	for _, api := range serviceConfig.Apis {
+		n += len(api.Methods)
+	}
+	return n
+}
+
+func prefixHttpRule(rule *annotationspb.HttpRule, prefix string) {
+	switch p := rule.Pattern.(type) {
+	case *annotationspb.HttpRule_Get:
+		p.Get = prefix + p.Get
+	case *annotationspb.HttpRule_Put:
+		p.Put = prefix + p.Put
+	case *annotationspb.HttpRule_Post:
+		p.Post = prefix + p.Post
+	case *annotationspb.HttpRule_Delete:
+		p.Delete = prefix + p.Delete
+	case *annotationspb.HttpRule_Patch:
+		p.Patch = prefix + p.Patch
+	case *annotationspb.HttpRule_Custom:
+		p.Custom.Path = prefix + p.Custom.Path
+	}
+	for _, binding := range rule.AdditionalBindings {
+		prefixHttpRule(binding, prefix)
+	}
+}
+
+// BenchmarkMakeRouteConfig compares the route table modes for large service
+// configs. It reports the number of routes, the size of the route config and
+// the time to generate it.
+func BenchmarkMakeRouteConfig(b *testing.B) {
+	for _, mode := range []string{RouteTableFlat, RouteTableGrouped} {
+		for _, numMethods := range []int{100, 1000, 3000} {
+			b.Run(fmt.Sprintf("%s/methods=%d", mode, numMethods), func(b *testing.B) {
+				serviceConfig := makeLargeServiceConfig(numMethods)
+				opts := options.DefaultConfigGeneratorOptions()
+				opts.RouteTableMode = mode
+				serviceInfo, err := configinfo.NewServiceInfoFromServiceConfig(serviceConfig, serviceConfig.Id, opts)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				b.ResetTimer()
+				start := time.Now()
+				for i := 0; i < b.N; i++ {
+					routeConfig, err := MakeRouteConfig(serviceInfo)
+					if err != nil {
+						b.Fatal(err)
+					}
+					if i == 0 {
+						b.ReportMetric(float64(len(routeConfig.VirtualHosts[0].Routes)), "routes")
+						b.ReportMetric(float64(proto.Size(routeConfig)), "config-bytes")
+					}
+				}
+				b.ReportMetric(float64(time.Since(start).Milliseconds())/float64(b.N), "generation-ms")
+			})
+		}
+	}
+}
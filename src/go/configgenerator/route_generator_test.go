@@ -22,11 +22,13 @@ import (
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/testutil"
 	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/proto"
 
 	routepb "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
 	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
+	typepb "github.com/envoyproxy/go-control-plane/envoy/type/v3"
 	wrapperspb "github.com/golang/protobuf/ptypes/wrappers"
 	annotationspb "google.golang.org/genproto/googleapis/api/annotations"
 	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
@@ -37,6 +39,8 @@ func TestMakeRouteConfig(t *testing.T) {
 	testData := []struct {
 		desc                          string
 		enableStrictTransportSecurity bool
+		optsMergeFunc                 func(opts *options.ConfigGeneratorOptions)
+		backendCanaryRules            string
 		fakeServiceConfig             *confpb.Service
 		wantedError                   string
 		wantRouteConfig               string
@@ -134,7 +138,7 @@ func TestMakeRouteConfig(t *testing.T) {
 						{
 							Selector: "endpoints.examples.bookstore.Bookstore.Foo",
 							Pattern: &annotationspb.HttpRule_Get{
-								Get: "foo",
+								Get: "/foo",
 							},
 						},
 					},
@@ -161,7 +165,7 @@ func TestMakeRouteConfig(t *testing.T) {
                 "name": ":method"
               }
             ],
-            "path": "foo"
+            "path": "/foo"
           },
           "responseHeadersToAdd": [
             {
@@ -246,6 +250,349 @@ func TestMakeRouteConfig(t *testing.T) {
       ]
     }
   ]
+}`,
+		},
+		{
+			desc: "OpenAPI path with variables in a partial segment for remote backend",
+			fakeServiceConfig: &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+					},
+				},
+				Backend: &confpb.Backend{
+					Rules: []*confpb.BackendRule{
+						{
+							Selector:        "endpoints.examples.bookstore.Bookstore.Foo",
+							Address:         "https://testapipb.com/foo",
+							PathTranslation: confpb.BackendRule_CONSTANT_ADDRESS,
+							Authentication: &confpb.BackendRule_JwtAudience{
+								JwtAudience: "bar.com",
+							},
+						},
+					},
+				},
+				Http: &annotationspb.Http{
+					Rules: []*annotationspb.HttpRule{
+						{
+							Selector: "endpoints.examples.bookstore.Bookstore.Foo",
+							Pattern: &annotationspb.HttpRule_Get{
+								Get: "/v1/files/{name}.{ext}",
+							},
+						},
+					},
+				},
+			},
+			wantRouteConfig: `
+{
+  "name":"local_route",
+  "virtualHosts":[
+    {
+      "domains":[
+        "*"
+      ],
+      "name":"backend",
+      "routes":[
+        {
+          "decorator":{
+            "operation":"ingress Foo"
+          },
+          "match":{
+            "headers":[
+              {
+                "exactMatch":"GET",
+                "name":":method"
+              }
+            ],
+            "safeRegex":{
+              "googleRe2":{},
+              "regex":"^/v1/files/[^\\/]+\\.[^\\/]+$"
+            }
+          },
+          "route":{
+            "cluster":"backend-cluster-testapipb.com:443",
+            "hostRewriteLiteral":"testapipb.com",
+            "timeout":"15s"
+          }
+        }
+      ]
+    }
+  ]
+}`,
+		},
+		{
+			desc: "Ring hash on a header for local backend",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.BackendAddress = "http://127.0.0.1:8081,http://127.0.0.1:8082"
+				opts.BackendLbPolicy = "ring_hash"
+				opts.BackendLbHashHeader = "x-user-id"
+			},
+			fakeServiceConfig: &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+						Methods: []*apipb.Method{
+							{
+								Name: "Echo",
+							},
+						},
+					},
+				},
+				Http: &annotationspb.Http{Rules: []*annotationspb.HttpRule{
+					{
+						Selector: fmt.Sprintf("%s.Echo", testApiName),
+						Pattern: &annotationspb.HttpRule_Get{
+							Get: "/echo",
+						},
+					},
+				},
+				},
+			},
+			wantRouteConfig: `
+{
+  "name":"local_route",
+  "virtualHosts":[
+    {
+      "domains":[
+        "*"
+      ],
+      "name":"backend",
+      "routes":[
+        {
+          "decorator":{
+            "operation":"ingress Echo"
+          },
+          "match":{
+            "headers":[
+              {
+                "exactMatch":"GET",
+                "name":":method"
+              }
+            ],
+            "path":"/echo"
+          },
+          "route":{
+            "cluster":"backend-cluster-bookstore.endpoints.project123.cloud.goog_local",
+            "hashPolicy":[
+              {
+                "header":{
+                  "headerName":"x-user-id"
+                }
+              }
+            ],
+            "timeout":"15s"
+          }
+        }
+      ]
+    }
+  ]
+}`,
+		},
+		{
+			desc: "Mirror requests of one operation to the shadow backend",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.BackendShadowAddress = "https://shadow.example.com"
+				opts.BackendShadowPercent = 12
+				opts.BackendShadowOperations = fmt.Sprintf("%s.Echo", testApiName)
+			},
+			fakeServiceConfig: &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+						Methods: []*apipb.Method{
+							{
+								Name: "Echo",
+							},
+							{
+								Name: "Foo",
+							},
+						},
+					},
+				},
+				Http: &annotationspb.Http{Rules: []*annotationspb.HttpRule{
+					{
+						Selector: fmt.Sprintf("%s.Echo", testApiName),
+						Pattern: &annotationspb.HttpRule_Get{
+							Get: "/echo",
+						},
+					},
+					{
+						Selector: fmt.Sprintf("%s.Foo", testApiName),
+						Pattern: &annotationspb.HttpRule_Get{
+							Get: "/foo",
+						},
+					},
+				},
+				},
+			},
+			wantRouteConfig: `
+{
+  "name":"local_route",
+  "virtualHosts":[
+    {
+      "domains":[
+        "*"
+      ],
+      "name":"backend",
+      "routes":[
+        {
+          "decorator":{
+            "operation":"ingress Echo"
+          },
+          "match":{
+            "headers":[
+              {
+                "exactMatch":"GET",
+                "name":":method"
+              }
+            ],
+            "path":"/echo"
+          },
+          "route":{
+            "cluster":"backend-cluster-bookstore.endpoints.project123.cloud.goog_local",
+            "requestMirrorPolicies":[
+              {
+                "cluster":"shadow-backend-cluster-shadow.example.com:443",
+                "runtimeFraction":{
+                  "defaultValue":{
+                    "numerator":12
+                  },
+                  "runtimeKey":"backend_shadow.percent"
+                }
+              }
+            ],
+            "timeout":"15s"
+          }
+        },
+        {
+          "decorator":{
+            "operation":"ingress Foo"
+          },
+          "match":{
+            "headers":[
+              {
+                "exactMatch":"GET",
+                "name":":method"
+              }
+            ],
+            "path":"/foo"
+          },
+          "route":{
+            "cluster":"backend-cluster-bookstore.endpoints.project123.cloud.goog_local",
+            "timeout":"15s"
+          }
+        }
+      ]
+    }
+  ]
+}`,
+		},
+		{
+			desc: "Header and percent canary for remote backend",
+			backendCanaryRules: `{"rules": [
+  {"selector": "endpoints.examples.bookstore.Bookstore.Foo", "address": "https://canary.testapipb.com/foo", "header": {"name": "x-canary", "value": "true"}},
+  {"selector": "endpoints.examples.bookstore.Bookstore.Foo", "address": "https://canary.testapipb.com/foo", "percent": 5}
+]}`,
+			fakeServiceConfig: &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+					},
+				},
+				Backend: &confpb.Backend{
+					Rules: []*confpb.BackendRule{
+						{
+							Selector:        "endpoints.examples.bookstore.Bookstore.Foo",
+							Address:         "https://testapipb.com/foo",
+							PathTranslation: confpb.BackendRule_CONSTANT_ADDRESS,
+							Authentication: &confpb.BackendRule_JwtAudience{
+								JwtAudience: "bar.com",
+							},
+						},
+					},
+				},
+				Http: &annotationspb.Http{
+					Rules: []*annotationspb.HttpRule{
+						{
+							Selector: "endpoints.examples.bookstore.Bookstore.Foo",
+							Pattern: &annotationspb.HttpRule_Get{
+								Get: "/foo",
+							},
+						},
+					},
+				},
+			},
+			wantRouteConfig: `
+{
+  "name":"local_route",
+  "virtualHosts":[
+    {
+      "domains":[
+        "*"
+      ],
+      "name":"backend",
+      "routes":[
+        {
+          "decorator":{
+            "operation":"ingress Foo"
+          },
+          "match":{
+            "headers":[
+              {
+                "exactMatch":"GET",
+                "name":":method"
+              },
+              {
+                "exactMatch":"true",
+                "name":"x-canary"
+              }
+            ],
+            "path":"/foo"
+          },
+          "route":{
+            "cluster":"backend-cluster-canary.testapipb.com:443",
+            "hostRewriteLiteral":"canary.testapipb.com",
+            "timeout":"15s"
+          }
+        },
+        {
+          "decorator":{
+            "operation":"ingress Foo"
+          },
+          "match":{
+            "headers":[
+              {
+                "exactMatch":"GET",
+                "name":":method"
+              }
+            ],
+            "path":"/foo"
+          },
+          "route":{
+            "autoHostRewrite":true,
+            "timeout":"15s",
+            "weightedClusters":{
+              "clusters":[
+                {
+                  "name":"backend-cluster-testapipb.com:443",
+                  "weight":95
+                },
+                {
+                  "name":"backend-cluster-canary.testapipb.com:443",
+                  "weight":5
+                }
+              ],
+              "totalWeight":100
+            }
+          }
+        }
+      ]
+    }
+  ]
 }`,
 		},
 		{
@@ -274,7 +621,7 @@ func TestMakeRouteConfig(t *testing.T) {
 						{
 							Selector: "endpoints.examples.bookstore.Bookstore.Foo",
 							Pattern: &annotationspb.HttpRule_Get{
-								Get: getOverSizeRegexForTest(),
+								Get: getOverSizeUriTemplateForTest(),
 							},
 						},
 					},
@@ -288,6 +635,14 @@ func TestMakeRouteConfig(t *testing.T) {
 		t.Run(tc.desc, func(t *testing.T) {
 			opts := options.DefaultConfigGeneratorOptions()
 			opts.EnableHSTS = tc.enableStrictTransportSecurity
+			if tc.optsMergeFunc != nil {
+				tc.optsMergeFunc(&opts)
+			}
+			if tc.backendCanaryRules != "" {
+				path, removeFile := testutil.WriteTempFile(t, "backend_canary_rules", tc.backendCanaryRules)
+				defer removeFile()
+				opts.BackendCanaryRulesPath = path
+			}
 			fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(tc.fakeServiceConfig, testConfigID, opts)
 			if err != nil {
 				t.Fatal(err)
@@ -443,7 +798,612 @@ func TestMakeRouteConfigForCors(t *testing.T) {
 	}
 }
 
-// Used to generate a oversize cors origin regex or a oversize wildcard uri template.
+func TestMakeVirtualClusters(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "GetShelf",
+					},
+					{
+						Name: "Echo",
+					},
+				},
+			},
+		},
+		Http: &annotationspb.Http{Rules: []*annotationspb.HttpRule{
+			{
+				Selector: fmt.Sprintf("%s.GetShelf", testApiName),
+				Pattern: &annotationspb.HttpRule_Get{
+					Get: "/v1/shelves/{shelf}",
+				},
+				AdditionalBindings: []*annotationspb.HttpRule{
+					{
+						Pattern: &annotationspb.HttpRule_Post{
+							Post: "/v1/shelves/{shelf}:get",
+						},
+					},
+				},
+			},
+			{
+				Selector: fmt.Sprintf("%s.Echo", testApiName),
+				Pattern: &annotationspb.HttpRule_Get{
+					Get: "/v1/echo.json",
+				},
+			},
+		},
+		},
+	}
+
+	testData := []struct {
+		desc                string
+		maxOperationStats   int
+		wantVirtualClusters string
+		wantedError         string
+	}{
+		{
+			desc:              "Virtual clusters for all HTTP rules",
+			maxOperationStats: 100,
+			wantVirtualClusters: `{"virtualClusters": [
+				{
+					"name": "endpoints_examples_bookstore_Bookstore_GetShelf",
+					"headers": [
+						{"name": ":path", "safeRegexMatch": {"googleRe2": {}, "regex": "^/v1/shelves/[^\\/]+(\\?.*)?$"}},
+						{"name": ":method", "exactMatch": "GET"}
+					]
+				},
+				{
+					"name": "endpoints_examples_bookstore_Bookstore_GetShelf_1",
+					"headers": [
+						{"name": ":path", "safeRegexMatch": {"googleRe2": {}, "regex": "^/v1/shelves/[^\\/]+:get(\\?.*)?$"}},
+						{"name": ":method", "exactMatch": "POST"}
+					]
+				},
+				{
+					"name": "endpoints_examples_bookstore_Bookstore_Echo",
+					"headers": [
+						{"name": ":path", "safeRegexMatch": {"googleRe2": {}, "regex": "^/v1/echo\\.json(\\?.*)?$"}},
+						{"name": ":method", "exactMatch": "GET"}
+					]
+				}
+			]}`,
+		},
+		{
+			desc:              "Virtual clusters are bounded",
+			maxOperationStats: 1,
+			wantVirtualClusters: `{"virtualClusters": [
+				{
+					"name": "endpoints_examples_bookstore_Bookstore_GetShelf",
+					"headers": [
+						{"name": ":path", "safeRegexMatch": {"googleRe2": {}, "regex": "^/v1/shelves/[^\\/]+(\\?.*)?$"}},
+						{"name": ":method", "exactMatch": "GET"}
+					]
+				}
+			]}`,
+		},
+		{
+			desc:              "Invalid max operation stats",
+			maxOperationStats: 0,
+			wantedError:       "max_operation_stats must be > 0",
+		},
+	}
+
+	for _, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.EnableOperationStats = true
+		opts.MaxOperationStats = tc.maxOperationStats
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+		if err != nil {
+			if tc.wantedError == "" || !strings.Contains(err.Error(), tc.wantedError) {
+				t.Errorf("Test (%s): expected err: %v, got: %v", tc.desc, tc.wantedError, err)
+			}
+			continue
+		}
+		if tc.wantedError != "" {
+			t.Errorf("Test (%s): expected err: %v, got no err", tc.desc, tc.wantedError)
+			continue
+		}
+
+		var gotVirtualClusters []string
+		for _, vc := range gotRoute.GetVirtualHosts()[0].GetVirtualClusters() {
+			jsonStr, err := util.ProtoToJson(vc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotVirtualClusters = append(gotVirtualClusters, jsonStr)
+		}
+		if err := util.JsonEqual(tc.wantVirtualClusters, `{"virtualClusters": [`+strings.Join(gotVirtualClusters, ",")+"]}"); err != nil {
+			t.Errorf("Test (%s): failed, \n %v ", tc.desc, err)
+		}
+	}
+}
+
+func TestMakeRouteConfigForCorsPolicy(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "GetShelf",
+					},
+				},
+			},
+		},
+		Endpoints: []*confpb.Endpoint{
+			{
+				Name:      testProjectName,
+				AllowCors: true,
+			},
+		},
+		Http: &annotationspb.Http{Rules: []*annotationspb.HttpRule{
+			{
+				Selector: fmt.Sprintf("%s.GetShelf", testApiName),
+				Pattern: &annotationspb.HttpRule_Get{
+					Get: "/v1/shelves/{shelf}",
+				},
+			},
+		},
+		},
+	}
+
+	testData := []struct {
+		desc       string
+		policyFile string
+		wantCors   string
+	}{
+		{
+			desc: "Route CORS policy with exact and regex origins",
+			policyFile: `{"policies": [
+  {"selector": "endpoints.examples.bookstore.Bookstore", "allowOrigins": ["https://example.com"], "allowOriginRegexes": ["https://[^.]+\\.example\\.com"],
+   "allowMethods": ["GET", "OPTIONS"], "allowHeaders": ["authorization"], "exposeHeaders": ["x-request-id"], "allowCredentials": true, "maxAge": 3600}
+]}`,
+			wantCors: `{
+				"allowOriginStringMatch": [
+					{"exact": "https://example.com"},
+					{"safeRegex": {"googleRe2": {}, "regex": "https://[^.]+\\.example\\.com"}}
+				],
+				"allowMethods": "GET,OPTIONS",
+				"allowHeaders": "authorization",
+				"exposeHeaders": "x-request-id",
+				"maxAge": "3600",
+				"allowCredentials": true
+			}`,
+		},
+		{
+			desc: "Route CORS policy without max age",
+			policyFile: `{"policies": [
+  {"selector": "endpoints.examples.bookstore.Bookstore.GetShelf", "allowOrigins": ["https://example.com"]}
+]}`,
+			wantCors: `{
+				"allowOriginStringMatch": [
+					{"exact": "https://example.com"}
+				],
+				"allowCredentials": false
+			}`,
+		},
+	}
+
+	for _, tc := range testData {
+		path, removeFile := testutil.WriteTempFile(t, "cors_policy", tc.policyFile)
+		defer removeFile()
+
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.CorsPolicyPath = path
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+		if err != nil {
+			t.Fatalf("Test (%s): got err: %v", tc.desc, err)
+		}
+
+		// Both the GET route and the OPTIONS route of the autogenerated CORS operation get the policy.
+		routes := gotRoute.GetVirtualHosts()[0].GetRoutes()
+		if len(routes) != 2 {
+			t.Fatalf("Test (%s): got %d routes, want 2", tc.desc, len(routes))
+		}
+		for _, r := range routes {
+			gotCors, err := util.ProtoToJson(r.GetRoute().GetCors())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := util.JsonEqual(tc.wantCors, gotCors); err != nil {
+				t.Errorf("Test (%s): failed route %v, \n %v ", tc.desc, r.GetMatch(), err)
+			}
+		}
+	}
+}
+
+func TestMakeRouteConfigForClaimsPolicy(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "CreateBook",
+					},
+					{
+						Name: "ListBooks",
+					},
+				},
+			},
+		},
+		Http: &annotationspb.Http{Rules: []*annotationspb.HttpRule{
+			{
+				Selector: fmt.Sprintf("%s.CreateBook", testApiName),
+				Pattern: &annotationspb.HttpRule_Post{
+					Post: "/v1/books",
+				},
+			},
+			{
+				Selector: fmt.Sprintf("%s.ListBooks", testApiName),
+				Pattern: &annotationspb.HttpRule_Get{
+					Get: "/v1/books",
+				},
+			},
+		},
+		},
+		Authentication: &confpb.Authentication{
+			Providers: []*confpb.AuthProvider{
+				{
+					Id:      "auth_provider",
+					Issuer:  "issuer@example.com",
+					JwksUri: "https://issuer.example.com/jwks",
+				},
+			},
+			Rules: []*confpb.AuthenticationRule{
+				{
+					Selector: fmt.Sprintf("%s.CreateBook", testApiName),
+					Requirements: []*confpb.AuthRequirement{
+						{
+							ProviderId: "auth_provider",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	path, removeFile := testutil.WriteTempFile(t, "jwt_claims_policy", `{"rules": [
+  {"selector": "endpoints.examples.bookstore.Bookstore.CreateBook", "claims": [
+    {"claim": "scope", "hasScope": "books.write"},
+    {"claim": "groups", "includes": "admin"},
+    {"claim": "tenant", "equals": "tenant-1"}
+  ]}
+]}`)
+	defer removeFile()
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.JwtClaimsPolicyPath = path
+	fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotConfigs []string
+	for _, r := range gotRoute.GetVirtualHosts()[0].GetRoutes() {
+		jsonStr, err := util.ProtoToJson(&routepb.Route{TypedPerFilterConfig: r.GetTypedPerFilterConfig()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotConfigs = append(gotConfigs, jsonStr)
+	}
+
+	wantConfigs := `{"routes": [
+		{
+			"typedPerFilterConfig": {
+				"envoy.filters.http.rbac": {
+					"@type": "type.googleapis.com/envoy.extensions.filters.http.rbac.v3.RBACPerRoute",
+					"rbac": {
+						"rules": {
+							"policies": {
+								"jwt-claims": {
+									"permissions": [{"any": true}],
+									"principals": [
+										{
+											"andIds": {
+												"ids": [
+													{
+														"metadata": {
+															"filter": "envoy.filters.http.jwt_authn",
+															"path": [{"key": "jwt_payloads"}, {"key": "scope"}],
+															"value": {"stringMatch": {"safeRegex": {"googleRe2": {}, "regex": "(^| )books\\.write( |$)"}}}
+														}
+													},
+													{
+														"metadata": {
+															"filter": "envoy.filters.http.jwt_authn",
+															"path": [{"key": "jwt_payloads"}, {"key": "groups"}],
+															"value": {"listMatch": {"oneOf": {"stringMatch": {"exact": "admin"}}}}
+														}
+													},
+													{
+														"metadata": {
+															"filter": "envoy.filters.http.jwt_authn",
+															"path": [{"key": "jwt_payloads"}, {"key": "tenant"}],
+															"value": {"stringMatch": {"exact": "tenant-1"}}
+														}
+													}
+												]
+											}
+										}
+									]
+								}
+							}
+						}
+					}
+				}
+			}
+		},
+		{}
+	]}`
+	if err := util.JsonEqual(wantConfigs, `{"routes": [`+strings.Join(gotConfigs, ",")+"]}"); err != nil {
+		t.Errorf("Test failed, \n %v ", err)
+	}
+}
+
+func TestMakeRouteConfigForClaimHeaders(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "GetBook",
+					},
+					{
+						Name: "ListBooks",
+					},
+				},
+			},
+		},
+		Http: &annotationspb.Http{Rules: []*annotationspb.HttpRule{
+			{
+				Selector: fmt.Sprintf("%s.GetBook", testApiName),
+				Pattern: &annotationspb.HttpRule_Get{
+					Get: "/v1/books/{book}",
+				},
+			},
+			{
+				Selector: fmt.Sprintf("%s.ListBooks", testApiName),
+				Pattern: &annotationspb.HttpRule_Get{
+					Get: "/v1/books",
+				},
+			},
+		},
+		},
+		Authentication: &confpb.Authentication{
+			Providers: []*confpb.AuthProvider{
+				{
+					Id:      "auth_provider",
+					Issuer:  "issuer@example.com",
+					JwksUri: "https://issuer.example.com/jwks",
+				},
+			},
+			Rules: []*confpb.AuthenticationRule{
+				{
+					Selector: fmt.Sprintf("%s.GetBook", testApiName),
+					Requirements: []*confpb.AuthRequirement{
+						{
+							ProviderId: "auth_provider",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.JwtClaimHeaders = `{"auth_provider": {"sub": "X-User-Id", "address.country": "X-User-Country"}}`
+	fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotHeaders := make(map[string]string)
+	for _, r := range gotRoute.GetVirtualHosts()[0].GetRoutes() {
+		headers, err := util.ProtoToJson(&routepb.Route{
+			RequestHeadersToAdd:    r.GetRequestHeadersToAdd(),
+			RequestHeadersToRemove: r.GetRequestHeadersToRemove(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotHeaders[r.GetDecorator().GetOperation()] = headers
+	}
+
+	wantHeaders := map[string]string{
+		"ingress GetBook": `{
+		"requestHeadersToAdd": [
+			{
+				"header": {
+					"key": "X-User-Country",
+					"value": "%DYNAMIC_METADATA([\"envoy.filters.http.jwt_authn\", \"jwt_payloads\", \"address\", \"country\"])%"
+				},
+				"append": false
+			},
+			{
+				"header": {
+					"key": "X-User-Id",
+					"value": "%DYNAMIC_METADATA([\"envoy.filters.http.jwt_authn\", \"jwt_payloads\", \"sub\"])%"
+				},
+				"append": false
+			}
+		],
+		"requestHeadersToRemove": ["X-User-Country", "X-User-Id"]
+	}`,
+		// Without JWT, the headers sent by the client are removed and not added back.
+		"ingress ListBooks": `{
+		"requestHeadersToRemove": ["X-User-Country", "X-User-Id"]
+	}`,
+	}
+	if len(gotHeaders) != len(wantHeaders) {
+		t.Fatalf("got routes %v, want routes %v", gotHeaders, wantHeaders)
+	}
+	for operation, want := range wantHeaders {
+		if err := util.JsonEqual(want, gotHeaders[operation]); err != nil {
+			t.Errorf("Test failed for route %s, \n %v ", operation, err)
+		}
+	}
+}
+
+func TestMakeRouteConfigForApiKeys(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "GetBook",
+					},
+					{
+						Name: "ListBooks",
+					},
+					{
+						Name: "DeleteBook",
+					},
+				},
+			},
+		},
+		Http: &annotationspb.Http{Rules: []*annotationspb.HttpRule{
+			{
+				Selector: fmt.Sprintf("%s.GetBook", testApiName),
+				Pattern: &annotationspb.HttpRule_Get{
+					Get: "/v1/books/{book}",
+				},
+			},
+			{
+				Selector: fmt.Sprintf("%s.ListBooks", testApiName),
+				Pattern: &annotationspb.HttpRule_Get{
+					Get: "/v1/books",
+				},
+			},
+			{
+				Selector: fmt.Sprintf("%s.DeleteBook", testApiName),
+				Pattern: &annotationspb.HttpRule_Delete{
+					Delete: "/v1/books/{book}",
+				},
+			},
+		},
+		},
+		SystemParameters: &confpb.SystemParameters{
+			Rules: []*confpb.SystemParameterRule{
+				{
+					Selector: fmt.Sprintf("%s.GetBook", testApiName),
+					Parameters: []*confpb.SystemParameter{
+						{
+							Name:       "api_key",
+							HttpHeader: "x-book-key",
+						},
+					},
+				},
+			},
+		},
+		Usage: &confpb.Usage{
+			Rules: []*confpb.UsageRule{
+				{
+					Selector:               fmt.Sprintf("%s.ListBooks", testApiName),
+					AllowUnregisteredCalls: true,
+				},
+			},
+		},
+	}
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.ApiKeysPath = "/etc/espv2/api_keys.json"
+	fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotRoute, err := MakeRouteConfig(fakeServiceInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotRoutes []*routepb.Route
+	for _, r := range gotRoute.GetVirtualHosts()[0].GetRoutes()[:3] {
+		gotRoutes = append(gotRoutes, &routepb.Route{
+			TypedPerFilterConfig:   r.GetTypedPerFilterConfig(),
+			RequestHeadersToRemove: r.GetRequestHeadersToRemove(),
+		})
+	}
+	gotJson, err := util.ProtoToJson(&routepb.VirtualHost{Routes: gotRoutes})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantJson := `{
+		"routes": [
+			{
+				"typedPerFilterConfig": {
+					"envoy.filters.http.ext_authz": {
+						"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
+						"checkSettings": {
+							"contextExtensions": {
+								"api_key_locations": "header:x-book-key",
+								"operation": "endpoints.examples.bookstore.Bookstore.GetBook"
+							}
+						}
+					}
+				}
+			},
+			{
+				"typedPerFilterConfig": {
+					"envoy.filters.http.ext_authz": {
+						"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
+						"disabled": true
+					}
+				},
+				"requestHeadersToRemove": ["X-Endpoint-API-Consumer"]
+			},
+			{
+				"typedPerFilterConfig": {
+					"envoy.filters.http.ext_authz": {
+						"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
+						"checkSettings": {
+							"contextExtensions": {
+								"api_key_locations": "query:key,query:api_key,header:x-api-key",
+								"operation": "endpoints.examples.bookstore.Bookstore.DeleteBook"
+							}
+						}
+					}
+				}
+			}
+		]
+	}`
+	if err := util.JsonEqual(wantJson, gotJson); err != nil {
+		t.Errorf("Test failed, \n %v ", err)
+	}
+}
+
+// Used to generate a oversize cors origin regex.
 func getOverSizeRegexForTest() string {
 	overSizeRegex := ""
 	for i := 0; i < 333; i += 1 {
@@ -452,3 +1412,47 @@ func getOverSizeRegexForTest() string {
 	}
 	return overSizeRegex
 }
+
+// Used to generate a oversize wildcard uri template.
+func getOverSizeUriTemplateForTest() string {
+	overSizeUriTemplate := ""
+	for i := 0; i < 333; i += 1 {
+		// Use "/*" as it is a replacement token for wildcard uri template.
+		overSizeUriTemplate += "/*"
+	}
+	return overSizeUriTemplate
+}
+
+func TestMakeShadowMirrorPolicy(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+			},
+		},
+	}
+
+	// The runtime override "backend_shadow.percent=5" must mean 5% of the
+	// requests, as the default value does.
+	for _, percent := range []int{0, 5, 100} {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendShadowAddress = "https://shadow.example.com"
+		opts.BackendShadowPercent = percent
+		fakeServiceInfo, err := configinfo.NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := makeShadowMirrorPolicy(fakeServiceInfo).GetRuntimeFraction()
+		if got.GetRuntimeKey() != util.BackendShadowRuntimeKey {
+			t.Errorf("percent %d: got runtime key %q, want %q", percent, got.GetRuntimeKey(), util.BackendShadowRuntimeKey)
+		}
+		if got.GetDefaultValue().GetDenominator() != typepb.FractionalPercent_HUNDRED {
+			t.Errorf("percent %d: got denominator %v, want HUNDRED", percent, got.GetDefaultValue().GetDenominator())
+		}
+		if got.GetDefaultValue().GetNumerator() != uint32(percent) {
+			t.Errorf("percent %d: got numerator %d, want %d", percent, got.GetDefaultValue().GetNumerator(), percent)
+		}
+	}
+}
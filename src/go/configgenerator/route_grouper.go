@@ -0,0 +1,268 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configgenerator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/protobuf/proto"
+
+	routepb "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
+)
+
+const (
+	// One route per http rule.
+	RouteTableFlat = "flat"
+	// The routes of the http rules that only differ by their path are merged
+	// into a route matching a regex of their prefix-grouped templates.
+	RouteTableGrouped = "grouped"
+)
+
+const (
+	// The instructions of a RE2 program that are not compiled from the regex.
+	regexProgramOverhead = 4
+	// The character class of a single wildcard, literals are escaped so they
+	// never contain it.
+	singleWildcardRegex = `[^\/]`
+)
+
+// routeGroup is a route of the route table, matching the paths of one or more
+// operation routes with the same method and action.
+type routeGroup struct {
+	members []*operationRoute
+	// The position of the group in the route table.
+	position int
+	// The templates of the members.
+	templates *templateTrie
+	// An upper bound of the RE2 program size of the regex of the templates.
+	maxProgramSize int
+}
+
+func newRouteGroup(r *operationRoute, position int) *routeGroup {
+	g := &routeGroup{
+		position:  position,
+		templates: &templateTrie{},
+	}
+	g.templates.insert(r.paths.regexAtoms)
+	g.members = []*operationRoute{r}
+	g.maxProgramSize = regexSizeBound(g.templates.regex()) + regexProgramOverhead
+	return g
+}
+
+// add adds the route to the group if the regex of the group stays under the
+// RE2 program size limit. The regex is only compiled when the upper bound of
+// its program size reaches the limit, its size is then the new bound.
+func (g *routeGroup) add(r *operationRoute) bool {
+	undo, addedSize := g.templates.insert(r.paths.regexAtoms)
+	maxProgramSize := g.maxProgramSize + addedSize
+	if maxProgramSize > util.GoogleRE2MaxProgramSize {
+		programSize, err := util.RegexProgramSize(g.templates.regex())
+		if err != nil || programSize > util.GoogleRE2MaxProgramSize {
+			undo()
+			return false
+		}
+		maxProgramSize = programSize
+	}
+	g.members = append(g.members, r)
+	g.maxProgramSize = maxProgramSize
+	return true
+}
+
+// regexSizeBound returns an upper bound of the RE2 program size of the regex
+// part. Each character compiles to at most one instruction, and a single
+// wildcard to one instruction.
+func regexSizeBound(regex string) int {
+	return len(regex) - (len(singleWildcardRegex)-1)*strings.Count(regex, singleWildcardRegex)
+}
+
+// groupRoutes merges the routes of the http rules that have the same method
+// and action into a route matching the union of their paths. Envoy matches a
+// single regex much faster than a linear list of regex routes, and large APIs
+// have a lot of routes only differing by their path.
+//
+// The routes are in the order of the route analysis. A route joins the last
+// group with the same method and action unless it overlaps a route of another
+// group after it, so merging never changes the route matching a request. The
+// header canary routes are never merged. A group matches the paths of a regex
+// under the RE2 program size limit, a new group is started when it is full.
+//
+// The merged routes send requests to several operations, so the span name of
+// their decorator is the name of the cluster instead of the operation. The
+// other filters get the operation from the Path Matcher filter.
+func groupRoutes(ordered []*operationRoute) ([]*routepb.Route, error) {
+	var groups []*routeGroup
+	lastGroups := make(map[string]*routeGroup)
+	groupOf := make(map[*operationRoute]*routeGroup)
+	for _, r := range ordered {
+		key, ok := routeGroupKey(r)
+		if ok {
+			if g := lastGroups[key]; g != nil && g.canJoin(r, groupOf) && g.add(r) {
+				groupOf[r] = g
+				continue
+			}
+		}
+
+		g := newRouteGroup(r, len(groups))
+		groups = append(groups, g)
+		groupOf[r] = g
+		if ok {
+			lastGroups[key] = g
+		}
+	}
+
+	var routes []*routepb.Route
+	for _, g := range groups {
+		routes = append(routes, g.makeRoutes()...)
+	}
+	return routes, nil
+}
+
+// routeGroupKey returns the method and the action of the route, without its
+// path and decorator. Routes with header canaries are not grouped.
+func routeGroupKey(r *operationRoute) (string, bool) {
+	if len(r.routes) != 1 {
+		return "", false
+	}
+	// Marshal the route without its match and decorator, restoring them
+	// afterwards instead of cloning the whole route.
+	action := r.routes[0]
+	match, decorator := action.Match, action.Decorator
+	action.Match, action.Decorator = nil, nil
+	b := proto.NewBuffer(nil)
+	b.SetDeterministic(true)
+	err := b.Marshal(action)
+	action.Match, action.Decorator = match, decorator
+	if err != nil {
+		return "", false
+	}
+	return r.httpRule.HttpMethod + " " + string(b.Bytes()), true
+}
+
+// canJoin returns whether the route can be matched at the position of the
+// group, without skipping an overlapping route of another group.
+func (g *routeGroup) canJoin(r *operationRoute, groupOf map[*operationRoute]*routeGroup) bool {
+	for _, o := range r.overlapping {
+		if og, ok := groupOf[o]; ok && og != g && og.position > g.position {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *routeGroup) makeRoutes() []*routepb.Route {
+	if len(g.members) == 1 {
+		return g.members[0].routes
+	}
+
+	first := g.members[0].routes[0]
+	r := proto.Clone(first).(*routepb.Route)
+	r.Match = &routepb.RouteMatch{
+		PathSpecifier: &routepb.RouteMatch_SafeRegex{
+			SafeRegex: &matcher.RegexMatcher{
+				EngineType: &matcher.RegexMatcher_GoogleRe2{
+					GoogleRe2: &matcher.RegexMatcher_GoogleRE2{},
+				},
+				Regex: g.templates.regex(),
+			},
+		},
+		Headers: first.GetMatch().GetHeaders(),
+	}
+	r.Decorator = &routepb.Decorator{
+		Operation: fmt.Sprintf("%s %s", util.SpanNamePrefix, first.GetRoute().GetCluster()),
+	}
+	return []*routepb.Route{r}
+}
+
+// templateTrie is a trie of the regex atoms of templates, which factors out
+// their common prefixes.
+type templateTrie struct {
+	atom     string
+	children []*templateTrie
+	// Whether a template ends at this node.
+	terminal bool
+}
+
+// insert adds the template, and returns a function removing it with the
+// regexSizeBound of the characters it adds to the regex.
+func (t *templateTrie) insert(atoms []string) (func(), int) {
+	if len(atoms) == 0 {
+		terminal := t.terminal
+		t.terminal = true
+		addedSize := 0
+		switch {
+		case terminal || len(t.children) == 0:
+		case len(t.children) == 1:
+			// "alt" becomes "(alt)?".
+			addedSize = 3
+		default:
+			// "(alt|...)" becomes "(alt|...)?".
+			addedSize = 1
+		}
+		return func() { t.terminal = terminal }, addedSize
+	}
+	for _, c := range t.children {
+		if c.atom == atoms[0] {
+			return c.insert(atoms[1:])
+		}
+	}
+
+	addedSize := 0
+	for _, atom := range atoms {
+		addedSize += regexSizeBound(atom)
+	}
+	switch {
+	case len(t.children) == 0 && t.terminal:
+		// "" becomes "(alt)?".
+		addedSize += 3
+	case len(t.children) == 1 && !t.terminal:
+		// "alt" becomes "(alt|alt)".
+		addedSize += 3
+	case len(t.children) >= 1:
+		// "|alt" is added to the alternatives.
+		addedSize += 1
+	}
+	c := &templateTrie{atom: atoms[0]}
+	t.children = append(t.children, c)
+	c.insert(atoms[1:])
+	return func() { t.children = t.children[:len(t.children)-1] }, addedSize
+}
+
+// regex returns the regex matching the templates.
+func (t *templateTrie) regex() string {
+	return "^" + t.pattern() + "$"
+}
+
+// pattern returns the regex of the paths after the node.
+func (t *templateTrie) pattern() string {
+	var alternatives []string
+	for _, c := range t.children {
+		alternatives = append(alternatives, c.atom+c.pattern())
+	}
+	switch {
+	case len(alternatives) == 0:
+		return ""
+	case len(alternatives) == 1 && !t.terminal:
+		return alternatives[0]
+	}
+	// Not a non-capturing group, RE2 programs are validated with the POSIX syntax.
+	p := "(" + strings.Join(alternatives, "|") + ")"
+	if t.terminal {
+		p += "?"
+	}
+	return p
+}
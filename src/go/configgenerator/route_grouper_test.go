@@ -0,0 +1,278 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configgenerator
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/google/go-cmp/cmp"
+
+	commonpb "github.com/GoogleCloudPlatform/esp-v2/src/go/proto/api/envoy/v9/http/common"
+	routepb "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+)
+
+func TestGroupRoutes(t *testing.T) {
+	type testRoute struct {
+		operation, httpMethod, uriTemplate, cluster string
+		canary                                      bool
+	}
+	// A route of the table, with its regex or path, and its decorator.
+	type wantRoute struct {
+		method, path, decorator string
+	}
+	testData := []struct {
+		desc       string
+		routes     []testRoute
+		wantRoutes []wantRoute
+	}{
+		{
+			desc: "Routes with the same method and action are merged with their common prefixes",
+			routes: []testRoute{
+				{"ListShelves", "GET", "/v1/shelves", "backend-a", false},
+				{"GetShelf", "GET", "/v1/shelves/{shelf}", "backend-a", false},
+				{"ListBooks", "GET", "/v1/books", "backend-a", false},
+				{"CreateShelf", "POST", "/v1/shelves", "backend-a", false},
+				{"CancelOperation", "POST", "/v1/{name=operations/*}:cancel", "backend-a", false},
+			},
+			wantRoutes: []wantRoute{
+				{"GET", `^/v1(/shelves(/[^\/]+)?|/books)$`, "ingress backend-a"},
+				{"POST", `^/v1(/shelves|/operations/[^\/]+:cancel)$`, "ingress backend-a"},
+			},
+		},
+		{
+			desc: "Routes with different actions are not merged",
+			routes: []testRoute{
+				{"ListShelves", "GET", "/v1/shelves", "backend-a", false},
+				{"ListBooks", "GET", "/v1/books", "backend-b", false},
+			},
+			wantRoutes: []wantRoute{
+				{"GET", "/v1/shelves", "ingress ListShelves"},
+				{"GET", "/v1/books", "ingress ListBooks"},
+			},
+		},
+		{
+			desc: "Routes with header canaries are not merged",
+			routes: []testRoute{
+				{"ListShelves", "GET", "/v1/shelves", "backend-a", true},
+				{"ListBooks", "GET", "/v1/books", "backend-a", false},
+			},
+			wantRoutes: []wantRoute{
+				{"GET", "/v1/shelves", "ingress ListShelves canary"},
+				{"GET", "/v1/shelves", "ingress ListShelves"},
+				{"GET", "/v1/books", "ingress ListBooks"},
+			},
+		},
+		{
+			desc: "Routes are not merged before an overlapping route of another group",
+			routes: []testRoute{
+				{"GetShelf", "GET", "/v1/a/{shelf}", "backend-a", false},
+				{"GetBook", "GET", "/v1/{shelf}/b", "backend-b", false},
+				{"GetAuthor", "GET", "/v1/c/{author}", "backend-a", false},
+				{"ListShelves", "GET", "/v1/shelves", "backend-a", false},
+			},
+			wantRoutes: []wantRoute{
+				{"GET", `^/v1/a/[^\/]+$`, "ingress GetShelf"},
+				{"GET", `^/v1/[^\/]+/b$`, "ingress GetBook"},
+				{"GET", `^/v1(/c/[^\/]+|/shelves)$`, "ingress backend-a"},
+			},
+		},
+	}
+
+	for _, tc := range testData {
+		serviceInfo := &configinfo.ServiceInfo{
+			Options: options.DefaultConfigGeneratorOptions(),
+		}
+		var opRoutes []*operationRoute
+		for _, r := range tc.routes {
+			httpRule := &commonpb.Pattern{
+				HttpMethod:  r.httpMethod,
+				UriTemplate: r.uriTemplate,
+			}
+			match, err := makeHttpRouteMatcher(httpRule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			paths, err := newPathAutomaton(r.uriTemplate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			route := &routepb.Route{
+				Match: match,
+				Action: &routepb.Route_Route{
+					Route: &routepb.RouteAction{
+						ClusterSpecifier: &routepb.RouteAction_Cluster{
+							Cluster: r.cluster,
+						},
+					},
+				},
+				Decorator: &routepb.Decorator{
+					Operation: "ingress " + r.operation,
+				},
+			}
+			opRoute := &operationRoute{
+				operation: r.operation,
+				httpRule:  httpRule,
+				paths:     paths,
+				routes:    []*routepb.Route{route},
+			}
+			if r.canary {
+				opRoute.routes = []*routepb.Route{
+					{
+						Match:     match,
+						Action:    route.Action,
+						Decorator: &routepb.Decorator{Operation: "ingress " + r.operation + " canary"},
+					},
+					route,
+				}
+			}
+			opRoutes = append(opRoutes, opRoute)
+		}
+
+		ordered, err := analyzeRoutes(serviceInfo, opRoutes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := groupRoutes(ordered)
+		if err != nil {
+			t.Errorf("Test Desc(%s): got error: %v", tc.desc, err)
+			continue
+		}
+
+		var gotRoutes []wantRoute
+		for _, r := range got {
+			path := r.GetMatch().GetPath()
+			if path == "" {
+				path = r.GetMatch().GetSafeRegex().GetRegex()
+			}
+			var method []string
+			for _, h := range r.GetMatch().GetHeaders() {
+				method = append(method, h.GetExactMatch())
+			}
+			gotRoutes = append(gotRoutes, wantRoute{strings.Join(method, ","), path, r.GetDecorator().GetOperation()})
+		}
+		if diff := cmp.Diff(tc.wantRoutes, gotRoutes, cmp.AllowUnexported(wantRoute{})); diff != "" {
+			t.Errorf("Test Desc(%s): got routes diff (-want +got):\n%s", tc.desc, diff)
+		}
+	}
+}
+
+func TestGroupRoutesRegexSize(t *testing.T) {
+	serviceInfo := &configinfo.ServiceInfo{
+		Options: options.DefaultConfigGeneratorOptions(),
+	}
+	var opRoutes []*operationRoute
+	for i := 0; i < 200; i++ {
+		uriTemplate := fmt.Sprintf("/v1/resources%d/{id}", i)
+		paths, err := newPathAutomaton(uriTemplate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		httpRule := &commonpb.Pattern{
+			HttpMethod:  "GET",
+			UriTemplate: uriTemplate,
+		}
+		match, err := makeHttpRouteMatcher(httpRule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opRoutes = append(opRoutes, &operationRoute{
+			operation: fmt.Sprintf("Get%d", i),
+			httpRule:  httpRule,
+			paths:     paths,
+			routes: []*routepb.Route{
+				{
+					Match: match,
+					Action: &routepb.Route_Route{
+						Route: &routepb.RouteAction{
+							ClusterSpecifier: &routepb.RouteAction_Cluster{
+								Cluster: "backend",
+							},
+						},
+					},
+				},
+			},
+		})
+	}
+
+	ordered, err := analyzeRoutes(serviceInfo, opRoutes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := groupRoutes(ordered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) < 2 || len(got) >= len(opRoutes)/10 {
+		t.Errorf("got %d routes for %d http rules, want several merged routes", len(got), len(opRoutes))
+	}
+	for _, r := range got {
+		regex := r.GetMatch().GetSafeRegex().GetRegex()
+		if err := util.ValidateRegexProgramSize(regex, util.GoogleRE2MaxProgramSize); err != nil {
+			t.Errorf("got invalid merged route: %v", err)
+		}
+	}
+}
+
+func TestTemplateTrieInsertSize(t *testing.T) {
+	trie := &templateTrie{}
+	size := regexSizeBound(trie.regex())
+	for _, uriTemplate := range []string{
+		"/v1/shelves",
+		"/v1/shelves/{shelf}",
+		"/v1/shelves/{shelf}/books",
+		"/v1/shelves/{shelf}/books/{book}",
+		"/v1/books",
+		"/v1/shelves/{shelf}/books/{book}:cancel",
+		"/v1/shelves/{shelf}",
+		"/v2/{name=**}",
+		"/v1",
+		"/v1/{id}.json",
+	} {
+		template, err := util.ParseHttpTemplate(uriTemplate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		undo, addedSize := trie.insert(template.RegexAtoms())
+		regex := trie.regex()
+		if got, want := size+addedSize, regexSizeBound(regex); got != want {
+			t.Errorf("insert %s: got size %d, want %d of regex %s", uriTemplate, got, want, regex)
+		}
+
+		// Removing and adding the template again gives the same regex.
+		undo()
+		trie.insert(template.RegexAtoms())
+		if got := trie.regex(); got != regex {
+			t.Errorf("insert %s again: got regex %s, want %s", uriTemplate, got, regex)
+		}
+		size = regexSizeBound(regex)
+	}
+}
+
+func TestMakeRouteTableMode(t *testing.T) {
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.RouteTableMode = "nested"
+	serviceInfo := &configinfo.ServiceInfo{
+		Options: opts,
+	}
+	wantError := `route_table_mode must be either "flat" or "grouped", got "nested"`
+	if _, err := makeRouteTable(serviceInfo); err == nil || err.Error() != wantError {
+		t.Errorf("got error: %v, want: %s", err, wantError)
+	}
+}
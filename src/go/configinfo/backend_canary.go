@@ -0,0 +1,165 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/glog"
+
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+)
+
+// CanaryBackend is an alternate backend for an operation. Requests are routed
+// to it either when they carry a header, or for a percentage of traffic.
+type CanaryBackend struct {
+	ClusterName string
+	Hostname    string
+
+	// Header match, the header is only required to be present if HeaderValue is empty.
+	HeaderName  string
+	HeaderValue string
+
+	// Percentage of traffic, between 1 and 99.
+	Percent uint32
+}
+
+// backendCanaryRulesFile is the format of the file at --backend_canary_rules_path.
+type backendCanaryRulesFile struct {
+	Rules []*backendCanaryRule `json:"rules"`
+}
+
+type backendCanaryRule struct {
+	Selector string             `json:"selector"`
+	Address  string             `json:"address"`
+	Header   *canaryHeaderMatch `json:"header,omitempty"`
+	Percent  uint32             `json:"percent,omitempty"`
+}
+
+type canaryHeaderMatch struct {
+	Name  string `json:"name"`
+	Value string `json:"value,omitempty"`
+}
+
+// processBackendCanary reads the canary rules and adds the canary backends to
+// the operations, creating remote backend clusters for them as needed.
+//
+// The backend routing and backend auth filters are configured per operation,
+// not per route, so a canary backend gets the path translation and the ID
+// token audience of the primary backend. Canary rules that would break either
+// are rejected.
+func (s *ServiceInfo) processBackendCanary() error {
+	if s.Options.BackendCanaryRulesPath == "" {
+		return nil
+	}
+
+	var rulesFile backendCanaryRulesFile
+	if err := util.UnmarshalJsonFile(s.Options.BackendCanaryRulesPath, &rulesFile); err != nil {
+		return fmt.Errorf("fail to read backend canary rules: %v", err)
+	}
+
+	clustersByAddress := make(map[string]*BackendRoutingCluster)
+	for _, c := range s.RemoteBackendClusters {
+		clustersByAddress[fmt.Sprintf("%v:%v", c.Hostname, c.Port)] = c
+	}
+
+	for _, rule := range rulesFile.Rules {
+		method, ok := s.Methods[rule.Selector]
+		if !ok {
+			return fmt.Errorf("backend canary rule has unknown operation %q", rule.Selector)
+		}
+
+		scheme, hostname, port, path, err := util.ParseURI(rule.Address)
+		if err != nil {
+			return fmt.Errorf("error parsing backend canary uri for operation %q: %v", rule.Selector, err)
+		}
+		if err := validateCanaryBackend(method, rule, scheme, hostname, path); err != nil {
+			return fmt.Errorf("invalid backend canary rule for operation %q: %v", rule.Selector, err)
+		}
+
+		address := fmt.Sprintf("%v:%v", hostname, port)
+		c, ok := clustersByAddress[address]
+		if !ok {
+			protocol, tls, err := util.ParseBackendProtocol(scheme, "")
+			if err != nil {
+				return err
+			}
+			if protocol == util.GRPC {
+				s.GrpcSupportRequired = true
+			}
+
+			c = &BackendRoutingCluster{
+				ClusterName: util.BackendClusterName(address),
+				UseTLS:      tls,
+				Protocol:    protocol,
+				Hostname:    hostname,
+				Port:        port,
+			}
+			s.RemoteBackendClusters = append(s.RemoteBackendClusters, c)
+			clustersByAddress[address] = c
+		}
+
+		canary := &CanaryBackend{
+			ClusterName: c.ClusterName,
+			Hostname:    hostname,
+			Percent:     rule.Percent,
+		}
+		if rule.Header != nil {
+			canary.HeaderName = rule.Header.Name
+			canary.HeaderValue = rule.Header.Value
+		}
+		method.CanaryBackends = append(method.CanaryBackends, canary)
+		glog.Infof("adding backend canary %s for operation %s", c.ClusterName, rule.Selector)
+	}
+	return nil
+}
+
+func validateCanaryBackend(method *methodInfo, rule *backendCanaryRule, scheme, hostname, path string) error {
+	if (rule.Header == nil) == (rule.Percent == 0) {
+		return fmt.Errorf("exactly one of header or percent must be set")
+	}
+	if rule.Header != nil && rule.Header.Name == "" {
+		return fmt.Errorf("header name must be set")
+	}
+	if rule.Percent >= 100 {
+		return fmt.Errorf("percent must be between 1 and 99, got %v", rule.Percent)
+	}
+	if rule.Percent != 0 {
+		for _, canary := range method.CanaryBackends {
+			if canary.Percent != 0 {
+				return fmt.Errorf("only one percent rule is allowed per operation")
+			}
+		}
+	}
+
+	// Same normalization as addBackendInfoToMethod.
+	if path == "" && method.BackendInfo.TranslationType == confpb.BackendRule_CONSTANT_ADDRESS {
+		path = "/"
+	}
+	if path != method.BackendInfo.Path {
+		return fmt.Errorf("canary address path %q must match the primary backend path %q, path translation is configured per operation", path, method.BackendInfo.Path)
+	}
+
+	// An audience derived from the primary backend address would be sent to the canary backend too.
+	jwtAud := method.BackendInfo.JwtAudience
+	primaryHostname := method.BackendInfo.Hostname
+	isDerivedJwtAud := jwtAud == getJwtAudienceFromBackendAddr("https", primaryHostname) ||
+		jwtAud == getJwtAudienceFromBackendAddr("http", primaryHostname)
+	if jwtAud != "" && isDerivedJwtAud && jwtAud != getJwtAudienceFromBackendAddr(scheme, hostname) {
+		return fmt.Errorf("the canary backend would receive ID tokens with audience %q of the primary backend, set jwt_audience explicitly in the backend rule", jwtAud)
+	}
+	return nil
+}
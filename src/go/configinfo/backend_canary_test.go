@@ -0,0 +1,196 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/testutil"
+
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func TestProcessBackendCanary(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "Foo",
+					},
+					{
+						Name: "Bar",
+					},
+					{
+						Name: "Baz",
+					},
+				},
+			},
+		},
+		Backend: &confpb.Backend{
+			Rules: []*confpb.BackendRule{
+				{
+					Selector:        "endpoints.examples.bookstore.Bookstore.Bar",
+					Address:         "https://bar.example.com/v1",
+					PathTranslation: confpb.BackendRule_APPEND_PATH_TO_ADDRESS,
+				},
+				{
+					Selector:        "endpoints.examples.bookstore.Bookstore.Baz",
+					Address:         "https://baz.example.com",
+					PathTranslation: confpb.BackendRule_CONSTANT_ADDRESS,
+					Authentication: &confpb.BackendRule_JwtAudience{
+						JwtAudience: "baz-audience",
+					},
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc             string
+		rulesFile        string
+		wantCanaries     map[string][]*CanaryBackend
+		wantClusterNames []string
+		wantError        string
+	}{
+		{
+			desc: "Header canary for local backend operation",
+			rulesFile: `{"rules": [
+  {"selector": "endpoints.examples.bookstore.Bookstore.Foo", "address": "http://127.0.0.1:9000", "header": {"name": "x-canary", "value": "true"}}
+]}`,
+			wantCanaries: map[string][]*CanaryBackend{
+				"endpoints.examples.bookstore.Bookstore.Foo": {
+					{
+						ClusterName: "backend-cluster-127.0.0.1:9000",
+						Hostname:    "127.0.0.1",
+						HeaderName:  "x-canary",
+						HeaderValue: "true",
+					},
+				},
+			},
+			wantClusterNames: []string{
+				"backend-cluster-bar.example.com:443",
+				"backend-cluster-baz.example.com:443",
+				"backend-cluster-127.0.0.1:9000",
+			},
+		},
+		{
+			desc: "Percent canary shares the cluster of an existing remote backend",
+			rulesFile: `{"rules": [
+  {"selector": "endpoints.examples.bookstore.Bookstore.Baz", "address": "https://bar.example.com", "percent": 10}
+]}`,
+			wantCanaries: map[string][]*CanaryBackend{
+				"endpoints.examples.bookstore.Bookstore.Baz": {
+					{
+						ClusterName: "backend-cluster-bar.example.com:443",
+						Hostname:    "bar.example.com",
+						Percent:     10,
+					},
+				},
+			},
+			wantClusterNames: []string{
+				"backend-cluster-bar.example.com:443",
+				"backend-cluster-baz.example.com:443",
+			},
+		},
+		{
+			desc: "Canary with a different path",
+			rulesFile: `{"rules": [
+  {"selector": "endpoints.examples.bookstore.Bookstore.Bar", "address": "https://bar-canary.example.com/v2", "percent": 10}
+]}`,
+			wantError: `canary address path "/v2" must match the primary backend path "/v1"`,
+		},
+		{
+			desc: "Canary would receive the derived audience of the primary backend",
+			rulesFile: `{"rules": [
+  {"selector": "endpoints.examples.bookstore.Bookstore.Bar", "address": "https://bar-canary.example.com/v1", "percent": 10}
+]}`,
+			wantError: `the canary backend would receive ID tokens with audience "https://bar.example.com" of the primary backend`,
+		},
+		{
+			desc: "Both header and percent",
+			rulesFile: `{"rules": [
+  {"selector": "endpoints.examples.bookstore.Bookstore.Foo", "address": "http://127.0.0.1:9000", "header": {"name": "x-canary"}, "percent": 10}
+]}`,
+			wantError: "exactly one of header or percent must be set",
+		},
+		{
+			desc: "Two percent rules for one operation",
+			rulesFile: `{"rules": [
+  {"selector": "endpoints.examples.bookstore.Bookstore.Foo", "address": "http://127.0.0.1:9000", "percent": 10},
+  {"selector": "endpoints.examples.bookstore.Bookstore.Foo", "address": "http://127.0.0.1:9001", "percent": 20}
+]}`,
+			wantError: "only one percent rule is allowed per operation",
+		},
+		{
+			desc: "Percent out of range",
+			rulesFile: `{"rules": [
+  {"selector": "endpoints.examples.bookstore.Bookstore.Foo", "address": "http://127.0.0.1:9000", "percent": 100}
+]}`,
+			wantError: "percent must be between 1 and 99",
+		},
+		{
+			desc: "Unknown operation",
+			rulesFile: `{"rules": [
+  {"selector": "endpoints.examples.bookstore.Bookstore.Unknown", "address": "http://127.0.0.1:9000", "percent": 10}
+]}`,
+			wantError: `backend canary rule has unknown operation "endpoints.examples.bookstore.Bookstore.Unknown"`,
+		},
+	}
+
+	for _, tc := range testData {
+		path, removeFile := testutil.WriteTempFile(t, "backend_canary_rules", tc.rulesFile)
+		defer removeFile()
+
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendCanaryRulesPath = path
+
+		s, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			if tc.wantError == "" || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test Desc(%s): want error: %s, get error: %v", tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if tc.wantError != "" {
+			t.Errorf("Test Desc(%s): want error: %s, get no error", tc.desc, tc.wantError)
+			continue
+		}
+
+		gotCanaries := make(map[string][]*CanaryBackend)
+		for selector, method := range s.Methods {
+			if method.CanaryBackends != nil {
+				gotCanaries[selector] = method.CanaryBackends
+			}
+		}
+		if !reflect.DeepEqual(gotCanaries, tc.wantCanaries) {
+			t.Errorf("Test Desc(%s): canary backends\ngot: %+v\nwant: %+v", tc.desc, gotCanaries, tc.wantCanaries)
+		}
+
+		var gotClusterNames []string
+		for _, c := range s.RemoteBackendClusters {
+			gotClusterNames = append(gotClusterNames, c.ClusterName)
+		}
+		if !reflect.DeepEqual(gotClusterNames, tc.wantClusterNames) {
+			t.Errorf("Test Desc(%s): remote backend clusters\ngot: %v\nwant: %v", tc.desc, gotClusterNames, tc.wantClusterNames)
+		}
+	}
+}
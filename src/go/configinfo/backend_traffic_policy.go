@@ -0,0 +1,370 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/glog"
+)
+
+// CircuitBreakers holds the circuit breaker thresholds of a backend cluster.
+// A nil threshold keeps the Envoy default.
+type CircuitBreakers struct {
+	MaxConnections     *uint32 `json:"maxConnections,omitempty"`
+	MaxPendingRequests *uint32 `json:"maxPendingRequests,omitempty"`
+	MaxRequests        *uint32 `json:"maxRequests,omitempty"`
+	MaxRetries         *uint32 `json:"maxRetries,omitempty"`
+}
+
+// OutlierDetection holds the outlier detection settings of a backend cluster.
+type OutlierDetection struct {
+	Consecutive5xx     uint32
+	Interval           time.Duration
+	BaseEjectionTime   time.Duration
+	MaxEjectionPercent uint32
+}
+
+// HealthCheck holds the active health check settings of a backend cluster.
+type HealthCheck struct {
+	// Either "http" or "grpc".
+	Type               string
+	Path               string
+	GrpcServiceName    string
+	Interval           time.Duration
+	Timeout            time.Duration
+	HealthyThreshold   uint32
+	UnhealthyThreshold uint32
+}
+
+// backendTrafficPolicyFile is the format of the file at --backend_traffic_policy_path.
+type backendTrafficPolicyFile struct {
+	Backends []*backendTrafficPolicy `json:"backends"`
+}
+
+type backendTrafficPolicy struct {
+	Address          string                  `json:"address"`
+	CircuitBreakers  *CircuitBreakers        `json:"circuitBreakers,omitempty"`
+	OutlierDetection *outlierDetectionPolicy `json:"outlierDetection,omitempty"`
+	HealthCheck      *healthCheckPolicy      `json:"healthCheck,omitempty"`
+}
+
+// outlierDetectionPolicy is the file format of OutlierDetection. Durations are
+// written as strings such as "10s".
+type outlierDetectionPolicy struct {
+	Consecutive5xx     uint32 `json:"consecutive5xx,omitempty"`
+	Interval           string `json:"interval,omitempty"`
+	BaseEjectionTime   string `json:"baseEjectionTime,omitempty"`
+	MaxEjectionPercent uint32 `json:"maxEjectionPercent,omitempty"`
+}
+
+// healthCheckPolicy is the file format of HealthCheck. Unset fields fall back
+// to the global health check options.
+type healthCheckPolicy struct {
+	Type               string `json:"type,omitempty"`
+	Path               string `json:"path,omitempty"`
+	GrpcServiceName    string `json:"grpcServiceName,omitempty"`
+	Interval           string `json:"interval,omitempty"`
+	Timeout            string `json:"timeout,omitempty"`
+	HealthyThreshold   uint32 `json:"healthyThreshold,omitempty"`
+	UnhealthyThreshold uint32 `json:"unhealthyThreshold,omitempty"`
+}
+
+// processBackendTrafficPolicy applies the global circuit breaker, outlier
+// detection and health check options to all backend clusters, then applies
+// the per address overrides from the backend traffic policy file.
+func (s *ServiceInfo) processBackendTrafficPolicy() error {
+	if err := s.applyBackendTrafficPolicyFile(); err != nil {
+		return err
+	}
+
+	if s.Options.HealthzGrpcHealthCheck {
+		if err := s.processHealthzGrpcHealthCheck(); err != nil {
+			return err
+		}
+	}
+
+	if s.Options.HealthzCheckLocalBackend {
+		if s.Options.Healthz == "" {
+			return fmt.Errorf("healthz_check_local_backend requires healthz to be set")
+		}
+		if s.LocalBackendCluster.HealthCheck == nil {
+			return fmt.Errorf("healthz_check_local_backend requires a health check for the local backend, set backend_health_check")
+		}
+	}
+	return nil
+}
+
+// processHealthzGrpcHealthCheck sets a gRPC health check on the local backend,
+// with the backend health check service name, checked at the healthz cache
+// interval. The healthz is answered from the health of the local backend
+// cluster, so the result of a check is used until the next one.
+func (s *ServiceInfo) processHealthzGrpcHealthCheck() error {
+	if s.Options.Healthz == "" {
+		return fmt.Errorf("healthz_grpc_health_check requires healthz to be set")
+	}
+	if s.LocalBackendCluster.Protocol != util.GRPC {
+		return fmt.Errorf("healthz_grpc_health_check requires a grpc backend_address")
+	}
+	if s.Options.HealthzGrpcCacheInterval <= 0 {
+		return fmt.Errorf("healthz_grpc_cache_interval must be positive")
+	}
+	if s.LocalBackendCluster.HealthCheck != nil {
+		return fmt.Errorf("healthz_grpc_health_check conflicts with the health check of the local backend set by backend_health_check or backend_traffic_policy_path")
+	}
+
+	// A single check flips the health, so that the healthz follows the latest
+	// result of the backend.
+	s.LocalBackendCluster.HealthCheck = &HealthCheck{
+		Type:               "grpc",
+		GrpcServiceName:    s.Options.BackendHealthCheckGrpcServiceName,
+		Interval:           s.Options.HealthzGrpcCacheInterval,
+		Timeout:            s.Options.HealthzGrpcCacheInterval,
+		HealthyThreshold:   1,
+		UnhealthyThreshold: 1,
+	}
+	return nil
+}
+
+func (s *ServiceInfo) applyBackendTrafficPolicyFile() error {
+	globalBreakers := s.globalCircuitBreakers()
+	globalDetection, err := s.globalOutlierDetection()
+	if err != nil {
+		return fmt.Errorf("invalid backend outlier detection: %v", err)
+	}
+
+	clusters := append([]*BackendRoutingCluster{s.LocalBackendCluster}, s.RemoteBackendClusters...)
+	for _, c := range clusters {
+		c.CircuitBreakers = globalBreakers
+		c.OutlierDetection = globalDetection
+		if s.Options.BackendHealthCheck == "grpc" && c.Protocol != util.GRPC && c.Protocol != util.HTTP2 {
+			glog.Warningf("Backend cluster %s does not use HTTP/2, skipping the gRPC health check for it.", c.ClusterName)
+		} else if s.Options.BackendHealthCheck != "" {
+			healthCheck, err := s.mergeHealthCheck(c, &healthCheckPolicy{})
+			if err != nil {
+				return fmt.Errorf("invalid backend health check: %v", err)
+			}
+			c.HealthCheck = healthCheck
+		}
+	}
+
+	if s.Options.BackendTrafficPolicyPath == "" {
+		return nil
+	}
+
+	var policyFile backendTrafficPolicyFile
+	if err := util.UnmarshalJsonFile(s.Options.BackendTrafficPolicyPath, &policyFile); err != nil {
+		return fmt.Errorf("fail to read backend traffic policy: %v", err)
+	}
+
+	clustersByAddress := make(map[string]*BackendRoutingCluster)
+	for _, c := range clusters {
+		clustersByAddress[fmt.Sprintf("%v:%v", c.Hostname, c.Port)] = c
+		for _, ep := range c.Endpoints {
+			clustersByAddress[fmt.Sprintf("%v:%v", ep.Hostname, ep.Port)] = c
+		}
+	}
+
+	for _, policy := range policyFile.Backends {
+		_, hostname, port, _, err := util.ParseURI(policy.Address)
+		if err != nil {
+			return fmt.Errorf("invalid address %q in backend traffic policy: %v", policy.Address, err)
+		}
+
+		c, ok := clustersByAddress[fmt.Sprintf("%v:%v", hostname, port)]
+		if !ok {
+			glog.Warningf("Backend traffic policy for address %q does not match any backend, skipping it.", policy.Address)
+			continue
+		}
+
+		if policy.CircuitBreakers != nil {
+			c.CircuitBreakers = mergeCircuitBreakers(globalBreakers, policy.CircuitBreakers)
+		}
+		if policy.OutlierDetection != nil {
+			detection, err := s.mergeOutlierDetection(policy.OutlierDetection)
+			if err != nil {
+				return fmt.Errorf("invalid outlier detection for address %q in backend traffic policy: %v", policy.Address, err)
+			}
+			c.OutlierDetection = detection
+		}
+		if policy.HealthCheck != nil {
+			healthCheck, err := s.mergeHealthCheck(c, policy.HealthCheck)
+			if err != nil {
+				return fmt.Errorf("invalid health check for address %q in backend traffic policy: %v", policy.Address, err)
+			}
+			c.HealthCheck = healthCheck
+		}
+	}
+	return nil
+}
+
+func (s *ServiceInfo) globalCircuitBreakers() *CircuitBreakers {
+	threshold := func(v int) *uint32 {
+		if v < 0 {
+			return nil
+		}
+		t := uint32(v)
+		return &t
+	}
+
+	breakers := &CircuitBreakers{
+		MaxConnections:     threshold(s.Options.BackendCircuitBreakerMaxConnections),
+		MaxPendingRequests: threshold(s.Options.BackendCircuitBreakerMaxPendingRequests),
+		MaxRequests:        threshold(s.Options.BackendCircuitBreakerMaxRequests),
+		MaxRetries:         threshold(s.Options.BackendCircuitBreakerMaxRetries),
+	}
+	if *breakers == (CircuitBreakers{}) {
+		return nil
+	}
+	return breakers
+}
+
+// globalOutlierDetection also validates the max ejection percent option, which
+// the policy file falls back to.
+func (s *ServiceInfo) globalOutlierDetection() (*OutlierDetection, error) {
+	if maxEjectionPercent := s.Options.BackendOutlierDetectionMaxEjectionPercent; maxEjectionPercent < 0 || maxEjectionPercent > 100 {
+		return nil, fmt.Errorf("backend_outlier_detection_max_ejection_percent must be between 0 and 100, got %v", maxEjectionPercent)
+	}
+	if s.Options.BackendOutlierDetectionConsecutive5xx <= 0 {
+		return nil, nil
+	}
+	return &OutlierDetection{
+		Consecutive5xx:     uint32(s.Options.BackendOutlierDetectionConsecutive5xx),
+		Interval:           s.Options.BackendOutlierDetectionInterval,
+		BaseEjectionTime:   s.Options.BackendOutlierDetectionBaseEjectionTime,
+		MaxEjectionPercent: uint32(s.Options.BackendOutlierDetectionMaxEjectionPercent),
+	}, nil
+}
+
+// mergeCircuitBreakers returns the thresholds of override, falling back to base
+// for the thresholds override does not set.
+func mergeCircuitBreakers(base, override *CircuitBreakers) *CircuitBreakers {
+	merged := *override
+	if base == nil {
+		return &merged
+	}
+	if merged.MaxConnections == nil {
+		merged.MaxConnections = base.MaxConnections
+	}
+	if merged.MaxPendingRequests == nil {
+		merged.MaxPendingRequests = base.MaxPendingRequests
+	}
+	if merged.MaxRequests == nil {
+		merged.MaxRequests = base.MaxRequests
+	}
+	if merged.MaxRetries == nil {
+		merged.MaxRetries = base.MaxRetries
+	}
+	return &merged
+}
+
+// mergeOutlierDetection fills the unset fields of override from the global options.
+// Outlier detection is disabled for the backend if consecutive5xx is not set.
+func (s *ServiceInfo) mergeOutlierDetection(override *outlierDetectionPolicy) (*OutlierDetection, error) {
+	if override.Consecutive5xx == 0 {
+		return nil, nil
+	}
+
+	merged := &OutlierDetection{
+		Consecutive5xx:     override.Consecutive5xx,
+		Interval:           s.Options.BackendOutlierDetectionInterval,
+		BaseEjectionTime:   s.Options.BackendOutlierDetectionBaseEjectionTime,
+		MaxEjectionPercent: uint32(s.Options.BackendOutlierDetectionMaxEjectionPercent),
+	}
+	if override.MaxEjectionPercent != 0 {
+		merged.MaxEjectionPercent = override.MaxEjectionPercent
+	}
+	if merged.MaxEjectionPercent > 100 {
+		return nil, fmt.Errorf("maxEjectionPercent must be at most 100, got %v", merged.MaxEjectionPercent)
+	}
+
+	var err error
+	if override.Interval != "" {
+		if merged.Interval, err = time.ParseDuration(override.Interval); err != nil {
+			return nil, fmt.Errorf("fail to parse interval: %v", err)
+		}
+	}
+	if override.BaseEjectionTime != "" {
+		if merged.BaseEjectionTime, err = time.ParseDuration(override.BaseEjectionTime); err != nil {
+			return nil, fmt.Errorf("fail to parse baseEjectionTime: %v", err)
+		}
+	}
+	return merged, nil
+}
+
+// mergeHealthCheck fills the unset fields of override from the global options
+// and validates the result against the protocol of the backend cluster.
+func (s *ServiceInfo) mergeHealthCheck(c *BackendRoutingCluster, override *healthCheckPolicy) (*HealthCheck, error) {
+	if s.Options.BackendHealthCheckHealthyThreshold <= 0 || s.Options.BackendHealthCheckUnhealthyThreshold <= 0 {
+		return nil, fmt.Errorf("health check thresholds must be positive")
+	}
+	merged := &HealthCheck{
+		Type:               s.Options.BackendHealthCheck,
+		Path:               s.Options.BackendHealthCheckPath,
+		GrpcServiceName:    s.Options.BackendHealthCheckGrpcServiceName,
+		Interval:           s.Options.BackendHealthCheckInterval,
+		Timeout:            s.Options.BackendHealthCheckTimeout,
+		HealthyThreshold:   uint32(s.Options.BackendHealthCheckHealthyThreshold),
+		UnhealthyThreshold: uint32(s.Options.BackendHealthCheckUnhealthyThreshold),
+	}
+	if override.Type != "" {
+		merged.Type = override.Type
+	}
+	if override.Path != "" {
+		merged.Path = override.Path
+	}
+	if override.GrpcServiceName != "" {
+		merged.GrpcServiceName = override.GrpcServiceName
+	}
+	if override.HealthyThreshold != 0 {
+		merged.HealthyThreshold = override.HealthyThreshold
+	}
+	if override.UnhealthyThreshold != 0 {
+		merged.UnhealthyThreshold = override.UnhealthyThreshold
+	}
+
+	var err error
+	if override.Interval != "" {
+		if merged.Interval, err = time.ParseDuration(override.Interval); err != nil {
+			return nil, fmt.Errorf("fail to parse interval: %v", err)
+		}
+	}
+	if override.Timeout != "" {
+		if merged.Timeout, err = time.ParseDuration(override.Timeout); err != nil {
+			return nil, fmt.Errorf("fail to parse timeout: %v", err)
+		}
+	}
+
+	switch merged.Type {
+	case "http":
+		if !strings.HasPrefix(merged.Path, "/") {
+			return nil, fmt.Errorf("http health check path must start with /, got %q", merged.Path)
+		}
+	case "grpc":
+		if c.Protocol != util.GRPC && c.Protocol != util.HTTP2 {
+			return nil, fmt.Errorf("grpc health check requires a grpc or http2 backend for cluster %s", c.ClusterName)
+		}
+	default:
+		return nil, fmt.Errorf(`health check type must be either "http" or "grpc", got %q`, merged.Type)
+	}
+
+	if merged.Interval <= 0 || merged.Timeout <= 0 {
+		return nil, fmt.Errorf("health check interval and timeout must be positive")
+	}
+	return merged, nil
+}
@@ -0,0 +1,458 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/testutil"
+	"github.com/google/go-cmp/cmp"
+
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func uint32Ptr(v uint32) *uint32 {
+	return &v
+}
+
+func TestProcessBackendTrafficPolicy(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "Foo",
+					},
+					{
+						Name: "Bar",
+					},
+				},
+			},
+		},
+		Backend: &confpb.Backend{
+			Rules: []*confpb.BackendRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.Foo",
+					Address:  "https://foo.example.com",
+				},
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.Bar",
+					Address:  "https://bar.example.com:8443/v1",
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc          string
+		optsMergeFunc func(opts *options.ConfigGeneratorOptions)
+		policyFile    string
+		wantLocal     *BackendRoutingCluster
+		wantRemoteFoo *BackendRoutingCluster
+		wantRemoteBar *BackendRoutingCluster
+		wantError     string
+	}{
+		{
+			desc: "No traffic policy by default",
+		},
+		{
+			desc: "Global options apply to all backends",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.BackendCircuitBreakerMaxRequests = 100
+				opts.BackendOutlierDetectionConsecutive5xx = 5
+			},
+			wantLocal: &BackendRoutingCluster{
+				CircuitBreakers: &CircuitBreakers{
+					MaxRequests: uint32Ptr(100),
+				},
+				OutlierDetection: &OutlierDetection{
+					Consecutive5xx:     5,
+					Interval:           10 * time.Second,
+					BaseEjectionTime:   30 * time.Second,
+					MaxEjectionPercent: 10,
+				},
+			},
+			wantRemoteFoo: &BackendRoutingCluster{
+				CircuitBreakers: &CircuitBreakers{
+					MaxRequests: uint32Ptr(100),
+				},
+				OutlierDetection: &OutlierDetection{
+					Consecutive5xx:     5,
+					Interval:           10 * time.Second,
+					BaseEjectionTime:   30 * time.Second,
+					MaxEjectionPercent: 10,
+				},
+			},
+			wantRemoteBar: &BackendRoutingCluster{
+				CircuitBreakers: &CircuitBreakers{
+					MaxRequests: uint32Ptr(100),
+				},
+				OutlierDetection: &OutlierDetection{
+					Consecutive5xx:     5,
+					Interval:           10 * time.Second,
+					BaseEjectionTime:   30 * time.Second,
+					MaxEjectionPercent: 10,
+				},
+			},
+		},
+		{
+			desc: "Per address policy overrides the global options",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.BackendCircuitBreakerMaxRequests = 100
+			},
+			policyFile: `{
+  "backends": [
+    {
+      "address": "bar.example.com:8443",
+      "circuitBreakers": {"maxConnections": 10},
+      "outlierDetection": {"consecutive5xx": 3, "interval": "1s", "maxEjectionPercent": 100}
+    },
+    {
+      "address": "https://unknown.example.com",
+      "circuitBreakers": {"maxConnections": 1}
+    }
+  ]
+}`,
+			wantLocal: &BackendRoutingCluster{
+				CircuitBreakers: &CircuitBreakers{
+					MaxRequests: uint32Ptr(100),
+				},
+			},
+			wantRemoteFoo: &BackendRoutingCluster{
+				CircuitBreakers: &CircuitBreakers{
+					MaxRequests: uint32Ptr(100),
+				},
+			},
+			wantRemoteBar: &BackendRoutingCluster{
+				CircuitBreakers: &CircuitBreakers{
+					MaxConnections: uint32Ptr(10),
+					MaxRequests:    uint32Ptr(100),
+				},
+				OutlierDetection: &OutlierDetection{
+					Consecutive5xx:     3,
+					Interval:           time.Second,
+					BaseEjectionTime:   30 * time.Second,
+					MaxEjectionPercent: 100,
+				},
+			},
+		},
+		{
+			desc: "Negative max ejection percent option",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.BackendOutlierDetectionConsecutive5xx = 5
+				opts.BackendOutlierDetectionMaxEjectionPercent = -1
+			},
+			wantError: "backend_outlier_detection_max_ejection_percent must be between 0 and 100, got -1",
+		},
+		{
+			desc: "Max ejection percent option over 100",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.BackendOutlierDetectionMaxEjectionPercent = 101
+			},
+			policyFile: `{"backends": [{"address": "https://foo.example.com", "outlierDetection": {"consecutive5xx": 3}}]}`,
+			wantError:  "backend_outlier_detection_max_ejection_percent must be between 0 and 100, got 101",
+		},
+		{
+			desc:       "Policy file with unknown field",
+			policyFile: `{"backends": [{"address": "https://foo.example.com", "circuitBreaker": {}}]}`,
+			wantError:  `unknown field "circuitBreaker"`,
+		},
+		{
+			desc:       "Policy file with invalid duration",
+			policyFile: `{"backends": [{"address": "https://foo.example.com", "outlierDetection": {"consecutive5xx": 3, "interval": "1"}}]}`,
+			wantError:  "fail to parse interval",
+		},
+		{
+			desc:       "Policy file with invalid max ejection percent",
+			policyFile: `{"backends": [{"address": "https://foo.example.com", "outlierDetection": {"consecutive5xx": 3, "maxEjectionPercent": 101}}]}`,
+			wantError:  "maxEjectionPercent must be at most 100",
+		},
+	}
+
+	for _, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendAddress = "grpc://127.0.0.1:8082"
+		if tc.optsMergeFunc != nil {
+			tc.optsMergeFunc(&opts)
+		}
+
+		if tc.policyFile != "" {
+			path, removeFile := testutil.WriteTempFile(t, "backend_traffic_policy", tc.policyFile)
+			defer removeFile()
+			opts.BackendTrafficPolicyPath = path
+		}
+
+		serviceInfo, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			if tc.wantError == "" || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test Desc(%s): want error: %s, get error: %v", tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if tc.wantError != "" {
+			t.Errorf("Test Desc(%s): want error: %s, get no error", tc.desc, tc.wantError)
+			continue
+		}
+
+		if len(serviceInfo.RemoteBackendClusters) != 2 {
+			t.Fatalf("Test Desc(%s): want 2 remote backend clusters, get %d", tc.desc, len(serviceInfo.RemoteBackendClusters))
+		}
+
+		got := []*BackendRoutingCluster{
+			serviceInfo.LocalBackendCluster,
+			serviceInfo.RemoteBackendClusters[0],
+			serviceInfo.RemoteBackendClusters[1],
+		}
+		want := []*BackendRoutingCluster{tc.wantLocal, tc.wantRemoteFoo, tc.wantRemoteBar}
+		for i := range got {
+			var wantBreakers *CircuitBreakers
+			var wantDetection *OutlierDetection
+			if want[i] != nil {
+				wantBreakers = want[i].CircuitBreakers
+				wantDetection = want[i].OutlierDetection
+			}
+
+			if !cmp.Equal(got[i].CircuitBreakers, wantBreakers) {
+				t.Errorf("Test Desc(%s): cluster %s circuit breakers\ngot: %+v\nwant: %+v", tc.desc, got[i].ClusterName, got[i].CircuitBreakers, wantBreakers)
+			}
+			if !cmp.Equal(got[i].OutlierDetection, wantDetection) {
+				t.Errorf("Test Desc(%s): cluster %s outlier detection\ngot: %+v\nwant: %+v", tc.desc, got[i].ClusterName, got[i].OutlierDetection, wantDetection)
+			}
+		}
+	}
+}
+
+func TestProcessBackendHealthCheck(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "Foo",
+					},
+				},
+			},
+		},
+		Backend: &confpb.Backend{
+			Rules: []*confpb.BackendRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.Foo",
+					Address:  "https://foo.example.com",
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc          string
+		optsMergeFunc func(opts *options.ConfigGeneratorOptions)
+		policyFile    string
+		wantLocal     *HealthCheck
+		wantRemote    *HealthCheck
+		wantError     string
+	}{
+		{
+			desc: "Global health check applies to all backends",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.BackendHealthCheck = "http"
+				opts.BackendHealthCheckPath = "/ready"
+			},
+			wantLocal: &HealthCheck{
+				Type:               "http",
+				Path:               "/ready",
+				Interval:           10 * time.Second,
+				Timeout:            5 * time.Second,
+				HealthyThreshold:   2,
+				UnhealthyThreshold: 3,
+			},
+			wantRemote: &HealthCheck{
+				Type:               "http",
+				Path:               "/ready",
+				Interval:           10 * time.Second,
+				Timeout:            5 * time.Second,
+				HealthyThreshold:   2,
+				UnhealthyThreshold: 3,
+			},
+		},
+		{
+			desc:       "Per address health check only",
+			policyFile: `{"backends": [{"address": "127.0.0.1:8082", "healthCheck": {"type": "grpc", "grpcServiceName": "foo.Bar", "timeout": "1s", "unhealthyThreshold": 1}}]}`,
+			wantLocal: &HealthCheck{
+				Type:               "grpc",
+				Path:               "/",
+				GrpcServiceName:    "foo.Bar",
+				Interval:           10 * time.Second,
+				Timeout:            time.Second,
+				HealthyThreshold:   2,
+				UnhealthyThreshold: 1,
+			},
+		},
+		{
+			desc:       "gRPC health check on HTTP/1 backend",
+			policyFile: `{"backends": [{"address": "https://foo.example.com", "healthCheck": {"type": "grpc"}}]}`,
+			wantError:  "grpc health check requires a grpc or http2 backend",
+		},
+		{
+			desc: "Invalid health check type",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.BackendHealthCheck = "tcp"
+			},
+			wantError: `health check type must be either "http" or "grpc"`,
+		},
+		{
+			desc: "Invalid health check path",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.BackendHealthCheck = "http"
+				opts.BackendHealthCheckPath = "ready"
+			},
+			wantError: "http health check path must start with /",
+		},
+		{
+			desc: "Healthz checks the local backend",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.Healthz = "/healthz"
+				opts.HealthzCheckLocalBackend = true
+				opts.BackendHealthCheck = "grpc"
+			},
+			wantLocal: &HealthCheck{
+				Type:               "grpc",
+				Path:               "/",
+				Interval:           10 * time.Second,
+				Timeout:            5 * time.Second,
+				HealthyThreshold:   2,
+				UnhealthyThreshold: 3,
+			},
+		},
+		{
+			desc: "Healthz checks the local backend without healthz",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.HealthzCheckLocalBackend = true
+				opts.BackendHealthCheck = "http"
+			},
+			wantError: "healthz_check_local_backend requires healthz to be set",
+		},
+		{
+			desc: "Healthz checks the local backend without health check",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.Healthz = "/healthz"
+				opts.HealthzCheckLocalBackend = true
+			},
+			wantError: "healthz_check_local_backend requires a health check for the local backend",
+		},
+		{
+			desc: "Healthz with gRPC health check of the local backend",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.Healthz = "/healthz"
+				opts.HealthzGrpcHealthCheck = true
+				opts.BackendHealthCheckGrpcServiceName = "foo.Bar"
+				opts.HealthzGrpcCacheInterval = 2 * time.Second
+			},
+			wantLocal: &HealthCheck{
+				Type:               "grpc",
+				GrpcServiceName:    "foo.Bar",
+				Interval:           2 * time.Second,
+				Timeout:            2 * time.Second,
+				HealthyThreshold:   1,
+				UnhealthyThreshold: 1,
+			},
+		},
+		{
+			desc: "Healthz with gRPC health check conflicts with the backend health check",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.Healthz = "/healthz"
+				opts.HealthzGrpcHealthCheck = true
+				opts.BackendHealthCheck = "grpc"
+			},
+			wantError: "healthz_grpc_health_check conflicts with the health check of the local backend",
+		},
+		{
+			desc: "Healthz with gRPC health check conflicts with the backend traffic policy",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.Healthz = "/healthz"
+				opts.HealthzGrpcHealthCheck = true
+			},
+			policyFile: `{"backends": [
+  {"address": "grpc://127.0.0.1:8082", "healthCheck": {"type": "grpc"}}
+]}`,
+			wantError: "healthz_grpc_health_check conflicts with the health check of the local backend",
+		},
+		{
+			desc: "Healthz with gRPC health check without healthz",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.HealthzGrpcHealthCheck = true
+			},
+			wantError: "healthz_grpc_health_check requires healthz to be set",
+		},
+		{
+			desc: "Healthz with gRPC health check on HTTP backend",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.BackendAddress = "http://127.0.0.1:8082"
+				opts.Healthz = "/healthz"
+				opts.HealthzGrpcHealthCheck = true
+			},
+			wantError: "healthz_grpc_health_check requires a grpc backend_address",
+		},
+		{
+			desc: "Healthz with gRPC health check with invalid cache interval",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.Healthz = "/healthz"
+				opts.HealthzGrpcHealthCheck = true
+				opts.HealthzGrpcCacheInterval = 0
+			},
+			wantError: "healthz_grpc_cache_interval must be positive",
+		},
+	}
+
+	for _, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.BackendAddress = "grpc://127.0.0.1:8082"
+		if tc.optsMergeFunc != nil {
+			tc.optsMergeFunc(&opts)
+		}
+
+		if tc.policyFile != "" {
+			path, removeFile := testutil.WriteTempFile(t, "backend_traffic_policy", tc.policyFile)
+			defer removeFile()
+			opts.BackendTrafficPolicyPath = path
+		}
+
+		serviceInfo, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			if tc.wantError == "" || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test Desc(%s): want error: %s, get error: %v", tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if tc.wantError != "" {
+			t.Errorf("Test Desc(%s): want error: %s, get no error", tc.desc, tc.wantError)
+			continue
+		}
+
+		if !cmp.Equal(serviceInfo.LocalBackendCluster.HealthCheck, tc.wantLocal) {
+			t.Errorf("Test Desc(%s): local backend health check\ngot: %+v\nwant: %+v", tc.desc, serviceInfo.LocalBackendCluster.HealthCheck, tc.wantLocal)
+		}
+		if !cmp.Equal(serviceInfo.RemoteBackendClusters[0].HealthCheck, tc.wantRemote) {
+			t.Errorf("Test Desc(%s): remote backend health check\ngot: %+v\nwant: %+v", tc.desc, serviceInfo.RemoteBackendClusters[0].HealthCheck, tc.wantRemote)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ClaimHeader forwards a claim of the JWT payload to the backend as a header.
+type ClaimHeader struct {
+	// Path of the claim in the JWT payload, with a single element for top level claims.
+	ClaimPath []string
+	Header    string
+}
+
+// processClaimHeaders adds the claim headers of the providers in
+// --jwt_claim_headers to the operations that require them. All the headers are
+// collected, the client must not send them to any operation.
+//
+// The headers are also ignored by the transcoder if they are sent as query
+// parameters, so the backend only gets them from the verified JWT.
+func (s *ServiceInfo) processClaimHeaders() error {
+	if s.Options.JwtClaimHeaders == "" {
+		return nil
+	}
+
+	var claimHeaders map[string]map[string]string
+	if err := json.Unmarshal([]byte(s.Options.JwtClaimHeaders), &claimHeaders); err != nil {
+		return fmt.Errorf("jwt_claim_headers must be a JSON object of provider ids to objects of claims to header names: %v", err)
+	}
+
+	providerHeaders := make(map[string][]*ClaimHeader)
+	allHeaders := make(map[string]bool)
+	for _, provider := range s.serviceConfig.GetAuthentication().GetProviders() {
+		claims, ok := claimHeaders[provider.GetId()]
+		if !ok {
+			continue
+		}
+		delete(claimHeaders, provider.GetId())
+
+		headers, err := makeClaimHeaders(claims)
+		if err != nil {
+			return fmt.Errorf("invalid jwt_claim_headers for provider %q: %v", provider.GetId(), err)
+		}
+		providerHeaders[provider.GetId()] = headers
+
+		for _, header := range headers {
+			key := strings.ToLower(header.Header)
+			if !allHeaders[key] {
+				allHeaders[key] = true
+				s.AllClaimHeaders = append(s.AllClaimHeaders, header.Header)
+			}
+		}
+	}
+	for id := range claimHeaders {
+		return fmt.Errorf("jwt_claim_headers has unknown provider id %q", id)
+	}
+	sort.Strings(s.AllClaimHeaders)
+
+	for _, operation := range s.Operations {
+		method := s.Methods[operation]
+
+		// An operation accepting JWTs of several providers gets the headers of
+		// all of them, a header must have the same claim for all of them.
+		claimPaths := make(map[string]string)
+		for _, requirement := range method.JwtRequirements {
+			for _, header := range providerHeaders[requirement.GetProviderId()] {
+				key := strings.ToLower(header.Header)
+				claimPath := strings.Join(header.ClaimPath, ".")
+				if other, ok := claimPaths[key]; ok {
+					if other != claimPath {
+						return fmt.Errorf("header %q of operation %q is mapped from claims %q and %q", header.Header, operation, other, claimPath)
+					}
+					continue
+				}
+				claimPaths[key] = claimPath
+				method.ClaimHeaders = append(method.ClaimHeaders, header)
+				s.AllTranscodingIgnoredQueryParams[header.Header] = true
+			}
+		}
+	}
+	return nil
+}
+
+// makeClaimHeaders sorts the headers by name so the output is stable.
+func makeClaimHeaders(claims map[string]string) ([]*ClaimHeader, error) {
+	var headers []*ClaimHeader
+	headerNames := make(map[string]bool)
+	for claim, header := range claims {
+		if claim == "" {
+			return nil, fmt.Errorf("claim name must not be empty")
+		}
+		for _, segment := range strings.Split(claim, ".") {
+			if segment == "" {
+				return nil, fmt.Errorf("invalid nested claim %q", claim)
+			}
+		}
+		if header == "" || strings.HasPrefix(header, ":") || strings.EqualFold(header, "host") {
+			return nil, fmt.Errorf("invalid header %q for claim %q", header, claim)
+		}
+		if headerNames[strings.ToLower(header)] {
+			return nil, fmt.Errorf("header %q is mapped from more than one claim", header)
+		}
+		headerNames[strings.ToLower(header)] = true
+
+		headers = append(headers, &ClaimHeader{
+			ClaimPath: strings.Split(claim, "."),
+			Header:    header,
+		})
+	}
+
+	sort.Slice(headers, func(i, j int) bool {
+		return headers[i].Header < headers[j].Header
+	})
+	return headers, nil
+}
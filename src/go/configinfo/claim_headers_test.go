@@ -0,0 +1,188 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func TestProcessClaimHeaders(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "GetBook",
+					},
+					{
+						Name: "ListBooks",
+					},
+					{
+						Name: "Echo",
+					},
+				},
+			},
+		},
+		Authentication: &confpb.Authentication{
+			Providers: []*confpb.AuthProvider{
+				{
+					Id:      "provider_0",
+					Issuer:  "issuer-0@example.com",
+					JwksUri: "https://issuer-0.example.com/jwks",
+				},
+				{
+					Id:      "provider_1",
+					Issuer:  "issuer-1@example.com",
+					JwksUri: "https://issuer-1.example.com/jwks",
+				},
+			},
+			Rules: []*confpb.AuthenticationRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.GetBook",
+					Requirements: []*confpb.AuthRequirement{
+						{
+							ProviderId: "provider_0",
+						},
+					},
+				},
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.ListBooks",
+					Requirements: []*confpb.AuthRequirement{
+						{
+							ProviderId: "provider_0",
+						},
+						{
+							ProviderId: "provider_1",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc              string
+		jwtClaimHeaders   string
+		wantClaimHeaders  map[string][]*ClaimHeader
+		wantIgnoredParams []string
+		wantError         string
+	}{
+		{
+			desc:            "Claim headers of the required providers",
+			jwtClaimHeaders: `{"provider_0": {"sub": "X-User-Id", "address.country": "X-User-Country"}, "provider_1": {"sub": "x-user-id", "email": "X-User-Email"}}`,
+			wantClaimHeaders: map[string][]*ClaimHeader{
+				"endpoints.examples.bookstore.Bookstore.GetBook": {
+					{
+						ClaimPath: []string{"address", "country"},
+						Header:    "X-User-Country",
+					},
+					{
+						ClaimPath: []string{"sub"},
+						Header:    "X-User-Id",
+					},
+				},
+				"endpoints.examples.bookstore.Bookstore.ListBooks": {
+					{
+						ClaimPath: []string{"address", "country"},
+						Header:    "X-User-Country",
+					},
+					{
+						ClaimPath: []string{"sub"},
+						Header:    "X-User-Id",
+					},
+					{
+						ClaimPath: []string{"email"},
+						Header:    "X-User-Email",
+					},
+				},
+			},
+			wantIgnoredParams: []string{"X-User-Country", "X-User-Email", "X-User-Id", "access_token", "api_key", "key"},
+		},
+		{
+			desc:            "Header mapped from different claims of the providers of an operation",
+			jwtClaimHeaders: `{"provider_0": {"sub": "X-User-Id"}, "provider_1": {"email": "X-User-Id"}}`,
+			wantError:       `header "X-User-Id" of operation "endpoints.examples.bookstore.Bookstore.ListBooks" is mapped from claims "sub" and "email"`,
+		},
+		{
+			desc:            "Header mapped from two claims of a provider",
+			jwtClaimHeaders: `{"provider_0": {"sub": "X-User-Id", "email": "x-user-id"}}`,
+			wantError:       "is mapped from more than one claim",
+		},
+		{
+			desc:            "Pseudo header",
+			jwtClaimHeaders: `{"provider_0": {"sub": ":authority"}}`,
+			wantError:       `invalid header ":authority" for claim "sub"`,
+		},
+		{
+			desc:            "Invalid nested claim",
+			jwtClaimHeaders: `{"provider_0": {"address.": "X-User-Address"}}`,
+			wantError:       `invalid nested claim "address."`,
+		},
+		{
+			desc:            "Unknown provider id",
+			jwtClaimHeaders: `{"provider_2": {"sub": "X-User-Id"}}`,
+			wantError:       `jwt_claim_headers has unknown provider id "provider_2"`,
+		},
+		{
+			desc:            "Flag is not a JSON object",
+			jwtClaimHeaders: `{"provider_0": ["sub"]}`,
+			wantError:       "jwt_claim_headers must be a JSON object",
+		},
+	}
+
+	for _, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.JwtClaimHeaders = tc.jwtClaimHeaders
+
+		s, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			if tc.wantError == "" || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test Desc(%s): want error: %s, get error: %v", tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if tc.wantError != "" {
+			t.Errorf("Test Desc(%s): want error: %s, get no error", tc.desc, tc.wantError)
+			continue
+		}
+
+		gotClaimHeaders := make(map[string][]*ClaimHeader)
+		for selector, method := range s.Methods {
+			if method.ClaimHeaders != nil {
+				gotClaimHeaders[selector] = method.ClaimHeaders
+			}
+		}
+		if !reflect.DeepEqual(gotClaimHeaders, tc.wantClaimHeaders) {
+			t.Errorf("Test Desc(%s): claim headers\ngot: %+v\nwant: %+v", tc.desc, gotClaimHeaders, tc.wantClaimHeaders)
+		}
+
+		wantIgnoredParams := make(map[string]bool)
+		for _, param := range tc.wantIgnoredParams {
+			wantIgnoredParams[param] = true
+		}
+		if !reflect.DeepEqual(s.AllTranscodingIgnoredQueryParams, wantIgnoredParams) {
+			t.Errorf("Test Desc(%s): transcoding ignored query params\ngot: %v\nwant: %v", tc.desc, s.AllTranscodingIgnoredQueryParams, wantIgnoredParams)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+)
+
+// ClaimRequirement is a requirement on a top level claim of the JWT payload.
+// Exactly one of the matchers is set.
+type ClaimRequirement struct {
+	Claim string
+
+	// The claim is a string equal to the value.
+	Equals string
+	// The claim is a list including the value.
+	Includes string
+	// The claim is a space delimited string, e.g. the scope claim, with the value as one of its words.
+	HasScope string
+}
+
+// claimsPolicyFile is the format of the file at --jwt_claims_policy_path.
+type claimsPolicyFile struct {
+	Rules []*claimsPolicyRule `json:"rules"`
+}
+
+// claimsPolicyRule requires all the claims for the operation with the selector.
+type claimsPolicyRule struct {
+	Selector string              `json:"selector"`
+	Claims   []*claimRequirement `json:"claims"`
+}
+
+type claimRequirement struct {
+	Claim    string `json:"claim"`
+	Equals   string `json:"equals,omitempty"`
+	Includes string `json:"includes,omitempty"`
+	HasScope string `json:"hasScope,omitempty"`
+}
+
+// processClaimsPolicy reads the claims policy and adds the claim requirements
+// to the operations. The claims are matched on the JWT payload written to the
+// dynamic metadata by the JWT Authn filter, so the operations must require a JWT.
+func (s *ServiceInfo) processClaimsPolicy() error {
+	if s.Options.JwtClaimsPolicyPath == "" {
+		return nil
+	}
+
+	var policyFile claimsPolicyFile
+	if err := util.UnmarshalJsonFile(s.Options.JwtClaimsPolicyPath, &policyFile); err != nil {
+		return fmt.Errorf("fail to read JWT claims policy: %v", err)
+	}
+
+	for _, rule := range policyFile.Rules {
+		method, ok := s.Methods[rule.Selector]
+		if !ok || method.IsGenerated {
+			return fmt.Errorf("JWT claims policy has unknown operation %q", rule.Selector)
+		}
+		if len(method.JwtRequirements) == 0 {
+			return fmt.Errorf("JWT claims policy for operation %q requires a JWT authentication rule for the operation", rule.Selector)
+		}
+		if method.ClaimRequirements != nil {
+			return fmt.Errorf("duplicate JWT claims policy for operation %q", rule.Selector)
+		}
+		if len(rule.Claims) == 0 {
+			return fmt.Errorf("JWT claims policy for operation %q has no claims", rule.Selector)
+		}
+
+		for _, claim := range rule.Claims {
+			requirement, err := makeClaimRequirement(claim)
+			if err != nil {
+				return fmt.Errorf("invalid JWT claims policy for operation %q: %v", rule.Selector, err)
+			}
+			method.ClaimRequirements = append(method.ClaimRequirements, requirement)
+		}
+	}
+	return nil
+}
+
+func makeClaimRequirement(claim *claimRequirement) (*ClaimRequirement, error) {
+	if claim.Claim == "" {
+		return nil, fmt.Errorf("claim name must be set")
+	}
+
+	matchers := 0
+	for _, value := range []string{claim.Equals, claim.Includes, claim.HasScope} {
+		if value != "" {
+			matchers++
+		}
+	}
+	if matchers != 1 {
+		return nil, fmt.Errorf("exactly one of equals, includes or hasScope must be set for claim %q", claim.Claim)
+	}
+
+	return &ClaimRequirement{
+		Claim:    claim.Claim,
+		Equals:   claim.Equals,
+		Includes: claim.Includes,
+		HasScope: claim.HasScope,
+	}, nil
+}
@@ -0,0 +1,179 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/testutil"
+
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func TestProcessClaimsPolicy(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "CreateBook",
+					},
+					{
+						Name: "ListBooks",
+					},
+				},
+			},
+		},
+		Authentication: &confpb.Authentication{
+			Providers: []*confpb.AuthProvider{
+				{
+					Id:      "auth_provider",
+					Issuer:  "issuer@example.com",
+					JwksUri: "https://issuer.example.com/jwks",
+				},
+			},
+			Rules: []*confpb.AuthenticationRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.CreateBook",
+					Requirements: []*confpb.AuthRequirement{
+						{
+							ProviderId: "auth_provider",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc             string
+		policyFile       string
+		wantRequirements map[string][]*ClaimRequirement
+		wantError        string
+	}{
+		{
+			desc: "All the claims of a rule are required",
+			policyFile: `{"rules": [
+  {"selector": "endpoints.examples.bookstore.Bookstore.CreateBook", "claims": [
+    {"claim": "scope", "hasScope": "books.write"},
+    {"claim": "groups", "includes": "admin"},
+    {"claim": "tenant", "equals": "tenant-1"}
+  ]}
+]}`,
+			wantRequirements: map[string][]*ClaimRequirement{
+				"endpoints.examples.bookstore.Bookstore.CreateBook": {
+					{
+						Claim:    "scope",
+						HasScope: "books.write",
+					},
+					{
+						Claim:    "groups",
+						Includes: "admin",
+					},
+					{
+						Claim:  "tenant",
+						Equals: "tenant-1",
+					},
+				},
+			},
+		},
+		{
+			desc: "Operation without JWT authentication",
+			policyFile: `{"rules": [
+  {"selector": "endpoints.examples.bookstore.Bookstore.ListBooks", "claims": [{"claim": "tenant", "equals": "tenant-1"}]}
+]}`,
+			wantError: `JWT claims policy for operation "endpoints.examples.bookstore.Bookstore.ListBooks" requires a JWT authentication rule`,
+		},
+		{
+			desc: "Unknown operation",
+			policyFile: `{"rules": [
+  {"selector": "endpoints.examples.bookstore.Bookstore.DeleteBook", "claims": [{"claim": "tenant", "equals": "tenant-1"}]}
+]}`,
+			wantError: `JWT claims policy has unknown operation "endpoints.examples.bookstore.Bookstore.DeleteBook"`,
+		},
+		{
+			desc: "Claim with two matchers",
+			policyFile: `{"rules": [
+  {"selector": "endpoints.examples.bookstore.Bookstore.CreateBook", "claims": [{"claim": "tenant", "equals": "tenant-1", "includes": "tenant-1"}]}
+]}`,
+			wantError: `exactly one of equals, includes or hasScope must be set for claim "tenant"`,
+		},
+		{
+			desc: "Claim without name",
+			policyFile: `{"rules": [
+  {"selector": "endpoints.examples.bookstore.Bookstore.CreateBook", "claims": [{"equals": "tenant-1"}]}
+]}`,
+			wantError: "claim name must be set",
+		},
+		{
+			desc: "Rule without claims",
+			policyFile: `{"rules": [
+  {"selector": "endpoints.examples.bookstore.Bookstore.CreateBook", "claims": []}
+]}`,
+			wantError: `JWT claims policy for operation "endpoints.examples.bookstore.Bookstore.CreateBook" has no claims`,
+		},
+		{
+			desc: "Duplicate rules",
+			policyFile: `{"rules": [
+  {"selector": "endpoints.examples.bookstore.Bookstore.CreateBook", "claims": [{"claim": "tenant", "equals": "tenant-1"}]},
+  {"selector": "endpoints.examples.bookstore.Bookstore.CreateBook", "claims": [{"claim": "tenant", "equals": "tenant-2"}]}
+]}`,
+			wantError: `duplicate JWT claims policy for operation "endpoints.examples.bookstore.Bookstore.CreateBook"`,
+		},
+		{
+			desc: "Unknown field",
+			policyFile: `{"rules": [
+  {"selector": "endpoints.examples.bookstore.Bookstore.CreateBook", "claims": [{"claim": "tenant", "prefix": "tenant-"}]}
+]}`,
+			wantError: "fail to read JWT claims policy",
+		},
+	}
+
+	for _, tc := range testData {
+		path, removeFile := testutil.WriteTempFile(t, "jwt_claims_policy", tc.policyFile)
+		defer removeFile()
+
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.JwtClaimsPolicyPath = path
+
+		s, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			if tc.wantError == "" || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test Desc(%s): want error: %s, get error: %v", tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if tc.wantError != "" {
+			t.Errorf("Test Desc(%s): want error: %s, get no error", tc.desc, tc.wantError)
+			continue
+		}
+
+		gotRequirements := make(map[string][]*ClaimRequirement)
+		for selector, method := range s.Methods {
+			if method.ClaimRequirements != nil {
+				gotRequirements[selector] = method.ClaimRequirements
+			}
+		}
+		if !reflect.DeepEqual(gotRequirements, tc.wantRequirements) {
+			t.Errorf("Test Desc(%s): claim requirements\ngot: %+v\nwant: %+v", tc.desc, gotRequirements, tc.wantRequirements)
+		}
+	}
+}
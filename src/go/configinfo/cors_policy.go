@@ -0,0 +1,191 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+)
+
+// CorsPolicy is the CORS policy of the routes of an operation. It overrides
+// the policy of the virtual host set by --cors_preset.
+type CorsPolicy struct {
+	AllowOrigins       []string
+	AllowOriginRegexes []string
+	AllowMethods       string
+	AllowHeaders       string
+	ExposeHeaders      string
+	AllowCredentials   bool
+
+	// Max age of the preflight response in seconds, not set if 0.
+	MaxAge uint32
+}
+
+// corsPolicyFile is the format of the file at --cors_policy_path.
+type corsPolicyFile struct {
+	Policies []*corsPolicyRule `json:"policies"`
+}
+
+// corsPolicyRule applies to the operation with the selector, or to all
+// operations of the API if the selector is an API name.
+type corsPolicyRule struct {
+	Selector           string   `json:"selector"`
+	AllowOrigins       []string `json:"allowOrigins,omitempty"`
+	AllowOriginRegexes []string `json:"allowOriginRegexes,omitempty"`
+	AllowMethods       []string `json:"allowMethods,omitempty"`
+	AllowHeaders       []string `json:"allowHeaders,omitempty"`
+	ExposeHeaders      []string `json:"exposeHeaders,omitempty"`
+	AllowCredentials   bool     `json:"allowCredentials,omitempty"`
+	MaxAge             uint32   `json:"maxAge,omitempty"`
+}
+
+// processCorsPolicy reads the CORS policies and adds them to the operations.
+// A policy for an operation selector takes precedence over a policy for its API.
+//
+// Preflight requests are matched by the autogenerated CORS operations, one per
+// path, so they get the policy of the operations sharing their path. Operations
+// sharing a path must have the same policy.
+func (s *ServiceInfo) processCorsPolicy() error {
+	if s.Options.CorsPolicyPath == "" {
+		return nil
+	}
+	if !s.AllowCors {
+		return fmt.Errorf("cors_policy_path requires allow_cors in the endpoints of the service config, so that preflight requests are routed")
+	}
+
+	var policyFile corsPolicyFile
+	if err := util.UnmarshalJsonFile(s.Options.CorsPolicyPath, &policyFile); err != nil {
+		return fmt.Errorf("fail to read CORS policies: %v", err)
+	}
+
+	apiPolicies := make(map[string]*CorsPolicy)
+	operationPolicies := make(map[string]*CorsPolicy)
+	for _, rule := range policyFile.Policies {
+		policy, err := makeCorsPolicy(rule)
+		if err != nil {
+			return fmt.Errorf("invalid CORS policy for %q: %v", rule.Selector, err)
+		}
+
+		if _, ok := apiPolicies[rule.Selector]; ok {
+			return fmt.Errorf("duplicate CORS policy for %q", rule.Selector)
+		}
+		if _, ok := operationPolicies[rule.Selector]; ok {
+			return fmt.Errorf("duplicate CORS policy for %q", rule.Selector)
+		}
+
+		if s.isApiName(rule.Selector) {
+			apiPolicies[rule.Selector] = policy
+			continue
+		}
+		if method, ok := s.Methods[rule.Selector]; !ok || method.IsGenerated {
+			return fmt.Errorf("CORS policy has unknown API or operation %q", rule.Selector)
+		}
+		operationPolicies[rule.Selector] = policy
+	}
+
+	pathPolicies := make(map[string]*CorsPolicy)
+	pathOperations := make(map[string]string)
+	for _, operation := range s.Operations {
+		method := s.Methods[operation]
+		if method.IsGenerated {
+			continue
+		}
+
+		method.CorsPolicy = operationPolicies[operation]
+		if method.CorsPolicy == nil {
+			method.CorsPolicy = apiPolicies[method.ApiName]
+		}
+
+		for _, httpRule := range method.HttpRule {
+			matcher, err := corsPathMatcher(httpRule.UriTemplate)
+			if err != nil {
+				return err
+			}
+			if other, ok := pathOperations[matcher]; ok {
+				if !reflect.DeepEqual(pathPolicies[matcher], method.CorsPolicy) {
+					return fmt.Errorf("operations %q and %q share the path %q but have different CORS policies", other, operation, httpRule.UriTemplate)
+				}
+				continue
+			}
+			pathOperations[matcher] = operation
+			pathPolicies[matcher] = method.CorsPolicy
+		}
+	}
+
+	for _, operation := range s.Operations {
+		method := s.Methods[operation]
+		if !method.IsGenerated || !strings.Contains(operation, fmt.Sprintf("%s_CORS_", util.AutogeneratedOperationPrefix)) {
+			continue
+		}
+		for _, httpRule := range method.HttpRule {
+			matcher, err := corsPathMatcher(httpRule.UriTemplate)
+			if err != nil {
+				return err
+			}
+			if policy := pathPolicies[matcher]; policy != nil {
+				method.CorsPolicy = policy
+			}
+		}
+	}
+	return nil
+}
+
+func (s *ServiceInfo) isApiName(name string) bool {
+	for _, apiName := range s.ApiNames {
+		if apiName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// corsPathMatcher is the same key used to decide which paths get an
+// autogenerated CORS operation.
+func corsPathMatcher(uriTemplate string) (string, error) {
+	matcher, err := util.WildcardMatcherForPath(uriTemplate)
+	if err != nil || matcher != "" {
+		return matcher, err
+	}
+	return uriTemplate, nil
+}
+
+func makeCorsPolicy(rule *corsPolicyRule) (*CorsPolicy, error) {
+	if len(rule.AllowOrigins) == 0 && len(rule.AllowOriginRegexes) == 0 {
+		return nil, fmt.Errorf("either allowOrigins or allowOriginRegexes must be set")
+	}
+	for _, origin := range rule.AllowOrigins {
+		if origin == "" {
+			return nil, fmt.Errorf("allowOrigins must not contain an empty origin")
+		}
+	}
+	for _, regex := range rule.AllowOriginRegexes {
+		if err := util.ValidateRegexProgramSize(regex, util.GoogleRE2MaxProgramSize); err != nil {
+			return nil, fmt.Errorf("invalid allowOriginRegexes: %v", err)
+		}
+	}
+
+	return &CorsPolicy{
+		AllowOrigins:       rule.AllowOrigins,
+		AllowOriginRegexes: rule.AllowOriginRegexes,
+		AllowMethods:       strings.Join(rule.AllowMethods, ","),
+		AllowHeaders:       strings.Join(rule.AllowHeaders, ","),
+		ExposeHeaders:      strings.Join(rule.ExposeHeaders, ","),
+		AllowCredentials:   rule.AllowCredentials,
+		MaxAge:             rule.MaxAge,
+	}, nil
+}
@@ -0,0 +1,203 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/testutil"
+
+	annotationspb "google.golang.org/genproto/googleapis/api/annotations"
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func TestProcessCorsPolicy(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "CreateShelf",
+					},
+					{
+						Name: "GetShelf",
+					},
+				},
+			},
+		},
+		Endpoints: []*confpb.Endpoint{
+			{
+				Name:      testProjectName,
+				AllowCors: true,
+			},
+		},
+		Http: &annotationspb.Http{
+			Rules: []*annotationspb.HttpRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/shelves",
+					},
+				},
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.CreateShelf",
+					Pattern: &annotationspb.HttpRule_Post{
+						Post: "/shelves",
+					},
+				},
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.GetShelf",
+					Pattern: &annotationspb.HttpRule_Get{
+						Get: "/shelves/{shelf}",
+					},
+				},
+			},
+		},
+	}
+
+	apiPolicy := &CorsPolicy{
+		AllowOrigins: []string{"https://example.com"},
+		AllowMethods: "GET,POST",
+		MaxAge:       600,
+	}
+	getShelfPolicy := &CorsPolicy{
+		AllowOriginRegexes: []string{`https://[^.]+\.example\.com`},
+		AllowHeaders:       "authorization,content-type",
+		AllowCredentials:   true,
+	}
+
+	testData := []struct {
+		desc         string
+		allowCors    bool
+		policyFile   string
+		wantPolicies map[string]*CorsPolicy
+		wantError    string
+	}{
+		{
+			desc:      "Operation policy takes precedence over API policy",
+			allowCors: true,
+			policyFile: `{"policies": [
+  {"selector": "endpoints.examples.bookstore.Bookstore", "allowOrigins": ["https://example.com"], "allowMethods": ["GET", "POST"], "maxAge": 600},
+  {"selector": "endpoints.examples.bookstore.Bookstore.GetShelf", "allowOriginRegexes": ["https://[^.]+\\.example\\.com"], "allowHeaders": ["authorization", "content-type"], "allowCredentials": true}
+]}`,
+			wantPolicies: map[string]*CorsPolicy{
+				"endpoints.examples.bookstore.Bookstore.ListShelves":                          apiPolicy,
+				"endpoints.examples.bookstore.Bookstore.CreateShelf":                          apiPolicy,
+				"endpoints.examples.bookstore.Bookstore.GetShelf":                             getShelfPolicy,
+				"endpoints.examples.bookstore.Bookstore.ESPv2_Autogenerated_CORS_ListShelves": apiPolicy,
+				"endpoints.examples.bookstore.Bookstore.ESPv2_Autogenerated_CORS_GetShelf":    getShelfPolicy,
+			},
+		},
+		{
+			desc:      "Operations without a policy use the policy of the virtual host",
+			allowCors: true,
+			policyFile: `{"policies": [
+  {"selector": "endpoints.examples.bookstore.Bookstore.GetShelf", "allowOriginRegexes": ["https://[^.]+\\.example\\.com"], "allowHeaders": ["authorization", "content-type"], "allowCredentials": true}
+]}`,
+			wantPolicies: map[string]*CorsPolicy{
+				"endpoints.examples.bookstore.Bookstore.GetShelf":                          getShelfPolicy,
+				"endpoints.examples.bookstore.Bookstore.ESPv2_Autogenerated_CORS_GetShelf": getShelfPolicy,
+			},
+		},
+		{
+			desc:      "Operations sharing a path with different policies",
+			allowCors: true,
+			policyFile: `{"policies": [
+  {"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf", "allowOrigins": ["https://example.com"]}
+]}`,
+			wantError: `operations "endpoints.examples.bookstore.Bookstore.ListShelves" and "endpoints.examples.bookstore.Bookstore.CreateShelf" share the path "/shelves" but have different CORS policies`,
+		},
+		{
+			desc:      "Policy for an autogenerated CORS operation",
+			allowCors: true,
+			policyFile: `{"policies": [
+  {"selector": "endpoints.examples.bookstore.Bookstore.ESPv2_Autogenerated_CORS_GetShelf", "allowOrigins": ["https://example.com"]}
+]}`,
+			wantError: `CORS policy has unknown API or operation "endpoints.examples.bookstore.Bookstore.ESPv2_Autogenerated_CORS_GetShelf"`,
+		},
+		{
+			desc:      "Policy without origins",
+			allowCors: true,
+			policyFile: `{"policies": [
+  {"selector": "endpoints.examples.bookstore.Bookstore", "allowMethods": ["GET"]}
+]}`,
+			wantError: "either allowOrigins or allowOriginRegexes must be set",
+		},
+		{
+			desc:      "Policy with invalid origin regex",
+			allowCors: true,
+			policyFile: `{"policies": [
+  {"selector": "endpoints.examples.bookstore.Bookstore", "allowOriginRegexes": ["https://(example"]}
+]}`,
+			wantError: "invalid allowOriginRegexes",
+		},
+		{
+			desc:      "Duplicate policies",
+			allowCors: true,
+			policyFile: `{"policies": [
+  {"selector": "endpoints.examples.bookstore.Bookstore", "allowOrigins": ["https://example.com"]},
+  {"selector": "endpoints.examples.bookstore.Bookstore", "allowOrigins": ["https://example.org"]}
+]}`,
+			wantError: `duplicate CORS policy for "endpoints.examples.bookstore.Bookstore"`,
+		},
+		{
+			desc: "Service config does not allow CORS",
+			policyFile: `{"policies": [
+  {"selector": "endpoints.examples.bookstore.Bookstore", "allowOrigins": ["https://example.com"]}
+]}`,
+			wantError: "cors_policy_path requires allow_cors",
+		},
+	}
+
+	for _, tc := range testData {
+		path, removeFile := testutil.WriteTempFile(t, "cors_policy", tc.policyFile)
+		defer removeFile()
+
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.CorsPolicyPath = path
+
+		fakeServiceConfig.Endpoints[0].AllowCors = tc.allowCors
+		s, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			if tc.wantError == "" || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test Desc(%s): want error: %s, get error: %v", tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if tc.wantError != "" {
+			t.Errorf("Test Desc(%s): want error: %s, get no error", tc.desc, tc.wantError)
+			continue
+		}
+
+		gotPolicies := make(map[string]*CorsPolicy)
+		for selector, method := range s.Methods {
+			if method.CorsPolicy != nil {
+				gotPolicies[selector] = method.CorsPolicy
+			}
+		}
+		if !reflect.DeepEqual(gotPolicies, tc.wantPolicies) {
+			t.Errorf("Test Desc(%s): CORS policies\ngot: %+v\nwant: %+v", tc.desc, gotPolicies, tc.wantPolicies)
+		}
+	}
+}
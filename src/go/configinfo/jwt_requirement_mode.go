@@ -0,0 +1,80 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+)
+
+// JwtRequirementMode is how the JWT requirements of an operation are combined.
+type JwtRequirementMode string
+
+const (
+	// A JWT of any of the providers is required, the default.
+	JwtRequirementAny JwtRequirementMode = "any"
+	// JWTs of all the providers are required.
+	JwtRequirementAll JwtRequirementMode = "all"
+	// Requests without JWT are allowed, a JWT of any of the providers must be valid.
+	JwtRequirementAllowMissing JwtRequirementMode = "allow_missing"
+	// Requests without JWT or with invalid JWTs are allowed.
+	JwtRequirementAllowMissingOrFailed JwtRequirementMode = "allow_missing_or_failed"
+)
+
+// jwtRequirementModesFile is the format of the file at --jwt_requirement_modes_path.
+type jwtRequirementModesFile struct {
+	Rules []*jwtRequirementModeRule `json:"rules"`
+}
+
+type jwtRequirementModeRule struct {
+	Selector string             `json:"selector"`
+	Mode     JwtRequirementMode `json:"mode"`
+}
+
+// processJwtRequirementModes reads the requirement modes of the operations,
+// which the service config can not express. The operations must have an
+// authentication rule with requirements.
+func (s *ServiceInfo) processJwtRequirementModes() error {
+	if s.Options.JwtRequirementModesPath == "" {
+		return nil
+	}
+
+	var modesFile jwtRequirementModesFile
+	if err := util.UnmarshalJsonFile(s.Options.JwtRequirementModesPath, &modesFile); err != nil {
+		return fmt.Errorf("fail to read JWT requirement modes: %v", err)
+	}
+
+	for _, rule := range modesFile.Rules {
+		method, ok := s.Methods[rule.Selector]
+		if !ok || method.IsGenerated {
+			return fmt.Errorf("JWT requirement modes have unknown operation %q", rule.Selector)
+		}
+		if len(method.JwtRequirements) == 0 {
+			return fmt.Errorf("JWT requirement mode for operation %q requires a JWT authentication rule for the operation", rule.Selector)
+		}
+		if method.JwtRequirementMode != "" {
+			return fmt.Errorf("duplicate JWT requirement mode for operation %q", rule.Selector)
+		}
+
+		switch rule.Mode {
+		case JwtRequirementAny, JwtRequirementAll, JwtRequirementAllowMissing, JwtRequirementAllowMissingOrFailed:
+			method.JwtRequirementMode = rule.Mode
+		default:
+			return fmt.Errorf("invalid JWT requirement mode %q for operation %q, must be one of any, all, allow_missing or allow_missing_or_failed", rule.Mode, rule.Selector)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/testutil"
+
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func TestProcessJwtRequirementModes(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "ListShelves",
+					},
+					{
+						Name: "CreateShelf",
+					},
+					{
+						Name: "GetShelf",
+					},
+				},
+			},
+		},
+		Authentication: &confpb.Authentication{
+			Providers: []*confpb.AuthProvider{
+				{
+					Id:      "auth_provider_0",
+					Issuer:  "issuer-0",
+					JwksUri: "https://issuer-0.example.com/jwks",
+				},
+				{
+					Id:      "auth_provider_1",
+					Issuer:  "issuer-1",
+					JwksUri: "https://issuer-1.example.com/jwks",
+				},
+			},
+			Rules: []*confpb.AuthenticationRule{
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.ListShelves",
+					Requirements: []*confpb.AuthRequirement{
+						{
+							ProviderId: "auth_provider_0",
+						},
+					},
+				},
+				{
+					Selector: "endpoints.examples.bookstore.Bookstore.CreateShelf",
+					Requirements: []*confpb.AuthRequirement{
+						{
+							ProviderId: "auth_provider_0",
+						},
+						{
+							ProviderId: "auth_provider_1",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc      string
+		modesFile string
+		wantModes map[string]JwtRequirementMode
+		wantError string
+	}{
+		{
+			desc: "Modes of operations",
+			modesFile: `{"rules": [
+  {"selector": "endpoints.examples.bookstore.Bookstore.ListShelves", "mode": "allow_missing"},
+  {"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf", "mode": "all"}
+]}`,
+			wantModes: map[string]JwtRequirementMode{
+				"endpoints.examples.bookstore.Bookstore.ListShelves": JwtRequirementAllowMissing,
+				"endpoints.examples.bookstore.Bookstore.CreateShelf": JwtRequirementAll,
+			},
+		},
+		{
+			desc: "Invalid mode",
+			modesFile: `{"rules": [
+  {"selector": "endpoints.examples.bookstore.Bookstore.ListShelves", "mode": "optional"}
+]}`,
+			wantError: `invalid JWT requirement mode "optional" for operation "endpoints.examples.bookstore.Bookstore.ListShelves"`,
+		},
+		{
+			desc: "Operation without authentication rule",
+			modesFile: `{"rules": [
+  {"selector": "endpoints.examples.bookstore.Bookstore.GetShelf", "mode": "allow_missing_or_failed"}
+]}`,
+			wantError: `JWT requirement mode for operation "endpoints.examples.bookstore.Bookstore.GetShelf" requires a JWT authentication rule`,
+		},
+		{
+			desc: "Unknown operation",
+			modesFile: `{"rules": [
+  {"selector": "endpoints.examples.bookstore.Bookstore.DeleteShelf", "mode": "all"}
+]}`,
+			wantError: `JWT requirement modes have unknown operation "endpoints.examples.bookstore.Bookstore.DeleteShelf"`,
+		},
+		{
+			desc: "Duplicate modes",
+			modesFile: `{"rules": [
+  {"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf", "mode": "all"},
+  {"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf", "mode": "any"}
+]}`,
+			wantError: `duplicate JWT requirement mode for operation "endpoints.examples.bookstore.Bookstore.CreateShelf"`,
+		},
+		{
+			desc:      "Unknown field",
+			modesFile: `{"rules": [{"selector": "endpoints.examples.bookstore.Bookstore.CreateShelf", "requires": "all"}]}`,
+			wantError: "fail to read JWT requirement modes",
+		},
+	}
+
+	for _, tc := range testData {
+		path, removeFile := testutil.WriteTempFile(t, "jwt_requirement_modes", tc.modesFile)
+		defer removeFile()
+
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.JwtRequirementModesPath = path
+
+		s, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			if tc.wantError == "" || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test Desc(%s): want error: %s, get error: %v", tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if tc.wantError != "" {
+			t.Errorf("Test Desc(%s): want error: %s, get no error", tc.desc, tc.wantError)
+			continue
+		}
+
+		gotModes := make(map[string]JwtRequirementMode)
+		for selector, method := range s.Methods {
+			if method.JwtRequirementMode != "" {
+				gotModes[selector] = method.JwtRequirementMode
+			}
+		}
+		if !reflect.DeepEqual(gotModes, tc.wantModes) {
+			t.Errorf("Test Desc(%s): JWT requirement modes\ngot: %v\nwant: %v", tc.desc, gotModes, tc.wantModes)
+		}
+	}
+}
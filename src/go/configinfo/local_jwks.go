@@ -0,0 +1,103 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+const localJwksUriPrefix = "file://"
+
+// processLocalJwks reads the JWKS of the providers that are not fetched by the
+// proxy. They are either set in --jwt_local_jwks, as a file path or inline
+// JSON, or the jwks_uri of the provider is a file:// URI.
+func (s *ServiceInfo) processLocalJwks() error {
+	providerIds := make(map[string]bool)
+	for _, provider := range s.serviceConfig.GetAuthentication().GetProviders() {
+		providerIds[provider.GetId()] = true
+	}
+
+	if s.Options.JwtLocalJwks != "" {
+		var localJwks map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(s.Options.JwtLocalJwks), &localJwks); err != nil {
+			return fmt.Errorf("jwt_local_jwks must be a JSON object of provider ids to JWKS file paths or JWKS: %v", err)
+		}
+
+		for id, jwks := range localJwks {
+			if !providerIds[id] {
+				return fmt.Errorf("jwt_local_jwks has unknown provider id %q", id)
+			}
+
+			var path string
+			if err := json.Unmarshal(jwks, &path); err == nil {
+				s.LocalJwksPaths[id] = path
+				continue
+			}
+			if err := validateJwks(jwks); err != nil {
+				return fmt.Errorf("invalid inline JWKS for provider %q: %v", id, err)
+			}
+			s.LocalJwks[id] = string(jwks)
+		}
+	}
+
+	for _, provider := range s.serviceConfig.GetAuthentication().GetProviders() {
+		if _, ok := s.LocalJwks[provider.GetId()]; ok {
+			continue
+		}
+		if _, ok := s.LocalJwksPaths[provider.GetId()]; ok {
+			continue
+		}
+		if strings.HasPrefix(provider.GetJwksUri(), localJwksUriPrefix) {
+			s.LocalJwksPaths[provider.GetId()] = strings.TrimPrefix(provider.GetJwksUri(), localJwksUriPrefix)
+		}
+	}
+
+	for id, path := range s.LocalJwksPaths {
+		jwks, err := ReadLocalJwks(path)
+		if err != nil {
+			return fmt.Errorf("fail to read JWKS for provider %q: %v", id, err)
+		}
+		s.LocalJwks[id] = jwks
+	}
+	return nil
+}
+
+// ReadLocalJwks reads and validates the JWKS file at the path.
+func ReadLocalJwks(path string) (string, error) {
+	jwks, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if err := validateJwks(jwks); err != nil {
+		return "", fmt.Errorf("invalid JWKS in file %s: %v", path, err)
+	}
+	return string(jwks), nil
+}
+
+func validateJwks(jwks []byte) error {
+	var keySet struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := json.Unmarshal(jwks, &keySet); err != nil {
+		return err
+	}
+	if len(keySet.Keys) == 0 {
+		return fmt.Errorf("JWKS has no keys")
+	}
+	return nil
+}
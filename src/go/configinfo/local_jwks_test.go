@@ -0,0 +1,139 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/testutil"
+
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func TestProcessLocalJwks(t *testing.T) {
+	fileJwks := `{"keys": [{"kty": "RSA", "kid": "file-key", "n": "AQAB", "e": "AQAB"}]}`
+	path, removeFile := testutil.WriteTempFile(t, "local_jwks", fileJwks)
+	defer removeFile()
+
+	emptyPath, removeEmptyFile := testutil.WriteTempFile(t, "local_jwks_empty", `{"keys": []}`)
+	defer removeEmptyFile()
+
+	testData := []struct {
+		desc          string
+		jwksUri       string
+		jwtLocalJwks  string
+		wantJwks      map[string]string
+		wantJwksPaths map[string]string
+		wantError     string
+	}{
+		{
+			desc:          "Remote JWKS",
+			jwksUri:       "https://issuer.example.com/jwks",
+			wantJwks:      map[string]string{},
+			wantJwksPaths: map[string]string{},
+		},
+		{
+			desc:          "JWKS file from the file jwks_uri",
+			jwksUri:       "file://" + path,
+			wantJwks:      map[string]string{"auth_provider": fileJwks},
+			wantJwksPaths: map[string]string{"auth_provider": path},
+		},
+		{
+			desc:          "JWKS file from the flag overrides the jwks_uri",
+			jwksUri:       "https://issuer.example.com/jwks",
+			jwtLocalJwks:  fmt.Sprintf(`{"auth_provider": %q}`, path),
+			wantJwks:      map[string]string{"auth_provider": fileJwks},
+			wantJwksPaths: map[string]string{"auth_provider": path},
+		},
+		{
+			desc:          "Inline JWKS from the flag without jwks_uri",
+			jwtLocalJwks:  `{"auth_provider": {"keys": [{"kty": "RSA", "kid": "inline-key", "n": "AQAB", "e": "AQAB"}]}}`,
+			wantJwks:      map[string]string{"auth_provider": `{"keys": [{"kty": "RSA", "kid": "inline-key", "n": "AQAB", "e": "AQAB"}]}`},
+			wantJwksPaths: map[string]string{},
+		},
+		{
+			desc:         "Unknown provider id",
+			jwtLocalJwks: `{"unknown_provider": {"keys": [{"kty": "RSA"}]}}`,
+			wantError:    `jwt_local_jwks has unknown provider id "unknown_provider"`,
+		},
+		{
+			desc:         "Flag is not a JSON object",
+			jwtLocalJwks: `["auth_provider"]`,
+			wantError:    "jwt_local_jwks must be a JSON object",
+		},
+		{
+			desc:         "Inline JWKS without keys",
+			jwtLocalJwks: `{"auth_provider": {"keys": []}}`,
+			wantError:    `invalid inline JWKS for provider "auth_provider": JWKS has no keys`,
+		},
+		{
+			desc:      "JWKS file without keys",
+			jwksUri:   "file://" + emptyPath,
+			wantError: `fail to read JWKS for provider "auth_provider"`,
+		},
+		{
+			desc:      "Missing JWKS file",
+			jwksUri:   "file:///missing/jwks.json",
+			wantError: `fail to read JWKS for provider "auth_provider"`,
+		},
+	}
+
+	for _, tc := range testData {
+		fakeServiceConfig := &confpb.Service{
+			Name: testProjectName,
+			Apis: []*apipb.Api{
+				{
+					Name: testApiName,
+				},
+			},
+			Authentication: &confpb.Authentication{
+				Providers: []*confpb.AuthProvider{
+					{
+						Id:      "auth_provider",
+						Issuer:  "issuer@example.com",
+						JwksUri: tc.jwksUri,
+					},
+				},
+			},
+		}
+
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.JwtLocalJwks = tc.jwtLocalJwks
+
+		s, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			if tc.wantError == "" || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test Desc(%s): want error: %s, get error: %v", tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if tc.wantError != "" {
+			t.Errorf("Test Desc(%s): want error: %s, get no error", tc.desc, tc.wantError)
+			continue
+		}
+
+		if !reflect.DeepEqual(s.LocalJwks, tc.wantJwks) {
+			t.Errorf("Test Desc(%s): local JWKS\ngot: %v\nwant: %v", tc.desc, s.LocalJwks, tc.wantJwks)
+		}
+		if !reflect.DeepEqual(s.LocalJwksPaths, tc.wantJwksPaths) {
+			t.Errorf("Test Desc(%s): local JWKS paths\ngot: %v\nwant: %v", tc.desc, s.LocalJwksPaths, tc.wantJwksPaths)
+		}
+	}
+}
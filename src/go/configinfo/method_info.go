@@ -37,6 +37,20 @@ type methodInfo struct {
 	MetricCosts        []*scpb.MetricCost
 	// All non-unary gRPC methods are considered streaming.
 	IsStreaming bool
+	// Requests are mirrored to the shadow backend.
+	MirrorToShadowBackend bool
+	// Alternate backends, in the order of the canary rules.
+	CanaryBackends []*CanaryBackend
+	// CORS policy of the routes, overriding the one of the virtual host.
+	CorsPolicy *CorsPolicy
+	// JWT requirements of the authentication rule of the method.
+	JwtRequirements []*confpb.AuthRequirement
+	// Claims the JWT must have, all of them are required.
+	ClaimRequirements []*ClaimRequirement
+	// How the JWT requirements are combined, empty for the default.
+	JwtRequirementMode JwtRequirementMode
+	// Claims of the JWT payload forwarded to the backend as headers.
+	ClaimHeaders []*ClaimHeader
 
 	// The request type name (not the entire type URL).
 	RequestTypeName string
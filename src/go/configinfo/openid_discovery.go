@@ -0,0 +1,123 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/glog"
+)
+
+// openIDJwksUris caches the jwks_uri resolved by OpenID Connect Discovery by
+// issuer, so config updates still succeed when an issuer is unreachable.
+var openIDJwksUris = struct {
+	sync.Mutex
+	byIssuer map[string]string
+}{
+	byIssuer: make(map[string]string),
+}
+
+// processEmptyJwksUriByOpenID sets the jwks_uri of the providers fetched by
+// the proxy. A provider without one in the service config gets it either from
+// --jwt_openid_jwks_uris, or resolved using the OpenID Connect Discovery
+// protocol, falling back to the one resolved by a previous config update if
+// the discovery fails.
+func (s *ServiceInfo) processEmptyJwksUriByOpenID() error {
+	overrides := make(map[string]string)
+	if s.Options.JwtOpenIDJwksUris != "" {
+		if err := json.Unmarshal([]byte(s.Options.JwtOpenIDJwksUris), &overrides); err != nil {
+			return fmt.Errorf("jwt_openid_jwks_uris must be a JSON object of provider ids to jwks_uri: %v", err)
+		}
+	}
+
+	providers := make(map[string]bool)
+	for _, provider := range s.serviceConfig.GetAuthentication().GetProviders() {
+		providers[provider.GetId()] = true
+	}
+	for id := range overrides {
+		if !providers[id] {
+			return fmt.Errorf("jwt_openid_jwks_uris has unknown provider id %q", id)
+		}
+	}
+
+	var client *http.Client
+	for _, provider := range s.serviceConfig.GetAuthentication().GetProviders() {
+		if _, ok := s.LocalJwks[provider.GetId()]; ok {
+			continue
+		}
+
+		// Note: When jwksUri is empty, proxy will try to find jwksUri using the
+		// OpenID Connect Discovery protocol.
+		if provider.GetJwksUri() != "" {
+			if _, ok := overrides[provider.GetId()]; ok {
+				return fmt.Errorf("jwt_openid_jwks_uris has provider %q, which already has a jwks_uri", provider.GetId())
+			}
+			s.JwksUris[provider.GetId()] = provider.GetJwksUri()
+			continue
+		}
+		if jwksUri, ok := overrides[provider.GetId()]; ok {
+			s.JwksUris[provider.GetId()] = jwksUri
+			continue
+		}
+
+		if client == nil {
+			client = openIDDiscoveryClient(s.Options)
+		}
+		glog.Infof("jwks_uri is empty, using OpenID Connect Discovery protocol")
+		jwksUri, err := util.ResolveJwksUriUsingOpenID(client, provider.GetIssuer(), s.Options.JwtOpenIDDiscoveryRetries, s.Options.JwtOpenIDDiscoveryInitialInterval)
+
+		openIDJwksUris.Lock()
+		if err == nil {
+			openIDJwksUris.byIssuer[provider.GetIssuer()] = jwksUri
+		} else if cachedJwksUri, ok := openIDJwksUris.byIssuer[provider.GetIssuer()]; ok {
+			glog.Warningf("failed OpenID Connect Discovery protocol for issuer %q, using the jwks_uri of the previous config: %v", provider.GetIssuer(), err)
+			jwksUri, err = cachedJwksUri, nil
+		}
+		openIDJwksUris.Unlock()
+		if err != nil {
+			return fmt.Errorf("failed OpenID Connect Discovery protocol: %v", err)
+		}
+		s.JwksUris[provider.GetId()] = jwksUri
+	}
+	return nil
+}
+
+// openIDDiscoveryClient trusts the sidestream root certificates, falling back
+// to the system root certificates if they can not be read or loaded.
+func openIDDiscoveryClient(opts options.ConfigGeneratorOptions) *http.Client {
+	transport := &http.Transport{}
+	caCert, err := ioutil.ReadFile(opts.SslSidestreamClientRootCertsPath)
+	if err != nil {
+		glog.Warningf("fail to read root certificates for OpenID Connect Discovery, using the system root certificates: %v", err)
+	} else if caCertPool := x509.NewCertPool(); !caCertPool.AppendCertsFromPEM(caCert) {
+		glog.Warningf("no root certificates loaded from %s for OpenID Connect Discovery, using the system root certificates", opts.SslSidestreamClientRootCertsPath)
+	} else {
+		transport.TLSClientConfig = &tls.Config{
+			RootCAs: caCertPool,
+		}
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   opts.JwtOpenIDDiscoveryTimeout,
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+const (
+	// A route that never matches, all its requests match an earlier route of
+	// another operation.
+	RouteConflictUnreachable = "unreachable"
+	// Some requests of a route match an earlier route of another operation,
+	// and neither route is more specific than the other.
+	RouteConflictAmbiguous = "ambiguous"
+)
+
+// RouteReport is the result of the analysis of the per-operation routes, in
+// the order Envoy matches them. It is serialized to JSON by the route report
+// CLI and the status of the config manager.
+type RouteReport struct {
+	Routes    []*RouteReportEntry `json:"routes"`
+	Conflicts []*RouteConflict    `json:"conflicts,omitempty"`
+	// Set when the routes could not be ordered by specificity without changing
+	// the matches of ambiguous routes, they are kept in the operation order.
+	ReorderSkipped bool `json:"reorderSkipped,omitempty"`
+}
+
+// RouteReportEntry is a route of an http rule of an operation.
+type RouteReportEntry struct {
+	Operation   string `json:"operation"`
+	HttpMethod  string `json:"httpMethod"`
+	UriTemplate string `json:"uriTemplate"`
+	// Set when the route is moved before a less specific route of an earlier
+	// operation.
+	Reordered bool `json:"reordered,omitempty"`
+}
+
+// RouteConflict is a route that is shadowed by an earlier route.
+type RouteConflict struct {
+	// Either "unreachable" or "ambiguous".
+	Type        string            `json:"type"`
+	Route       *RouteReportEntry `json:"route"`
+	ShadowedBy  *RouteReportEntry `json:"shadowedBy"`
+	ExamplePath string            `json:"examplePath"`
+}
@@ -0,0 +1,98 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// selectorSpecificity returns how specific a selector of the service config
+// rules is, an exact method name is more specific than any wildcard, and a
+// longer "prefix.*" wildcard is more specific than a shorter one or "*".
+func selectorSpecificity(selector string) (int, error) {
+	switch {
+	case selector == "*":
+		return 0, nil
+	case strings.HasSuffix(selector, ".*"):
+		prefix := strings.TrimSuffix(selector, "*")
+		if len(prefix) == 1 || strings.Contains(prefix, "*") {
+			return 0, fmt.Errorf("invalid selector %q, a wildcard must be the last component of the selector", selector)
+		}
+		return len(prefix), nil
+	case strings.Contains(selector, "*"):
+		return 0, fmt.Errorf("invalid selector %q, a wildcard must be the last component of the selector", selector)
+	default:
+		return math.MaxInt32, nil
+	}
+}
+
+// selectorMatches reports whether a valid selector matches the operation.
+func selectorMatches(selector, operation string) bool {
+	if selector == "*" {
+		return true
+	}
+	if strings.HasSuffix(selector, ".*") {
+		return strings.HasPrefix(operation, strings.TrimSuffix(selector, "*"))
+	}
+	return selector == operation
+}
+
+// methodsBySelector resolves the selectors of the rules of a service config
+// section, and returns the methods each rule applies to, indexed like the
+// selectors. Every method gets the rule with the most specific selector
+// matching it, the last one among equally specific rules.
+//
+// Wildcards only match the methods of the apis, not the ones generated by
+// ESPv2. An exact selector of an unknown method creates it if create is set,
+// otherwise the rule is not applied.
+func (s *ServiceInfo) methodsBySelector(selectors []string, create bool) ([][]*methodInfo, error) {
+	specificities := make([]int, len(selectors))
+	for i, selector := range selectors {
+		specificity, err := selectorSpecificity(selector)
+		if err != nil {
+			return nil, err
+		}
+		specificities[i] = specificity
+
+		if create && specificity == math.MaxInt32 {
+			if _, err := s.getOrCreateMethod(selector); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	methods := make([][]*methodInfo, len(selectors))
+	for _, operation := range s.Operations {
+		method := s.Methods[operation]
+		selected := -1
+		for i, selector := range selectors {
+			if method.IsGenerated && specificities[i] != math.MaxInt32 {
+				continue
+			}
+			if !selectorMatches(selector, operation) {
+				continue
+			}
+			if selected == -1 || specificities[i] >= specificities[selected] {
+				selected = i
+			}
+		}
+		if selected != -1 {
+			methods[selected] = append(methods[selected], method)
+		}
+	}
+	return methods, nil
+}
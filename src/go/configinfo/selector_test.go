@@ -0,0 +1,318 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/google/go-cmp/cmp"
+
+	annotationspb "google.golang.org/genproto/googleapis/api/annotations"
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+// selectorResult summarizes the rules applied to a method.
+type selectorResult struct {
+	Cluster                string
+	AllowUnregisteredCalls bool
+	SkipServiceControl     bool
+	MetricCosts            string
+	ApiKeyLocations        string
+	JwtProviders           string
+}
+
+func TestWildcardSelectors(t *testing.T) {
+	const (
+		bookstore = "endpoints.examples.bookstore.Bookstore"
+		admin     = "endpoints.examples.bookstore.Admin"
+	)
+	apis := []*apipb.Api{
+		{
+			Name: bookstore,
+			Methods: []*apipb.Method{
+				{Name: "ListShelves"},
+				{Name: "GetShelf"},
+			},
+		},
+		{
+			Name: admin,
+			Methods: []*apipb.Method{
+				{Name: "Purge"},
+			},
+		},
+	}
+
+	testData := []struct {
+		desc              string
+		fakeServiceConfig *confpb.Service
+		wantResults       map[string]selectorResult
+		wantError         string
+	}{
+		{
+			desc: "Backend rules, the most specific selector wins regardless of the order",
+			fakeServiceConfig: &confpb.Service{
+				Backend: &confpb.Backend{
+					Rules: []*confpb.BackendRule{
+						{
+							Selector: bookstore + ".GetShelf",
+						},
+						{
+							Selector: bookstore + ".*",
+							Address:  "https://bookstore.example.com",
+						},
+						{
+							Selector: "*",
+							Address:  "https://default.example.com",
+						},
+					},
+				},
+			},
+			wantResults: map[string]selectorResult{
+				bookstore + ".ListShelves": {Cluster: "backend-cluster-bookstore.example.com:443"},
+				bookstore + ".GetShelf":    {Cluster: "backend-cluster-bookstore.endpoints.project123.cloud.goog_local"},
+				admin + ".Purge":           {Cluster: "backend-cluster-default.example.com:443"},
+			},
+		},
+		{
+			desc: "Usage rules, the last of equally specific selectors wins",
+			fakeServiceConfig: &confpb.Service{
+				Usage: &confpb.Usage{
+					Rules: []*confpb.UsageRule{
+						{
+							Selector:               bookstore + ".ListShelves",
+							AllowUnregisteredCalls: true,
+						},
+						{
+							Selector:           "*",
+							SkipServiceControl: true,
+						},
+						{
+							Selector:               "*",
+							AllowUnregisteredCalls: true,
+						},
+					},
+				},
+			},
+			wantResults: map[string]selectorResult{
+				bookstore + ".ListShelves": {AllowUnregisteredCalls: true},
+				bookstore + ".GetShelf":    {AllowUnregisteredCalls: true},
+				admin + ".Purge":           {AllowUnregisteredCalls: true},
+			},
+		},
+		{
+			desc: "Quota and system parameter rules with wildcards",
+			fakeServiceConfig: &confpb.Service{
+				Quota: &confpb.Quota{
+					MetricRules: []*confpb.MetricRule{
+						{
+							Selector:    "endpoints.examples.*",
+							MetricCosts: map[string]int64{"read": 1},
+						},
+						{
+							Selector:    admin + ".*",
+							MetricCosts: map[string]int64{"write": 2},
+						},
+					},
+				},
+				SystemParameters: &confpb.SystemParameters{
+					Rules: []*confpb.SystemParameterRule{
+						{
+							Selector: "*",
+							Parameters: []*confpb.SystemParameter{
+								{
+									Name:       "api_key",
+									HttpHeader: "x-api-key",
+								},
+							},
+						},
+						{
+							Selector: bookstore + ".GetShelf",
+							Parameters: []*confpb.SystemParameter{
+								{
+									Name:              "api_key",
+									UrlQueryParameter: "shelf_key",
+								},
+							},
+						},
+					},
+				},
+			},
+			wantResults: map[string]selectorResult{
+				bookstore + ".ListShelves": {MetricCosts: "read=1", ApiKeyLocations: "header:x-api-key"},
+				bookstore + ".GetShelf":    {MetricCosts: "read=1", ApiKeyLocations: "query:shelf_key"},
+				admin + ".Purge":           {MetricCosts: "write=2", ApiKeyLocations: "header:x-api-key"},
+			},
+		},
+		{
+			desc: "Authentication rules do not apply to the generated methods",
+			fakeServiceConfig: &confpb.Service{
+				Endpoints: []*confpb.Endpoint{
+					{
+						Name:      testProjectName,
+						AllowCors: true,
+					},
+				},
+				Http: &annotationspb.Http{
+					Rules: []*annotationspb.HttpRule{
+						{
+							Selector: bookstore + ".GetShelf",
+							Pattern: &annotationspb.HttpRule_Get{
+								Get: "/v1/shelves/{shelf}",
+							},
+						},
+					},
+				},
+				Authentication: &confpb.Authentication{
+					Rules: []*confpb.AuthenticationRule{
+						{
+							Selector: "*",
+							Requirements: []*confpb.AuthRequirement{
+								{ProviderId: "default"},
+							},
+						},
+						{
+							Selector: bookstore + ".*",
+							Requirements: []*confpb.AuthRequirement{
+								{ProviderId: "bookstore"},
+							},
+						},
+						{
+							Selector: bookstore + ".ListShelves",
+						},
+						{
+							Selector: bookstore + ".Unknown",
+							Requirements: []*confpb.AuthRequirement{
+								{ProviderId: "unknown"},
+							},
+						},
+					},
+				},
+			},
+			wantResults: map[string]selectorResult{
+				bookstore + ".ListShelves":                       {},
+				bookstore + ".GetShelf":                          {JwtProviders: "bookstore"},
+				bookstore + ".ESPv2_Autogenerated_CORS_GetShelf": {},
+				admin + ".Purge":                                 {JwtProviders: "default"},
+			},
+		},
+		{
+			desc: "Fail, wildcard in the middle of the selector",
+			fakeServiceConfig: &confpb.Service{
+				Usage: &confpb.Usage{
+					Rules: []*confpb.UsageRule{
+						{
+							Selector:           "endpoints.*.Bookstore.ListShelves",
+							SkipServiceControl: true,
+						},
+					},
+				},
+			},
+			wantError: `invalid selector "endpoints.*.Bookstore.ListShelves", a wildcard must be the last component of the selector`,
+		},
+		{
+			desc: "Fail, wildcard in a partial component",
+			fakeServiceConfig: &confpb.Service{
+				Backend: &confpb.Backend{
+					Rules: []*confpb.BackendRule{
+						{
+							Selector: bookstore + ".List*",
+							Address:  "https://bookstore.example.com",
+						},
+					},
+				},
+			},
+			wantError: `invalid selector "endpoints.examples.bookstore.Bookstore.List*", a wildcard must be the last component of the selector`,
+		},
+		{
+			desc: "Fail, wildcard without a prefix",
+			fakeServiceConfig: &confpb.Service{
+				Quota: &confpb.Quota{
+					MetricRules: []*confpb.MetricRule{
+						{
+							Selector:    ".*",
+							MetricCosts: map[string]int64{"read": 1},
+						},
+					},
+				},
+			},
+			wantError: `invalid selector ".*", a wildcard must be the last component of the selector`,
+		},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.desc, func(t *testing.T) {
+			tc.fakeServiceConfig.Name = testProjectName
+			tc.fakeServiceConfig.Apis = apis
+			opts := options.DefaultConfigGeneratorOptions()
+			opts.BackendAddress = "http://127.0.0.1:80"
+			serviceInfo, err := NewServiceInfoFromServiceConfig(tc.fakeServiceConfig, testConfigID, opts)
+			if err != nil {
+				if tc.wantError == "" || err.Error() != tc.wantError {
+					t.Fatalf("got error: %v, want error: %v", err, tc.wantError)
+				}
+				return
+			}
+			if tc.wantError != "" {
+				t.Fatalf("got no error, want error: %v", tc.wantError)
+			}
+
+			gotResults := make(map[string]selectorResult)
+			for operation := range tc.wantResults {
+				method, ok := serviceInfo.Methods[operation]
+				if !ok {
+					t.Fatalf("missing method %q", operation)
+				}
+
+				var result selectorResult
+				if tc.fakeServiceConfig.GetBackend() != nil {
+					result.Cluster = method.BackendInfo.ClusterName
+				}
+				result.AllowUnregisteredCalls = method.AllowUnregisteredCalls
+				result.SkipServiceControl = method.SkipServiceControl
+				var costs, locations, providers []string
+				for _, cost := range method.MetricCosts {
+					costs = append(costs, fmt.Sprintf("%s=%d", cost.GetName(), cost.GetCost()))
+				}
+				if tc.fakeServiceConfig.GetSystemParameters() != nil {
+					for _, location := range method.ApiKeyLocations {
+						if location.GetHeader() != "" {
+							locations = append(locations, "header:"+location.GetHeader())
+						} else {
+							locations = append(locations, "query:"+location.GetQuery())
+						}
+					}
+				}
+				for _, requirement := range method.JwtRequirements {
+					providers = append(providers, requirement.GetProviderId())
+				}
+				result.MetricCosts = strings.Join(costs, ",")
+				result.ApiKeyLocations = strings.Join(locations, ",")
+				result.JwtProviders = strings.Join(providers, ",")
+				gotResults[operation] = result
+			}
+
+			if diff := cmp.Diff(tc.wantResults, gotResults); diff != "" {
+				t.Errorf("selector results mismatch (-want +got):\n%s", diff)
+			}
+			if _, ok := serviceInfo.Methods[bookstore+".Unknown"]; ok {
+				t.Errorf("authentication rule of an unknown method should not create it")
+			}
+		})
+	}
+}
@@ -17,6 +17,7 @@ package configinfo
 import (
 	"fmt"
 	"math"
+	"strconv"
 	"strings"
 	"time"
 
@@ -54,10 +55,17 @@ type ServiceInfo struct {
 
 	// Stores all the query parameters to be ignored for json-grpc transcoder.
 	AllTranscodingIgnoredQueryParams map[string]bool
+	// Headers of all the forwarded JWT claims, sorted. They are removed from the
+	// requests of all the operations.
+	AllClaimHeaders []string
+	// Options of the json-grpc transcoder, using api name as key.
+	ApiTranscodingOptions map[string]*TranscodingOptions
 
 	AllowCors         bool
 	ServiceControlURI string
-	GcpAttributes     *scpb.GcpAttributes
+	// The analysis of the routes, set when the route table is made.
+	RouteReport   *RouteReport
+	GcpAttributes *scpb.GcpAttributes
 	// Keep a pointer to original service config. Should always process rules
 	// inside ServiceInfo.
 	serviceConfig *confpb.Service
@@ -68,6 +76,17 @@ type ServiceInfo struct {
 	GrpcSupportRequired   bool
 	LocalBackendCluster   *BackendRoutingCluster
 	RemoteBackendClusters []*BackendRoutingCluster
+
+	// The secondary backend that receives a copy of the requests. Nil if shadowing is disabled.
+	ShadowBackendCluster *BackendRoutingCluster
+
+	// JWKS of the providers that are not fetched by the proxy, using provider id as key.
+	LocalJwks map[string]string
+	// Files of the local JWKS, using provider id as key. Inline JWKS have no file.
+	LocalJwksPaths map[string]string
+	// The jwks_uri of the providers fetched by the proxy, using provider id as key.
+	// It is kept out of the service config, which may be processed again.
+	JwksUris map[string]string
 }
 
 type BackendRoutingCluster struct {
@@ -76,6 +95,15 @@ type BackendRoutingCluster struct {
 	Port        uint32
 	UseTLS      bool
 	Protocol    util.BackendProtocol
+
+	// All the endpoints of a multi-endpoint cluster. Hostname and Port are the first endpoint.
+	// Nil for single endpoint clusters.
+	Endpoints []*util.WeightedEndpoint
+
+	// Traffic policies for the cluster. Nil keeps the Envoy defaults.
+	CircuitBreakers  *CircuitBreakers
+	OutlierDetection *OutlierDetection
+	HealthCheck      *HealthCheck
 }
 
 // NewServiceInfoFromServiceConfig returns an instance of ServiceInfo.
@@ -86,6 +114,10 @@ func NewServiceInfoFromServiceConfig(serviceConfig *confpb.Service, id string, o
 	if len(serviceConfig.GetApis()) == 0 {
 		return nil, fmt.Errorf("service config must have one api at least")
 	}
+	if opts.ApiKeysPath != "" && serviceConfig.GetControl().GetEnvironment() != "" && !opts.SkipServiceControlFilter && !opts.LocalServiceControl {
+		// The Service Control filter would still send the API keys to Google in the Reports.
+		return nil, fmt.Errorf("api_keys_path requires local_service_control or skip_service_control_filter when the service config has a Service Control environment")
+	}
 
 	serviceInfo := &ServiceInfo{
 		Name:                             serviceConfig.GetName(),
@@ -94,6 +126,9 @@ func NewServiceInfoFromServiceConfig(serviceConfig *confpb.Service, id string, o
 		Options:                          opts,
 		Methods:                          make(map[string]*methodInfo),
 		AllTranscodingIgnoredQueryParams: make(map[string]bool),
+		LocalJwks:                        make(map[string]string),
+		LocalJwksPaths:                   make(map[string]string),
+		JwksUris:                         make(map[string]string),
 	}
 
 	// Calling order is required due to following variable usage
@@ -106,15 +141,29 @@ func NewServiceInfoFromServiceConfig(serviceConfig *confpb.Service, id string, o
 	// * GrpcSupportRequired:
 	//     set by processBackendRule, buildLocalBackend
 	//     used by addGrpcHttpRules
+	// * LocalBackendCluster, RemoteBackendClusters:
+	//     set by buildLocalBackend, processBackendRule, processBackendCanary
+	//     used by processBackendTrafficPolicy
+	// * BackendInfo of all methods:
+	//     set by processBackendRule, processLocalBackendOperations
+	//     used by processBackendCanary
 	// * Methods:
 	//		 set by processApis, processHttpRule, addGrpcHttpRules, processUsageRule
 	//     used by processApiKeyLocations
+	// * LocalJwks:
+	//     set by processLocalJwks
+	//     used by processEmptyJwksUriByOpenID
+	// * JwtRequirements of all methods:
+	//     set by processAuthenticationRules
+	//     used by processJwtRequirementModes, processClaimsPolicy, processClaimHeaders
 	if err := serviceInfo.buildLocalBackend(); err != nil {
 		return nil, err
 	}
 	serviceInfo.processEndpoints()
 	serviceInfo.processApis()
-	serviceInfo.processQuota()
+	if err := serviceInfo.processQuota(); err != nil {
+		return nil, err
+	}
 	if err := serviceInfo.processBackendRule(); err != nil {
 		return nil, err
 	}
@@ -133,32 +182,92 @@ func NewServiceInfoFromServiceConfig(serviceConfig *confpb.Service, id string, o
 	if err := serviceInfo.processTranscodingIgnoredQueryParams(); err != nil {
 		return nil, err
 	}
+	if err := serviceInfo.processTranscodingOptions(); err != nil {
+		return nil, err
+	}
 	if err := serviceInfo.processApiKeyLocations(); err != nil {
 		return nil, err
 	}
 
+	if err := serviceInfo.processLocalJwks(); err != nil {
+		return nil, err
+	}
 	if err := serviceInfo.processEmptyJwksUriByOpenID(); err != nil {
 		return nil, err
 	}
 	if err := serviceInfo.processLocalBackendOperations(); err != nil {
 		return nil, err
 	}
+	if err := serviceInfo.processCorsPolicy(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processAuthenticationRules(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processJwtRequirementModes(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processClaimsPolicy(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processClaimHeaders(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processBackendCanary(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processBackendTrafficPolicy(); err != nil {
+		return nil, err
+	}
+	if err := serviceInfo.processBackendShadow(); err != nil {
+		return nil, err
+	}
 
 	return serviceInfo, nil
 }
 
 func (s *ServiceInfo) buildLocalBackend() error {
-
-	scheme, hostname, port, _, err := util.ParseURI(s.Options.BackendAddress)
+	addresses := strings.Split(s.Options.BackendAddress, ",")
+	weights, err := parseBackendWeights(s.Options.BackendWeights, len(addresses))
 	if err != nil {
-		return fmt.Errorf("error parsing backend uri: %v", err)
+		return err
+	}
+
+	var endpoints []*util.WeightedEndpoint
+	var firstScheme string
+	for i, address := range addresses {
+		scheme, hostname, port, _, err := util.ParseURI(strings.TrimSpace(address))
+		if err != nil {
+			return fmt.Errorf("error parsing backend uri: %v", err)
+		}
+
+		// All local backend addresses share one cluster, so they must use the same protocol and TLS setting.
+		if i == 0 {
+			firstScheme = scheme
+		} else if scheme != firstScheme {
+			return fmt.Errorf("all backend addresses must use the same scheme, got %q and %q", firstScheme, scheme)
+		}
+
+		endpoints = append(endpoints, &util.WeightedEndpoint{
+			Hostname: hostname,
+			Port:     port,
+			Weight:   weights[i],
+		})
 	}
 
 	// For local backend, user cannot configure http protocol explicitly.
-	protocol, tls, err := util.ParseBackendProtocol(scheme, "")
+	protocol, tls, err := util.ParseBackendProtocol(firstScheme, "")
 	if err != nil {
 		return err
 	}
+	if tls {
+		// The cluster has a single SNI and certificate verification hostname.
+		for _, ep := range endpoints[1:] {
+			if ep.Hostname != endpoints[0].Hostname {
+				return fmt.Errorf("all backend addresses must use the same hostname with TLS, got %q and %q", endpoints[0].Hostname, ep.Hostname)
+			}
+		}
+	}
 	if protocol == util.GRPC {
 		s.GrpcSupportRequired = true
 	}
@@ -167,36 +276,53 @@ func (s *ServiceInfo) buildLocalBackend() error {
 		UseTLS:      tls,
 		Protocol:    protocol,
 		ClusterName: s.LocalBackendClusterName(),
-		Hostname:    hostname,
-		Port:        port,
+		Hostname:    endpoints[0].Hostname,
+		Port:        endpoints[0].Port,
+	}
+	if len(endpoints) > 1 {
+		s.LocalBackendCluster.Endpoints = endpoints
 	}
-	return nil
-}
 
-// Returns the pointer of the ServiceConfig that this API belongs to.
-func (s *ServiceInfo) ServiceConfig() *confpb.Service {
-	return s.serviceConfig
+	switch s.Options.BackendLbPolicy {
+	case "round_robin", "least_request":
+		if s.Options.BackendLbHashHeader != "" {
+			return fmt.Errorf("backend_lb_hash_header can only be set when backend_lb_policy is ring_hash")
+		}
+	case "ring_hash":
+		if s.Options.BackendLbHashHeader == "" {
+			return fmt.Errorf("backend_lb_hash_header must be set when backend_lb_policy is ring_hash")
+		}
+	default:
+		return fmt.Errorf(`backend_lb_policy must be one of "round_robin", "least_request" or "ring_hash", got %q`, s.Options.BackendLbPolicy)
+	}
+	return nil
 }
 
-func (s *ServiceInfo) processEmptyJwksUriByOpenID() error {
-	authn := s.serviceConfig.GetAuthentication()
-	for _, provider := range authn.GetProviders() {
-		jwksUri := provider.GetJwksUri()
+// parseBackendWeights parses the comma separated backend weights. An empty
+// string leaves all weights unset, so traffic is spread equally.
+func parseBackendWeights(weightsStr string, numAddresses int) ([]uint32, error) {
+	weights := make([]uint32, numAddresses)
+	if weightsStr == "" {
+		return weights, nil
+	}
 
-		// Note: When jwksUri is empty, proxy will try to find jwksUri using the
-		// OpenID Connect Discovery protocol.
-		if jwksUri == "" {
-			glog.Infof("jwks_uri is empty, using OpenID Connect Discovery protocol")
-			jwksUriByOpenID, err := util.ResolveJwksUriUsingOpenID(provider.GetIssuer())
-			if err != nil {
-				return fmt.Errorf("failed OpenID Connect Discovery protocol: %v", err)
-			} else {
-				jwksUri = jwksUriByOpenID
-			}
-			provider.JwksUri = jwksUri
+	weightStrs := strings.Split(weightsStr, ",")
+	if len(weightStrs) != numAddresses {
+		return nil, fmt.Errorf("backend_weights has %d weights, but backend_address has %d addresses", len(weightStrs), numAddresses)
+	}
+	for i, w := range weightStrs {
+		weight, err := strconv.ParseUint(strings.TrimSpace(w), 10, 32)
+		if err != nil || weight == 0 {
+			return nil, fmt.Errorf("invalid backend weight %q, must be a positive integer", w)
 		}
+		weights[i] = uint32(weight)
 	}
-	return nil
+	return weights, nil
+}
+
+// Returns the pointer of the ServiceConfig that this API belongs to.
+func (s *ServiceInfo) ServiceConfig() *confpb.Service {
+	return s.serviceConfig
 }
 
 func (s *ServiceInfo) processApis() {
@@ -270,8 +396,18 @@ func (s *ServiceInfo) processAccessToken() {
 
 }
 
-func (s *ServiceInfo) processQuota() {
-	for _, metricRule := range s.ServiceConfig().GetQuota().GetMetricRules() {
+func (s *ServiceInfo) processQuota() error {
+	rules := s.ServiceConfig().GetQuota().GetMetricRules()
+	var selectors []string
+	for _, metricRule := range rules {
+		selectors = append(selectors, metricRule.GetSelector())
+	}
+	methods, err := s.methodsBySelector(selectors, false)
+	if err != nil {
+		return err
+	}
+
+	for i, metricRule := range rules {
 		var metricCosts []*scpb.MetricCost
 		for name, cost := range metricRule.GetMetricCosts() {
 			metricCosts = append(metricCosts, &scpb.MetricCost{
@@ -279,8 +415,11 @@ func (s *ServiceInfo) processQuota() {
 				Cost: cost,
 			})
 		}
-		s.Methods[metricRule.GetSelector()].MetricCosts = metricCosts
+		for _, method := range methods[i] {
+			method.MetricCosts = metricCosts
+		}
 	}
+	return nil
 }
 
 func (s *ServiceInfo) processEndpoints() {
@@ -327,17 +466,29 @@ func addHttpRule(method *methodInfo, r *annotationspb.HttpRule, httpMatcherWithO
 			HttpMethod:  httpMethod,
 		}
 
-		if httpMethod == util.OPTIONS {
-			// Ensure we don't generate duplicate methods later for AllowCors.
-			matcher := util.WildcardMatcherForPath(r.GetCustom().GetPath())
-			if matcher == "" {
-				matcher = r.GetCustom().GetPath()
-			}
-			httpMatcherWithOptionsSet[matcher] = true
-		}
 	default:
 		return fmt.Errorf("unsupported http method %T", r.GetPattern())
 	}
+
+	// Reject malformed templates before any matcher is generated for them.
+	template, err := util.ParseHttpTemplate(httpRule.UriTemplate)
+	if err != nil {
+		return fmt.Errorf("invalid http rule for operation %s: %v", r.GetSelector(), err)
+	}
+	if template.HasPartialSegment() {
+		glog.Warningf("http rule for operation %s has a variable in a partial segment in %q, which google.api.http does not allow; it is still accepted for OpenAPI paths", r.GetSelector(), httpRule.UriTemplate)
+	}
+	matcher, err := util.WildcardMatcherForPath(httpRule.UriTemplate)
+	if err != nil {
+		return fmt.Errorf("invalid http rule for operation %s: %v", r.GetSelector(), err)
+	}
+	if httpRule.HttpMethod == util.OPTIONS {
+		// Ensure we don't generate duplicate methods later for AllowCors.
+		if matcher == "" {
+			matcher = httpRule.UriTemplate
+		}
+		httpMatcherWithOptionsSet[matcher] = true
+	}
 	method.HttpRule = append(method.HttpRule, httpRule)
 
 	return nil
@@ -374,7 +525,10 @@ func (s *ServiceInfo) processHttpRule() error {
 			method := s.Methods[r.GetSelector()]
 			for _, httpRule := range method.HttpRule {
 				if httpRule.HttpMethod != util.OPTIONS {
-					matcher := util.WildcardMatcherForPath(httpRule.UriTemplate)
+					matcher, err := util.WildcardMatcherForPath(httpRule.UriTemplate)
+					if err != nil {
+						return err
+					}
 					if matcher == "" {
 						matcher = httpRule.UriTemplate
 					}
@@ -435,13 +589,21 @@ func (s *ServiceInfo) addOptionMethod(originalMethod *methodInfo, path string) e
 func (s *ServiceInfo) processBackendRule() error {
 	backendRoutingClustersMap := make(map[string]string)
 
-	for _, r := range s.ServiceConfig().Backend.GetRules() {
+	rules := s.ServiceConfig().GetBackend().GetRules()
+	var selectors []string
+	for _, r := range rules {
+		selectors = append(selectors, r.GetSelector())
+	}
+	methods, err := s.methodsBySelector(selectors, true)
+	if err != nil {
+		return err
+	}
+
+	for i, r := range rules {
 
 		if r.Address == "" {
 			// Processing a backend rule associated with the local backend.
-			if err := s.addBackendInfoToMethod(r, "", "", "", s.LocalBackendClusterName()); err != nil {
-				return err
-			}
+			s.addBackendInfoToMethods(r, methods[i], "", "", "", s.LocalBackendClusterName())
 		} else {
 			// Processing a backend rule associated with a remote backend.
 			scheme, hostname, port, path, err := util.ParseURI(r.Address)
@@ -473,21 +635,14 @@ func (s *ServiceInfo) processBackendRule() error {
 			}
 
 			backendClusterName := backendRoutingClustersMap[address]
-			if err := s.addBackendInfoToMethod(r, scheme, hostname, path, backendClusterName); err != nil {
-				return err
-			}
+			s.addBackendInfoToMethods(r, methods[i], scheme, hostname, path, backendClusterName)
 		}
 
 	}
 	return nil
 }
 
-func (s *ServiceInfo) addBackendInfoToMethod(r *confpb.BackendRule, scheme string, hostname string, path string, backendClusterName string) error {
-	method, err := s.getOrCreateMethod(r.GetSelector())
-	if err != nil {
-		return err
-	}
-
+func (s *ServiceInfo) addBackendInfoToMethods(r *confpb.BackendRule, methods []*methodInfo, scheme string, hostname string, path string, backendClusterName string) {
 	// For CONSTANT_ADDRESS, an empty uri will generate an empty path header.
 	// It is an invalid Http header if path is empty.
 	if path == "" && r.PathTranslation == confpb.BackendRule_CONSTANT_ADDRESS {
@@ -510,14 +665,6 @@ func (s *ServiceInfo) addBackendInfoToMethod(r *confpb.BackendRule, scheme strin
 		deadline = time.Duration(deadlineMs) * time.Millisecond
 	}
 
-	method.BackendInfo = &backendInfo{
-		ClusterName:     backendClusterName,
-		Path:            path,
-		Hostname:        hostname,
-		TranslationType: r.PathTranslation,
-		Deadline:        deadline,
-	}
-
 	jwtAud := s.determineBackendAuthJwtAud(r, scheme, hostname)
 	if jwtAud != "" && s.Options.CommonOptions.NonGCP {
 		glog.Warningf("Backend authentication is enabled for method %v, "+
@@ -526,9 +673,17 @@ func (s *ServiceInfo) addBackendInfoToMethod(r *confpb.BackendRule, scheme strin
 			r.Selector)
 		jwtAud = ""
 	}
-	method.BackendInfo.JwtAudience = jwtAud
 
-	return nil
+	for _, method := range methods {
+		method.BackendInfo = &backendInfo{
+			ClusterName:     backendClusterName,
+			Path:            path,
+			Hostname:        hostname,
+			TranslationType: r.PathTranslation,
+			JwtAudience:     jwtAud,
+			Deadline:        deadline,
+		}
+	}
 }
 
 func (s *ServiceInfo) determineBackendAuthJwtAud(r *confpb.BackendRule, scheme string, hostname string) string {
@@ -568,14 +723,94 @@ func (s *ServiceInfo) processLocalBackendOperations() error {
 	return nil
 }
 
+// processBackendShadow creates the shadow backend cluster and marks the
+// operations whose requests are mirrored to it. Without an explicit list of
+// operations, all the operations except the ones generated by ESPv2 are mirrored.
+func (s *ServiceInfo) processBackendShadow() error {
+	if s.Options.BackendShadowAddress == "" {
+		if s.Options.BackendShadowOperations != "" {
+			return fmt.Errorf("backend_shadow_operations requires backend_shadow_address to be set")
+		}
+		return nil
+	}
+
+	if s.Options.BackendShadowPercent < 0 || s.Options.BackendShadowPercent > 100 {
+		return fmt.Errorf("backend_shadow_percent must be between 0 and 100, got %v", s.Options.BackendShadowPercent)
+	}
+
+	scheme, hostname, port, _, err := util.ParseURI(s.Options.BackendShadowAddress)
+	if err != nil {
+		return fmt.Errorf("error parsing backend shadow uri: %v", err)
+	}
+	protocol, tls, err := util.ParseBackendProtocol(scheme, "")
+	if err != nil {
+		return err
+	}
+
+	s.ShadowBackendCluster = &BackendRoutingCluster{
+		ClusterName: util.ShadowBackendClusterName(fmt.Sprintf("%v:%v", hostname, port)),
+		Hostname:    hostname,
+		Port:        port,
+		UseTLS:      tls,
+		Protocol:    protocol,
+	}
+
+	if s.Options.BackendShadowOperations == "" {
+		for _, method := range s.Methods {
+			if !method.IsGenerated {
+				method.MirrorToShadowBackend = true
+			}
+		}
+		return nil
+	}
+
+	for _, selector := range strings.Split(s.Options.BackendShadowOperations, ",") {
+		method, ok := s.Methods[strings.TrimSpace(selector)]
+		if !ok {
+			return fmt.Errorf("backend_shadow_operations has unknown operation %q", selector)
+		}
+		method.MirrorToShadowBackend = true
+	}
+	return nil
+}
+
+// processAuthenticationRules sets the JWT requirements of the methods. The
+// rules of unknown methods are ignored, they never match a request.
+func (s *ServiceInfo) processAuthenticationRules() error {
+	rules := s.ServiceConfig().GetAuthentication().GetRules()
+	var selectors []string
+	for _, rule := range rules {
+		selectors = append(selectors, rule.GetSelector())
+	}
+	methods, err := s.methodsBySelector(selectors, false)
+	if err != nil {
+		return err
+	}
+
+	for i, rule := range rules {
+		for _, method := range methods[i] {
+			method.JwtRequirements = rule.GetRequirements()
+		}
+	}
+	return nil
+}
+
 func (s *ServiceInfo) processUsageRule() error {
-	for _, r := range s.ServiceConfig().GetUsage().GetRules() {
-		method, err := s.getOrCreateMethod(r.GetSelector())
-		if err != nil {
-			return err
+	rules := s.ServiceConfig().GetUsage().GetRules()
+	var selectors []string
+	for _, r := range rules {
+		selectors = append(selectors, r.GetSelector())
+	}
+	methods, err := s.methodsBySelector(selectors, true)
+	if err != nil {
+		return err
+	}
+
+	for i, r := range rules {
+		for _, method := range methods[i] {
+			method.AllowUnregisteredCalls = r.GetAllowUnregisteredCalls()
+			method.SkipServiceControl = r.GetSkipServiceControl()
 		}
-		method.AllowUnregisteredCalls = r.GetAllowUnregisteredCalls()
-		method.SkipServiceControl = r.GetSkipServiceControl()
 	}
 	return nil
 }
@@ -618,7 +853,17 @@ func (s *ServiceInfo) processTranscodingIgnoredQueryParams() error {
 }
 
 func (s *ServiceInfo) processApiKeyLocations() error {
-	for _, rule := range s.ServiceConfig().GetSystemParameters().GetRules() {
+	rules := s.ServiceConfig().GetSystemParameters().GetRules()
+	var selectors []string
+	for _, rule := range rules {
+		selectors = append(selectors, rule.GetSelector())
+	}
+	methods, err := s.methodsBySelector(selectors, true)
+	if err != nil {
+		return err
+	}
+
+	for i, rule := range rules {
 		apiKeyLocationParameters := []*confpb.SystemParameter{}
 
 		for _, parameter := range rule.GetParameters() {
@@ -627,12 +872,9 @@ func (s *ServiceInfo) processApiKeyLocations() error {
 			}
 		}
 
-		method, err := s.getOrCreateMethod(rule.GetSelector())
-		if err != nil {
-			return err
+		for _, method := range methods[i] {
+			s.extractApiKeyLocations(method, apiKeyLocationParameters)
 		}
-
-		s.extractApiKeyLocations(method, apiKeyLocationParameters)
 	}
 
 	for _, method := range s.Methods {
@@ -716,6 +958,11 @@ func (s *ServiceInfo) processTypes() error {
 			}
 		}
 
+		// Path parameters may bind fields of nested messages with dotted field paths.
+		if err := addFieldPathSegmentMappings(operation, mi, requestType, typesByTypeName, snakeToJson); err != nil {
+			return err
+		}
+
 		// Store the mapping per selector.
 		if len(snakeToJson) > 0 {
 			mi.SegmentMappings = snakeToJson
@@ -724,6 +971,57 @@ func (s *ServiceInfo) processTypes() error {
 	return nil
 }
 
+// addFieldPathSegmentMappings adds the snake name to JSON name mappings of the
+// nested fields in the dotted field paths of the http rules of the method.
+// Only these fields are checked for duplicates, the other fields of the
+// nested types are never bound by the path matcher.
+func addFieldPathSegmentMappings(operation string, mi *methodInfo, requestType *typepb.Type, typesByTypeName map[string]*typepb.Type, snakeToJson SnakeToJsonSegments) error {
+	for _, httpRule := range mi.HttpRule {
+		template, err := util.ParseHttpTemplate(httpRule.GetUriTemplate())
+		if err != nil {
+			// Invalid templates are reported when the routes are generated.
+			continue
+		}
+
+		for _, variable := range template.Variables {
+			segments := strings.Split(variable.FieldPath, ".")
+			t := requestType
+			for i, segment := range segments[:len(segments)-1] {
+				field := findField(t, segment)
+				if field == nil || field.GetKind() != typepb.Field_TYPE_MESSAGE {
+					break
+				}
+				nestedType, ok := typesByTypeName[strings.TrimPrefix(field.GetTypeUrl(), util.TypeUrlPrefix)]
+				if !ok {
+					break
+				}
+				t = nestedType
+
+				nestedField := findField(t, segments[i+1])
+				if nestedField == nil || nestedField.GetName() == nestedField.GetJsonName() {
+					continue
+				}
+				if prevJsonName, ok := snakeToJson[nestedField.GetName()]; ok && prevJsonName != nestedField.GetJsonName() {
+					// The path matcher maps the segments by name, whatever the type.
+					return fmt.Errorf("for operation (%v): detected two types with same snake_name (%v) "+
+						"but mistmatching json_name (%v, %v)", operation, nestedField.GetName(), nestedField.GetJsonName(), prevJsonName)
+				}
+				snakeToJson[nestedField.GetName()] = nestedField.GetJsonName()
+			}
+		}
+	}
+	return nil
+}
+
+func findField(t *typepb.Type, name string) *typepb.Field {
+	for _, field := range t.GetFields() {
+		if field.GetName() == name {
+			return field
+		}
+	}
+	return nil
+}
+
 // get the methodInfo by full name, and create a new one if not exists.
 // Ideally, all selector name in service config rules should exist in the api
 // methods.
@@ -1464,6 +1464,34 @@ func TestMethods(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc: "Fail for malformed http template",
+			fakeServiceConfig: &confpb.Service{
+				Name: testProjectName,
+				Apis: []*apipb.Api{
+					{
+						Name: "endpoints.examples.bookstore.Bookstore",
+						Methods: []*apipb.Method{
+							{
+								Name: "GetBook",
+							},
+						},
+					},
+				},
+				Http: &annotationspb.Http{
+					Rules: []*annotationspb.HttpRule{
+						{
+							Selector: "endpoints.examples.bookstore.Bookstore.GetBook",
+							Pattern: &annotationspb.HttpRule_Get{
+								Get: "/v1/books/{book",
+							},
+						},
+					},
+				},
+			},
+			BackendAddress: "grpc://127.0.0.1:80",
+			wantError:      `invalid http rule for operation endpoints.examples.bookstore.Bookstore.GetBook: invalid http template "/v1/books/{book": variable must end with } at position 15`,
+		},
 	}
 
 	for _, tc := range testData {
@@ -1597,6 +1625,256 @@ func TestProcessBackendRuleForDeadline(t *testing.T) {
 	}
 }
 
+func TestBuildLocalBackend(t *testing.T) {
+	testData := []struct {
+		desc             string
+		optsMergeFunc    func(opts *options.ConfigGeneratorOptions)
+		wantLocalBackend *BackendRoutingCluster
+		wantError        string
+	}{
+		{
+			desc: "Single backend address",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.BackendAddress = "grpcs://mybackend.com"
+			},
+			wantLocalBackend: &BackendRoutingCluster{
+				ClusterName: "backend-cluster-bookstore.endpoints.project123.cloud.goog_local",
+				Hostname:    "mybackend.com",
+				Port:        443,
+				UseTLS:      true,
+				Protocol:    util.GRPC,
+			},
+		},
+		{
+			desc: "Multiple weighted backend addresses",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.BackendAddress = "http://127.0.0.1:8081, http://127.0.0.1:8082"
+				opts.BackendWeights = "1, 2"
+			},
+			wantLocalBackend: &BackendRoutingCluster{
+				ClusterName: "backend-cluster-bookstore.endpoints.project123.cloud.goog_local",
+				Hostname:    "127.0.0.1",
+				Port:        8081,
+				Protocol:    util.HTTP1,
+				Endpoints: []*util.WeightedEndpoint{
+					{
+						Hostname: "127.0.0.1",
+						Port:     8081,
+						Weight:   1,
+					},
+					{
+						Hostname: "127.0.0.1",
+						Port:     8082,
+						Weight:   2,
+					},
+				},
+			},
+		},
+		{
+			desc: "Mixed schemes",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.BackendAddress = "http://127.0.0.1:8081,grpc://127.0.0.1:8082"
+			},
+			wantError: `all backend addresses must use the same scheme, got "http" and "grpc"`,
+		},
+		{
+			desc: "Mixed hostnames with TLS",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.BackendAddress = "https://backend-a.example.com,https://backend-b.example.com"
+			},
+			wantError: `all backend addresses must use the same hostname with TLS, got "backend-a.example.com" and "backend-b.example.com"`,
+		},
+		{
+			desc: "Weights do not match addresses",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.BackendAddress = "http://127.0.0.1:8081,http://127.0.0.1:8082"
+				opts.BackendWeights = "1"
+			},
+			wantError: "backend_weights has 1 weights, but backend_address has 2 addresses",
+		},
+		{
+			desc: "Zero weight",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.BackendAddress = "http://127.0.0.1:8081,http://127.0.0.1:8082"
+				opts.BackendWeights = "1,0"
+			},
+			wantError: `invalid backend weight "0"`,
+		},
+		{
+			desc: "Ring hash without hash header",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.BackendLbPolicy = "ring_hash"
+			},
+			wantError: "backend_lb_hash_header must be set when backend_lb_policy is ring_hash",
+		},
+		{
+			desc: "Hash header without ring hash",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.BackendLbHashHeader = "x-user-id"
+			},
+			wantError: "backend_lb_hash_header can only be set when backend_lb_policy is ring_hash",
+		},
+		{
+			desc: "Unknown lb policy",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.BackendLbPolicy = "random"
+			},
+			wantError: `backend_lb_policy must be one of "round_robin", "least_request" or "ring_hash"`,
+		},
+	}
+
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+			},
+		},
+	}
+
+	for _, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		tc.optsMergeFunc(&opts)
+
+		s, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			if tc.wantError == "" || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test Desc(%s): want error: %s, get error: %v", tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if tc.wantError != "" {
+			t.Errorf("Test Desc(%s): want error: %s, get no error", tc.desc, tc.wantError)
+			continue
+		}
+
+		if !reflect.DeepEqual(s.LocalBackendCluster, tc.wantLocalBackend) {
+			t.Errorf("Test Desc(%s): local backend cluster\ngot: %+v\nwant: %+v", tc.desc, s.LocalBackendCluster, tc.wantLocalBackend)
+		}
+	}
+}
+
+func TestProcessBackendShadow(t *testing.T) {
+	testData := []struct {
+		desc              string
+		optsMergeFunc     func(opts *options.ConfigGeneratorOptions)
+		wantShadowCluster *BackendRoutingCluster
+		wantMirrored      []string
+		wantError         string
+	}{
+		{
+			desc:          "Shadowing disabled by default",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {},
+		},
+		{
+			desc: "Mirror all operations except the generated ones",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.BackendShadowAddress = "grpc://127.0.0.1:9000"
+				opts.Healthz = "/healthz"
+			},
+			wantShadowCluster: &BackendRoutingCluster{
+				ClusterName: "shadow-backend-cluster-127.0.0.1:9000",
+				Hostname:    "127.0.0.1",
+				Port:        9000,
+				Protocol:    util.GRPC,
+			},
+			wantMirrored: []string{
+				"endpoints.examples.bookstore.Bookstore.Bar",
+				"endpoints.examples.bookstore.Bookstore.Foo",
+			},
+		},
+		{
+			desc: "Mirror selected operations",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.BackendShadowAddress = "https://shadow.example.com"
+				opts.BackendShadowOperations = "endpoints.examples.bookstore.Bookstore.Foo"
+			},
+			wantShadowCluster: &BackendRoutingCluster{
+				ClusterName: "shadow-backend-cluster-shadow.example.com:443",
+				Hostname:    "shadow.example.com",
+				Port:        443,
+				UseTLS:      true,
+				Protocol:    util.HTTP1,
+			},
+			wantMirrored: []string{
+				"endpoints.examples.bookstore.Bookstore.Foo",
+			},
+		},
+		{
+			desc: "Unknown shadow operation",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.BackendShadowAddress = "https://shadow.example.com"
+				opts.BackendShadowOperations = "endpoints.examples.bookstore.Bookstore.Baz"
+			},
+			wantError: `backend_shadow_operations has unknown operation "endpoints.examples.bookstore.Bookstore.Baz"`,
+		},
+		{
+			desc: "Shadow operations without shadow address",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.BackendShadowOperations = "endpoints.examples.bookstore.Bookstore.Foo"
+			},
+			wantError: "backend_shadow_operations requires backend_shadow_address to be set",
+		},
+		{
+			desc: "Invalid shadow percent",
+			optsMergeFunc: func(opts *options.ConfigGeneratorOptions) {
+				opts.BackendShadowAddress = "https://shadow.example.com"
+				opts.BackendShadowPercent = 101
+			},
+			wantError: "backend_shadow_percent must be between 0 and 100",
+		},
+	}
+
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: testApiName,
+				Methods: []*apipb.Method{
+					{
+						Name: "Foo",
+					},
+					{
+						Name: "Bar",
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		tc.optsMergeFunc(&opts)
+
+		s, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			if tc.wantError == "" || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test Desc(%s): want error: %s, get error: %v", tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if tc.wantError != "" {
+			t.Errorf("Test Desc(%s): want error: %s, get no error", tc.desc, tc.wantError)
+			continue
+		}
+
+		if !reflect.DeepEqual(s.ShadowBackendCluster, tc.wantShadowCluster) {
+			t.Errorf("Test Desc(%s): shadow backend cluster\ngot: %+v\nwant: %+v", tc.desc, s.ShadowBackendCluster, tc.wantShadowCluster)
+		}
+
+		var gotMirrored []string
+		for selector, method := range s.Methods {
+			if method.MirrorToShadowBackend {
+				gotMirrored = append(gotMirrored, selector)
+			}
+		}
+		sort.Strings(gotMirrored)
+		if !reflect.DeepEqual(gotMirrored, tc.wantMirrored) {
+			t.Errorf("Test Desc(%s): mirrored operations\ngot: %v\nwant: %v", tc.desc, gotMirrored, tc.wantMirrored)
+		}
+	}
+}
+
 func TestProcessBackendRuleForProtocol(t *testing.T) {
 	testData := []struct {
 		desc              string
@@ -2134,6 +2412,43 @@ func TestProcessQuota(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc: "Succeed, rule of an unknown method is not applied",
+			fakeServiceConfig: &confpb.Service{
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+						Methods: []*apipb.Method{
+							{
+								Name: "ListShelves",
+							},
+						},
+					},
+				},
+				Quota: &confpb.Quota{
+					MetricRules: []*confpb.MetricRule{
+						{
+							Selector: "endpoints.examples.bookstore.Bookstore.DeleteShelf",
+							MetricCosts: map[string]int64{
+								"metric_a": 1,
+							},
+						},
+					},
+				},
+			},
+			wantMethods: map[string]*methodInfo{
+				fmt.Sprintf("%s.%s", testApiName, "ListShelves"): &methodInfo{
+					ShortName: "ListShelves",
+					ApiName:   testApiName,
+					HttpRule: []*commonpb.Pattern{
+						{
+							UriTemplate: fmt.Sprintf("/%s/%s", testApiName, "ListShelves"),
+							HttpMethod:  util.POST,
+						},
+					},
+				},
+			},
+		},
 	}
 
 	for _, tc := range testData {
@@ -2169,6 +2484,7 @@ func TestProcessEmptyJwksUriByOpenID(t *testing.T) {
 	testData := []struct {
 		desc              string
 		fakeServiceConfig *confpb.Service
+		jwtOpenIDJwksUris string
 		wantedJwksUri     string
 		wantErr           bool
 	}{
@@ -2210,10 +2526,74 @@ func TestProcessEmptyJwksUriByOpenID(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			desc: "Empty jwksUri, use jwksUri from the flag without Open ID Connect Discovery",
+			fakeServiceConfig: &confpb.Service{
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+					},
+				},
+				Authentication: &confpb.Authentication{
+					Providers: []*confpb.AuthProvider{
+						{
+							Id:     "auth_provider",
+							Issuer: "aaaaa.bbbbbb.ccccc/inaccessible_uri/",
+						},
+					},
+				},
+			},
+			jwtOpenIDJwksUris: `{"auth_provider": "https://issuer.example.com/jwks"}`,
+			wantedJwksUri:     "https://issuer.example.com/jwks",
+		},
+		{
+			desc: "jwksUri from the flag for a provider with jwksUri",
+			fakeServiceConfig: &confpb.Service{
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+					},
+				},
+				Authentication: &confpb.Authentication{
+					Providers: []*confpb.AuthProvider{
+						{
+							Id:      "auth_provider",
+							Issuer:  openIDServer.URL,
+							JwksUri: "https://issuer.example.com/jwks",
+						},
+					},
+				},
+			},
+			jwtOpenIDJwksUris: `{"auth_provider": "https://issuer.example.com/other_jwks"}`,
+			wantErr:           true,
+		},
+		{
+			desc: "jwksUri from the flag for an unknown provider",
+			fakeServiceConfig: &confpb.Service{
+				Apis: []*apipb.Api{
+					{
+						Name: testApiName,
+					},
+				},
+				Authentication: &confpb.Authentication{
+					Providers: []*confpb.AuthProvider{
+						{
+							Id:     "auth_provider",
+							Issuer: openIDServer.URL,
+						},
+					},
+				},
+			},
+			jwtOpenIDJwksUris: `{"unknown_provider": "https://issuer.example.com/jwks"}`,
+			wantErr:           true,
+		},
 	}
 
 	for i, tc := range testData {
 		opts := options.DefaultConfigGeneratorOptions()
+		opts.JwtOpenIDDiscoveryRetries = 1
+		opts.JwtOpenIDDiscoveryInitialInterval = time.Millisecond
+		opts.JwtOpenIDJwksUris = tc.jwtOpenIDJwksUris
 		serviceInfo, err := NewServiceInfoFromServiceConfig(tc.fakeServiceConfig, testConfigID, opts)
 
 		if tc.wantErr {
@@ -2222,12 +2602,72 @@ func TestProcessEmptyJwksUriByOpenID(t *testing.T) {
 			}
 		} else if err != nil {
 			t.Errorf("Test Desc(%d): %s, process jwksUri got: %v, but expected no err", i, tc.desc, err)
-		} else if jwksUri := serviceInfo.serviceConfig.Authentication.Providers[0].JwksUri; jwksUri != tc.wantedJwksUri {
+		} else if jwksUri := serviceInfo.JwksUris["auth_provider"]; jwksUri != tc.wantedJwksUri {
 			t.Errorf("Test Desc(%d): %s, process jwksUri got: %v, want: %v", i, tc.desc, jwksUri, tc.wantedJwksUri)
 		}
 	}
 }
 
+func TestOpenIDJwksUriCache(t *testing.T) {
+	discoveryRequests := 0
+	jwksUri := "this-is-cached-jwksUri"
+	openIDServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		discoveryRequests++
+		jwksUriEntry, _ := json.Marshal(map[string]string{"jwks_uri": jwksUri})
+		w.Write(jwksUriEntry)
+	}))
+
+	newServiceConfig := func() *confpb.Service {
+		return &confpb.Service{
+			Apis: []*apipb.Api{
+				{
+					Name: testApiName,
+				},
+			},
+			Authentication: &confpb.Authentication{
+				Providers: []*confpb.AuthProvider{
+					{
+						Id:     "auth_provider",
+						Issuer: openIDServer.URL,
+					},
+				},
+			},
+		}
+	}
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.JwtOpenIDDiscoveryRetries = 1
+	opts.JwtOpenIDDiscoveryInitialInterval = time.Millisecond
+	serviceConfig := newServiceConfig()
+	if _, err := NewServiceInfoFromServiceConfig(serviceConfig, testConfigID, opts); err != nil {
+		t.Fatalf("process jwksUri got: %v, but expected no err", err)
+	}
+
+	// Config updates run the discovery again to pick up a rotated jwks_uri, also
+	// when the same service config is processed again.
+	jwksUri = "this-is-rotated-jwksUri"
+	serviceInfo, err := NewServiceInfoFromServiceConfig(serviceConfig, testConfigID, opts)
+	if err != nil {
+		t.Fatalf("process jwksUri got: %v, but expected no err", err)
+	}
+	if got := serviceInfo.JwksUris["auth_provider"]; got != "this-is-rotated-jwksUri" {
+		t.Errorf("process jwksUri got: %v, want: this-is-rotated-jwksUri", got)
+	}
+	if discoveryRequests != 2 {
+		t.Errorf("OpenID Connect Discovery requests got: %v, want: 2", discoveryRequests)
+	}
+
+	// The cached jwks_uri is used when the issuer is unavailable.
+	openIDServer.Close()
+	serviceInfo, err = NewServiceInfoFromServiceConfig(newServiceConfig(), testConfigID, opts)
+	if err != nil {
+		t.Fatalf("process jwksUri with cache got: %v, but expected no err", err)
+	}
+	if got := serviceInfo.JwksUris["auth_provider"]; got != "this-is-rotated-jwksUri" {
+		t.Errorf("process jwksUri with cache got: %v, want: this-is-rotated-jwksUri", got)
+	}
+}
+
 func TestProcessApis(t *testing.T) {
 	testData := []struct {
 		desc              string
@@ -2445,6 +2885,7 @@ func TestProcessTypes(t *testing.T) {
 		desc                            string
 		fakeServiceConfig               *confpb.Service
 		fakeRequestTypeNamesByOperation map[string]string
+		fakeUriTemplatesByOperation     map[string][]string
 		wantSegmentsByOperation         map[string]SnakeToJsonSegments
 		wantErr                         error
 	}{
@@ -2662,6 +3103,201 @@ func TestProcessTypes(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc: "Success for nested message fields bound by the path",
+			fakeServiceConfig: &confpb.Service{
+				Types: []*ptypepb.Type{
+					{
+						Name: "UpdateBookRequest",
+						Fields: []*ptypepb.Field{
+							{
+								Name:     "book_info",
+								JsonName: "bookInfo",
+								Kind:     ptypepb.Field_TYPE_MESSAGE,
+								TypeUrl:  "type.googleapis.com/Book",
+							},
+							{
+								Name:     "update_mask",
+								JsonName: "updateMask",
+								Kind:     ptypepb.Field_TYPE_MESSAGE,
+								// This will be ignored, it doesn't exist in types.
+								TypeUrl: "type.googleapis.com/google.protobuf.FieldMask",
+							},
+						},
+					},
+					{
+						Name: "Book",
+						Fields: []*ptypepb.Field{
+							{
+								Name:     "shelf_id",
+								JsonName: "shelfId",
+							},
+							{
+								Name:     "author",
+								JsonName: "author",
+								Kind:     ptypepb.Field_TYPE_MESSAGE,
+								TypeUrl:  "type.googleapis.com/Author",
+							},
+						},
+					},
+					{
+						Name: "Author",
+						Fields: []*ptypepb.Field{
+							{
+								Name:     "last_name",
+								JsonName: "lastName",
+							},
+						},
+					},
+				},
+			},
+			fakeRequestTypeNamesByOperation: map[string]string{
+				"api-1.operation-1": "UpdateBookRequest",
+			},
+			fakeUriTemplatesByOperation: map[string][]string{
+				"api-1.operation-1": {"/v1/authors/{book_info.author.last_name}/books"},
+			},
+			// Book.shelf_id is not in the path.
+			wantSegmentsByOperation: map[string]SnakeToJsonSegments{
+				"api-1.operation-1": {
+					"book_info":   "bookInfo",
+					"update_mask": "updateMask",
+					"last_name":   "lastName",
+				},
+			},
+		},
+		{
+			desc: "Success for recursive message fields",
+			fakeServiceConfig: &confpb.Service{
+				Types: []*ptypepb.Type{
+					{
+						Name: "CreateNodeRequest",
+						Fields: []*ptypepb.Field{
+							{
+								Name:     "root_node",
+								JsonName: "rootNode",
+								Kind:     ptypepb.Field_TYPE_MESSAGE,
+								TypeUrl:  "type.googleapis.com/Node",
+							},
+						},
+					},
+					{
+						Name: "Node",
+						Fields: []*ptypepb.Field{
+							{
+								Name:     "node_id",
+								JsonName: "nodeId",
+							},
+							{
+								Name:     "child_node",
+								JsonName: "childNode",
+								Kind:     ptypepb.Field_TYPE_MESSAGE,
+								TypeUrl:  "type.googleapis.com/Node",
+							},
+							{
+								Name:     "parent_request",
+								JsonName: "parentRequest",
+								Kind:     ptypepb.Field_TYPE_MESSAGE,
+								TypeUrl:  "type.googleapis.com/CreateNodeRequest",
+							},
+						},
+					},
+				},
+			},
+			fakeRequestTypeNamesByOperation: map[string]string{
+				"api-1.operation-1": "CreateNodeRequest",
+			},
+			fakeUriTemplatesByOperation: map[string][]string{
+				"api-1.operation-1": {"/v1/nodes/{root_node.child_node.child_node.node_id}"},
+			},
+			wantSegmentsByOperation: map[string]SnakeToJsonSegments{
+				"api-1.operation-1": {
+					"root_node":  "rootNode",
+					"child_node": "childNode",
+					"node_id":    "nodeId",
+				},
+			},
+		},
+		{
+			desc: "Failure for conflicting fields across nested types",
+			fakeServiceConfig: &confpb.Service{
+				Types: []*ptypepb.Type{
+					{
+						Name: "UpdateBookRequest",
+						Fields: []*ptypepb.Field{
+							{
+								Name:     "shelf_id",
+								JsonName: "shelfId",
+							},
+							{
+								Name:     "book",
+								JsonName: "book",
+								Kind:     ptypepb.Field_TYPE_MESSAGE,
+								TypeUrl:  "type.googleapis.com/Book",
+							},
+						},
+					},
+					{
+						Name: "Book",
+						Fields: []*ptypepb.Field{
+							{
+								Name:     "shelf_id",
+								JsonName: "shelf-id",
+							},
+						},
+					},
+				},
+			},
+			fakeRequestTypeNamesByOperation: map[string]string{
+				"api-1.operation-1": "UpdateBookRequest",
+			},
+			fakeUriTemplatesByOperation: map[string][]string{
+				"api-1.operation-1": {"/v1/shelves/{shelf_id}/books/{book.shelf_id}"},
+			},
+			wantErr: fmt.Errorf("for operation (api-1.operation-1): detected two types with same snake_name (shelf_id) but mistmatching json_name"),
+		},
+		{
+			desc: "Success for conflicting fields of nested types not bound by the path",
+			fakeServiceConfig: &confpb.Service{
+				Types: []*ptypepb.Type{
+					{
+						Name: "UpdateBookRequest",
+						Fields: []*ptypepb.Field{
+							{
+								Name:     "shelf_id",
+								JsonName: "shelfId",
+							},
+							{
+								Name:     "book",
+								JsonName: "book",
+								Kind:     ptypepb.Field_TYPE_MESSAGE,
+								TypeUrl:  "type.googleapis.com/Book",
+							},
+						},
+					},
+					{
+						Name: "Book",
+						Fields: []*ptypepb.Field{
+							{
+								Name:     "shelf_id",
+								JsonName: "shelf-id",
+							},
+						},
+					},
+				},
+			},
+			fakeRequestTypeNamesByOperation: map[string]string{
+				"api-1.operation-1": "UpdateBookRequest",
+			},
+			fakeUriTemplatesByOperation: map[string][]string{
+				"api-1.operation-1": {"/v1/shelves/{shelf_id}/books/{book}"},
+			},
+			wantSegmentsByOperation: map[string]SnakeToJsonSegments{
+				"api-1.operation-1": {
+					"shelf_id": "shelfId",
+				},
+			},
+		},
 	}
 
 	for _, tc := range testData {
@@ -2674,6 +3310,12 @@ func TestProcessTypes(t *testing.T) {
 			mi := &methodInfo{
 				RequestTypeName: requestType,
 			}
+			for _, uriTemplate := range tc.fakeUriTemplatesByOperation[operation] {
+				mi.HttpRule = append(mi.HttpRule, &commonpb.Pattern{
+					UriTemplate: uriTemplate,
+					HttpMethod:  util.GET,
+				})
+			}
 			serviceInfo.Methods[operation] = mi
 		}
 
@@ -2754,3 +3396,61 @@ func TestProcessAccessToken(t *testing.T) {
 	}
 
 }
+
+func TestApiKeysPathWithServiceControl(t *testing.T) {
+	testData := []struct {
+		desc                     string
+		environment              string
+		localServiceControl      bool
+		skipServiceControlFilter bool
+		wantError                string
+	}{
+		{
+			desc:        "Fail, API keys would be sent to Service Control",
+			environment: "servicecontrol.googleapis.com",
+			wantError:   "api_keys_path requires local_service_control or skip_service_control_filter",
+		},
+		{
+			desc:                "Success with the local Service Control server",
+			environment:         "servicecontrol.googleapis.com",
+			localServiceControl: true,
+		},
+		{
+			desc:                     "Success without the Service Control filter",
+			environment:              "servicecontrol.googleapis.com",
+			skipServiceControlFilter: true,
+		},
+		{
+			desc: "Success without Service Control environment",
+		},
+	}
+
+	for _, tc := range testData {
+		fakeServiceConfig := &confpb.Service{
+			Name: testProjectName,
+			Apis: []*apipb.Api{
+				{
+					Name: testApiName,
+				},
+			},
+			Control: &confpb.Control{
+				Environment: tc.environment,
+			},
+		}
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.ApiKeysPath = "/etc/espv2/api_keys.json"
+		opts.LocalServiceControl = tc.localServiceControl
+		opts.SkipServiceControlFilter = tc.skipServiceControlFilter
+
+		_, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			if tc.wantError == "" || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test (%s): want error: %s, get error: %v", tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if tc.wantError != "" {
+			t.Errorf("Test (%s): want error: %s, get no error", tc.desc, tc.wantError)
+		}
+	}
+}
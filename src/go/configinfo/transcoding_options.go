@@ -0,0 +1,97 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+)
+
+// TranscodingOptions are the options of the gRPC-JSON transcoder for an api.
+type TranscodingOptions struct {
+	AlwaysPrintPrimitiveFields   bool
+	AlwaysPrintEnumsAsInts       bool
+	PreserveProtoFieldNames      bool
+	IgnoreUnknownQueryParameters bool
+	// Transcode with the route of the incoming request instead of the one of
+	// the gRPC method, e.g. after the path is rewritten.
+	MatchIncomingRequestRoute bool
+}
+
+// transcodingOptionsFile is the format of the file at --transcoding_api_options_path.
+type transcodingOptionsFile struct {
+	Rules []*transcodingOptionsRule `json:"rules"`
+}
+
+// transcodingOptionsRule overrides the options of the flags for the api, the
+// unset options keep the value of the flags.
+type transcodingOptionsRule struct {
+	Api                          string `json:"api"`
+	AlwaysPrintPrimitiveFields   *bool  `json:"alwaysPrintPrimitiveFields,omitempty"`
+	AlwaysPrintEnumsAsInts       *bool  `json:"alwaysPrintEnumsAsInts,omitempty"`
+	PreserveProtoFieldNames      *bool  `json:"preserveProtoFieldNames,omitempty"`
+	IgnoreUnknownQueryParameters *bool  `json:"ignoreUnknownQueryParameters,omitempty"`
+	MatchIncomingRequestRoute    *bool  `json:"matchIncomingRequestRoute,omitempty"`
+}
+
+// processTranscodingOptions sets the transcoding options of all the apis, from
+// the flags and the per-api overrides.
+func (s *ServiceInfo) processTranscodingOptions() error {
+	s.ApiTranscodingOptions = make(map[string]*TranscodingOptions)
+	for _, apiName := range s.ApiNames {
+		s.ApiTranscodingOptions[apiName] = &TranscodingOptions{
+			AlwaysPrintPrimitiveFields:   s.Options.TranscodingAlwaysPrintPrimitiveFields,
+			AlwaysPrintEnumsAsInts:       s.Options.TranscodingAlwaysPrintEnumsAsInts,
+			PreserveProtoFieldNames:      s.Options.TranscodingPreserveProtoFieldNames,
+			IgnoreUnknownQueryParameters: s.Options.TranscodingIgnoreUnknownQueryParameters,
+			MatchIncomingRequestRoute:    s.Options.TranscodingMatchIncomingRequestRoute,
+		}
+	}
+
+	if s.Options.TranscodingApiOptionsPath == "" {
+		return nil
+	}
+
+	var optionsFile transcodingOptionsFile
+	if err := util.UnmarshalJsonFile(s.Options.TranscodingApiOptionsPath, &optionsFile); err != nil {
+		return fmt.Errorf("fail to read transcoding api options: %v", err)
+	}
+
+	overridden := make(map[string]bool)
+	for _, rule := range optionsFile.Rules {
+		options, ok := s.ApiTranscodingOptions[rule.Api]
+		if !ok {
+			return fmt.Errorf("transcoding api options have unknown api %q", rule.Api)
+		}
+		if overridden[rule.Api] {
+			return fmt.Errorf("duplicate transcoding api options for api %q", rule.Api)
+		}
+		overridden[rule.Api] = true
+
+		overrideOption(&options.AlwaysPrintPrimitiveFields, rule.AlwaysPrintPrimitiveFields)
+		overrideOption(&options.AlwaysPrintEnumsAsInts, rule.AlwaysPrintEnumsAsInts)
+		overrideOption(&options.PreserveProtoFieldNames, rule.PreserveProtoFieldNames)
+		overrideOption(&options.IgnoreUnknownQueryParameters, rule.IgnoreUnknownQueryParameters)
+		overrideOption(&options.MatchIncomingRequestRoute, rule.MatchIncomingRequestRoute)
+	}
+	return nil
+}
+
+func overrideOption(option *bool, override *bool) {
+	if override != nil {
+		*option = *override
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configinfo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/testutil"
+
+	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
+	apipb "google.golang.org/genproto/protobuf/api"
+)
+
+func TestProcessTranscodingOptions(t *testing.T) {
+	fakeServiceConfig := &confpb.Service{
+		Name: testProjectName,
+		Apis: []*apipb.Api{
+			{
+				Name: "endpoints.examples.bookstore.LegacyBookstore",
+			},
+			{
+				Name: "endpoints.examples.bookstore.Bookstore",
+			},
+		},
+	}
+
+	testData := []struct {
+		desc        string
+		optionsFile string
+		wantOptions map[string]*TranscodingOptions
+		wantError   string
+	}{
+		{
+			desc: "No per-api options",
+			wantOptions: map[string]*TranscodingOptions{
+				"endpoints.examples.bookstore.LegacyBookstore": {
+					AlwaysPrintPrimitiveFields: true,
+				},
+				"endpoints.examples.bookstore.Bookstore": {
+					AlwaysPrintPrimitiveFields: true,
+				},
+			},
+		},
+		{
+			desc: "Per-api options override the flags",
+			optionsFile: `{"rules": [
+  {"api": "endpoints.examples.bookstore.LegacyBookstore", "preserveProtoFieldNames": true, "alwaysPrintPrimitiveFields": false, "matchIncomingRequestRoute": true},
+  {"api": "endpoints.examples.bookstore.Bookstore", "ignoreUnknownQueryParameters": true}
+]}`,
+			wantOptions: map[string]*TranscodingOptions{
+				"endpoints.examples.bookstore.LegacyBookstore": {
+					PreserveProtoFieldNames:   true,
+					MatchIncomingRequestRoute: true,
+				},
+				"endpoints.examples.bookstore.Bookstore": {
+					AlwaysPrintPrimitiveFields:   true,
+					IgnoreUnknownQueryParameters: true,
+				},
+			},
+		},
+		{
+			desc: "Unknown api",
+			optionsFile: `{"rules": [
+  {"api": "endpoints.examples.bookstore.Library", "preserveProtoFieldNames": true}
+]}`,
+			wantError: `transcoding api options have unknown api "endpoints.examples.bookstore.Library"`,
+		},
+		{
+			desc: "Duplicate rules",
+			optionsFile: `{"rules": [
+  {"api": "endpoints.examples.bookstore.Bookstore", "preserveProtoFieldNames": true},
+  {"api": "endpoints.examples.bookstore.Bookstore", "alwaysPrintEnumsAsInts": true}
+]}`,
+			wantError: `duplicate transcoding api options for api "endpoints.examples.bookstore.Bookstore"`,
+		},
+		{
+			desc: "Unknown option",
+			optionsFile: `{"rules": [
+  {"api": "endpoints.examples.bookstore.Bookstore", "caseInsensitiveEnumParsing": true}
+]}`,
+			wantError: "fail to read transcoding api options",
+		},
+	}
+	for _, tc := range testData {
+		opts := options.DefaultConfigGeneratorOptions()
+		opts.TranscodingAlwaysPrintPrimitiveFields = true
+		if tc.optionsFile != "" {
+			path, removeFile := testutil.WriteTempFile(t, "transcoding_api_options", tc.optionsFile)
+			defer removeFile()
+			opts.TranscodingApiOptionsPath = path
+		}
+
+		s, err := NewServiceInfoFromServiceConfig(fakeServiceConfig, testConfigID, opts)
+		if err != nil {
+			if tc.wantError == "" || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test Desc(%s): want error: %s, get error: %v", tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if tc.wantError != "" {
+			t.Errorf("Test Desc(%s): want error: %s, get no error", tc.desc, tc.wantError)
+			continue
+		}
+		if !reflect.DeepEqual(s.ApiTranscodingOptions, tc.wantOptions) {
+			t.Errorf("Test Desc(%s): transcoding options\ngot: %+v\nwant: %+v", tc.desc, s.ApiTranscodingOptions, tc.wantOptions)
+		}
+	}
+}
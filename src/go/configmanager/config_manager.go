@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
@@ -42,6 +43,8 @@ import (
 var (
 	// These flags are used by config manage only.
 	checkNewRolloutInterval = flag.Duration("check_rollout_interval", 60*time.Second, `the interval periodically to call servicemanagment to check the latest rolloutil.`)
+	checkLocalJwksInterval  = flag.Duration("check_local_jwks_interval", 10*time.Second, `the interval periodically to check the local JWKS files for changes.`)
+	CheckApiKeysInterval    = flag.Duration("check_api_keys_interval", 10*time.Second, `the interval periodically to check the API keys file for changes.`)
 	CheckMetadata           = flag.Bool("check_metadata", false, `enable fetching service name, config ID and rollout strategy from service metadata server`)
 	RolloutStrategy         = flag.String("rollout_strategy", "fixed", `service config rollout strategy, must be either "managed" or "fixed"`)
 	ServiceConfigId         = flag.String("service_config_id", "", "initial service config id")
@@ -51,6 +54,8 @@ var (
 					GCP metadata server will not be called to fetch access token, and
 					following flags will be ignored; --service_config_id, --service,
 					--rollout_strategy`)
+	StatusPort = flag.Uint("status_port", 0, `Port of the status server of the config manager on localhost, serving the
+					route analysis of the current service config at /status/routes. The server is disabled when it is 0.`)
 )
 
 // Config Manager handles service configuration fetching and updating.
@@ -66,6 +71,13 @@ type ConfigManager struct {
 	rolloutIdChangeDetector *sc.RolloutIdChangeDetector
 
 	curServiceConfig *confpb.Service
+
+	// Incremented when the local JWKS files change, so the snapshot version changes
+	// with the same service config.
+	localJwksRevision int
+
+	// Guards the service config updates from the rollout and local JWKS checks.
+	mu sync.Mutex
 }
 
 // NewConfigManager creates new instance of Config Manager.
@@ -93,6 +105,7 @@ func NewConfigManager(mf *metadata.MetadataFetcher, opts options.ConfigGenerator
 		if err := m.readAndApplyServiceConfig(*ServicePath); err != nil {
 			return nil, err
 		}
+		m.startLocalJwksCheck(*checkLocalJwksInterval)
 
 		glog.Infof("create new Config Manager from static service config json file at %v", *ServicePath)
 		return m, nil
@@ -184,11 +197,14 @@ func NewConfigManager(mf *metadata.MetadataFetcher, opts options.ConfigGenerator
 				return
 			}
 
+			m.mu.Lock()
+			defer m.mu.Unlock()
 			if err = m.fetchAndApplyServiceConfig(latestConfigId); err != nil {
 				glog.Errorf("error occurred when fetching and applying new service config, %v", err)
 			}
 		})
 	}
+	m.startLocalJwksCheck(*checkLocalJwksInterval)
 
 	glog.Infof("create new Config Manager for service (%v) with configuration id (%v), %v rollout strategy",
 		m.serviceName, m.curConfigId(), rolloutStrategy)
@@ -229,12 +245,12 @@ func (m *ConfigManager) applyServiceConfig(serviceConfig *confpb.Service) error
 		return fmt.Errorf("applid service config is empty")
 	}
 
-	var err error
 	m.curServiceConfig = serviceConfig
-	m.serviceInfo, err = configinfo.NewServiceInfoFromServiceConfig(serviceConfig, serviceConfig.Id, m.envoyConfigOptions)
+	serviceInfo, err := configinfo.NewServiceInfoFromServiceConfig(serviceConfig, serviceConfig.Id, m.envoyConfigOptions)
 	if err != nil {
 		return fmt.Errorf("fail to initialize ServiceInfo, %s", err)
 	}
+	m.serviceInfo = serviceInfo
 
 	if m.metadataFetcher != nil {
 		attrs, err := m.metadataFetcher.FetchGCPAttributes()
@@ -273,11 +289,56 @@ func (m *ConfigManager) makeSnapshot() (*cache.Snapshot, error) {
 		listenerResources = append(listenerResources, lis)
 	}
 
-	snapshot := cache.NewSnapshot(m.curConfigId(), endpoints, clusterResources, routes, listenerResources, runtimes)
+	snapshot := cache.NewSnapshot(m.snapshotVersion(), endpoints, clusterResources, routes, listenerResources, runtimes)
 	m.Infof("Envoy Dynamic Configuration is cached for service: %v", m.serviceName)
 	return &snapshot, nil
 }
 
+// startLocalJwksCheck periodically checks the local JWKS files, and applies the
+// current service config again if any of them changed. Envoy does not watch the
+// files itself, the JWKS are inlined in the config. The check runs even if the
+// current service config has no local JWKS, a later rollout may add some.
+func (m *ConfigManager) startLocalJwksCheck(interval time.Duration) {
+	go func() {
+		glog.Infof("start checking local JWKS files every %v", interval)
+		ticker := time.NewTicker(interval)
+		for range ticker.C {
+			m.mu.Lock()
+			if m.localJwksChanged() {
+				m.localJwksRevision++
+				if err := m.applyServiceConfig(m.curServiceConfig); err != nil {
+					// The snapshot was not updated, it keeps its version.
+					m.localJwksRevision--
+					glog.Errorf("error occurred when applying the changed local JWKS, %v", err)
+				}
+			}
+			m.mu.Unlock()
+		}
+	}()
+}
+
+func (m *ConfigManager) localJwksChanged() bool {
+	for id, path := range m.serviceInfo.LocalJwksPaths {
+		jwks, err := configinfo.ReadLocalJwks(path)
+		if err != nil {
+			glog.Warningf("fail to read local JWKS for provider %q, keeping the current JWKS: %v", id, err)
+			continue
+		}
+		if jwks != m.serviceInfo.LocalJwks[id] {
+			glog.Infof("local JWKS for provider %q changed", id)
+			return true
+		}
+	}
+	return false
+}
+
+func (m *ConfigManager) snapshotVersion() string {
+	if m.localJwksRevision == 0 {
+		return m.curConfigId()
+	}
+	return fmt.Sprintf("%s-jwks-%d", m.curConfigId(), m.localJwksRevision)
+}
+
 func (m *ConfigManager) curConfigId() string {
 	if m.curServiceConfig == nil {
 		return ""
@@ -17,6 +17,7 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"sort"
@@ -30,6 +31,7 @@ import (
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/serviceconfig"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/testutil"
 	"github.com/GoogleCloudPlatform/esp-v2/tests/env/platform"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
@@ -377,6 +379,267 @@ func TestFixedModeDynamicRouting(t *testing.T) {
 	}
 }
 
+func TestLocalJwksCheck(t *testing.T) {
+	jwksPath, removeJwksFile := testutil.WriteTempFile(t, "local_jwks", `{"keys": [{"kty": "RSA", "kid": "key-0"}]}`)
+	defer removeJwksFile()
+
+	serviceConfig := fmt.Sprintf(`{
+		"name": "bookstore.endpoints.project123.cloud.goog",
+		"id": "%s",
+		"apis": [{"name": "endpoints.examples.bookstore.Bookstore"}],
+		"authentication": {
+			"providers": [{"id": "auth_provider", "issuer": "issuer-0", "jwksUri": "file://%s"}]
+		}
+	}`, testdata.TestFetchListenersConfigID, jwksPath)
+	serviceConfigPath, removeServiceConfigFile := testutil.WriteTempFile(t, "service_config", serviceConfig)
+	defer removeServiceConfigFile()
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.DisableTracing = true
+
+	_ = flag.Set("service_json_path", serviceConfigPath)
+	_ = flag.Set("check_local_jwks_interval", "50ms")
+	defer func() {
+		_ = flag.Set("service_json_path", "")
+		_ = flag.Set("check_local_jwks_interval", "10s")
+	}()
+
+	manager, err := NewConfigManager(nil, opts)
+	if err != nil {
+		t.Fatal("fail to initialize Config Manager: ", err)
+	}
+
+	_, resp, gotListeners, err := getListeners(manager, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Version != testdata.TestFetchListenersConfigID {
+		t.Errorf("snapshot cache fetch got version: %v, want: %v", resp.Version, testdata.TestFetchListenersConfigID)
+	}
+	if !strings.Contains(gotListeners, "key-0") {
+		t.Errorf("listeners do not have the local JWKS: %v", gotListeners)
+	}
+
+	// Invalid JWKS are ignored, the current JWKS is kept.
+	if err := ioutil.WriteFile(jwksPath, []byte(`{"keys": []}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if _, resp, _, err = getListeners(manager, opts); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Version != testdata.TestFetchListenersConfigID {
+		t.Errorf("snapshot cache fetch got version: %v after invalid JWKS, want: %v", resp.Version, testdata.TestFetchListenersConfigID)
+	}
+
+	if err := ioutil.WriteFile(jwksPath, []byte(`{"keys": [{"kty": "RSA", "kid": "key-1"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wantVersion := testdata.TestFetchListenersConfigID + "-jwks-1"
+	for i := 0; i < 20 && resp.Version != wantVersion; i++ {
+		time.Sleep(50 * time.Millisecond)
+		if _, resp, gotListeners, err = getListeners(manager, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if resp.Version != wantVersion {
+		t.Fatalf("snapshot cache fetch got version: %v, want: %v", resp.Version, wantVersion)
+	}
+	if !strings.Contains(gotListeners, "key-1") {
+		t.Errorf("listeners do not have the changed local JWKS: %v", gotListeners)
+	}
+}
+
+// The local JWKS files added by a later service config are also checked.
+func TestLocalJwksCheckAfterNewConfig(t *testing.T) {
+	jwksPath, removeJwksFile := testutil.WriteTempFile(t, "local_jwks", `{"keys": [{"kty": "RSA", "kid": "key-0"}]}`)
+	defer removeJwksFile()
+
+	serviceConfig := fmt.Sprintf(`{
+		"name": "bookstore.endpoints.project123.cloud.goog",
+		"id": "%s",
+		"apis": [{"name": "endpoints.examples.bookstore.Bookstore"}]
+	}`, testdata.TestFetchListenersConfigID)
+	serviceConfigPath, removeServiceConfigFile := testutil.WriteTempFile(t, "service_config", serviceConfig)
+	defer removeServiceConfigFile()
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.DisableTracing = true
+
+	_ = flag.Set("service_json_path", serviceConfigPath)
+	_ = flag.Set("check_local_jwks_interval", "50ms")
+	defer func() {
+		_ = flag.Set("service_json_path", "")
+		_ = flag.Set("check_local_jwks_interval", "10s")
+	}()
+
+	manager, err := NewConfigManager(nil, opts)
+	if err != nil {
+		t.Fatal("fail to initialize Config Manager: ", err)
+	}
+
+	newConfigId := testdata.TestFetchListenersConfigID + "-new"
+	newServiceConfig, err := util.UnmarshalServiceConfig(strings.NewReader(fmt.Sprintf(`{
+		"name": "bookstore.endpoints.project123.cloud.goog",
+		"id": "%s",
+		"apis": [{"name": "endpoints.examples.bookstore.Bookstore"}],
+		"authentication": {
+			"providers": [{"id": "auth_provider", "issuer": "issuer-0", "jwksUri": "file://%s"}]
+		}
+	}`, newConfigId, jwksPath)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.mu.Lock()
+	err = manager.applyServiceConfig(newServiceConfig)
+	manager.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(jwksPath, []byte(`{"keys": [{"kty": "RSA", "kid": "key-1"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wantVersion := newConfigId + "-jwks-1"
+	var resp *cache.Response
+	var gotListeners string
+	for i := 0; i < 20 && (resp == nil || resp.Version != wantVersion); i++ {
+		time.Sleep(50 * time.Millisecond)
+		if _, resp, gotListeners, err = getListeners(manager, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if resp.Version != wantVersion {
+		t.Fatalf("snapshot cache fetch got version: %v, want: %v", resp.Version, wantVersion)
+	}
+	if !strings.Contains(gotListeners, "key-1") {
+		t.Errorf("listeners do not have the changed local JWKS: %v", gotListeners)
+	}
+}
+
+// The jwks_uri set by --jwt_openid_jwks_uris is kept when the service config
+// is applied again for the changed local JWKS.
+func TestLocalJwksCheckWithOpenIDJwksUris(t *testing.T) {
+	jwksPath, removeJwksFile := testutil.WriteTempFile(t, "local_jwks", `{"keys": [{"kty": "RSA", "kid": "key-0"}]}`)
+	defer removeJwksFile()
+
+	serviceConfig := fmt.Sprintf(`{
+		"name": "bookstore.endpoints.project123.cloud.goog",
+		"id": "%s",
+		"apis": [{"name": "endpoints.examples.bookstore.Bookstore"}],
+		"authentication": {
+			"providers": [
+				{"id": "local_provider", "issuer": "issuer-0", "jwksUri": "file://%s"},
+				{"id": "openid_provider", "issuer": "issuer-1"}
+			]
+		}
+	}`, testdata.TestFetchListenersConfigID, jwksPath)
+	serviceConfigPath, removeServiceConfigFile := testutil.WriteTempFile(t, "service_config", serviceConfig)
+	defer removeServiceConfigFile()
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.DisableTracing = true
+	opts.JwtOpenIDJwksUris = `{"openid_provider": "https://issuer-1.example.com/jwks"}`
+
+	_ = flag.Set("service_json_path", serviceConfigPath)
+	_ = flag.Set("check_local_jwks_interval", "50ms")
+	defer func() {
+		_ = flag.Set("service_json_path", "")
+		_ = flag.Set("check_local_jwks_interval", "10s")
+	}()
+
+	manager, err := NewConfigManager(nil, opts)
+	if err != nil {
+		t.Fatal("fail to initialize Config Manager: ", err)
+	}
+
+	if err := ioutil.WriteFile(jwksPath, []byte(`{"keys": [{"kty": "RSA", "kid": "key-1"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wantVersion := testdata.TestFetchListenersConfigID + "-jwks-1"
+	var resp *cache.Response
+	var gotListeners string
+	for i := 0; i < 20 && (resp == nil || resp.Version != wantVersion); i++ {
+		time.Sleep(50 * time.Millisecond)
+		if _, resp, gotListeners, err = getListeners(manager, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if resp.Version != wantVersion {
+		t.Fatalf("snapshot cache fetch got version: %v, want: %v", resp.Version, wantVersion)
+	}
+	if !strings.Contains(gotListeners, "key-1") {
+		t.Errorf("listeners do not have the changed local JWKS: %v", gotListeners)
+	}
+	if !strings.Contains(gotListeners, "https://issuer-1.example.com/jwks") {
+		t.Errorf("listeners do not have the jwks_uri of jwt_openid_jwks_uris: %v", gotListeners)
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	serviceConfig := fmt.Sprintf(`{
+		"name": "bookstore.endpoints.project123.cloud.goog",
+		"id": "%s",
+		"apis": [{"name": "endpoints.examples.bookstore.Bookstore", "methods": [{"name": "GetResource"}, {"name": "ListShelves"}]}],
+		"http": {
+			"rules": [
+				{"selector": "endpoints.examples.bookstore.Bookstore.GetResource", "get": "/v1/{name=**}"},
+				{"selector": "endpoints.examples.bookstore.Bookstore.ListShelves", "get": "/v1/shelves"}
+			]
+		}
+	}`, testdata.TestFetchListenersConfigID)
+	serviceConfigPath, removeServiceConfigFile := testutil.WriteTempFile(t, "service_config", serviceConfig)
+	defer removeServiceConfigFile()
+
+	opts := options.DefaultConfigGeneratorOptions()
+	opts.DisableTracing = true
+
+	_ = flag.Set("service_json_path", serviceConfigPath)
+	defer func() {
+		_ = flag.Set("service_json_path", "")
+	}()
+
+	manager, err := NewConfigManager(nil, opts)
+	if err != nil {
+		t.Fatal("fail to initialize Config Manager: ", err)
+	}
+
+	s := httptest.NewServer(manager.StatusHandler())
+	defer s.Close()
+	resp, err := http.Get(s.URL + StatusRoutesPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantStatus := fmt.Sprintf(`{
+		"serviceName": "bookstore.endpoints.project123.cloud.goog",
+		"serviceConfigId": "%s",
+		"routeReport": {
+			"routes": [
+				{
+					"operation": "endpoints.examples.bookstore.Bookstore.ListShelves",
+					"httpMethod": "GET",
+					"uriTemplate": "/v1/shelves",
+					"reordered": true
+				},
+				{
+					"operation": "endpoints.examples.bookstore.Bookstore.GetResource",
+					"httpMethod": "GET",
+					"uriTemplate": "/v1/{name=**}"
+				}
+			]
+		}
+	}`, testdata.TestFetchListenersConfigID)
+	if err := util.JsonEqual(wantStatus, string(body)); err != nil {
+		t.Errorf("status got diff: %v", err)
+	}
+}
+
 func TestServiceConfigAutoUpdate(t *testing.T) {
 	var fakeConfig, fakeScReport, fakeRollouts safeData
 
@@ -39,14 +39,74 @@ var (
 	CorsExposeHeaders    = flag.String("cors_expose_headers", "", "set Access-Control-Expose-Headers to the specified headers")
 	CorsPreset           = flag.String("cors_preset", "", `enable CORS support, must be either "basic" or "cors_with_regex"`)
 
+	CorsPolicyPath = flag.String("cors_policy_path", "", `Path to a JSON file with CORS policies per API or per operation, overriding the policy of --cors_preset.
+	Format: {"policies": [{"selector": "API_NAME_OR_OPERATION", "allowOrigins": ["https://example.com"], "allowOriginRegexes": ["https://[^.]+\\.example\\.com"],
+	"allowMethods": ["GET"], "allowHeaders": ["authorization"], "exposeHeaders": [], "allowCredentials": false, "maxAge": 3600}]}.
+	A policy for an operation takes precedence over a policy for its API. Requires allow_cors in the endpoints of the service config.`)
+
+	RouteConflicts = flag.String("route_conflicts", "warn", `What to do with routes that are unreachable or ambiguous because an earlier route of another operation matches the same requests,
+	must be either "warn" or "fail". Routes more specific than an earlier route are always moved before it.`)
+	RouteTableMode = flag.String("route_table_mode", "flat", `How the routes of the http rules are made, must be either "flat" or "grouped".
+	With "flat", each http rule has its own route. With "grouped", the http rules with the same method and route action are merged into routes
+	matching a regex of their prefix-grouped templates, which scales to large APIs. The span names of the merged routes are the backend cluster names.`)
+
 	// Backend routing configurations.
 	BackendDnsLookupFamily = flag.String("backend_dns_lookup_family", "auto", `Define the dns lookup family for all backends. The options are "auto", "v4only" and "v6only". The default is "auto".`)
 
+	// Backend circuit breakers and outlier detection.
+	BackendCircuitBreakerMaxConnections = flag.Int("backend_circuit_breaker_max_connections", -1, `The maximum number of connections ESPv2 makes to each backend cluster.
+	If not set, the Envoy default of 1024 is used. Overflows are counted in the "cluster.<cluster_name>.upstream_cx_overflow" stat.`)
+	BackendCircuitBreakerMaxPendingRequests = flag.Int("backend_circuit_breaker_max_pending_requests", -1, `The maximum number of requests waiting for a connection to each backend cluster.
+	If not set, the Envoy default of 1024 is used. Overflows are counted in the "cluster.<cluster_name>.upstream_rq_pending_overflow" stat.`)
+	BackendCircuitBreakerMaxRequests = flag.Int("backend_circuit_breaker_max_requests", -1, `The maximum number of parallel requests to each backend cluster.
+	If not set, the Envoy default of 1024 is used. Overflows are counted in the "cluster.<cluster_name>.upstream_rq_pending_overflow" stat.`)
+	BackendCircuitBreakerMaxRetries = flag.Int("backend_circuit_breaker_max_retries", -1, `The maximum number of parallel retries to each backend cluster.
+	If not set, the Envoy default of 3 is used. Overflows are counted in the "cluster.<cluster_name>.upstream_rq_retry_overflow" stat.`)
+	BackendOutlierDetectionConsecutive5xx = flag.Int("backend_outlier_detection_consecutive_5xx", 0, `Enable outlier detection for backend clusters: a backend host is ejected
+	after this many consecutive 5xx responses. Outlier detection is disabled if not set.`)
+	BackendOutlierDetectionInterval           = flag.Duration("backend_outlier_detection_interval", 10*time.Second, "The time interval between outlier detection ejection sweeps.")
+	BackendOutlierDetectionBaseEjectionTime   = flag.Duration("backend_outlier_detection_base_ejection_time", 30*time.Second, "The base time that an outlier backend host is ejected for.")
+	BackendOutlierDetectionMaxEjectionPercent = flag.Int("backend_outlier_detection_max_ejection_percent", 10, "The maximum percentage of hosts in a backend cluster that can be ejected.")
+
+	// Backend active health checks.
+	BackendHealthCheck = flag.String("backend_health_check", "", `Enable active health checks for backend clusters, must be either "http" or "grpc".
+	Health checks are disabled if not set.`)
+	BackendHealthCheckPath               = flag.String("backend_health_check_path", "/", `The path requested by "http" backend health checks.`)
+	BackendHealthCheckGrpcServiceName    = flag.String("backend_health_check_grpc_service_name", "", `The service name sent by "grpc" backend health checks.`)
+	BackendHealthCheckInterval           = flag.Duration("backend_health_check_interval", 10*time.Second, "The time interval between backend health checks.")
+	BackendHealthCheckTimeout            = flag.Duration("backend_health_check_timeout", 5*time.Second, "The time to wait for a backend health check response.")
+	BackendHealthCheckHealthyThreshold   = flag.Int("backend_health_check_healthy_threshold", 2, "The number of successful health checks before a backend host is marked healthy.")
+	BackendHealthCheckUnhealthyThreshold = flag.Int("backend_health_check_unhealthy_threshold", 3, "The number of failed health checks before a backend host is marked unhealthy.")
+
+	BackendTrafficPolicyPath = flag.String("backend_traffic_policy_path", "", `Path to a JSON file that overrides the circuit breaker, outlier detection and health check
+	settings for individual backend addresses. For example:
+	  {"backends": [{"address": "https://foo.example.com", "circuitBreakers": {"maxRequests": 100}, "outlierDetection": {"consecutive5xx": 3},
+	                 "healthCheck": {"type": "http", "path": "/ready", "interval": "5s"}}]}`)
+
+	// Backend request mirroring.
+	BackendShadowAddress = flag.String("backend_shadow_address", "", `The URI of a secondary backend that receives a copy of the requests.
+	Responses from the shadow backend are ignored, and mirrored requests are not checked or reported to Service Control.`)
+	BackendShadowPercent = flag.Int("backend_shadow_percent", 100, `The integer percentage of requests mirrored to --backend_shadow_address.
+	It can be changed at runtime with the Envoy admin endpoint "/runtime_modify?backend_shadow.percent=<integer percent>".`)
+	BackendShadowOperations = flag.String("backend_shadow_operations", "", `Comma separated operation selectors whose requests are mirrored to --backend_shadow_address.
+	All operations are mirrored if not set.`)
+
+	BackendCanaryRulesPath = flag.String("backend_canary_rules_path", "", `Path to a JSON file with canary rules that route requests of an operation to an alternate backend,
+	either when they carry a header or for a percentage of traffic. The canary backend must use the same path as the primary backend. For example:
+	  {"rules": [{"selector": "foo.Bar", "address": "https://canary.example.com", "header": {"name": "x-canary", "value": "true"}},
+	             {"selector": "foo.Baz", "address": "https://canary.example.com", "percent": 10}]}`)
+
 	// Envoy specific configurations.
 	ClusterConnectTimeout = flag.Duration("cluster_connect_timeout", 20*time.Second, "cluster connect timeout in seconds")
 
 	// Network related configurations.
-	BackendAddress       = flag.String("backend_address", "http://127.0.0.1:8082", `The application server URI to which ESPv2 proxies requests.`)
+	BackendAddress = flag.String("backend_address", "http://127.0.0.1:8082", `The application server URI to which ESPv2 proxies requests.
+	Multiple comma separated URIs with the same scheme can be set to load balance across several local backends.`)
+	BackendWeights = flag.String("backend_weights", "", `Comma separated load balancing weights, one for each address in --backend_address.
+	Traffic is spread equally if not set.`)
+	BackendLbPolicy = flag.String("backend_lb_policy", "round_robin", `The load balancing policy across the addresses in --backend_address.
+	Must be one of "round_robin", "least_request" or "ring_hash".`)
+	BackendLbHashHeader  = flag.String("backend_lb_hash_header", "", `The request header hashed to pick a backend address when --backend_lb_policy is "ring_hash".`)
 	ListenerAddress      = flag.String("listener_address", "0.0.0.0", "listener socket ip address")
 	ServiceManagementURL = flag.String("service_management_url", "https://servicemanagement.googleapis.com", "url of service management server")
 	ServiceControlURL    = flag.String("service_control_url", "https://servicecontrol.googleapis.com", "url of service control server")
@@ -54,6 +114,14 @@ var (
 	ListenerPort = flag.Int("listener_port", 8080, "listener port")
 	Healthz      = flag.String("healthz", "", "path for health check of ESPv2 proxy itself")
 
+	HealthzCheckLocalBackend = flag.Bool("healthz_check_local_backend", false, `If true, the health check of ESPv2 proxy itself fails when the local backend cluster
+	has no healthy hosts. Requires --healthz and --backend_health_check.`)
+
+	HealthzGrpcHealthCheck = flag.Bool("healthz_grpc_health_check", false, `If true, the health check of ESPv2 proxy itself returns 200 or 503 according to
+	the grpc.health.v1.Health/Check of the gRPC local backend, with the service name of --backend_health_check_grpc_service_name.
+	Requires --healthz and a grpc backend_address, and replaces no other health check of the local backend.`)
+	HealthzGrpcCacheInterval = flag.Duration("healthz_grpc_cache_interval", time.Second, "The interval the result of the grpc.health.v1.Health/Check of --healthz_grpc_health_check is cached for.")
+
 	SslServerCertPath                = flag.String("ssl_server_cert_path", "", "Path to the certificate and key that ESPv2 uses to act as a HTTPS server")
 	SslSidestreamClientRootCertsPath = flag.String("ssl_sidestream_client_root_certs_path", util.DefaultRootCAPaths, "Path to the root certificates to make TLS connection to all external services other than the backend.")
 	SslBackendClientCertPath         = flag.String("ssl_backend_client_cert_path", "", "Path to the certificate and key that ESPv2 uses to enable TLS mutual authentication for HTTPS backend")
@@ -70,12 +138,22 @@ var (
 	TokenAgentPort = flag.Uint("token_agent_port", 8791, "Port that configmanager use to setup server to provide envoy with access token using service account credential, for accessing servicecontrol.")
 
 	// Envoy configurations.
-	AccessLog       = flag.String("access_log", "", "Path to a local file to which the access log entries will be written")
+	AccessLog = flag.String("access_log", "", `Path to a local file to which the access log entries will be written.
+	Use "stdout" or "stderr" to write the access log to the standard output or the standard error of Envoy.`)
 	AccessLogFormat = flag.String("access_log_format", "", `String format to specify the format of access log.
 	If unset, the following format will be used.
 	https://www.envoyproxy.io/docs/envoy/latest/configuration/observability/access_log#default-format-string
 	For the detailed format grammar, please refer to the following document.
 	https://www.envoyproxy.io/docs/envoy/latest/configuration/observability/access_log#format-strings`)
+	AccessLogJsonFormat = flag.String("access_log_json_format", "", `Write the access log entries as JSON, specified as a JSON object of log keys to command operators,
+	e.g. '{"status":"%RESPONSE_CODE%","path":"%REQ(:PATH)%"}'. Cannot be used with --access_log_format.`)
+	AccessLogGrpcServiceAddress = flag.String("access_log_grpc_service_address", "", `Address of a gRPC access log service (ALS) collector to which the access log entries will be sent,
+	in format of grpc://HOST:PORT or grpcs://HOST:PORT. It can be used together with --access_log.`)
+	AccessLogMinStatusCode = flag.Int("access_log_min_status_code", 0, "Only log requests with a response code greater than or equal to this value. 0 means no lower bound.")
+	AccessLogMaxStatusCode = flag.Int("access_log_max_status_code", 0, "Only log requests with a response code less than or equal to this value. 0 means no upper bound.")
+	AccessLogSamplePercent = flag.Int("access_log_sample_percent", 100, `Integer percentage of requests to log, between 0 and 100. It can be overridden at runtime with the
+	"access_log.sample_percent" runtime key through the Envoy admin endpoint.`)
+	AccessLogExcludeHealthz = flag.Bool("access_log_exclude_healthz", false, "Do not log the health check requests handled by the --healthz endpoint.")
 
 	EnvoyUseRemoteAddress  = flag.Bool("envoy_use_remote_address", false, "Envoy HttpConnectionManager configuration, please refer to envoy documentation for detailed information.")
 	EnvoyXffNumTrustedHops = flag.Int("envoy_xff_num_trusted_hops", 2, "Envoy HttpConnectionManager configuration, please refer to envoy documentation for detailed information.")
@@ -100,7 +178,43 @@ var (
 	ConnectionBufferLimitBytes = flag.Int("connection_buffer_limit_bytes", -1, `Configure the maximum amount of data that is buffered for each request/response body. 
 			If not provided, Envoy will decide the default value.`)
 
+	EnableOperationStats = flag.Bool("enable_operation_stats", false, `Emit Envoy request, latency and response code stats for each operation, as virtual cluster stats
+	named vhost.backend.vcluster.OPERATION.*, where OPERATION is the selector with non word characters replaced by "_".`)
+	MaxOperationStats = flag.Int("max_operation_stats", 100, `The maximum number of HTTP rules with operation stats, to bound the stats cardinality for large APIs.
+	Requests to the remaining operations are counted in vhost.backend.vcluster.other.*.`)
+
 	JwksCacheDurationInS = flag.Int("jwks_cache_duration_in_s", 300, "Specify JWT public key cache duration in seconds. The default is 5 minutes.")
+	JwtLocalJwks         = flag.String("jwt_local_jwks", "", `Use local JWKS instead of fetching them from the jwks_uri, specified as a JSON object of provider ids to JWKS file paths or inline JWKS,
+	e.g. '{"provider1": "/etc/jwks/provider1.json", "provider2": {"keys": [...]}}'. A jwks_uri in format of file:///PATH is also read from the local file.
+	No cluster is created for providers with local JWKS. The config manager reloads the files when they change.`)
+	JwtClaimsPolicyPath = flag.String("jwt_claims_policy_path", "", `Path to a JSON file with the claims the JWT must have per operation, requests without them are rejected with 403.
+	Format: {"rules": [{"selector": "OPERATION", "claims": [{"claim": "scope", "hasScope": "books.write"}, {"claim": "groups", "includes": "admin"}, {"claim": "tenant", "equals": "tenant-1"}]}]}.
+	All the claims of a rule are required. The operations must have a JWT authentication rule.`)
+	JwtClaimHeaders = flag.String("jwt_claim_headers", "", `Forwards claims of the JWT payload to the backend as headers, specified as a JSON object of provider ids to objects of claims to header names,
+	e.g. '{"provider1": {"sub": "X-User-Id", "email": "X-User-Email", "address.country": "X-User-Country"}}'. Nested claims are separated by ".".
+	The headers sent by the client are removed, the headers are not sent if the JWT does not have the claims.`)
+
+	JwtRequirementModesPath = flag.String("jwt_requirement_modes_path", "", `Path to a JSON file with how the JWT requirements of the operations are combined.
+	Format: {"rules": [{"selector": "OPERATION", "mode": "all"}]}. The modes are "any" (the default), "all", "allow_missing",
+	which allows requests without JWT but validates the JWT if present, and "allow_missing_or_failed", which also allows invalid JWTs.`)
+
+	ApiKeysPath = flag.String("api_keys_path", "", `Path to a JSON file with the API keys checked by the config manager instead of Service Control, for non-GCP deployments.
+	Format: {"keys": [{"key": "KEY", "consumer": "CONSUMER", "operations": ["OPERATION"], "allowedReferers": ["*.example.com/*"], "allowedIps": ["10.0.0.0/8"]}]}.
+	The operations and restrictions are optional. The consumer of the key is sent to the backend in the API-Consumer generated header.
+	The config manager reloads the file when it changes. Not supported with static bootstrap.`)
+
+	LocalServiceControl = flag.Bool("local_service_control", false, `Send the Check, AllocateQuota and Report calls of the Service Control filter to a local server in the config manager
+	instead of control.environment, for non-GCP deployments. The local server allows all the requests and writes the reported operations as JSON lines
+	to local_service_control_report_path. Not supported with static bootstrap.`)
+	LocalServiceControlPort       = flag.Uint("local_service_control_port", 8792, "Port that configmanager use to setup the local service control server.")
+	LocalServiceControlReportPath = flag.String("local_service_control_report_path", "", `Path to a local file to which the operations reported to the local service control server are appended as JSON lines.
+	If unset, the operations are written to the standard output of the config manager.`)
+
+	JwtOpenIDDiscoveryTimeout         = flag.Duration("jwt_openid_discovery_timeout", 5*time.Second, "The timeout of each OpenID Connect Discovery request for providers without jwks_uri.")
+	JwtOpenIDDiscoveryRetries         = flag.Uint64("jwt_openid_discovery_retries", 3, "The number of retries of a failed OpenID Connect Discovery request, with exponential backoff.")
+	JwtOpenIDDiscoveryInitialInterval = flag.Duration("jwt_openid_discovery_initial_interval", 500*time.Millisecond, "The initial backoff interval between retries of OpenID Connect Discovery requests.")
+	JwtOpenIDJwksUris                 = flag.String("jwt_openid_jwks_uris", "", `Use the jwks_uri instead of OpenID Connect Discovery for providers without jwks_uri, specified as a JSON object
+	of provider ids to jwks_uri, e.g. '{"provider1": "https://issuer.example.com/jwks"}'. Used when the issuer can not be reached while generating config.`)
 
 	ScCheckTimeoutMs  = flag.Int("service_control_check_timeout_ms", 0, `Set the timeout in millisecond for service control Check request. Must be > 0 and the default is 1000 if not set.`)
 	ScQuotaTimeoutMs  = flag.Int("service_control_quota_timeout_ms", 0, `Set the timeout in millisecond for service control Quota request. Must be > 0 and the default is 1000 if not set.`)
@@ -121,64 +235,121 @@ var (
 	TranscodingPreserveProtoFieldNames      = flag.Bool("transcoding_preserve_proto_field_names", false, "Whether to preserve proto field names for grpc-json transcoding")
 	TranscodingIgnoreQueryParameters        = flag.String("transcoding_ignore_query_parameters", "", "A list of query parameters(separated by comma) to be ignored for transcoding method mapping in grpc-json transcoding.")
 	TranscodingIgnoreUnknownQueryParameters = flag.Bool("transcoding_ignore_unknown_query_parameters", false, "Whether to ignore query parameters that cannot be mapped to a corresponding protobuf field in grpc-json transcoding.")
+	TranscodingMatchIncomingRequestRoute    = flag.Bool("transcoding_match_incoming_request_route", false, "Whether to match the gRPC method with the route of the incoming request instead of the one of the gRPC method in grpc-json transcoding, e.g. when the path is rewritten.")
+	TranscodingApiOptionsPath               = flag.String("transcoding_api_options_path", "", `Path to a JSON file with grpc-json transcoding options per api, overriding the transcoding flags.
+	Format: {"rules": [{"api": "API", "preserveProtoFieldNames": true, "alwaysPrintPrimitiveFields": true, "alwaysPrintEnumsAsInts": true, "ignoreUnknownQueryParameters": true, "matchIncomingRequestRoute": true}]}.
+	The options are optional, the unset ones keep the value of the flags. The apis with different options are transcoded by different filters.`)
+	TranscodingProtoDescriptorPath = flag.String("transcoding_proto_descriptor_path", "", "Path of a local proto descriptor set (.pb) for grpc-json transcoding. It is merged into the descriptor sets of the service config, its files replace the ones with the same name.")
 )
 
 func EnvoyConfigOptionsFromFlags() options.ConfigGeneratorOptions {
 	opts := options.ConfigGeneratorOptions{
-		CommonOptions:                           commonflags.DefaultCommonOptionsFromFlags(),
-		BackendAddress:                          *BackendAddress,
-		AccessLog:                               *AccessLog,
-		AccessLogFormat:                         *AccessLogFormat,
-		ComputePlatformOverride:                 *ComputePlatformOverride,
-		CorsAllowCredentials:                    *CorsAllowCredentials,
-		CorsAllowHeaders:                        *CorsAllowHeaders,
-		CorsAllowMethods:                        *CorsAllowMethods,
-		CorsAllowOrigin:                         *CorsAllowOrigin,
-		CorsAllowOriginRegex:                    *CorsAllowOriginRegex,
-		CorsExposeHeaders:                       *CorsExposeHeaders,
-		CorsPreset:                              *CorsPreset,
-		BackendDnsLookupFamily:                  *BackendDnsLookupFamily,
-		ClusterConnectTimeout:                   *ClusterConnectTimeout,
-		ListenerAddress:                         *ListenerAddress,
-		ServiceManagementURL:                    *ServiceManagementURL,
-		ServiceControlURL:                       *ServiceControlURL,
-		ListenerPort:                            *ListenerPort,
-		Healthz:                                 *Healthz,
-		SslSidestreamClientRootCertsPath:        *SslSidestreamClientRootCertsPath,
-		SslBackendClientCertPath:                *SslBackendClientCertPath,
-		SslBackendClientRootCertsPath:           *SslBackendClientRootCertsPath,
-		SslServerCertPath:                       *SslServerCertPath,
-		SslMinimumProtocol:                      *SslMinimumProtocol,
-		SslMaximumProtocol:                      *SslMaximumProtocol,
-		EnableHSTS:                              *EnableHSTS,
-		DnsResolverAddresses:                    *DnsResolverAddresses,
-		ServiceAccountKey:                       *ServiceAccountKey,
-		TokenAgentPort:                          *TokenAgentPort,
-		SkipJwtAuthnFilter:                      *SkipJwtAuthnFilter,
-		SkipServiceControlFilter:                *SkipServiceControlFilter,
-		EnvoyUseRemoteAddress:                   *EnvoyUseRemoteAddress,
-		EnvoyXffNumTrustedHops:                  *EnvoyXffNumTrustedHops,
-		LogJwtPayloads:                          *LogJwtPayloads,
-		LogRequestHeaders:                       *LogRequestHeaders,
-		LogResponseHeaders:                      *LogResponseHeaders,
-		MinStreamReportIntervalMs:               *MinStreamReportIntervalMs,
-		SuppressEnvoyHeaders:                    *SuppressEnvoyHeaders,
-		UnderscoresInHeaders:                    *UnderscoresInHeaders,
-		ServiceControlNetworkFailOpen:           *ServiceControlNetworkFailOpen,
-		EnableGrpcForHttp1:                      *EnableGrpcForHttp1,
-		ConnectionBufferLimitBytes:              *ConnectionBufferLimitBytes,
-		JwksCacheDurationInS:                    *JwksCacheDurationInS,
-		ScCheckTimeoutMs:                        *ScCheckTimeoutMs,
-		ScQuotaTimeoutMs:                        *ScQuotaTimeoutMs,
-		ScReportTimeoutMs:                       *ScReportTimeoutMs,
-		ScCheckRetries:                          *ScCheckRetries,
-		ScQuotaRetries:                          *ScQuotaRetries,
-		ScReportRetries:                         *ScReportRetries,
-		TranscodingAlwaysPrintPrimitiveFields:   *TranscodingAlwaysPrintPrimitiveFields,
-		TranscodingAlwaysPrintEnumsAsInts:       *TranscodingAlwaysPrintEnumsAsInts,
-		TranscodingPreserveProtoFieldNames:      *TranscodingPreserveProtoFieldNames,
-		TranscodingIgnoreQueryParameters:        *TranscodingIgnoreQueryParameters,
-		TranscodingIgnoreUnknownQueryParameters: *TranscodingIgnoreUnknownQueryParameters,
+		CommonOptions:                             commonflags.DefaultCommonOptionsFromFlags(),
+		BackendAddress:                            *BackendAddress,
+		BackendWeights:                            *BackendWeights,
+		BackendLbPolicy:                           *BackendLbPolicy,
+		BackendLbHashHeader:                       *BackendLbHashHeader,
+		AccessLog:                                 *AccessLog,
+		AccessLogFormat:                           *AccessLogFormat,
+		AccessLogJsonFormat:                       *AccessLogJsonFormat,
+		AccessLogGrpcServiceAddress:               *AccessLogGrpcServiceAddress,
+		AccessLogMinStatusCode:                    *AccessLogMinStatusCode,
+		AccessLogMaxStatusCode:                    *AccessLogMaxStatusCode,
+		AccessLogSamplePercent:                    *AccessLogSamplePercent,
+		AccessLogExcludeHealthz:                   *AccessLogExcludeHealthz,
+		ComputePlatformOverride:                   *ComputePlatformOverride,
+		CorsAllowCredentials:                      *CorsAllowCredentials,
+		CorsAllowHeaders:                          *CorsAllowHeaders,
+		CorsAllowMethods:                          *CorsAllowMethods,
+		CorsAllowOrigin:                           *CorsAllowOrigin,
+		CorsAllowOriginRegex:                      *CorsAllowOriginRegex,
+		CorsExposeHeaders:                         *CorsExposeHeaders,
+		CorsPreset:                                *CorsPreset,
+		CorsPolicyPath:                            *CorsPolicyPath,
+		RouteConflicts:                            *RouteConflicts,
+		RouteTableMode:                            *RouteTableMode,
+		BackendDnsLookupFamily:                    *BackendDnsLookupFamily,
+		BackendCircuitBreakerMaxConnections:       *BackendCircuitBreakerMaxConnections,
+		BackendCircuitBreakerMaxPendingRequests:   *BackendCircuitBreakerMaxPendingRequests,
+		BackendCircuitBreakerMaxRequests:          *BackendCircuitBreakerMaxRequests,
+		BackendCircuitBreakerMaxRetries:           *BackendCircuitBreakerMaxRetries,
+		BackendOutlierDetectionConsecutive5xx:     *BackendOutlierDetectionConsecutive5xx,
+		BackendOutlierDetectionInterval:           *BackendOutlierDetectionInterval,
+		BackendOutlierDetectionBaseEjectionTime:   *BackendOutlierDetectionBaseEjectionTime,
+		BackendOutlierDetectionMaxEjectionPercent: *BackendOutlierDetectionMaxEjectionPercent,
+		BackendHealthCheck:                        *BackendHealthCheck,
+		BackendHealthCheckPath:                    *BackendHealthCheckPath,
+		BackendHealthCheckGrpcServiceName:         *BackendHealthCheckGrpcServiceName,
+		BackendHealthCheckInterval:                *BackendHealthCheckInterval,
+		BackendHealthCheckTimeout:                 *BackendHealthCheckTimeout,
+		BackendHealthCheckHealthyThreshold:        *BackendHealthCheckHealthyThreshold,
+		BackendHealthCheckUnhealthyThreshold:      *BackendHealthCheckUnhealthyThreshold,
+		BackendTrafficPolicyPath:                  *BackendTrafficPolicyPath,
+		BackendShadowAddress:                      *BackendShadowAddress,
+		BackendShadowPercent:                      *BackendShadowPercent,
+		BackendShadowOperations:                   *BackendShadowOperations,
+		BackendCanaryRulesPath:                    *BackendCanaryRulesPath,
+		ClusterConnectTimeout:                     *ClusterConnectTimeout,
+		ListenerAddress:                           *ListenerAddress,
+		ServiceManagementURL:                      *ServiceManagementURL,
+		ServiceControlURL:                         *ServiceControlURL,
+		ListenerPort:                              *ListenerPort,
+		Healthz:                                   *Healthz,
+		HealthzCheckLocalBackend:                  *HealthzCheckLocalBackend,
+		HealthzGrpcHealthCheck:                    *HealthzGrpcHealthCheck,
+		HealthzGrpcCacheInterval:                  *HealthzGrpcCacheInterval,
+		SslSidestreamClientRootCertsPath:          *SslSidestreamClientRootCertsPath,
+		SslBackendClientCertPath:                  *SslBackendClientCertPath,
+		SslBackendClientRootCertsPath:             *SslBackendClientRootCertsPath,
+		SslServerCertPath:                         *SslServerCertPath,
+		SslMinimumProtocol:                        *SslMinimumProtocol,
+		SslMaximumProtocol:                        *SslMaximumProtocol,
+		EnableHSTS:                                *EnableHSTS,
+		DnsResolverAddresses:                      *DnsResolverAddresses,
+		ServiceAccountKey:                         *ServiceAccountKey,
+		TokenAgentPort:                            *TokenAgentPort,
+		SkipJwtAuthnFilter:                        *SkipJwtAuthnFilter,
+		SkipServiceControlFilter:                  *SkipServiceControlFilter,
+		EnvoyUseRemoteAddress:                     *EnvoyUseRemoteAddress,
+		EnvoyXffNumTrustedHops:                    *EnvoyXffNumTrustedHops,
+		LogJwtPayloads:                            *LogJwtPayloads,
+		LogRequestHeaders:                         *LogRequestHeaders,
+		LogResponseHeaders:                        *LogResponseHeaders,
+		MinStreamReportIntervalMs:                 *MinStreamReportIntervalMs,
+		SuppressEnvoyHeaders:                      *SuppressEnvoyHeaders,
+		UnderscoresInHeaders:                      *UnderscoresInHeaders,
+		ServiceControlNetworkFailOpen:             *ServiceControlNetworkFailOpen,
+		EnableGrpcForHttp1:                        *EnableGrpcForHttp1,
+		ConnectionBufferLimitBytes:                *ConnectionBufferLimitBytes,
+		EnableOperationStats:                      *EnableOperationStats,
+		MaxOperationStats:                         *MaxOperationStats,
+		JwksCacheDurationInS:                      *JwksCacheDurationInS,
+		JwtLocalJwks:                              *JwtLocalJwks,
+		JwtClaimsPolicyPath:                       *JwtClaimsPolicyPath,
+		JwtClaimHeaders:                           *JwtClaimHeaders,
+		JwtRequirementModesPath:                   *JwtRequirementModesPath,
+		ApiKeysPath:                               *ApiKeysPath,
+		LocalServiceControl:                       *LocalServiceControl,
+		LocalServiceControlPort:                   *LocalServiceControlPort,
+		LocalServiceControlReportPath:             *LocalServiceControlReportPath,
+		JwtOpenIDDiscoveryTimeout:                 *JwtOpenIDDiscoveryTimeout,
+		JwtOpenIDDiscoveryRetries:                 *JwtOpenIDDiscoveryRetries,
+		JwtOpenIDDiscoveryInitialInterval:         *JwtOpenIDDiscoveryInitialInterval,
+		JwtOpenIDJwksUris:                         *JwtOpenIDJwksUris,
+		ScCheckTimeoutMs:                          *ScCheckTimeoutMs,
+		ScQuotaTimeoutMs:                          *ScQuotaTimeoutMs,
+		ScReportTimeoutMs:                         *ScReportTimeoutMs,
+		ScCheckRetries:                            *ScCheckRetries,
+		ScQuotaRetries:                            *ScQuotaRetries,
+		ScReportRetries:                           *ScReportRetries,
+		TranscodingAlwaysPrintPrimitiveFields:     *TranscodingAlwaysPrintPrimitiveFields,
+		TranscodingAlwaysPrintEnumsAsInts:         *TranscodingAlwaysPrintEnumsAsInts,
+		TranscodingPreserveProtoFieldNames:        *TranscodingPreserveProtoFieldNames,
+		TranscodingIgnoreQueryParameters:          *TranscodingIgnoreQueryParameters,
+		TranscodingIgnoreUnknownQueryParameters:   *TranscodingIgnoreUnknownQueryParameters,
+		TranscodingMatchIncomingRequestRoute:      *TranscodingMatchIncomingRequestRoute,
+		TranscodingApiOptionsPath:                 *TranscodingApiOptionsPath,
+		TranscodingProtoDescriptorPath:            *TranscodingProtoDescriptorPath,
 	}
 
 	glog.Infof("Config Generator options: %+v", opts)
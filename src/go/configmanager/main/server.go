@@ -24,14 +24,17 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/apikeyserver"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/configmanager"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/configmanager/flags"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/metadata"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/servicecontrolserver"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/tokengenerator"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
 	"github.com/golang/glog"
 	"google.golang.org/grpc"
 
+	authgrpc "github.com/envoyproxy/go-control-plane/envoy/service/auth/v2"
 	discoverygrpc "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 	xds "github.com/envoyproxy/go-control-plane/pkg/server/v3"
 )
@@ -64,6 +67,16 @@ func main() {
 	// Register Envoy discovery services.
 	discoverygrpc.RegisterAggregatedDiscoveryServiceServer(grpcServer, server)
 
+	if opts.ApiKeysPath != "" {
+		// Register the API key server for the ext_authz filter, with the same
+		// address as the discovery services.
+		apiKeyServer, err := apikeyserver.NewApiKeyServer(opts.ApiKeysPath, opts.GeneratedHeaderPrefix+util.ApiKeyConsumerHeaderSuffix, opts.EnvoyXffNumTrustedHops, *configmanager.CheckApiKeysInterval)
+		if err != nil {
+			glog.Exitf("fail to initialize API key server: %v", err)
+		}
+		authgrpc.RegisterAuthorizationServer(grpcServer, apiKeyServer)
+	}
+
 	fmt.Printf("config manager server is running at %s .......\n", lis.Addr())
 
 	// Handle signals gracefully
@@ -91,6 +104,32 @@ func main() {
 
 	}
 
+	if opts.LocalServiceControl {
+		// Setup local service control server
+		sink, err := servicecontrolserver.NewFileSink(opts.LocalServiceControlReportPath)
+		if err != nil {
+			glog.Exitf("fail to initialize local service control server: %v", err)
+		}
+		r := servicecontrolserver.MakeServiceControlHandler(sink)
+		go func() {
+			err := http.ListenAndServe(fmt.Sprintf("%s:%v", util.LoopbackIPv4Addr, opts.LocalServiceControlPort), r)
+			if err != nil {
+				glog.Errorf("local service control server fail to serve: %v", err)
+			}
+		}()
+	}
+
+	if *configmanager.StatusPort != 0 {
+		// Setup status server
+		r := m.StatusHandler()
+		go func() {
+			err := http.ListenAndServe(fmt.Sprintf("%s:%v", util.LoopbackIPv4Addr, *configmanager.StatusPort), r)
+			if err != nil {
+				glog.Errorf("status server fail to serve: %v", err)
+			}
+		}()
+	}
+
 	if err := grpcServer.Serve(lis); err != nil {
 		glog.Exitf("Server fail to serve: %v", err)
 	}
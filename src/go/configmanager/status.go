@@ -0,0 +1,58 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configmanager
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/configinfo"
+	"github.com/gorilla/mux"
+)
+
+const StatusRoutesPath = "/status/routes"
+
+// RoutesStatus is the status of the routes of the current service config.
+type RoutesStatus struct {
+	ServiceName     string                  `json:"serviceName"`
+	ServiceConfigId string                  `json:"serviceConfigId"`
+	RouteReport     *configinfo.RouteReport `json:"routeReport"`
+}
+
+// StatusHandler creates the handler of the status server of the config
+// manager. It serves the report of the route analysis of the current service
+// config as JSON at GET /status/routes.
+func (m *ConfigManager) StatusHandler() http.Handler {
+	r := mux.NewRouter()
+	r.Path(StatusRoutesPath).Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		status := &RoutesStatus{}
+		if m.serviceInfo != nil {
+			status.ServiceName = m.serviceInfo.Name
+			status.ServiceConfigId = m.serviceInfo.ConfigID
+			status.RouteReport = m.serviceInfo.RouteReport
+		}
+		body, err := json.Marshal(status)
+		m.mu.Unlock()
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	})
+	return r
+}
@@ -30,6 +30,8 @@ type CommonOptions struct {
 
 	// Flags for tracing
 	DisableTracing             bool
+	TracingProvider            string
+	TracingCollectorAddress    string
 	TracingProjectId           string
 	TracingStackdriverAddress  string
 	TracingSamplingRate        float64
@@ -40,6 +42,14 @@ type CommonOptions struct {
 	TracingMaxNumMessageEvents int64
 	TracingMaxNumLinks         int64
 
+	// Flags for metrics
+	StatsSink        string
+	StatsSinkAddress string
+	StatsPrefix      string
+	StatsTags        string
+	MetricsAddress   string
+	MetricsPort      int
+
 	// Flags for metadata
 	NonGCP             bool
 	HttpRequestTimeout time.Duration
@@ -85,11 +95,14 @@ func DefaultCommonOptions() CommonOptions {
 		HttpRequestTimeout: 30 * time.Second,
 
 		Node:                       "ESPv2",
+		TracingProvider:            "stackdriver",
 		TracingSamplingRate:        0.001,
 		TracingMaxNumAttributes:    32,
 		TracingMaxNumAnnotations:   32,
 		TracingMaxNumMessageEvents: 128,
 		TracingMaxNumLinks:         128,
+		StatsSinkAddress:           "127.0.0.1:8125",
+		MetricsAddress:             "0.0.0.0",
 		MetadataURL:                "http://169.254.169.254",
 		IamURL:                     "https://iamcredentials.googleapis.com",
 		GeneratedHeaderPrefix:      "X-Endpoint-",
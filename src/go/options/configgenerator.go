@@ -35,18 +35,69 @@ type ConfigGeneratorOptions struct {
 	CorsExposeHeaders    string
 	CorsPreset           string
 
+	// Path to the file with per API or per operation CORS policies.
+	CorsPolicyPath string
+
+	// Either "warn" or "fail", what to do with routes shadowed by the routes
+	// of another operation.
+	RouteConflicts string
+	// Either "flat" or "grouped", how the routes of the http rules are made.
+	RouteTableMode string
+
 	// Backend routing configurations.
 	BackendDnsLookupFamily string
 
+	// Backend cluster circuit breaker thresholds. Negative values keep the Envoy defaults.
+	BackendCircuitBreakerMaxConnections     int
+	BackendCircuitBreakerMaxPendingRequests int
+	BackendCircuitBreakerMaxRequests        int
+	BackendCircuitBreakerMaxRetries         int
+
+	// Backend cluster outlier detection. Disabled when BackendOutlierDetectionConsecutive5xx is 0.
+	BackendOutlierDetectionConsecutive5xx     int
+	BackendOutlierDetectionInterval           time.Duration
+	BackendOutlierDetectionBaseEjectionTime   time.Duration
+	BackendOutlierDetectionMaxEjectionPercent int
+
+	// Backend cluster active health checks. Disabled when BackendHealthCheck is empty,
+	// otherwise it is either "http" or "grpc".
+	BackendHealthCheck                   string
+	BackendHealthCheckPath               string
+	BackendHealthCheckGrpcServiceName    string
+	BackendHealthCheckInterval           time.Duration
+	BackendHealthCheckTimeout            time.Duration
+	BackendHealthCheckHealthyThreshold   int
+	BackendHealthCheckUnhealthyThreshold int
+
+	// Path to the file with per backend address overrides of the traffic policies above.
+	BackendTrafficPolicyPath string
+
+	// Mirror requests to a secondary backend, for all operations or the comma separated
+	// operation selectors in BackendShadowOperations.
+	BackendShadowAddress    string
+	BackendShadowPercent    int
+	BackendShadowOperations string
+
+	// Path to the file with canary rules that route some requests of an operation
+	// to an alternate backend.
+	BackendCanaryRulesPath string
+
 	// Envoy specific configurations.
 	ClusterConnectTimeout time.Duration
 
-	// Full URI to the backend: scheme, address/hostname, port
-	BackendAddress string
+	// Full URI to the backend: scheme, address/hostname, port.
+	// Multiple comma separated URIs are load balanced with BackendWeights and BackendLbPolicy.
+	BackendAddress      string
+	BackendWeights      string
+	BackendLbPolicy     string
+	BackendLbHashHeader string
 
 	// Network related configurations.
 	ListenerAddress                  string
 	Healthz                          string
+	HealthzCheckLocalBackend         bool
+	HealthzGrpcHealthCheck           bool
+	HealthzGrpcCacheInterval         time.Duration
 	ServiceManagementURL             string
 	ServiceControlURL                string
 	ListenerPort                     int
@@ -68,8 +119,14 @@ type ConfigGeneratorOptions struct {
 	SkipServiceControlFilter bool
 
 	// Envoy configurations.
-	AccessLog       string
-	AccessLogFormat string
+	AccessLog                   string
+	AccessLogFormat             string
+	AccessLogJsonFormat         string
+	AccessLogGrpcServiceAddress string
+	AccessLogMinStatusCode      int
+	AccessLogMaxStatusCode      int
+	AccessLogSamplePercent      int
+	AccessLogExcludeHealthz     bool
 
 	EnvoyUseRemoteAddress  bool
 	EnvoyXffNumTrustedHops int
@@ -85,7 +142,26 @@ type ConfigGeneratorOptions struct {
 	EnableGrpcForHttp1            bool
 	ConnectionBufferLimitBytes    int
 
+	EnableOperationStats bool
+	MaxOperationStats    int
+
 	JwksCacheDurationInS int
+	JwtLocalJwks         string
+	JwtClaimsPolicyPath  string
+	JwtClaimHeaders      string
+
+	JwtRequirementModesPath string
+
+	ApiKeysPath string
+
+	LocalServiceControl           bool
+	LocalServiceControlPort       uint
+	LocalServiceControlReportPath string
+
+	JwtOpenIDDiscoveryTimeout         time.Duration
+	JwtOpenIDDiscoveryRetries         uint64
+	JwtOpenIDDiscoveryInitialInterval time.Duration
+	JwtOpenIDJwksUris                 string
 
 	ScCheckTimeoutMs  int
 	ScQuotaTimeoutMs  int
@@ -102,6 +178,12 @@ type ConfigGeneratorOptions struct {
 	TranscodingPreserveProtoFieldNames      bool
 	TranscodingIgnoreQueryParameters        string
 	TranscodingIgnoreUnknownQueryParameters bool
+	TranscodingMatchIncomingRequestRoute    bool
+	// Per-api overrides of the transcoding options.
+	TranscodingApiOptionsPath string
+	// Local proto descriptor set merged into the ones of the service config,
+	// its files replace the ones with the same name.
+	TranscodingProtoDescriptorPath string
 }
 
 // DefaultConfigGeneratorOptions returns ConfigGeneratorOptions with default values.
@@ -110,25 +192,48 @@ type ConfigGeneratorOptions struct {
 func DefaultConfigGeneratorOptions() ConfigGeneratorOptions {
 
 	return ConfigGeneratorOptions{
-		CommonOptions:                    DefaultCommonOptions(),
-		BackendDnsLookupFamily:           "auto",
-		BackendAddress:                   fmt.Sprintf("http://%s:8082", util.LoopbackIPv4Addr),
-		ClusterConnectTimeout:            20 * time.Second,
-		EnvoyXffNumTrustedHops:           2,
-		JwksCacheDurationInS:             300,
-		ListenerAddress:                  "0.0.0.0",
-		ListenerPort:                     8080,
-		TokenAgentPort:                   8791,
-		SslSidestreamClientRootCertsPath: util.DefaultRootCAPaths,
-		SslBackendClientRootCertsPath:    util.DefaultRootCAPaths,
-		SuppressEnvoyHeaders:             true,
-		ServiceControlNetworkFailOpen:    true,
-		EnableGrpcForHttp1:               true,
-		ConnectionBufferLimitBytes:       -1,
-		ServiceManagementURL:             "https://servicemanagement.googleapis.com",
-		ServiceControlURL:                "https://servicecontrol.googleapis.com",
-		ScCheckRetries:                   -1,
-		ScQuotaRetries:                   -1,
-		ScReportRetries:                  -1,
+		CommonOptions:                             DefaultCommonOptions(),
+		BackendDnsLookupFamily:                    "auto",
+		BackendCircuitBreakerMaxConnections:       -1,
+		BackendCircuitBreakerMaxPendingRequests:   -1,
+		BackendCircuitBreakerMaxRequests:          -1,
+		BackendCircuitBreakerMaxRetries:           -1,
+		BackendOutlierDetectionInterval:           10 * time.Second,
+		BackendOutlierDetectionBaseEjectionTime:   30 * time.Second,
+		BackendOutlierDetectionMaxEjectionPercent: 10,
+		BackendHealthCheckPath:                    "/",
+		BackendHealthCheckInterval:                10 * time.Second,
+		BackendHealthCheckTimeout:                 5 * time.Second,
+		BackendHealthCheckHealthyThreshold:        2,
+		BackendHealthCheckUnhealthyThreshold:      3,
+		BackendAddress:                            fmt.Sprintf("http://%s:8082", util.LoopbackIPv4Addr),
+		BackendLbPolicy:                           "round_robin",
+		BackendShadowPercent:                      100,
+		AccessLogSamplePercent:                    100,
+		ClusterConnectTimeout:                     20 * time.Second,
+		EnvoyXffNumTrustedHops:                    2,
+		JwksCacheDurationInS:                      300,
+		JwtOpenIDDiscoveryTimeout:                 5 * time.Second,
+		JwtOpenIDDiscoveryRetries:                 3,
+		JwtOpenIDDiscoveryInitialInterval:         500 * time.Millisecond,
+		ListenerAddress:                           "0.0.0.0",
+		ListenerPort:                              8080,
+		RouteConflicts:                            "warn",
+		RouteTableMode:                            "flat",
+		HealthzGrpcCacheInterval:                  time.Second,
+		TokenAgentPort:                            8791,
+		LocalServiceControlPort:                   8792,
+		SslSidestreamClientRootCertsPath:          util.DefaultRootCAPaths,
+		SslBackendClientRootCertsPath:             util.DefaultRootCAPaths,
+		SuppressEnvoyHeaders:                      true,
+		ServiceControlNetworkFailOpen:             true,
+		EnableGrpcForHttp1:                        true,
+		ConnectionBufferLimitBytes:                -1,
+		MaxOperationStats:                         100,
+		ServiceManagementURL:                      "https://servicemanagement.googleapis.com",
+		ServiceControlURL:                         "https://servicecontrol.googleapis.com",
+		ScCheckRetries:                            -1,
+		ScQuotaRetries:                            -1,
+		ScReportRetries:                           -1,
 	}
 }
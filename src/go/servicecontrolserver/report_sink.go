@@ -0,0 +1,92 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package servicecontrolserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/golang/protobuf/jsonpb"
+
+	scpb "google.golang.org/genproto/googleapis/api/servicecontrol/v1"
+)
+
+// ReportSink receives the operations reported to the local Service Control
+// server, with their metrics and log entries.
+type ReportSink interface {
+	Report(serviceName string, req *scpb.ReportRequest) error
+}
+
+// reportLine is a line written by the JSON lines sink, one per operation.
+type reportLine struct {
+	ServiceName     string          `json:"serviceName"`
+	ServiceConfigId string          `json:"serviceConfigId,omitempty"`
+	Operation       json.RawMessage `json:"operation"`
+}
+
+type jsonLinesSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJsonLinesSink writes each reported operation as a line of JSON to w.
+func NewJsonLinesSink(w io.Writer) ReportSink {
+	return &jsonLinesSink{
+		w: w,
+	}
+}
+
+// NewFileSink appends the reported operations as JSON lines to the file at
+// the path, or writes them to the standard output if the path is empty.
+func NewFileSink(path string) (ReportSink, error) {
+	if path == "" {
+		return NewJsonLinesSink(os.Stdout), nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("fail to open report file: %v", err)
+	}
+	return NewJsonLinesSink(f), nil
+}
+
+func (s *jsonLinesSink) Report(serviceName string, req *scpb.ReportRequest) error {
+	marshaler := &jsonpb.Marshaler{}
+	var lines []byte
+	for _, operation := range req.GetOperations() {
+		operationJson, err := marshaler.MarshalToString(operation)
+		if err != nil {
+			return fmt.Errorf("fail to marshal operation %s: %v", operation.GetOperationId(), err)
+		}
+		line, err := json.Marshal(&reportLine{
+			ServiceName:     serviceName,
+			ServiceConfigId: req.GetServiceConfigId(),
+			Operation:       json.RawMessage(operationJson),
+		})
+		if err != nil {
+			return fmt.Errorf("fail to marshal operation %s: %v", operation.GetOperationId(), err)
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+
+	// The operations of a request are written at once, so that the lines of
+	// concurrent reports are not interleaved.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.w.Write(lines)
+	return err
+}
@@ -0,0 +1,121 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package servicecontrolserver implements a local Service Control server for
+// the Service Control filter on non-GCP deployments. It allows all the check
+// and quota requests, and sends the reported operations to a ReportSink.
+package servicecontrolserver
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	"github.com/gorilla/mux"
+
+	scpb "google.golang.org/genproto/googleapis/api/servicecontrol/v1"
+)
+
+const (
+	// The access token served to the Service Control filter, it is not
+	// checked by the local server.
+	localAccessToken = "local-service-control"
+
+	// The lifetime of the access token in seconds.
+	localAccessTokenExpiresIn = 3600
+)
+
+// MakeServiceControlHandler creates the handler of the local Service Control
+// server, with the same API as Service Control:
+//
+//	POST /v1/services/{service}:check
+//	POST /v1/services/{service}:allocateQuota
+//	POST /v1/services/{service}:report
+//
+// The requests and responses are binary protobuf messages. It also serves the
+// access token of the Service Control filter at GET /local/access_token.
+func MakeServiceControlHandler(sink ReportSink) http.Handler {
+	r := mux.NewRouter()
+
+	r.Path("/v1/services/{service}:check").Methods("POST").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &scpb.CheckRequest{}
+		if !readRequest(w, r, req) {
+			return
+		}
+		writeResponse(w, &scpb.CheckResponse{
+			OperationId:     req.GetOperation().GetOperationId(),
+			ServiceConfigId: req.GetServiceConfigId(),
+		})
+	})
+
+	r.Path("/v1/services/{service}:allocateQuota").Methods("POST").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &scpb.AllocateQuotaRequest{}
+		if !readRequest(w, r, req) {
+			return
+		}
+		writeResponse(w, &scpb.AllocateQuotaResponse{
+			OperationId:     req.GetAllocateOperation().GetOperationId(),
+			ServiceConfigId: req.GetServiceConfigId(),
+		})
+	})
+
+	r.Path("/v1/services/{service}:report").Methods("POST").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &scpb.ReportRequest{}
+		if !readRequest(w, r, req) {
+			return
+		}
+		if err := sink.Report(mux.Vars(r)["service"], req); err != nil {
+			glog.Errorf("local service control fail to report %d operations: %v", len(req.GetOperations()), err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeResponse(w, &scpb.ReportResponse{
+			ServiceConfigId: req.GetServiceConfigId(),
+		})
+	})
+
+	r.Path(util.TokenAgentAccessTokenPath).Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(fmt.Sprintf(`{"access_token": "%s", "expires_in": %v}`, localAccessToken, localAccessTokenExpiresIn)))
+	})
+
+	return r
+}
+
+// readRequest unmarshals the binary protobuf request, and replies with an
+// error if it fails.
+func readRequest(w http.ResponseWriter, r *http.Request, req proto.Message) bool {
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = proto.Unmarshal(body, req)
+	}
+	if err != nil {
+		glog.Errorf("local service control fail to read request %s: %v", r.URL.Path, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeResponse(w http.ResponseWriter, resp proto.Message) {
+	body, err := proto.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	_, _ = w.Write(body)
+}
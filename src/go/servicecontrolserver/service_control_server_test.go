@@ -0,0 +1,213 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package servicecontrolserver
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
+	"github.com/golang/protobuf/proto"
+
+	scpb "google.golang.org/genproto/googleapis/api/servicecontrol/v1"
+)
+
+const testServiceName = "bookstore.endpoints.project123.cloud.goog"
+
+type fakeSink struct {
+	serviceName string
+	reqs        []*scpb.ReportRequest
+	err         error
+}
+
+func (s *fakeSink) Report(serviceName string, req *scpb.ReportRequest) error {
+	s.serviceName = serviceName
+	s.reqs = append(s.reqs, req)
+	return s.err
+}
+
+func post(t *testing.T, url string, req proto.Message) (int, []byte) {
+	body, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(url, "application/x-protobuf", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, respBody
+}
+
+func TestServiceControlHandler(t *testing.T) {
+	sink := &fakeSink{}
+	s := httptest.NewServer(MakeServiceControlHandler(sink))
+	defer s.Close()
+	url := fmt.Sprintf("%s/v1/services/%s", s.URL, testServiceName)
+
+	testData := []struct {
+		desc     string
+		path     string
+		req      proto.Message
+		wantResp proto.Message
+	}{
+		{
+			desc: "Check is allowed",
+			path: ":check",
+			req: &scpb.CheckRequest{
+				ServiceName:     testServiceName,
+				ServiceConfigId: "2020-01-01r0",
+				Operation: &scpb.Operation{
+					OperationId:   "operation-1",
+					OperationName: "endpoints.examples.bookstore.Bookstore.GetBook",
+				},
+			},
+			wantResp: &scpb.CheckResponse{
+				OperationId:     "operation-1",
+				ServiceConfigId: "2020-01-01r0",
+			},
+		},
+		{
+			desc: "Quota is allowed",
+			path: ":allocateQuota",
+			req: &scpb.AllocateQuotaRequest{
+				ServiceName:     testServiceName,
+				ServiceConfigId: "2020-01-01r0",
+				AllocateOperation: &scpb.QuotaOperation{
+					OperationId: "operation-2",
+					MethodName:  "endpoints.examples.bookstore.Bookstore.GetBook",
+				},
+			},
+			wantResp: &scpb.AllocateQuotaResponse{
+				OperationId:     "operation-2",
+				ServiceConfigId: "2020-01-01r0",
+			},
+		},
+		{
+			desc: "Report is sent to the sink",
+			path: ":report",
+			req: &scpb.ReportRequest{
+				ServiceName:     testServiceName,
+				ServiceConfigId: "2020-01-01r0",
+				Operations: []*scpb.Operation{
+					{
+						OperationId: "operation-3",
+					},
+				},
+			},
+			wantResp: &scpb.ReportResponse{
+				ServiceConfigId: "2020-01-01r0",
+			},
+		},
+	}
+
+	for _, tc := range testData {
+		code, body := post(t, url+tc.path, tc.req)
+		if code != http.StatusOK {
+			t.Errorf("Test Desc(%s): got status %d, want %d", tc.desc, code, http.StatusOK)
+			continue
+		}
+		gotResp := proto.Clone(tc.wantResp)
+		gotResp.Reset()
+		if err := proto.Unmarshal(body, gotResp); err != nil {
+			t.Errorf("Test Desc(%s): fail to unmarshal response: %v", tc.desc, err)
+			continue
+		}
+		if !proto.Equal(gotResp, tc.wantResp) {
+			t.Errorf("Test Desc(%s): got response %v, want %v", tc.desc, gotResp, tc.wantResp)
+		}
+	}
+
+	if sink.serviceName != testServiceName || len(sink.reqs) != 1 || sink.reqs[0].GetOperations()[0].GetOperationId() != "operation-3" {
+		t.Errorf("got reports %v of service %s, want operation-3 of service %s", sink.reqs, sink.serviceName, testServiceName)
+	}
+
+	// Invalid requests are rejected.
+	resp, err := http.Post(url+":check", "application/x-protobuf", strings.NewReader("invalid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid check request got status %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+
+	// Reports that fail to be written are retried by the filter.
+	sink.err = fmt.Errorf("disk full")
+	if code, _ := post(t, url+":report", &scpb.ReportRequest{}); code != http.StatusInternalServerError {
+		t.Errorf("failed report got status %d, want %d", code, http.StatusInternalServerError)
+	}
+
+	resp, err = http.Get(s.URL + util.TokenAgentAccessTokenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	wantToken := `{"access_token": "local-service-control", "expires_in": 3600}`
+	if string(body) != wantToken {
+		t.Errorf("got access token %s, want %s", body, wantToken)
+	}
+}
+
+func TestJsonLinesSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJsonLinesSink(&buf)
+
+	req := &scpb.ReportRequest{
+		ServiceConfigId: "2020-01-01r0",
+		Operations: []*scpb.Operation{
+			{
+				OperationId:   "operation-1",
+				OperationName: "endpoints.examples.bookstore.Bookstore.GetBook",
+				ConsumerId:    "api_key:key-0",
+			},
+			{
+				OperationId: "operation-2",
+				LogEntries: []*scpb.LogEntry{
+					{
+						Name: "endpoints_log",
+					},
+				},
+			},
+		},
+	}
+	if err := sink.Report(testServiceName, req); err != nil {
+		t.Fatal(err)
+	}
+
+	wantLines := []string{
+		`{"serviceName":"bookstore.endpoints.project123.cloud.goog","serviceConfigId":"2020-01-01r0","operation":{"operationId":"operation-1","operationName":"endpoints.examples.bookstore.Bookstore.GetBook","consumerId":"api_key:key-0"}}`,
+		`{"serviceName":"bookstore.endpoints.project123.cloud.goog","serviceConfigId":"2020-01-01r0","operation":{"operationId":"operation-2","logEntries":[{"name":"endpoints_log"}]}}`,
+	}
+	gotLines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(gotLines) != len(wantLines) {
+		t.Fatalf("got %d lines, want %d: %s", len(gotLines), len(wantLines), buf.String())
+	}
+	for i := range wantLines {
+		if err := util.JsonEqual(wantLines[i], gotLines[i]); err != nil {
+			t.Errorf("line %d: %v", i, err)
+		}
+	}
+}
@@ -21,15 +21,30 @@ import (
 
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/metadata"
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/options"
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
 	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
 
 	opencensuspb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+	corepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	tracepb "github.com/envoyproxy/go-control-plane/envoy/config/trace/v3"
 	hcmpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
 	typepb "github.com/envoyproxy/go-control-plane/envoy/type/v3"
 )
 
+const (
+	// StackdriverProvider exports spans to Stackdriver Trace with the OpenCensus tracer.
+	StackdriverProvider = "stackdriver"
+	// OpenCensusAgentProvider exports spans to an OpenCensus agent, or to a
+	// collector with an opencensus receiver such as the OpenTelemetry collector.
+	OpenCensusAgentProvider = "opencensus_agent"
+	// ZipkinProvider exports spans to a Zipkin collector.
+	ZipkinProvider = "zipkin"
+
+	defaultZipkinCollectorEndpoint = "/api/v2/spans"
+)
+
 func createTraceContexts(ctx_str string) ([]tracepb.OpenCensusConfig_TraceContext, error) {
 	var out []tracepb.OpenCensusConfig_TraceContext
 
@@ -70,12 +85,7 @@ func getTracingProjectId(opts options.CommonOptions) (string, error) {
 	return metadata.NewMetadataFetcher(opts).FetchProjectId()
 }
 
-func createOpenCensusConfig(opts options.CommonOptions) (*tracepb.OpenCensusConfig, error) {
-	projectId, err := getTracingProjectId(opts)
-	if err != nil {
-		return nil, err
-	}
-
+func createOpenCensusConfig(opts options.CommonOptions, rootCertsPath string) (*tracepb.OpenCensusConfig, error) {
 	cfg := &tracepb.OpenCensusConfig{
 		TraceConfig: &opencensuspb.TraceConfig{
 			MaxNumberOfAttributes:    opts.TracingMaxNumAttributes,
@@ -83,12 +93,26 @@ func createOpenCensusConfig(opts options.CommonOptions) (*tracepb.OpenCensusConf
 			MaxNumberOfMessageEvents: opts.TracingMaxNumMessageEvents,
 			MaxNumberOfLinks:         opts.TracingMaxNumLinks,
 		},
-		StackdriverExporterEnabled: true,
-		StackdriverProjectId:       projectId,
 	}
 
-	if opts.TracingStackdriverAddress != "" {
-		cfg.StackdriverAddress = opts.TracingStackdriverAddress
+	if opts.TracingProvider == OpenCensusAgentProvider {
+		grpcService, err := createCollectorGrpcService(opts.TracingCollectorAddress, rootCertsPath)
+		if err != nil {
+			return nil, err
+		}
+		cfg.OcagentExporterEnabled = true
+		cfg.OcagentGrpcService = grpcService
+	} else {
+		projectId, err := getTracingProjectId(opts)
+		if err != nil {
+			return nil, err
+		}
+		cfg.StackdriverExporterEnabled = true
+		cfg.StackdriverProjectId = projectId
+
+		if opts.TracingStackdriverAddress != "" {
+			cfg.StackdriverAddress = opts.TracingStackdriverAddress
+		}
 	}
 
 	if ctx, err := createTraceContexts(opts.TracingIncomingContext); err == nil {
@@ -109,15 +133,109 @@ func createOpenCensusConfig(opts options.CommonOptions) (*tracepb.OpenCensusConf
 	return cfg, nil
 }
 
-// CreateTracing outputs envoy HCM tracing config.
-func CreateTracing(opts options.CommonOptions) (*hcmpb.HttpConnectionManager_Tracing, error) {
+// createCollectorGrpcService creates the gRPC service of the OpenCensus agent exporter.
+// The OpenCensus tracer only supports Google gRPC for the agent, so it connects by
+// itself instead of through a cluster, and verifies TLS with the root certs file.
+func createCollectorGrpcService(address, rootCertsPath string) (*corepb.GrpcService, error) {
+	if address == "" {
+		return nil, fmt.Errorf("tracing_collector_address must be set for tracing provider %s", OpenCensusAgentProvider)
+	}
+	scheme, hostname, port, path, err := util.ParseURI(address)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing tracing collector address: %v", err)
+	}
+	if path != "" {
+		return nil, fmt.Errorf("tracing collector address for provider %s should not have path part: %s", OpenCensusAgentProvider, address)
+	}
+	protocol, tls, err := util.ParseBackendProtocol(scheme, "")
+	if err != nil {
+		return nil, err
+	}
+	if protocol != util.GRPC {
+		return nil, fmt.Errorf("tracing collector address for provider %s must use grpc or grpcs scheme: %s", OpenCensusAgentProvider, address)
+	}
 
-	openCensusConfig, err := createOpenCensusConfig(opts)
+	googleGrpc := &corepb.GrpcService_GoogleGrpc{
+		TargetUri:  fmt.Sprintf("%s:%d", hostname, port),
+		StatPrefix: "opencensus_agent",
+	}
+	if tls {
+		sslCredentials := &corepb.GrpcService_GoogleGrpc_SslCredentials{}
+		if rootCertsPath != "" {
+			sslCredentials.RootCerts = &corepb.DataSource{
+				Specifier: &corepb.DataSource_Filename{
+					Filename: rootCertsPath,
+				},
+			}
+		}
+		googleGrpc.ChannelCredentials = &corepb.GrpcService_GoogleGrpc_ChannelCredentials{
+			CredentialSpecifier: &corepb.GrpcService_GoogleGrpc_ChannelCredentials_SslCredentials{
+				SslCredentials: sslCredentials,
+			},
+		}
+	}
+	return &corepb.GrpcService{
+		TargetSpecifier: &corepb.GrpcService_GoogleGrpc_{
+			GoogleGrpc: googleGrpc,
+		},
+	}, nil
+}
+
+// createZipkinConfig creates the Zipkin tracer config, it sends spans to the
+// tracing collector cluster built by the config generator.
+func createZipkinConfig(opts options.CommonOptions) (*tracepb.ZipkinConfig, error) {
+	if opts.TracingCollectorAddress == "" {
+		return nil, fmt.Errorf("tracing_collector_address must be set for tracing provider %s", ZipkinProvider)
+	}
+	_, _, _, path, err := util.ParseURI(opts.TracingCollectorAddress)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing tracing collector address: %v", err)
+	}
+	if path == "" {
+		path = defaultZipkinCollectorEndpoint
+	}
+
+	return &tracepb.ZipkinConfig{
+		CollectorCluster:         util.TracingCollectorClusterName,
+		CollectorEndpoint:        path,
+		CollectorEndpointVersion: tracepb.ZipkinConfig_HTTP_JSON,
+		TraceId_128Bit:           true,
+	}, nil
+}
+
+func createTracingProvider(opts options.CommonOptions, rootCertsPath string) (*tracepb.Tracing_Http, error) {
+	var name string
+	var config proto.Message
+	var err error
+	switch opts.TracingProvider {
+	case "", StackdriverProvider, OpenCensusAgentProvider:
+		name = util.OpenCensusTracer
+		config, err = createOpenCensusConfig(opts, rootCertsPath)
+	case ZipkinProvider:
+		name = util.ZipkinTracer
+		config, err = createZipkinConfig(opts)
+	default:
+		return nil, fmt.Errorf("invalid tracing provider: %v. It must be one of (%s|%s|%s)", opts.TracingProvider, StackdriverProvider, OpenCensusAgentProvider, ZipkinProvider)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	typedConfig, err := ptypes.MarshalAny(openCensusConfig)
+	typedConfig, err := ptypes.MarshalAny(config)
+	if err != nil {
+		return nil, err
+	}
+	return &tracepb.Tracing_Http{
+		Name:       name,
+		ConfigType: &tracepb.Tracing_Http_TypedConfig{TypedConfig: typedConfig},
+	}, nil
+}
+
+// CreateTracing outputs envoy HCM tracing config. rootCertsPath is used to
+// verify the tracing collector when it is not reached through a cluster.
+func CreateTracing(opts options.CommonOptions, rootCertsPath string) (*hcmpb.HttpConnectionManager_Tracing, error) {
+
+	provider, err := createTracingProvider(opts, rootCertsPath)
 	if err != nil {
 		return nil, err
 	}
@@ -140,9 +258,6 @@ func CreateTracing(opts options.CommonOptions) (*hcmpb.HttpConnectionManager_Tra
 		OverallSampling: &typepb.Percent{
 			Value: percentSampleRate,
 		},
-		Provider: &tracepb.Tracing_Http{
-			Name:       "envoy.tracers.opencensus",
-			ConfigType: &tracepb.Tracing_Http_TypedConfig{TypedConfig: typedConfig},
-		},
+		Provider: provider,
 	}, nil
 }
@@ -25,8 +25,10 @@ import (
 	"github.com/GoogleCloudPlatform/esp-v2/src/go/util"
 	typepb "github.com/envoyproxy/go-control-plane/envoy/type/v3"
 	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
 
 	opencensuspb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+	corepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	tracepb "github.com/envoyproxy/go-control-plane/envoy/config/trace/v3"
 	hcmpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
 )
@@ -167,7 +169,7 @@ func TestNonGcpOpenCensusConfig(t *testing.T) {
 		opts.TracingMaxNumMessageEvents = tc.tracingMaxNumMessageEvents
 		opts.TracingMaxNumLinks = tc.tracingMaxNumLinks
 
-		got, err := createOpenCensusConfig(opts)
+		got, err := createOpenCensusConfig(opts, "")
 
 		if tc.wantError != "" && (err == nil || !strings.Contains(err.Error(), tc.wantError)) {
 			t.Errorf("Test (%s): failed, expected err: %v, got: %v", tc.desc, tc.wantError, err)
@@ -214,7 +216,7 @@ func TestGcpOpenCensusConfig(t *testing.T) {
 		runTest(t, true, func() {
 
 			opts := options.DefaultCommonOptions()
-			got, err := createOpenCensusConfig(opts)
+			got, err := createOpenCensusConfig(opts, "")
 			if err != nil {
 				t.Fatalf("Test (%s): failed, got err: %v, want no err", tc.desc, err)
 			}
@@ -357,7 +359,7 @@ func TestHcmTracingSampleRate(t *testing.T) {
 			opts := options.DefaultCommonOptions()
 			opts.TracingSamplingRate = tc.tracingSampleRate
 
-			got, err := CreateTracing(opts)
+			got, err := CreateTracing(opts, "")
 
 			if tc.wantError != "" && (err == nil || !strings.Contains(err.Error(), tc.wantError)) {
 				t.Errorf("Test (%s): failed, expected err: %v, got: %v", tc.desc, tc.wantError, err)
@@ -379,6 +381,150 @@ func TestHcmTracingSampleRate(t *testing.T) {
 	}
 }
 
+// Tests the tracer config of the non-Stackdriver providers, they do not need a project-id.
+func TestTracingProviders(t *testing.T) {
+	defaultOpts := options.DefaultCommonOptions()
+
+	testData := []struct {
+		desc                    string
+		tracingProvider         string
+		tracingCollectorAddress string
+		rootCertsPath           string
+		wantName                string
+		wantConfig              proto.Message
+		wantError               string
+	}{
+		{
+			desc:                    "OpenCensus agent provider with insecure collector",
+			tracingProvider:         "opencensus_agent",
+			tracingCollectorAddress: "grpc://otel-collector:55678",
+			wantName:                "envoy.tracers.opencensus",
+			wantConfig: &tracepb.OpenCensusConfig{
+				TraceConfig: &opencensuspb.TraceConfig{
+					MaxNumberOfAttributes:    defaultOpts.TracingMaxNumAttributes,
+					MaxNumberOfAnnotations:   defaultOpts.TracingMaxNumAnnotations,
+					MaxNumberOfMessageEvents: defaultOpts.TracingMaxNumMessageEvents,
+					MaxNumberOfLinks:         defaultOpts.TracingMaxNumLinks,
+				},
+				OcagentExporterEnabled: true,
+				OcagentGrpcService: &corepb.GrpcService{
+					TargetSpecifier: &corepb.GrpcService_GoogleGrpc_{
+						GoogleGrpc: &corepb.GrpcService_GoogleGrpc{
+							TargetUri:  "otel-collector:55678",
+							StatPrefix: "opencensus_agent",
+						},
+					},
+				},
+			},
+		},
+		{
+			desc:                    "OpenCensus agent provider with TLS collector",
+			tracingProvider:         "opencensus_agent",
+			tracingCollectorAddress: "grpcs://otel.example.com",
+			rootCertsPath:           "/etc/ssl/certs/ca-certificates.crt",
+			wantName:                "envoy.tracers.opencensus",
+			wantConfig: &tracepb.OpenCensusConfig{
+				TraceConfig: &opencensuspb.TraceConfig{
+					MaxNumberOfAttributes:    defaultOpts.TracingMaxNumAttributes,
+					MaxNumberOfAnnotations:   defaultOpts.TracingMaxNumAnnotations,
+					MaxNumberOfMessageEvents: defaultOpts.TracingMaxNumMessageEvents,
+					MaxNumberOfLinks:         defaultOpts.TracingMaxNumLinks,
+				},
+				OcagentExporterEnabled: true,
+				OcagentGrpcService: &corepb.GrpcService{
+					TargetSpecifier: &corepb.GrpcService_GoogleGrpc_{
+						GoogleGrpc: &corepb.GrpcService_GoogleGrpc{
+							TargetUri:  "otel.example.com:443",
+							StatPrefix: "opencensus_agent",
+							ChannelCredentials: &corepb.GrpcService_GoogleGrpc_ChannelCredentials{
+								CredentialSpecifier: &corepb.GrpcService_GoogleGrpc_ChannelCredentials_SslCredentials{
+									SslCredentials: &corepb.GrpcService_GoogleGrpc_SslCredentials{
+										RootCerts: &corepb.DataSource{
+											Specifier: &corepb.DataSource_Filename{
+												Filename: "/etc/ssl/certs/ca-certificates.crt",
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			desc:                    "OpenCensus agent provider with http collector",
+			tracingProvider:         "opencensus_agent",
+			tracingCollectorAddress: "http://otel-collector:55678",
+			wantError:               "must use grpc or grpcs scheme",
+		},
+		{
+			desc:            "OpenCensus agent provider without collector",
+			tracingProvider: "opencensus_agent",
+			wantError:       "tracing_collector_address must be set for tracing provider opencensus_agent",
+		},
+		{
+			desc:                    "Zipkin provider with default endpoint",
+			tracingProvider:         "zipkin",
+			tracingCollectorAddress: "http://zipkin:9411",
+			wantName:                "envoy.tracers.zipkin",
+			wantConfig: &tracepb.ZipkinConfig{
+				CollectorCluster:         "tracing-collector-cluster",
+				CollectorEndpoint:        "/api/v2/spans",
+				CollectorEndpointVersion: tracepb.ZipkinConfig_HTTP_JSON,
+				TraceId_128Bit:           true,
+			},
+		},
+		{
+			desc:                    "Zipkin provider with custom endpoint",
+			tracingProvider:         "zipkin",
+			tracingCollectorAddress: "https://zipkin.example.com/zipkin/api/v2/spans",
+			wantName:                "envoy.tracers.zipkin",
+			wantConfig: &tracepb.ZipkinConfig{
+				CollectorCluster:         "tracing-collector-cluster",
+				CollectorEndpoint:        "/zipkin/api/v2/spans",
+				CollectorEndpointVersion: tracepb.ZipkinConfig_HTTP_JSON,
+				TraceId_128Bit:           true,
+			},
+		},
+		{
+			desc:            "Unknown provider",
+			tracingProvider: "jaeger",
+			wantError:       "invalid tracing provider: jaeger",
+		},
+	}
+
+	for _, tc := range testData {
+		opts := options.DefaultCommonOptions()
+		opts.NonGCP = true
+		opts.TracingProvider = tc.tracingProvider
+		opts.TracingCollectorAddress = tc.tracingCollectorAddress
+
+		got, err := CreateTracing(opts, tc.rootCertsPath)
+		if err != nil {
+			if tc.wantError == "" || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test (%s): failed, expected err: %v, got: %v", tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if tc.wantError != "" {
+			t.Errorf("Test (%s): failed, expected err: %v, got no err", tc.desc, tc.wantError)
+			continue
+		}
+
+		if got.Provider.Name != tc.wantName {
+			t.Errorf("Test (%s): failed, got provider: %v, want: %v", tc.desc, got.Provider.Name, tc.wantName)
+		}
+		gotConfig := proto.Clone(tc.wantConfig)
+		if err := ptypes.UnmarshalAny(got.Provider.GetTypedConfig(), gotConfig); err != nil {
+			t.Fatalf("Test (%s): failed, got err: %v", tc.desc, err)
+		}
+		if !proto.Equal(gotConfig, tc.wantConfig) {
+			t.Errorf("Test (%s): failed, got : %v, want: %v", tc.desc, gotConfig, tc.wantConfig)
+		}
+	}
+}
+
 // Tests the various cases for automatically determining the project-id in any environment
 func TestDetermineProjectId(t *testing.T) {
 	testData := []struct {
@@ -0,0 +1,396 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// HttpTemplate is a parsed path template of google.api.http, with the grammar:
+//
+//	Template = "/" Segments [ Verb ] ;
+//	Segments = Segment { "/" Segment } ;
+//	Segment  = "*" | "**" | LITERAL | Variable ;
+//	Variable = "{" FieldPath [ "=" Segments ] "}" ;
+//	FieldPath = IDENT { "." IDENT } ;
+//	Verb     = ":" LITERAL ;
+//
+// The root template "/" and a trailing "/" are also accepted, and matched
+// exactly, as they are common in the paths of OpenAPI specs. So are segments
+// mixing literals and variables, like "{name}.{ext}", which the grammar does
+// not allow but the OpenAPI paths often have.
+type HttpTemplate struct {
+	Segments  []*HttpTemplateSegment
+	Variables []*HttpTemplateVariable
+	// The custom verb without ":", empty if the template has none.
+	Verb string
+	// Whether the path ends with "/".
+	TrailingSlash bool
+}
+
+// HttpTemplateSegment is a path segment, either a literal or a wildcard.
+type HttpTemplateSegment struct {
+	// The literal, or "*" or "**" for wildcards.
+	Literal    string
+	IsWildcard bool
+	// The literals and "*" wildcards of a partial segment, a wildcard mixing
+	// literals and variables. Nil for the other segments.
+	Parts []*HttpTemplateSegment
+}
+
+// HttpTemplateVariable binds the segments [StartSegment, EndSegment) to the
+// field path. A variable of a partial segment binds its part of the segment.
+type HttpTemplateVariable struct {
+	FieldPath    string
+	StartSegment int
+	EndSegment   int
+}
+
+var identRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// httpTemplateParser is a recursive descent parser of the template grammar.
+type httpTemplateParser struct {
+	template string
+	pos      int
+	result   *HttpTemplate
+	// The variable being parsed, variables can not be nested.
+	inVariable bool
+}
+
+// ParseHttpTemplate parses the path template of a google.api.http rule. The
+// errors point to the position of the template where parsing failed.
+func ParseHttpTemplate(template string) (*HttpTemplate, error) {
+	p := &httpTemplateParser{
+		template: template,
+		result:   &HttpTemplate{},
+	}
+	if err := p.parse(); err != nil {
+		return nil, fmt.Errorf("invalid http template %q: %v", template, err)
+	}
+	return p.result, nil
+}
+
+func (p *httpTemplateParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s at position %d", fmt.Sprintf(format, args...), p.pos)
+}
+
+func (p *httpTemplateParser) done() bool {
+	return p.pos >= len(p.template)
+}
+
+func (p *httpTemplateParser) peek() byte {
+	return p.template[p.pos]
+}
+
+func (p *httpTemplateParser) parse() error {
+	if p.done() || p.peek() != '/' {
+		return p.errorf("template must start with /")
+	}
+	p.pos++
+	if p.done() {
+		// The root template "/".
+		return nil
+	}
+
+	if err := p.parseSegments(); err != nil {
+		return err
+	}
+
+	if !p.done() && p.peek() == '/' {
+		p.pos++
+		if !p.done() {
+			return p.errorf("unexpected /")
+		}
+		p.result.TrailingSlash = true
+	}
+
+	if !p.done() && p.peek() == ':' {
+		p.pos++
+		verb := p.parseLiteral()
+		if verb == "" {
+			return p.errorf("verb must not be empty")
+		}
+		if p.result.TrailingSlash {
+			return p.errorf("verb must not follow a trailing /")
+		}
+		p.result.Verb = verb
+	}
+
+	if !p.done() {
+		return p.errorf("unexpected %q", p.peek())
+	}
+
+	for i, segment := range p.result.Segments {
+		if segment.IsWildcard && segment.Literal == "**" && i != len(p.result.Segments)-1 {
+			return fmt.Errorf("** must be the last segment")
+		}
+	}
+	if p.result.TrailingSlash && len(p.result.Segments) > 0 && p.result.Segments[len(p.result.Segments)-1].Literal == "**" {
+		return fmt.Errorf("** must not be followed by a trailing /")
+	}
+	return nil
+}
+
+// parseSegments parses segments separated by "/", stopping before a trailing
+// "/", a verb or the end of a variable.
+func (p *httpTemplateParser) parseSegments() error {
+	for {
+		if err := p.parseSegment(); err != nil {
+			return err
+		}
+		// A "/" followed by the end of the template is a trailing slash.
+		if p.done() || p.peek() != '/' || p.pos == len(p.template)-1 {
+			return nil
+		}
+		p.pos++
+	}
+}
+
+func (p *httpTemplateParser) parseSegment() error {
+	if p.done() {
+		return p.errorf("segment must not be empty")
+	}
+
+	isLiteral := false
+	switch p.peek() {
+	case '*':
+		p.pos++
+		literal := "*"
+		if !p.done() && p.peek() == '*' {
+			p.pos++
+			literal = "**"
+		}
+		p.result.Segments = append(p.result.Segments, &HttpTemplateSegment{
+			Literal:    literal,
+			IsWildcard: true,
+		})
+	case '{':
+		if err := p.parseVariable(); err != nil {
+			return err
+		}
+	case '/':
+		return p.errorf("segment must not be empty")
+	default:
+		literal := p.parseLiteral()
+		if literal == "" {
+			return p.errorf("unexpected %q", p.peek())
+		}
+		p.result.Segments = append(p.result.Segments, &HttpTemplateSegment{
+			Literal: literal,
+		})
+		isLiteral = true
+	}
+
+	if !p.done() {
+		switch p.peek() {
+		case '/', ':', '}':
+		case '{':
+			if isLiteral && !p.inVariable {
+				return p.parsePartialSegment()
+			}
+			return p.errorf("unexpected %q", p.peek())
+		default:
+			if isLiteral {
+				return p.errorf("unexpected %q", p.peek())
+			}
+			if p.lastIsSingleVariable() && p.peek() != '*' && p.peek() != '=' {
+				return p.parsePartialSegment()
+			}
+			return p.errorf("unexpected %q, wildcards and variables must be whole segments", p.peek())
+		}
+	}
+	return nil
+}
+
+// lastIsSingleVariable returns whether the last segment is a variable binding
+// a single "*", outside the segments of another variable.
+func (p *httpTemplateParser) lastIsSingleVariable() bool {
+	if p.inVariable || len(p.result.Variables) == 0 {
+		return false
+	}
+	last := len(p.result.Segments) - 1
+	variable := p.result.Variables[len(p.result.Variables)-1]
+	return variable.StartSegment == last && variable.EndSegment == last+1 && p.result.Segments[last].Literal == "*"
+}
+
+// parsePartialSegment parses the rest of a segment mixing literals and
+// variables, the last segment being its first part.
+func (p *httpTemplateParser) parsePartialSegment() error {
+	last := len(p.result.Segments) - 1
+	parts := []*HttpTemplateSegment{p.result.Segments[last]}
+	p.result.Segments = p.result.Segments[:last]
+
+	for !p.done() && !strings.ContainsRune("/:}", rune(p.peek())) {
+		if p.peek() != '{' {
+			literal := p.parseLiteral()
+			if literal == "" {
+				return p.errorf("unexpected %q", p.peek())
+			}
+			parts = append(parts, &HttpTemplateSegment{
+				Literal: literal,
+			})
+			continue
+		}
+
+		if parts[len(parts)-1].IsWildcard {
+			return p.errorf("variables of a partial segment must be separated by literals")
+		}
+		start := p.pos
+		if err := p.parseVariable(); err != nil {
+			return err
+		}
+		if !p.lastIsSingleVariable() {
+			p.pos = start
+			return p.errorf("variables of a partial segment must bind a single *")
+		}
+		parts = append(parts, p.result.Segments[last])
+		p.result.Segments = p.result.Segments[:last]
+	}
+
+	p.result.Segments = append(p.result.Segments, &HttpTemplateSegment{
+		IsWildcard: true,
+		Parts:      parts,
+	})
+	return nil
+}
+
+func (p *httpTemplateParser) parseVariable() error {
+	if p.inVariable {
+		return p.errorf("variables must not be nested")
+	}
+	// Skip "{".
+	p.pos++
+	start := p.pos
+	for !p.done() && p.peek() != '=' && p.peek() != '}' {
+		p.pos++
+	}
+	if p.done() {
+		return p.errorf("variable must end with }")
+	}
+
+	fieldPath := p.template[start:p.pos]
+	for _, ident := range strings.Split(fieldPath, ".") {
+		if !identRegex.MatchString(ident) {
+			p.pos = start
+			return p.errorf("invalid field path %q", fieldPath)
+		}
+	}
+	for _, v := range p.result.Variables {
+		if v.FieldPath == fieldPath {
+			p.pos = start
+			return p.errorf("field path %q is bound more than once", fieldPath)
+		}
+	}
+
+	variable := &HttpTemplateVariable{
+		FieldPath:    fieldPath,
+		StartSegment: len(p.result.Segments),
+	}
+	if p.peek() == '=' {
+		p.pos++
+		p.inVariable = true
+		if err := p.parseSegments(); err != nil {
+			return err
+		}
+		p.inVariable = false
+	} else {
+		// {field} is the same as {field=*}.
+		p.result.Segments = append(p.result.Segments, &HttpTemplateSegment{
+			Literal:    "*",
+			IsWildcard: true,
+		})
+	}
+
+	if p.done() || p.peek() != '}' {
+		return p.errorf("variable must end with }")
+	}
+	p.pos++
+	variable.EndSegment = len(p.result.Segments)
+	p.result.Variables = append(p.result.Variables, variable)
+	return nil
+}
+
+// parseLiteral reads until a character with a meaning in the grammar.
+func (p *httpTemplateParser) parseLiteral() string {
+	start := p.pos
+	for !p.done() && !strings.ContainsRune("/{}=*:", rune(p.peek())) {
+		p.pos++
+	}
+	return p.template[start:p.pos]
+}
+
+// HasPartialSegment returns whether the template has a segment mixing
+// literals and variables.
+func (t *HttpTemplate) HasPartialSegment() bool {
+	for _, segment := range t.Segments {
+		if segment.Parts != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// HasWildcard returns whether the template matches more than one path.
+func (t *HttpTemplate) HasWildcard() bool {
+	for _, segment := range t.Segments {
+		if segment.IsWildcard {
+			return true
+		}
+	}
+	return false
+}
+
+// Regex returns the regex matching the paths of the template, with the
+// literals escaped. "*" matches a segment and "**" matches any number of
+// segments.
+func (t *HttpTemplate) Regex() string {
+	return "^" + strings.Join(t.RegexAtoms(), "") + "$"
+}
+
+// RegexAtoms returns the parts of the regex of the template, one per segment,
+// followed by the trailing "/" and the verb. Templates with the same first
+// atoms share a prefix of their paths.
+func (t *HttpTemplate) RegexAtoms() []string {
+	var atoms []string
+	for _, segment := range t.Segments {
+		switch {
+		case segment.Literal == "**":
+			atoms = append(atoms, doubleWildcardReplacementRegex)
+		case segment.Parts != nil:
+			atom := "/"
+			for _, part := range segment.Parts {
+				if part.IsWildcard {
+					atom += partialWildcardReplacementRegex
+				} else {
+					atom += regexp.QuoteMeta(part.Literal)
+				}
+			}
+			atoms = append(atoms, atom)
+		case segment.IsWildcard:
+			atoms = append(atoms, singleWildcardReplacementRegex)
+		default:
+			atoms = append(atoms, "/"+regexp.QuoteMeta(segment.Literal))
+		}
+	}
+	if t.TrailingSlash || len(t.Segments) == 0 {
+		atoms = append(atoms, "/")
+	}
+	if t.Verb != "" {
+		atoms = append(atoms, regexp.QuoteMeta(":"+t.Verb))
+	}
+	return atoms
+}
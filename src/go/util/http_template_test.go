@@ -0,0 +1,270 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseHttpTemplate(t *testing.T) {
+	testData := []struct {
+		desc         string
+		template     string
+		wantTemplate *HttpTemplate
+		wantError    string
+	}{
+		{
+			desc:         "Root",
+			template:     "/",
+			wantTemplate: &HttpTemplate{},
+		},
+		{
+			desc:     "Literals with trailing slash",
+			template: "/v1/shelves/",
+			wantTemplate: &HttpTemplate{
+				Segments: []*HttpTemplateSegment{
+					{Literal: "v1"},
+					{Literal: "shelves"},
+				},
+				TrailingSlash: true,
+			},
+		},
+		{
+			desc:     "Variables with nested field path and segments",
+			template: "/v1/{parent=shelves/*}/books/{book.id}",
+			wantTemplate: &HttpTemplate{
+				Segments: []*HttpTemplateSegment{
+					{Literal: "v1"},
+					{Literal: "shelves"},
+					{Literal: "*", IsWildcard: true},
+					{Literal: "books"},
+					{Literal: "*", IsWildcard: true},
+				},
+				Variables: []*HttpTemplateVariable{
+					{FieldPath: "parent", StartSegment: 1, EndSegment: 3},
+					{FieldPath: "book.id", StartSegment: 4, EndSegment: 5},
+				},
+			},
+		},
+		{
+			desc:     "Double wildcard with verb",
+			template: "/v1/{name=**}:cancel",
+			wantTemplate: &HttpTemplate{
+				Segments: []*HttpTemplateSegment{
+					{Literal: "v1"},
+					{Literal: "**", IsWildcard: true},
+				},
+				Variables: []*HttpTemplateVariable{
+					{FieldPath: "name", StartSegment: 1, EndSegment: 2},
+				},
+				Verb: "cancel",
+			},
+		},
+		{
+			desc:     "OpenAPI path with variables in partial segments",
+			template: "/files/{name}.{ext}/v{version}",
+			wantTemplate: &HttpTemplate{
+				Segments: []*HttpTemplateSegment{
+					{Literal: "files"},
+					{IsWildcard: true, Parts: []*HttpTemplateSegment{
+						{Literal: "*", IsWildcard: true},
+						{Literal: "."},
+						{Literal: "*", IsWildcard: true},
+					}},
+					{IsWildcard: true, Parts: []*HttpTemplateSegment{
+						{Literal: "v"},
+						{Literal: "*", IsWildcard: true},
+					}},
+				},
+				Variables: []*HttpTemplateVariable{
+					{FieldPath: "name", StartSegment: 1, EndSegment: 2},
+					{FieldPath: "ext", StartSegment: 1, EndSegment: 2},
+					{FieldPath: "version", StartSegment: 2, EndSegment: 3},
+				},
+			},
+		},
+		{
+			desc:      "Empty template",
+			template:  "",
+			wantError: "template must start with / at position 0",
+		},
+		{
+			desc:      "Empty segment",
+			template:  "/v1//books",
+			wantError: "segment must not be empty at position 4",
+		},
+		{
+			desc:      "Unclosed variable",
+			template:  "/v1/{name",
+			wantError: "variable must end with } at position 9",
+		},
+		{
+			desc:      "Unclosed variable with segments",
+			template:  "/v1/{name=books/*",
+			wantError: "variable must end with } at position 17",
+		},
+		{
+			desc:      "Nested variables",
+			template:  "/v1/{name={id}}",
+			wantError: "variables must not be nested at position 10",
+		},
+		{
+			desc:      "Invalid field path",
+			template:  "/v1/{book..id}",
+			wantError: `invalid field path "book..id" at position 5`,
+		},
+		{
+			desc:      "Field path bound twice",
+			template:  "/v1/{id}/{id}",
+			wantError: `field path "id" is bound more than once at position 10`,
+		},
+		{
+			desc:      "Double wildcard in the middle",
+			template:  "/v1/**/books",
+			wantError: "** must be the last segment",
+		},
+		{
+			desc:      "Wildcard in a partial segment",
+			template:  "/v1/books*",
+			wantError: `unexpected '*' at position 9`,
+		},
+		{
+			desc:      "Triple wildcard",
+			template:  "/v1/***",
+			wantError: `unexpected '*', wildcards and variables must be whole segments at position 6`,
+		},
+		{
+			desc:      "Adjacent variables in a partial segment",
+			template:  "/v1/{id}{ext}",
+			wantError: `unexpected '{' at position 8`,
+		},
+		{
+			desc:      "Variables of a partial segment not separated by literals",
+			template:  "/v1/{id}.{ext}{format}",
+			wantError: "variables of a partial segment must be separated by literals at position 14",
+		},
+		{
+			desc:      "Variable with segments in a partial segment",
+			template:  "/v1/{id}.{name=books/*}",
+			wantError: "variables of a partial segment must bind a single * at position 9",
+		},
+		{
+			desc:      "Partial segment in a variable",
+			template:  "/v1/{name=books/{id}.json}",
+			wantError: "variables must not be nested at position 16",
+		},
+		{
+			desc:      "Empty verb",
+			template:  "/v1/books:",
+			wantError: "verb must not be empty at position 10",
+		},
+		{
+			desc:      "Verb before the last segment",
+			template:  "/v1/books:cancel/1",
+			wantError: "unexpected '/' at position 16",
+		},
+		{
+			desc:      "Unmatched closing brace",
+			template:  "/v1/books}",
+			wantError: "unexpected '}' at position 9",
+		},
+	}
+
+	for _, tc := range testData {
+		got, err := ParseHttpTemplate(tc.template)
+		if err != nil {
+			if tc.wantError == "" || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test Desc(%s): want error: %s, get error: %v", tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if tc.wantError != "" {
+			t.Errorf("Test Desc(%s): want error: %s, get no error", tc.desc, tc.wantError)
+			continue
+		}
+
+		if diff := cmp.Diff(tc.wantTemplate, got); diff != "" {
+			t.Errorf("Test Desc(%s): got template diff (-want +got):\n%s", tc.desc, diff)
+		}
+	}
+}
+
+func TestHttpTemplateRegex(t *testing.T) {
+	testData := []struct {
+		desc      string
+		template  string
+		wantMatch []string
+		wantMiss  []string
+	}{
+		{
+			desc:      "Single wildcard matches one segment",
+			template:  "/v1/shelves/{shelf}/books/*",
+			wantMatch: []string{"/v1/shelves/1/books/2"},
+			wantMiss:  []string{"/v1/shelves/1/books/2/3", "/v1/shelves//books/2", "/v1/shelves/1/books"},
+		},
+		{
+			desc:      "Double wildcard matches any segments",
+			template:  "/v1/{name=**}",
+			wantMatch: []string{"/v1/", "/v1/a", "/v1/a/b/c"},
+			wantMiss:  []string{"/v2/a"},
+		},
+		{
+			desc:      "Custom verb",
+			template:  "/v1/{name=operations/*}:cancel",
+			wantMatch: []string{"/v1/operations/1:cancel"},
+			wantMiss:  []string{"/v1/operations/1", "/v1/operations/1:cancelX", "/v1/jobs/1:cancel"},
+		},
+		{
+			desc:      "Literals are not regex",
+			template:  "/v1.0/{id}",
+			wantMatch: []string{"/v1.0/1"},
+			wantMiss:  []string{"/v1x0/1"},
+		},
+		{
+			desc:      "Variables in a partial segment match a part of the segment",
+			template:  "/files/{name}.{ext}",
+			wantMatch: []string{"/files/report.pdf", "/files/report.tar.gz"},
+			wantMiss:  []string{"/files/report", "/files/report.", "/files/dir/report.pdf"},
+		},
+		{
+			desc:      "Trailing slash",
+			template:  "/v1/{id}/",
+			wantMatch: []string{"/v1/1/"},
+			wantMiss:  []string{"/v1/1"},
+		},
+	}
+
+	for _, tc := range testData {
+		template, err := ParseHttpTemplate(tc.template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		re := regexp.MustCompile(template.Regex())
+		for _, path := range tc.wantMatch {
+			if !re.MatchString(path) {
+				t.Errorf("Test Desc(%s): regex %s does not match %s", tc.desc, re, path)
+			}
+		}
+		for _, path := range tc.wantMiss {
+			if re.MatchString(path) {
+				t.Errorf("Test Desc(%s): regex %s matches %s", tc.desc, re, path)
+			}
+		}
+	}
+}
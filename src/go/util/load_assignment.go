@@ -17,6 +17,7 @@ package util
 import (
 	corepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	endpointpb "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	wrapperspb "github.com/golang/protobuf/ptypes/wrappers"
 )
 
 // CreateLoadAssignment creates a ClusterLoadAssignment
@@ -47,3 +48,52 @@ func CreateLoadAssignment(hostname string, port uint32) *endpointpb.ClusterLoadA
 		},
 	}
 }
+
+// WeightedEndpoint is one endpoint of a multi-endpoint cluster.
+// A zero Weight leaves the load balancing weight unset.
+type WeightedEndpoint struct {
+	Hostname string
+	Port     uint32
+	Weight   uint32
+}
+
+// CreateWeightedLoadAssignment creates a ClusterLoadAssignment with one
+// LbEndpoint per endpoint, all in the same locality. The health checks of an
+// endpoint send its own hostname, instead of the one of the cluster.
+func CreateWeightedLoadAssignment(clusterName string, endpoints []*WeightedEndpoint) *endpointpb.ClusterLoadAssignment {
+	var lbEndpoints []*endpointpb.LbEndpoint
+	for _, ep := range endpoints {
+		lbEndpoint := &endpointpb.LbEndpoint{
+			HostIdentifier: &endpointpb.LbEndpoint_Endpoint{
+				Endpoint: &endpointpb.Endpoint{
+					Address: &corepb.Address{
+						Address: &corepb.Address_SocketAddress{
+							SocketAddress: &corepb.SocketAddress{
+								Address: ep.Hostname,
+								PortSpecifier: &corepb.SocketAddress_PortValue{
+									PortValue: ep.Port,
+								},
+							},
+						},
+					},
+					HealthCheckConfig: &endpointpb.Endpoint_HealthCheckConfig{
+						Hostname: ep.Hostname,
+					},
+				},
+			},
+		}
+		if ep.Weight != 0 {
+			lbEndpoint.LoadBalancingWeight = &wrapperspb.UInt32Value{Value: ep.Weight}
+		}
+		lbEndpoints = append(lbEndpoints, lbEndpoint)
+	}
+
+	return &endpointpb.ClusterLoadAssignment{
+		ClusterName: clusterName,
+		Endpoints: []*endpointpb.LocalityLbEndpoints{
+			{
+				LbEndpoints: lbEndpoints,
+			},
+		},
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"testing"
+)
+
+func TestCreateWeightedLoadAssignment(t *testing.T) {
+	loadAssignment := CreateWeightedLoadAssignment("backend-cluster", []*WeightedEndpoint{
+		{
+			Hostname: "backend-a.example.com",
+			Port:     8081,
+			Weight:   3,
+		},
+		{
+			Hostname: "backend-b.example.com",
+			Port:     8082,
+		},
+	})
+
+	gotJson, err := ProtoToJson(loadAssignment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantJson := `{
+  "clusterName": "backend-cluster",
+  "endpoints": [
+    {
+      "lbEndpoints": [
+        {
+          "endpoint": {
+            "address": {"socketAddress": {"address": "backend-a.example.com", "portValue": 8081}},
+            "healthCheckConfig": {"hostname": "backend-a.example.com"}
+          },
+          "loadBalancingWeight": 3
+        },
+        {
+          "endpoint": {
+            "address": {"socketAddress": {"address": "backend-b.example.com", "portValue": 8082}},
+            "healthCheckConfig": {"hostname": "backend-b.example.com"}
+          }
+        }
+      ]
+    }
+  ]
+}`
+	if err := JsonEqual(wantJson, gotJson); err != nil {
+		t.Errorf("CreateWeightedLoadAssignment: %v", err)
+	}
+}
@@ -15,8 +15,11 @@
 package util
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 
 	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/proto"
@@ -30,9 +33,11 @@ import (
 	tracepb "github.com/envoyproxy/go-control-plane/envoy/config/trace/v3"
 	accessfilepb "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/file/v3"
 	accessgrpcpb "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/grpc/v3"
+	extauthzpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_authz/v3"
 	transcoderpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/grpc_json_transcoder/v3"
 	gspb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/grpc_stats/v3"
 	jwtpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/jwt_authn/v3"
+	rbacpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/rbac/v3"
 	routerpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/router/v3"
 	hcmpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
 	tlspb "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
@@ -83,6 +88,14 @@ var Resolver = FuncResolver(func(url string) (proto.Message, error) {
 		return new(transcoderpb.GrpcJsonTranscoder), nil
 	case "type.googleapis.com/envoy.extensions.filters.http.jwt_authn.v3.JwtAuthentication":
 		return new(jwtpb.JwtAuthentication), nil
+	case "type.googleapis.com/envoy.extensions.filters.http.rbac.v3.RBAC":
+		return new(rbacpb.RBAC), nil
+	case "type.googleapis.com/envoy.extensions.filters.http.rbac.v3.RBACPerRoute":
+		return new(rbacpb.RBACPerRoute), nil
+	case "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthz":
+		return new(extauthzpb.ExtAuthz), nil
+	case "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute":
+		return new(extauthzpb.ExtAuthzPerRoute), nil
 	case "type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager":
 		return new(hcmpb.HttpConnectionManager), nil
 	case "type.googleapis.com/espv2.api.envoy.v9.http.path_matcher.FilterConfig":
@@ -111,8 +124,12 @@ var Resolver = FuncResolver(func(url string) (proto.Message, error) {
 		return new(statspb.StatsSink), nil
 	case "type.googleapis.com/envoy.config.metrics.v3.StatsdSink":
 		return new(statspb.StatsdSink), nil
+	case "type.googleapis.com/envoy.config.metrics.v3.DogStatsdSink":
+		return new(statspb.DogStatsdSink), nil
 	case "type.googleapis.com/envoy.config.trace.v3.OpenCensusConfig":
 		return new(tracepb.OpenCensusConfig), nil
+	case "type.googleapis.com/envoy.config.trace.v3.ZipkinConfig":
+		return new(tracepb.ZipkinConfig), nil
 	default:
 		return nil, fmt.Errorf("unexpected protobuf.Any with url: %s", url)
 	}
@@ -153,6 +170,22 @@ func UnmarshalServiceConfig(config io.Reader) (*confpb.Service, error) {
 	return &serviceConfig, nil
 }
 
+// UnmarshalJsonFile reads the JSON file at path into v. Unknown fields are
+// rejected so that typos in ESPv2 configuration files are surfaced early.
+func UnmarshalJsonFile(path string, v interface{}) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("fail to read file %s: %v", path, err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("fail to unmarshal file %s: %v", path, err)
+	}
+	return nil
+}
+
 func ProtoToJson(msg proto.Message) (string, error) {
 	marshaler := &jsonpb.Marshaler{}
 	return marshaler.MarshalToString(msg)
@@ -19,13 +19,17 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/GoogleCloudPlatform/esp-v2/src/go/util/testutil"
 	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
 
 	statspb "github.com/envoyproxy/go-control-plane/envoy/config/metrics/v3"
+	tracepb "github.com/envoyproxy/go-control-plane/envoy/config/trace/v3"
 	accessfilepb "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/file/v3"
 	accessgrpcpb "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/grpc/v3"
+	extauthzpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_authz/v3"
+	rbacpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/rbac/v3"
 	confpb "google.golang.org/genproto/googleapis/api/serviceconfig"
 	scpb "google.golang.org/genproto/googleapis/api/servicecontrol/v1"
 	smpb "google.golang.org/genproto/googleapis/api/servicemanagement/v1"
@@ -41,7 +45,13 @@ func TestResolver(t *testing.T) {
 		{msg: &accessgrpcpb.CommonGrpcAccessLogConfig{}},
 		{msg: &statspb.StatsSink{}},
 		{msg: &statspb.StatsdSink{}},
+		{msg: &statspb.DogStatsdSink{}},
 		{msg: &statspb.StatsConfig{}},
+		{msg: &tracepb.ZipkinConfig{}},
+		{msg: &rbacpb.RBAC{}},
+		{msg: &rbacpb.RBACPerRoute{}},
+		{msg: &extauthzpb.ExtAuthz{}},
+		{msg: &extauthzpb.ExtAuthzPerRoute{}},
 	}
 
 	marshaler := &jsonpb.Marshaler{
@@ -110,3 +120,60 @@ func TestUnmarshalBytesToPbMessage(t *testing.T) {
 		}
 	}
 }
+
+func TestUnmarshalJsonFile(t *testing.T) {
+	type fileFormat struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+
+	testCases := []struct {
+		desc      string
+		content   string
+		want      fileFormat
+		wantError string
+	}{
+		{
+			desc:    "success",
+			content: `{"name": "foo", "count": 3}`,
+			want: fileFormat{
+				Name:  "foo",
+				Count: 3,
+			},
+		},
+		{
+			desc:      "unknown field is rejected",
+			content:   `{"name": "foo", "cnt": 3}`,
+			wantError: `json: unknown field "cnt"`,
+		},
+		{
+			desc:      "malformed json",
+			content:   `{"name": `,
+			wantError: "fail to unmarshal file",
+		},
+	}
+
+	for _, tc := range testCases {
+		path, removeFile := testutil.WriteTempFile(t, "unmarshal_json_file", tc.content)
+		defer removeFile()
+
+		var got fileFormat
+		err := UnmarshalJsonFile(path, &got)
+		if err != nil {
+			if tc.wantError == "" || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test (%s): want error: %s, get error: %v", tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if tc.wantError != "" {
+			t.Errorf("Test (%s): want error: %s, get no error", tc.desc, tc.wantError)
+		}
+		if got != tc.want {
+			t.Errorf("Test (%s): want: %v, get: %v", tc.desc, tc.want, got)
+		}
+	}
+
+	if err := UnmarshalJsonFile("/nonexistent/file.json", &fileFormat{}); err == nil || !strings.Contains(err.Error(), "fail to read file") {
+		t.Errorf("Test (nonexistent file): want error: fail to read file, get error: %v", err)
+	}
+}
@@ -20,19 +20,28 @@ import (
 )
 
 func ValidateRegexProgramSize(regex string, maxProgramSize int) error {
-	regParse, err := syntax.Parse(regex, 0)
+	programSize, err := RegexProgramSize(regex)
 	if err != nil {
 		return err
 	}
 
-	prog, err := syntax.Compile(regParse)
-	if err != nil {
-		return err
+	if programSize > maxProgramSize {
+		return fmt.Errorf("regex program size(%v) is larger than the max expected(%v): %s", programSize, maxProgramSize, regex)
 	}
 
-	if len(prog.Inst) > maxProgramSize {
-		return fmt.Errorf("regex program size(%v) is larger than the max expected(%v): %s", len(prog.Inst), maxProgramSize, regex)
+	return nil
+}
+
+// RegexProgramSize returns the number of instructions of the compiled regex.
+func RegexProgramSize(regex string) (int, error) {
+	regParse, err := syntax.Parse(regex, 0)
+	if err != nil {
+		return 0, err
 	}
 
-	return nil
+	prog, err := syntax.Compile(regParse)
+	if err != nil {
+		return 0, err
+	}
+	return len(prog.Inst), nil
 }
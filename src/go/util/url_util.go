@@ -21,9 +21,12 @@ import (
 	"net"
 	"net/http"
 	"net/url"
-	"regexp"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/golang/glog"
 )
 
 const (
@@ -38,21 +41,13 @@ const (
 )
 
 var (
-	// Various hacky regular expressions to match a subset of the http template syntax.
-	// Replace segments with single wildcards: /v1/books/*
-	singleWildcardMatcher = regexp.MustCompile(`/\*`)
-	// Replace segments with double wildcards: /v1/**
-	doubleWildcardMatcher = regexp.MustCompile(`/\*\*`)
-	// Replace any path templates: /v1/books/{book_id}
-	pathParamMatcher = regexp.MustCompile(`/{[^{}]+}`)
-	// Replace path templates with double wildcards: /v1/{name=**}
-	pathParamDoubleWildcardMatcher = regexp.MustCompile(`/{[^{}]+=\*\*}`)
-
 	// Common regex forms that emulate http template syntax.
 	// Matches 1 or more segments of any character except '/'.
 	singleWildcardReplacementRegex = `/[^\/]+`
 	// Matches any character or no characters at all.
 	doubleWildcardReplacementRegex = `/.*`
+	// Matches the part of a segment bound by a variable, in a partial segment.
+	partialWildcardReplacementRegex = `[^\/]+`
 )
 
 // ParseURI parses uri into scheme, hostname, port, path with err(if exist).
@@ -121,9 +116,8 @@ func ParseBackendProtocol(scheme string, httpProtocol string) (BackendProtocol,
 }
 
 // Note: the path of openID discovery may be https
-var getRemoteContent = func(path string) ([]byte, error) {
+var getRemoteContent = func(client *http.Client, path string) ([]byte, error) {
 	req, _ := http.NewRequest("GET", path, nil)
-	client := &http.Client{}
 	resp, err := client.Do(req)
 
 	if err != nil {
@@ -137,15 +131,34 @@ var getRemoteContent = func(path string) ([]byte, error) {
 	return ioutil.ReadAll(resp.Body)
 }
 
-func ResolveJwksUriUsingOpenID(uri string) (string, error) {
+// ResolveJwksUriUsingOpenID gets the jwks_uri from the OpenID Connect Discovery
+// configuration of the issuer. Failed requests are retried up to maxRetries
+// times with exponential backoff starting at initialInterval, invalid
+// configurations are not retried.
+func ResolveJwksUriUsingOpenID(client *http.Client, uri string, maxRetries uint64, initialInterval time.Duration) (string, error) {
 	if !strings.HasPrefix(uri, "http") {
 		uri = fmt.Sprintf("https://%s", uri)
 	}
 	uri = strings.TrimSuffix(uri, "/")
 	uri = fmt.Sprintf("%s%s", uri, OpenIDDiscoveryCfgURLSuffix)
 
-	body, err := getRemoteContent(uri)
-	if err != nil {
+	var body []byte
+	ebo := backoff.NewExponentialBackOff()
+	ebo.InitialInterval = initialInterval
+	// WithMaxRetries retries forever with 0 retries.
+	var bo backoff.BackOff = &backoff.StopBackOff{}
+	if maxRetries > 0 {
+		bo = backoff.WithMaxRetries(ebo, maxRetries)
+	}
+	op := func() error {
+		var err error
+		body, err = getRemoteContent(client, uri)
+		if err != nil {
+			glog.Warningf("failed to fetch OpenID Connect Discovery configuration from %s: %v", uri, err)
+		}
+		return err
+	}
+	if err := backoff.Retry(op, bo); err != nil {
 		return "", fmt.Errorf("Failed to fetch jwks_uri from %s: %v", uri, err)
 	}
 
@@ -177,25 +190,18 @@ func ExtraAddressFromURI(jwksUri string) (string, error) {
 	return fmt.Sprintf("%s:%v", hostname, port), nil
 }
 
-// Returns a regex that will match requests to the uri with path parameters or wildcards.
-// If there are no path params or wildcards, returns empty string.
-//
-// Essentially matches a subset of the http template syntax.
-// FIXME(nareddyt): Remove this hack completely when envoy route config supports path matching with path templates.
-func WildcardMatcherForPath(uri string) string {
-
-	// Ordering matters, start with most specific and work upwards.
-	matcher := pathParamDoubleWildcardMatcher.ReplaceAllString(uri, doubleWildcardReplacementRegex)
-	matcher = pathParamMatcher.ReplaceAllString(matcher, singleWildcardReplacementRegex)
-	matcher = doubleWildcardMatcher.ReplaceAllString(matcher, doubleWildcardReplacementRegex)
-	matcher = singleWildcardMatcher.ReplaceAllString(matcher, singleWildcardReplacementRegex)
-
-	if matcher == uri {
-		return ""
+// WildcardMatcherForPath returns a regex that will match requests to the uri
+// with path parameters or wildcards. If there are no path params or
+// wildcards, returns empty string. Malformed http templates are rejected.
+func WildcardMatcherForPath(uri string) (string, error) {
+	template, err := ParseHttpTemplate(uri)
+	if err != nil {
+		return "", err
 	}
-
-	// Enforce strict prefix / suffix.
-	return "^" + matcher + "$"
+	if !template.HasWildcard() {
+		return "", nil
+	}
+	return template.Regex(), nil
 }
 
 var (
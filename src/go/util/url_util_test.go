@@ -20,6 +20,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -419,11 +420,28 @@ func TestResolveJwksUriUsingOpenID(t *testing.T) {
 		_, _ = w.Write([]byte("{}"))
 	}))
 
+	flakyRequests := 0
+	flakyOpenIDServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flakyRequests++
+		if flakyRequests <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write(jwksUriEntry)
+	}))
+
+	slowOpenIDServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		_, _ = w.Write(jwksUriEntry)
+	}))
+
 	testData := []struct {
-		desc    string
-		issuer  string
-		wantUri string
-		wantErr string
+		desc       string
+		issuer     string
+		timeout    time.Duration
+		maxRetries uint64
+		wantUri    string
+		wantErr    string
 	}{
 		{
 			desc:    "Success, with correct jwks_uri",
@@ -440,9 +458,24 @@ func TestResolveJwksUriUsingOpenID(t *testing.T) {
 			issuer:  "http://aaaaaaa.bbbbbbbbbbbbb.cccccccccc",
 			wantErr: "Failed to fetch jwks_uri from http://aaaaaaa.bbbbbbbbbbbbb.cccccccccc/.well-known/openid-configuration",
 		},
+		{
+			desc:       "Success, with retries of failed requests",
+			issuer:     flakyOpenIDServer.URL,
+			maxRetries: 2,
+			wantUri:    "this-is-jwksUri",
+		},
+		{
+			desc:    "Fail, with slow server exceeding the timeout",
+			issuer:  slowOpenIDServer.URL,
+			timeout: 50 * time.Millisecond,
+			wantErr: "Client.Timeout exceeded",
+		},
 	}
 	for i, tc := range testData {
-		uri, err := ResolveJwksUriUsingOpenID(tc.issuer)
+		client := &http.Client{
+			Timeout: tc.timeout,
+		}
+		uri, err := ResolveJwksUriUsingOpenID(client, tc.issuer, tc.maxRetries, time.Millisecond)
 		if uri != tc.wantUri {
 			t.Errorf("Test Desc(%d): %s, resolve jwksUri by openID got: %v, want: %v", i, tc.desc, uri, tc.wantUri)
 		}
@@ -511,6 +544,7 @@ func TestWildcardMatcherForPath(t *testing.T) {
 		desc        string
 		uri         string
 		wantMatcher string
+		wantError   string
 	}{
 		{
 			desc:        "No path params",
@@ -538,22 +572,59 @@ func TestWildcardMatcherForPath(t *testing.T) {
 			wantMatcher: `^/test/[^\/]+/test/.*$`,
 		},
 		{
-			desc:        "Invalid http template, not preceded by '/' ",
-			uri:         "**",
-			wantMatcher: "",
+			desc:      "Invalid http template, not preceded by '/' ",
+			uri:       "**",
+			wantError: `invalid http template "**": template must start with / at position 0`,
 		},
 		{
-			// TODO(nareddyt): This is incorrect. But it should be fine, it's only a problem
-			// when user configures gRPC transcoding manually. OpenAPI compiler will
-			// never generate such a segment binding.
 			desc:        "Path params with full segment binding",
 			uri:         "/v1/{name=books/*}",
-			wantMatcher: `^/v1/[^\/]+$`,
+			wantMatcher: `^/v1/books/[^\/]+$`,
+		},
+		{
+			desc:        "Path params with multi-segment binding",
+			uri:         "/v1/{name=shelves/*/books/*}",
+			wantMatcher: `^/v1/shelves/[^\/]+/books/[^\/]+$`,
+		},
+		{
+			desc:        "Path param with custom verb",
+			uri:         "/v1/{name}:cancel",
+			wantMatcher: `^/v1/[^\/]+:cancel$`,
+		},
+		{
+			desc:        "Custom verb without path params",
+			uri:         "/v1/operations:cancel",
+			wantMatcher: "",
+		},
+		{
+			desc:        "Literals are escaped",
+			uri:         "/v1.0/books+authors/{id}",
+			wantMatcher: `^/v1\.0/books\+authors/[^\/]+$`,
+		},
+		{
+			desc:        "OpenAPI path with a variable in a partial segment",
+			uri:         "/v1/{id}.json",
+			wantMatcher: `^/v1/[^\/]+\.json$`,
+		},
+		{
+			desc:        "OpenAPI path with variables in a partial segment",
+			uri:         "/files/{name}.{ext}",
+			wantMatcher: `^/files/[^\/]+\.[^\/]+$`,
 		},
 	}
 
 	for _, tc := range testData {
-		got := WildcardMatcherForPath(tc.uri)
+		got, err := WildcardMatcherForPath(tc.uri)
+		if err != nil {
+			if tc.wantError == "" || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Test (%v): want error: %s, get error: %v", tc.desc, tc.wantError, err)
+			}
+			continue
+		}
+		if tc.wantError != "" {
+			t.Errorf("Test (%v): want error: %s, get no error", tc.desc, tc.wantError)
+			continue
+		}
 
 		if tc.wantMatcher != got {
 			t.Errorf("Test (%v): \n got %v \nwant %v", tc.desc, got, tc.wantMatcher)
@@ -93,6 +93,32 @@ const (
 	// Default api key locations
 	DefaultApiKeyQueryParamKey    = "key"
 	DefaultApiKeyQueryParamApiKey = "api_key"
+	DefaultApiKeyHeader           = "x-api-key"
+
+	// The suffix of the header with the consumer of the API key validated by the local API key server.
+	ApiKeyConsumerHeaderSuffix = "API-Consumer"
+
+	// Context extensions of the ext_authz requests to the local API key server,
+	// with the operation and its API key locations in format of "query:key,header:x-api-key,cookie:key".
+	ApiKeyOperationContextKey = "operation"
+	ApiKeyLocationsContextKey = "api_key_locations"
+
+	// Minimum percentage of healthy local backend hosts for the ESPv2 healthz to pass.
+	// Any non-zero value fails the healthz only when all hosts are unhealthy.
+	HealthzMinHealthyPercentage = 0.001
+
+	// Runtime key to override the percentage of requests mirrored to the shadow backend,
+	// e.g. with the Envoy admin endpoint "/runtime_modify?backend_shadow.percent=5".
+	BackendShadowRuntimeKey = "backend_shadow.percent"
+
+	// Log name of the entries sent to the gRPC access log service.
+	AccessLogName = "espv2"
+
+	// Runtime key to override the percentage of requests written to the access log.
+	AccessLogSampleRuntimeKey = "access_log.sample_percent"
+	// Runtime keys to override the response code range of requests written to the access log.
+	AccessLogMinStatusCodeRuntimeKey = "access_log.min_status_code"
+	AccessLogMaxStatusCodeRuntimeKey = "access_log.max_status_code"
 
 	// Strict Transport Security header key and value
 	HSTSHeaderKey   = "Strict-Transport-Security"
@@ -37,10 +37,24 @@ const (
 	HTTPConnectionManager = "envoy.filters.network.http_connection_manager"
 	// JwtAuthn filter.
 	JwtAuthn = "envoy.filters.http.jwt_authn"
+	// RBAC HTTP filter
+	RBAC = "envoy.filters.http.rbac"
+	// ExtAuthz HTTP filter
+	ExtAuthz = "envoy.filters.http.ext_authz"
 	// TLSTransportSocket is Envoy TLS Transport Socket name.
 	TLSTransportSocket = "envoy.transport_sockets.tls"
 	// AccessFileLogger filter name
 	AccessFileLogger = "envoy.access_loggers.file"
+	// OpenCensusTracer tracer name
+	OpenCensusTracer = "envoy.tracers.opencensus"
+	// ZipkinTracer tracer name
+	ZipkinTracer = "envoy.tracers.zipkin"
+	// StatsdSink stats sink name
+	StatsdSink = "envoy.stat_sinks.statsd"
+	// DogStatsdSink stats sink name
+	DogStatsdSink = "envoy.stat_sinks.dog_statsd"
+	// AccessHttpGrpcLogger filter name
+	AccessHttpGrpcLogger = "envoy.access_loggers.http_grpc"
 
 	// ESPv2 custom http filters.
 
@@ -67,8 +81,21 @@ const (
 	// The service control server cluster name.
 	ServiceControlClusterName = "service-control-cluster"
 
+	// The tracing collector cluster name.
+	TracingCollectorClusterName = "tracing-collector-cluster"
+
+	// The admin interface cluster name, used by the metrics listener.
+	AdminClusterName = "admin-cluster"
+
+	// The gRPC access log service cluster name.
+	AccessLogServiceClusterName = "access-log-service-cluster"
+
+	// The local API key server cluster name, served by the config manager.
+	ApiKeyServerClusterName = "api-key-server-cluster"
+
 	IngressListenerName  = "ingress_listener"
 	LoopbackListenerName = "loopback_listener"
+	MetricsListenerName  = "metrics_listener"
 )
 
 // Jwt provider cluster's name will be in form of "jwt-provider-cluster-${JWT_PROVIDER_ADDRESS}".
@@ -80,3 +107,8 @@ func JwtProviderClusterName(address string) string {
 func BackendClusterName(address string) string {
 	return fmt.Sprintf("backend-cluster-%s", address)
 }
+
+// Shadow backend cluster's name will be in form of "shadow-backend-cluster-${BACKEND_ADDRESS}"
+func ShadowBackendClusterName(address string) string {
+	return fmt.Sprintf("shadow-backend-cluster-%s", address)
+}